@@ -73,6 +73,10 @@ where they can be graphed on dashboards. The Datadog Serverless Agent implements
 	apiKeyEnvVar    = "DD_API_KEY"
 
 	logLevelEnvVar = "DD_LOG_LEVEL"
+
+	// timeouts of the calls to the AWS Extension environment, as durations, e.g. "2s"
+	connectTimeoutEnvVar = "DD_SERVERLESS_CONNECT_TIMEOUT"
+	requestTimeoutEnvVar = "DD_SERVERLESS_REQUEST_TIMEOUT"
 )
 
 const (
@@ -152,22 +156,17 @@ func runAgent(ctx context.Context, stopCh chan struct{}) (err error) {
 		}
 	}
 
+	serverless.SetHTTPTimeouts(
+		durationFromEnv(connectTimeoutEnvVar, serverless.DefaultConnectTimeout),
+		durationFromEnv(requestTimeoutEnvVar, serverless.DefaultRequestTimeout),
+	)
+
 	// immediately starts the communication server
 	daemon := serverless.StartDaemon(stopCh)
 
 	// serverless parts
 	// ----------------
 
-	// register
-	serverlessID, err := serverless.Register()
-	if err != nil {
-		// at this point, we were not even able to register, thus, we don't have
-		// any ID assigned, thus, we can't report an error to the init error route
-		// which needs an Id.
-		log.Errorf("Can't register as a serverless agent: %s", err)
-		return
-	}
-
 	// api key reading
 	// ---------------
 
@@ -188,25 +187,24 @@ func runAgent(ctx context.Context, stopCh chan struct{}) (err error) {
 		log.Warn("An API Key has been set in multiple places:", strings.Join(apikeySetIn, ", "))
 	}
 
-	// try to read apikey from KMS
+	// the api key is read from KMS, then from SSM, then from the environment
+	apiKeyProvider := serverless.ChainAPIKeyProviders(
+		serverless.NewAPIKeyProvider("KMS", readAPIKeyFromKMS),
+		serverless.NewAPIKeyProvider("SSM", readAPIKeyFromSSM),
+		serverless.EnvAPIKeyProvider(),
+	)
 
-	var apiKey string
-	if apiKey, err = readAPIKeyFromKMS(); err != nil {
-		log.Errorf("Error while trying to read an API Key from KMS: %s", err)
-	} else if apiKey != "" {
-		log.Info("Using deciphered KMS API Key.")
-		os.Setenv(apiKeyEnvVar, apiKey) // it will be catched up by config.Load()
+	// register and resolve the api key
+	serverlessID, apiKey, err := serverless.RegisterWithAPIKey(serverless.ExtensionName, apiKeyProvider)
+	if _, isAPIKeyErr := err.(*serverless.APIKeyError); err != nil && !isAPIKeyErr {
+		// at this point, we were not even able to register, thus, we don't have
+		// any ID assigned, thus, we can't report an error to the init error route
+		// which needs an Id.
+		log.Errorf("Can't register as a serverless agent: %s", err)
+		return
 	}
-
-	// try to read the apikey from SSM, only if not set from KMS
-
-	if apiKey == "" {
-		if apiKey, err = readAPIKeyFromSSM(); err != nil {
-			log.Errorf("Error while trying to read an API Key from SSM: %s", err)
-		} else if apiKey != "" {
-			log.Info("Using API key set in SSM.")
-			os.Setenv(apiKeyEnvVar, apiKey) // it will be catched up by config.Load()
-		}
+	if apiKey != "" {
+		os.Setenv(apiKeyEnvVar, apiKey) // it will be catched up by config.Load()
 	}
 
 	// read configuration from the environment vars
@@ -263,22 +261,63 @@ func runAgent(ctx context.Context, stopCh chan struct{}) (err error) {
 	// run the invocation loop in a routine
 	// we don't want to start this mainloop before because once we're waiting on
 	// the invocation route, we can't report init errors anymore.
+	dispatcher := serverless.NewDefaultDispatcher(stopCh, statsdServer, f)
 	go func() {
 		for {
-			if err := serverless.WaitForNextInvocation(stopCh, statsdServer, serverlessID); err != nil {
+			if err := serverless.WaitForNextInvocation(dispatcher, serverlessID, reportInvocationWait); err != nil {
 				log.Error(err)
 			}
+			reportEventCounts()
 		}
 	}()
 
 	// DogStatsD daemon ready.
 	daemon.SetStatsdServer(statsdServer)
+	daemon.SetForwarder(f)
 	daemon.ReadyWg.Done()
 
 	log.Debugf("serverless agent ready in %v", time.Since(startTime))
 	return
 }
 
+// durationFromEnv returns the duration set in the environment variable,
+// or the default value if it isn't set or isn't a valid positive duration.
+func durationFromEnv(envVar string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(envVar)
+	if len(value) == 0 {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Warnf("Invalid duration %q for %s, using the default %v", value, envVar, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+// reportInvocationWait reports how long the extension waited for the next invocation.
+func reportInvocationWait(waited time.Duration) {
+	sender, err := aggregator.GetDefaultSender()
+	if err != nil {
+		log.Debugf("Can't report the invocation wait duration: %s", err)
+		return
+	}
+	sender.Gauge("datadog.serverless_agent.next_invocation_wait", waited.Seconds(), "", nil)
+	sender.Commit()
+}
+
+// reportEventCounts reports the number of events handled by the extension since the start.
+func reportEventCounts() {
+	sender, err := aggregator.GetDefaultSender()
+	if err != nil {
+		log.Debugf("Can't report the events count: %s", err)
+		return
+	}
+	sender.MonotonicCount("datadog.serverless_agent.invocations", float64(serverless.InvocationCount()), "", nil)
+	sender.MonotonicCount("datadog.serverless_agent.shutdowns", float64(serverless.ShutdownCount()), "", nil)
+	sender.Commit()
+}
+
 // handleSignals handles OS signals, if a SIGTERM is received,
 // the serverless agent stops.
 func handleSignals(stopCh chan struct{}) {
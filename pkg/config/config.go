@@ -560,8 +560,26 @@ func InitConfig(config Config) {
 	config.BindEnvAndSetDefault("logs_config.use_port_443", false)
 	// increase the read buffer size of the UDP sockets:
 	config.BindEnvAndSetDefault("logs_config.frame_size", 9000)
-	// increase the number of files that can be tailed in parallel:
+	// increase the number of files that can be tailed in parallel, a file matched by several sources
+	// with different processing rules is tailed once per set of rules and counts once for each:
 	config.BindEnvAndSetDefault("logs_config.open_files_limit", 100)
+	// select the files tailed first when more files than open_files_limit match a wildcard path,
+	// either "by_name" (reverse lexicographic order) or "by_modification_time" (most recently modified first):
+	config.BindEnvAndSetDefault("logs_config.file_wildcard_selection_mode", "by_name")
+	// number of consecutive scans a file source can match no files before a warning is shown in the status, 0 disables it
+	config.BindEnvAndSetDefault("logs_config.file_scan_no_match_threshold", 6)
+	// watch the directories of the tailed files with inotify and read the files when they change instead of polling them,
+	// the files are still polled when their directory can't be watched
+	config.BindEnvAndSetDefault("logs_config.file_scan_use_inotify", false)
+	// number of file sources whose paths are searched concurrently by each scan, it speeds up the scans of the hosts
+	// with many sources or slow file systems, the sources are searched one after the other when it is 1 or less
+	config.BindEnvAndSetDefault("logs_config.file_scan_concurrency", 1)
+	// tag the logs of a file matched by several sources with the tags of all of them, the file is still tailed once,
+	// by the first source matching it, whose tags win over the tags of the other sources with the same key
+	config.BindEnvAndSetDefault("logs_config.file_merge_overlapping_source_tags", false)
+	// how long the stats of the files are cached during a scan, in milliseconds, to coalesce the stats of the same files
+	// by the scans of large wildcard paths on slow file systems, each scan starts with fresh stats, 0 disables the cache
+	config.BindEnvAndSetDefault("logs_config.file_stat_cache_ttl", 1000)
 	// add global processing rules that are applied on all logs
 	config.BindEnv("logs_config.processing_rules") //nolint:errcheck
 	// enforce the agent to use files to collect container logs on kubernetes environment
@@ -589,6 +607,24 @@ func InitConfig(config Config) {
 	config.BindEnvAndSetDefault("logs_config.dd_url_443", "agent-443-intake.logs.datadoghq.com")
 	config.BindEnvAndSetDefault("logs_config.stop_grace_period", 30)
 	config.BindEnvAndSetDefault("logs_config.close_timeout", 60)
+	// number of decoded messages the file tailers can buffer when the pipeline is full, 0 disables the buffer
+	config.BindEnvAndSetDefault("logs_config.file_tailer_buffer_size", 0)
+	// memory budget of the read buffers of all the file tailers, in bytes, the buffers shrink when many files are tailed
+	// and grow when few are, and the tailers wait for buffers to be released when it is exhausted, 0 disables the budget
+	// and makes every tailer use a fixed 4KB buffer
+	config.BindEnvAndSetDefault("logs_config.file_read_buffer_budget", 0)
+	// maximum size of the files of the sources with full_read_on_change, in bytes, the bigger files are not read
+	config.BindEnvAndSetDefault("logs_config.full_read_max_file_size", 1024*1024)
+	// maximum number of lines per second sent by all the file tailers, shared between the sources according to their
+	// rate_weight when it is reached, the tailers stop reading their files while they wait, 0 disables the limit
+	config.BindEnvAndSetDefault("logs_config.file_max_lines_per_second", 0)
+	// how often the file tailers commit their offsets to the registry, in seconds and/or in bytes read since the last commit,
+	// the offsets are committed for every log when both are 0
+	config.BindEnvAndSetDefault("logs_config.registry_commit_interval", 0)
+	config.BindEnvAndSetDefault("logs_config.registry_commit_bytes", 0)
+	// path of a registry file, e.g. captured from another agent, the files are tailed from its offsets and it is never
+	// written, the file tailers don't commit their offsets
+	config.BindEnvAndSetDefault("logs_config.registry_snapshot", "")
 	config.BindEnv("logs_config.additional_endpoints") //nolint:errcheck
 
 	// The cardinality of tags to send for checks and dogstatsd respectively.
@@ -765,6 +801,9 @@ func InitConfig(config Config) {
 	config.BindEnvAndSetDefault("runtime_security_config.enable_kernel_filters", true)
 	config.BindEnvAndSetDefault("runtime_security_config.flush_discarder_window", 3)
 	config.BindEnvAndSetDefault("runtime_security_config.syscall_monitor.enabled", false)
+	config.BindEnvAndSetDefault("runtime_security_config.syscall_monitor.required", false)
+	config.BindEnvAndSetDefault("runtime_security_config.syscall_monitor.per_process.enabled", false)
+	config.BindEnvAndSetDefault("runtime_security_config.syscall_monitor.per_process.top_n", 10)
 	config.BindEnvAndSetDefault("runtime_security_config.run_path", defaultRunPath)
 	config.BindEnvAndSetDefault("runtime_security_config.event_server.burst", 40)
 	config.BindEnvAndSetDefault("runtime_security_config.event_server.rate", 10)
@@ -772,6 +811,15 @@ func InitConfig(config Config) {
 	config.BindEnvAndSetDefault("runtime_security_config.load_controller.discarder_timeout", 10)
 	config.BindEnvAndSetDefault("runtime_security_config.load_controller.control_period", 2)
 	config.BindEnvAndSetDefault("runtime_security_config.pid_cache_size", 10000)
+	config.BindEnvAndSetDefault("runtime_security_config.events_stats.enabled", true)
+	config.BindEnvAndSetDefault("runtime_security_config.events_stats.polling_interval", 20)
+	// sample rates of the events stats by event type, e.g. {open: 10} only counts 1 in 10 open events
+	config.SetKnown("runtime_security_config.events_stats.sample_rates")
+	// upper bounds in bytes of the buckets of the event size histogram, e.g. [128, 1024, 4096]
+	config.SetKnown("runtime_security_config.events_stats.size_buckets")
+	// how the events stats are reported in the runtime security status: "cumulative" reports the totals, "delta"
+	// reports the differences since the previous read, without resetting the counters
+	config.BindEnvAndSetDefault("runtime_security_config.events_stats.counter_mode", "cumulative")
 
 	// command line options
 	config.SetKnown("cmd.check.fullsketches")
@@ -61,6 +61,9 @@ func init() {
 
 // Server represent a Dogstatsd server
 type Server struct {
+	// bufferedCount is the number of samples, events and service checks received
+	// since the last flush. Accessed atomically, kept first for 64-bit alignment.
+	bufferedCount uint64
 	// listeners are the instantiated socket listener (UDS or UDP or both)
 	listeners []listeners.StatsdListener
 	// aggregator is a pointer to the aggregator that the dogstatsd daemon
@@ -332,6 +335,7 @@ func (s *Server) forwarder(fcon net.Conn, packetsChannel chan listeners.Packets)
 // Set waitForSerializer to true to serialize and send the data synchronously.
 func (s *Server) Flush(waitForSerializer bool) {
 	log.Debug("Received a Flush trigger")
+	atomic.StoreUint64(&s.bufferedCount, 0)
 	// make all workers flush their aggregated data (in the batcher) to the aggregator.
 	for _, w := range s.workers {
 		w.flush()
@@ -341,6 +345,12 @@ func (s *Server) Flush(waitForSerializer bool) {
 	s.aggregator.Flush(time.Now().Add(time.Second*10), true)
 }
 
+// BufferedCount returns the number of samples, events and service checks received
+// since the last flush.
+func (s *Server) BufferedCount() uint64 {
+	return atomic.LoadUint64(&s.bufferedCount)
+}
+
 func nextMessage(packet *[]byte) (message []byte) {
 	if len(*packet) == 0 {
 		return nil
@@ -385,6 +395,7 @@ func (s *Server) parsePackets(batcher *batcher, parser *parser, packets []*liste
 					continue
 				}
 				batcher.appendServiceCheck(serviceCheck)
+				atomic.AddUint64(&s.bufferedCount, 1)
 			case eventType:
 				event, err := s.parseEventMessage(parser, message, originTagger.getTags)
 				if err != nil {
@@ -397,6 +408,7 @@ func (s *Server) parsePackets(batcher *batcher, parser *parser, packets []*liste
 					continue
 				}
 				batcher.appendEvent(event)
+				atomic.AddUint64(&s.bufferedCount, 1)
 			case metricSampleType:
 				var err error
 				samples = samples[0:0]
@@ -423,6 +435,7 @@ func (s *Server) parsePackets(batcher *batcher, parser *parser, packets []*liste
 						batcher.appendSample(*distSample)
 					}
 				}
+				atomic.AddUint64(&s.bufferedCount, uint64(len(samples)))
 			}
 		}
 		s.sharedPacketPool.Put(packet)
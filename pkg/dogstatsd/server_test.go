@@ -407,6 +407,41 @@ func TestHistToDist(t *testing.T) {
 	}
 }
 
+func TestBufferedCount(t *testing.T) {
+	port, err := getAvailableUDPPort()
+	require.NoError(t, err)
+	defaultPort := config.Datadog.GetInt("dogstatsd_port")
+	config.Datadog.SetDefault("dogstatsd_port", port)
+	defer config.Datadog.SetDefault("dogstatsd_port", defaultPort)
+
+	agg := mockAggregator()
+	metricOut, eventOut, _ := agg.GetBufferedChannels()
+	s, err := NewServer(agg)
+	require.NoError(t, err, "cannot start DSD")
+	defer s.Stop()
+
+	assert.Equal(t, uint64(0), s.BufferedCount())
+
+	url := fmt.Sprintf("127.0.0.1:%d", config.Datadog.GetInt("dogstatsd_port"))
+	conn, err := net.Dial("udp", url)
+	require.NoError(t, err, "cannot connect to DSD socket")
+	defer conn.Close()
+
+	conn.Write([]byte("daemon:666|g|#sometag1:somevalue1\ndaemon:667|g|#sometag1:somevalue1"))
+	select {
+	case <-metricOut:
+	case <-time.After(2 * time.Second):
+		assert.FailNow(t, "Timeout on receive channel")
+	}
+	conn.Write([]byte("_e{10,10}:test title|test\\ntext|t:warning"))
+	select {
+	case <-eventOut:
+	case <-time.After(2 * time.Second):
+		assert.FailNow(t, "Timeout on receive channel")
+	}
+	assert.Equal(t, uint64(3), s.BufferedCount())
+}
+
 func TestExtraTags(t *testing.T) {
 	port, err := getAvailableUDPPort()
 	require.NoError(t, err)
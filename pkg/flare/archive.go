@@ -204,6 +204,13 @@ func createArchive(confSearchPaths SearchPaths, local bool, zipFilePath string,
 		if err != nil {
 			log.Errorf("Could not zip system probe exp var stats: %s", err)
 		}
+
+		if config.Datadog.GetBool("runtime_security_config.enabled") {
+			err = zipRuntimeSecurityDiagnostics(tempDir, hostname)
+			if err != nil {
+				log.Errorf("Could not zip runtime security diagnostics: %s", err)
+			}
+		}
 	}
 
 	err = zipDiagnose(tempDir, hostname)
@@ -488,6 +495,23 @@ func zipSystemProbeStats(tempDir, hostname string) error {
 	return err
 }
 
+func zipRuntimeSecurityDiagnostics(tempDir, hostname string) error {
+	diagnostics, err := status.GetRuntimeSecurityDiagnostics(config.Datadog.GetString("system_probe_config.sysprobe_socket"))
+	if err != nil {
+		return err
+	}
+
+	f := filepath.Join(tempDir, hostname, "runtime-security-diagnostics.log")
+	w, err := newRedactingWriter(f, os.ModePerm, true)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	_, err = w.Write(diagnostics)
+	return err
+}
+
 func zipConfigFiles(tempDir, hostname string, confSearchPaths SearchPaths, permsInfos permissionsInfos) error {
 	c, err := yaml.Marshal(config.Datadog.AllSettings())
 	if err != nil {
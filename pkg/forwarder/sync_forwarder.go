@@ -3,18 +3,30 @@ package forwarder
 import (
 	"context"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/hashicorp/go-multierror"
+
 	utilhttp "github.com/DataDog/datadog-agent/pkg/util/http"
 	"github.com/DataDog/datadog-agent/pkg/util/log"
 )
 
+// maxSyncRetryTransactions is the maximum number of transactions the SyncForwarder keeps
+// to send them again, the oldest ones are dropped beyond it.
+const maxSyncRetryTransactions = 100
+
 // SyncForwarder is a very simple Forwarder synchronously sending
 // the data to the intake.
-// It doesn't ship any retry mechanism for now.
+// The transactions it could not send because of a retryable error are kept and sent
+// again before the next ones, or when RetryTransactions is called.
 type SyncForwarder struct {
 	defaultForwarder *DefaultForwarder
 	client           *http.Client
+
+	// m protects retryTransactions and serializes the sends
+	m                 sync.Mutex
+	retryTransactions []*HTTPTransaction
 }
 
 // NewSyncForwarder returns a new synchronous forwarder.
@@ -37,14 +49,42 @@ func (f *SyncForwarder) Start() error {
 func (f *SyncForwarder) Stop() {
 }
 
+// PendingTransactions returns the number of transactions which could not be sent and are
+// kept to be sent again.
+func (f *SyncForwarder) PendingTransactions() int {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return len(f.retryTransactions)
+}
+
+// RetryTransactions sends again the transactions which could not be sent.
+// Returns the errors of the transactions failing again.
+func (f *SyncForwarder) RetryTransactions() error {
+	return f.sendHTTPTransactions(nil)
+}
+
 func (f *SyncForwarder) sendHTTPTransactions(transactions []*HTTPTransaction) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	// the transactions which could not be sent previously are sent first
+	transactions = append(f.retryTransactions, transactions...)
+	f.retryTransactions = nil
+
+	var errs error
 	for _, t := range transactions {
 		if err := t.Process(context.Background(), f.client); err != nil {
 			log.Errorf("SyncForwarder.sendHTTPTransactions: %s", err)
+			f.retryTransactions = append(f.retryTransactions, t)
+			errs = multierror.Append(errs, err)
 		}
 	}
-	log.Debugf("SyncForwarder has flushed %d transactions", len(transactions))
-	return nil
+	if dropped := len(f.retryTransactions) - maxSyncRetryTransactions; dropped > 0 {
+		log.Errorf("SyncForwarder has dropped %d transactions which could not be sent", dropped)
+		f.retryTransactions = append([]*HTTPTransaction(nil), f.retryTransactions[dropped:]...)
+	}
+	log.Debugf("SyncForwarder has flushed %d transactions, %d are kept to be sent again", len(transactions)-len(f.retryTransactions), len(f.retryTransactions))
+	return errs
 }
 
 // SubmitV1Series will send timeserie to v1 endpoint (this will be remove once
@@ -0,0 +1,61 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package forwarder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncForwarderRetriesFailedTransactions(t *testing.T) {
+	var requests, failures int64 = 0, 1
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if atomic.AddInt64(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	f := NewSyncForwarder(map[string][]string{ts.URL: {"api_key"}}, 5*time.Second)
+	data := []byte("data payload")
+
+	assert.NotNil(t, f.SubmitSeries(Payloads{&data}, http.Header{}))
+	assert.Equal(t, 1, f.PendingTransactions())
+
+	// the failed transaction is sent again before the new one
+	assert.Nil(t, f.SubmitSeries(Payloads{&data}, http.Header{}))
+	assert.Equal(t, 0, f.PendingTransactions())
+	assert.Equal(t, int64(3), atomic.LoadInt64(&requests))
+
+	assert.Nil(t, f.RetryTransactions())
+	assert.Equal(t, int64(3), atomic.LoadInt64(&requests))
+}
+
+func TestSyncForwarderDropsOldestFailedTransactions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	f := NewSyncForwarder(map[string][]string{ts.URL: {"api_key"}}, 5*time.Second)
+	payloads := make(Payloads, maxSyncRetryTransactions+1)
+	for i := range payloads {
+		data := []byte("data payload")
+		payloads[i] = &data
+	}
+
+	assert.NotNil(t, f.SubmitSeries(payloads, http.Header{}))
+	assert.Equal(t, maxSyncRetryTransactions, f.PendingTransactions())
+	assert.Equal(t, payloads[1], f.retryTransactions[0].Payload)
+}
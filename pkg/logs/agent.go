@@ -55,9 +55,16 @@ func NewAgent(sources *config.LogSources, services *service.Services, processing
 	// setup the pipeline provider that provides pairs of processor and sender
 	pipelineProvider := pipeline.NewProvider(config.NumberOfPipelines, auditor, processingRules, endpoints, destinationsCtx)
 
+	fileScanner := file.NewScanner(sources, coreConfig.Datadog.GetInt("logs_config.open_files_limit"), pipelineProvider, auditor, file.DefaultSleepDuration)
+	if snapshot := coreConfig.Datadog.GetString("logs_config.registry_snapshot"); snapshot != "" {
+		if err := fileScanner.ReadOnlyRegistry(snapshot); err != nil {
+			log.Errorf("%v, the files are tailed from the offsets of the registry of the agent", err)
+		}
+	}
+
 	// setup the inputs
 	inputs := []restart.Restartable{
-		file.NewScanner(sources, coreConfig.Datadog.GetInt("logs_config.open_files_limit"), pipelineProvider, auditor, file.DefaultSleepDuration),
+		fileScanner,
 		container.NewLauncher(
 			coreConfig.Datadog.GetBool("logs_config.container_collect_all"),
 			coreConfig.Datadog.GetBool("logs_config.k8s_container_use_file"),
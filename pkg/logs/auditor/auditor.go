@@ -35,6 +35,8 @@ const registryAPIVersion = 2
 type Registry interface {
 	GetOffset(identifier string) string
 	GetTailingMode(identifier string) string
+	GetCurrentConfigID(identifier string) string
+	GetLastUpdatedIdentifier(match func(identifier string) bool) string
 	SetConfigID(identifier, configID string)
 }
 
@@ -163,6 +165,30 @@ func (a *Auditor) GetTailingMode(identifier string) string {
 	return entry.TailingMode
 }
 
+// GetCurrentConfigID returns the source configuration ID allowed to update the offset of a given identifier,
+// returns an empty string if it does not exist or if no configuration ID has been set since the agent started.
+func (a *Auditor) GetCurrentConfigID(identifier string) string {
+	r := a.readOnlyRegistryCopy()
+	entry, exists := r[identifier]
+	if !exists {
+		return ""
+	}
+	return entry.CurrentConfigID
+}
+
+// GetLastUpdatedIdentifier returns the identifier of the entry updated last among the ones match
+// returns true for, returns an empty string if none matches.
+func (a *Auditor) GetLastUpdatedIdentifier(match func(identifier string) bool) string {
+	var identifier string
+	var lastUpdated time.Time
+	for id, entry := range a.readOnlyRegistryCopy() {
+		if match(id) && (identifier == "" || entry.LastUpdated.After(lastUpdated)) {
+			identifier, lastUpdated = id, entry.LastUpdated
+		}
+	}
+	return identifier
+}
+
 // run keeps up to date the registry depending on different events
 func (a *Auditor) run() {
 	cleanUpTicker := time.NewTicker(defaultCleanupPeriod)
@@ -174,6 +200,9 @@ func (a *Auditor) run() {
 		a.done <- struct{}{}
 	}()
 
+	// commitTime is the time recorded as the last commit of the sources, it is refreshed on each flush
+	// rather than for each message as the status only shows it to the second
+	commitTime := time.Now()
 	var fileError sync.Once
 	for {
 		select {
@@ -188,11 +217,13 @@ func (a *Auditor) run() {
 				return
 			}
 			// update the registry with new entry
-			a.updateRegistry(msg.Origin.Identifier, msg.Origin.Offset, msg.Origin.LogSource.Config.TailingMode, msg.Origin.LogSource.Config.Identifier)
+			if a.updateRegistry(msg.Origin.Identifier, msg.Origin.Offset, msg.Origin.LogSource.Config.TailingMode, msg.Origin.LogSource.Config.Identifier) {
+				msg.Origin.LogSource.SetLastCommit(commitTime)
+			}
 		case <-cleanUpTicker.C:
 			// remove expired offsets from registry
 			a.cleanupRegistry()
-		case <-flushTicker.C:
+		case commitTime = <-flushTicker.C:
 			// saves current registry into disk
 			err := a.flushRegistry()
 			if err != nil {
@@ -219,7 +250,7 @@ func (a *Auditor) recoverRegistry() map[string]*RegistryEntry {
 		}
 		return make(map[string]*RegistryEntry)
 	}
-	r, err := a.unmarshalRegistry(mr)
+	r, err := unmarshalRegistry(mr)
 	if err != nil {
 		log.Error(err)
 		return make(map[string]*RegistryEntry)
@@ -239,25 +270,28 @@ func (a *Auditor) cleanupRegistry() {
 	}
 }
 
-// updateRegistry updates the registry entry matching identifier with new the offset and timestamp
-func (a *Auditor) updateRegistry(identifier string, offset string, tailingMode string, configID string) {
+// updateRegistry updates the registry entry matching identifier with new the offset and timestamp,
+// returns true if the entry has been updated
+func (a *Auditor) updateRegistry(identifier string, offset string, tailingMode string, configID string) bool {
 	a.registryMutex.Lock()
 	defer a.registryMutex.Unlock()
 	if identifier == "" {
 		// An empty Identifier means that we don't want to track down the offset
 		// This is useful for origins that don't have offsets (networks), or when we
 		// specially want to avoid storing the offset
-		return
+		return false
 	}
 	entry, exists := a.registry[identifier]
-	if !(exists && entry.CurrentConfigID != configID) {
-		a.registry[identifier] = &RegistryEntry{
-			LastUpdated:     time.Now().UTC(),
-			Offset:          offset,
-			TailingMode:     tailingMode,
-			CurrentConfigID: configID,
-		}
+	if exists && entry.CurrentConfigID != configID {
+		return false
+	}
+	a.registry[identifier] = &RegistryEntry{
+		LastUpdated:     time.Now().UTC(),
+		Offset:          offset,
+		TailingMode:     tailingMode,
+		CurrentConfigID: configID,
 	}
+	return true
 }
 
 // updateCurrentConfigID updates the registry entry matching identifier with new the offset and timestamp
@@ -303,7 +337,7 @@ func (a *Auditor) marshalRegistry(registry map[string]RegistryEntry) ([]byte, er
 }
 
 // unmarshalRegistry unmarshals a registry
-func (a *Auditor) unmarshalRegistry(b []byte) (map[string]*RegistryEntry, error) {
+func unmarshalRegistry(b []byte) (map[string]*RegistryEntry, error) {
 	var r map[string]interface{}
 	err := json.Unmarshal(b, &r)
 	if err != nil {
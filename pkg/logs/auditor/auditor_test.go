@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -90,6 +91,8 @@ func (suite *AuditorTestSuite) TestAuditorUpdatesRegistryWithConfigID() {
 	suite.Equal(1, len(suite.a.registry))
 	suite.Equal("43", suite.a.registry[suite.source.Config.Path].Offset)
 	suite.Equal("beginning", suite.a.registry[suite.source.Config.Path].TailingMode)
+	suite.Equal("123456789", suite.a.GetCurrentConfigID(suite.source.Config.Path))
+	suite.Equal("", suite.a.GetCurrentConfigID("unknown"))
 }
 
 func (suite *AuditorTestSuite) TestAuditorFlushesAndRecoversRegistry() {
@@ -143,6 +146,26 @@ func (suite *AuditorTestSuite) TestAuditorCleansupRegistry() {
 	suite.Equal("43", suite.a.registry[otherpath].Offset)
 }
 
+func (suite *AuditorTestSuite) TestAuditorGetLastUpdatedIdentifier() {
+	suite.a.registry = make(map[string]*RegistryEntry)
+	suite.a.registry["file:/var/log/app.log"] = &RegistryEntry{
+		LastUpdated: time.Date(2006, time.January, 12, 1, 1, 1, 1, time.UTC),
+		Offset:      "42",
+	}
+	suite.a.registry["file:/var/log/app.log#1234"] = &RegistryEntry{
+		LastUpdated: time.Date(2006, time.January, 13, 1, 1, 1, 1, time.UTC),
+		Offset:      "43",
+	}
+	suite.a.registry["file:/var/log/other.log"] = &RegistryEntry{
+		LastUpdated: time.Now().UTC(),
+		Offset:      "44",
+	}
+
+	matchApp := func(identifier string) bool { return strings.HasPrefix(identifier, "file:/var/log/app.log") }
+	suite.Equal("file:/var/log/app.log#1234", suite.a.GetLastUpdatedIdentifier(matchApp))
+	suite.Equal("", suite.a.GetLastUpdatedIdentifier(func(string) bool { return false }))
+}
+
 func TestScannerTestSuite(t *testing.T) {
 	suite.Run(t, new(AuditorTestSuite))
 }
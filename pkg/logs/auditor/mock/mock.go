@@ -44,6 +44,22 @@ func (r *Registry) SetConfigID(identifier, configID string) {
 	r.identifier = identifier
 }
 
+// GetCurrentConfigID returns the config identifier when the identifier is the one it was set for.
+func (r *Registry) GetCurrentConfigID(identifier string) string {
+	if identifier != r.identifier {
+		return ""
+	}
+	return r.configID
+}
+
+// GetLastUpdatedIdentifier returns the identifier the config identifier was set for when it matches.
+func (r *Registry) GetLastUpdatedIdentifier(match func(identifier string) bool) string {
+	if r.identifier == "" || !match(r.identifier) {
+		return ""
+	}
+	return r.identifier
+}
+
 // GetConfigID get the config identifier
 func (r *Registry) GetConfigID() string {
 	return r.configID
@@ -0,0 +1,74 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package auditor
+
+import (
+	"io/ioutil"
+	"time"
+)
+
+// SnapshotRegistry is a read-only registry loaded from a registry file, e.g. a copy of the registry of an agent
+// captured to replay its logs from the same offsets. Its entries never change: they don't expire and the
+// configuration IDs set are ignored, the file is never written.
+type SnapshotRegistry struct {
+	registry map[string]*RegistryEntry
+}
+
+// NewSnapshotRegistry returns the registry recorded in the registry file at path
+func NewSnapshotRegistry(path string) (*SnapshotRegistry, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := unmarshalRegistry(b)
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotRegistry{
+		registry: r,
+	}, nil
+}
+
+// GetOffset returns the offset recorded for a given identifier,
+// returns an empty string if it does not exist.
+func (s *SnapshotRegistry) GetOffset(identifier string) string {
+	entry, exists := s.registry[identifier]
+	if !exists {
+		return ""
+	}
+	return entry.Offset
+}
+
+// GetTailingMode returns the tailing mode recorded for a given identifier,
+// returns an empty string if it does not exist.
+func (s *SnapshotRegistry) GetTailingMode(identifier string) string {
+	entry, exists := s.registry[identifier]
+	if !exists {
+		return ""
+	}
+	return entry.TailingMode
+}
+
+// GetCurrentConfigID always returns an empty string, the configuration IDs are only known at runtime.
+func (s *SnapshotRegistry) GetCurrentConfigID(identifier string) string {
+	return ""
+}
+
+// GetLastUpdatedIdentifier returns the identifier of the entry updated last among the ones match
+// returns true for, returns an empty string if none matches.
+func (s *SnapshotRegistry) GetLastUpdatedIdentifier(match func(identifier string) bool) string {
+	var identifier string
+	var lastUpdated time.Time
+	for id, entry := range s.registry {
+		if match(id) && (identifier == "" || entry.LastUpdated.After(lastUpdated)) {
+			identifier, lastUpdated = id, entry.LastUpdated
+		}
+	}
+	return identifier
+}
+
+// SetConfigID does nothing, the snapshot is read-only.
+func (s *SnapshotRegistry) SetConfigID(identifier, configID string) {}
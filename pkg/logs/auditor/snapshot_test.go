@@ -0,0 +1,65 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package auditor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRegistry(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "tests")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	// the entries of the snapshot are kept however old they are
+	input := `{
+	    "Registry": {
+	        "file:/var/log/app.log": {
+	            "Offset": "42",
+	            "TailingMode": "end",
+	            "LastUpdated": "2006-01-12T01:01:01.000000001Z"
+	        }
+	    },
+	    "Version": 2
+	}`
+	path := filepath.Join(testDir, "registry.json")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(input), 0644))
+
+	r, err := NewSnapshotRegistry(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "42", r.GetOffset("file:/var/log/app.log"))
+	assert.Equal(t, "end", r.GetTailingMode("file:/var/log/app.log"))
+	assert.Equal(t, "", r.GetOffset("file:/var/log/other.log"))
+	assert.Equal(t, "file:/var/log/app.log", r.GetLastUpdatedIdentifier(func(id string) bool { return strings.HasPrefix(id, "file:") }))
+	assert.Equal(t, "", r.GetLastUpdatedIdentifier(func(id string) bool { return id == "file:/var/log/other.log" }))
+
+	// the snapshot is never changed
+	r.SetConfigID("file:/var/log/app.log", "123456789")
+	assert.Equal(t, "", r.GetCurrentConfigID("file:/var/log/app.log"))
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, input, string(content))
+}
+
+func TestSnapshotRegistryErrors(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "tests")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	_, err = NewSnapshotRegistry(filepath.Join(testDir, "missing.json"))
+	assert.NotNil(t, err)
+
+	path := filepath.Join(testDir, "registry.json")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"Registry": {}}`), 0644))
+	_, err = NewSnapshotRegistry(path)
+	assert.NotNil(t, err)
+}
@@ -7,7 +7,10 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 )
 
 // Logs source types
@@ -24,6 +27,13 @@ const (
 	UTF16BE string = "utf-16-be"
 	// UTF16LE for UTF-16 Little Endian encoding
 	UTF16LE string = "utf-16-le"
+
+	// ChecksumRotationDetection detects the file rotations from the checksum of the first bytes of the files
+	ChecksumRotationDetection = "checksum"
+
+	// JournalExportFormat is the format of the files holding journal entries in the journal export format,
+	// see https://www.freedesktop.org/wiki/Software/systemd/export/
+	JournalExportFormat = "journal-export"
 )
 
 // LogsConfig represents a log source config, which can be for instance
@@ -37,6 +47,76 @@ type LogsConfig struct {
 	Encoding     string   `mapstructure:"encoding" json:"encoding"`             // File
 	ExcludePaths []string `mapstructure:"exclude_paths" json:"exclude_paths"`   // File
 	TailingMode  string   `mapstructure:"start_position" json:"start_position"` // File
+	// Heartbeat is the number of seconds without new data after which a heartbeat message is sent, 0 disables it
+	Heartbeat int `mapstructure:"heartbeat" json:"heartbeat"` // File
+	// CollapseRepeatedLines is the number of seconds during which the consecutive identical lines of a file are
+	// collapsed into one message tagged with their repeat count, 0 disables it
+	CollapseRepeatedLines int `mapstructure:"collapse_repeated_lines" json:"collapse_repeated_lines"` // File
+	// MaxBacklogAge is the number of seconds after which a line read from a file is dropped instead of being sent
+	// when the pipeline is blocked, 0 disables it and the lines are sent however late
+	MaxBacklogAge int `mapstructure:"max_backlog_age" json:"max_backlog_age"` // File
+	// PollInterval is the number of milliseconds between two reads of a file without new data,
+	// it overrides the default of the file scanner when set
+	PollInterval int `mapstructure:"poll_interval" json:"poll_interval"` // File
+	// CheckpointFile is the path of a JSON file holding the offsets of the tailed files, indexed by path,
+	// it is read when a tailer starts and kept up to date by the agent
+	CheckpointFile string `mapstructure:"checkpoint_file" json:"checkpoint_file"` // File
+	// Stream makes the path be read as an append-only stream, like a pipe or the standard output
+	// of a process exposed as /proc/<pid>/fd/1: it is never seeked, no offset is recorded
+	// and it is reopened when its writer closes it
+	Stream bool `mapstructure:"stream" json:"stream"` // File
+	// LiteralPath makes the path be used as an exact file name, its glob metacharacters
+	// like '*' or '[' are not expanded
+	LiteralPath bool `mapstructure:"literal_path" json:"literal_path"` // File
+	// TailDirectory makes the path be a directory of which all the regular files are tailed,
+	// including the ones created later on
+	TailDirectory bool `mapstructure:"tail_directory" json:"tail_directory"` // File
+	// RotationDetection defines how the file rotations are detected, by default a file is rotated when its inode
+	// changes or its size becomes smaller than the offset read. With "checksum", a file is rotated when the checksum
+	// of its first bytes changes, which is more reliable on the filesystems where inodes are not, like NFS or overlay,
+	// at the cost of reading the first kilobyte of each tailed file at every scan
+	RotationDetection string `mapstructure:"rotation_detection" json:"rotation_detection"` // File
+	// Format is the format of the records of a file, by default a record is a line. With "journal-export", a record
+	// is a journal entry in the journal export format and is sent as one message holding its fields
+	Format string `mapstructure:"format" json:"format"` // File
+	// AddFileMetadata makes the messages of a file be tagged with the inode and the device of the file,
+	// which identify the file the messages come from, including across rotations
+	AddFileMetadata bool `mapstructure:"add_file_metadata" json:"add_file_metadata"` // File
+	// AddOffset makes each message of a file be tagged with the offset of its first byte in the file,
+	// the offsets of a compressed rotated file are the ones of its uncompressed content
+	AddOffset bool `mapstructure:"add_offset" json:"add_offset"` // File
+	// TimestampPattern is a regular expression whose first capture group holds the timestamp of a line, the timestamp
+	// is parsed with the Go time layout TimestampLayout and used as the time of the message. The lines without
+	// a timestamp are sent with the ingestion time. TimestampTimezone is the IANA name of the timezone of the
+	// timestamps whose layout has no timezone, UTC by default
+	TimestampPattern  string `mapstructure:"timestamp_pattern" json:"timestamp_pattern"`   // File
+	TimestampLayout   string `mapstructure:"timestamp_layout" json:"timestamp_layout"`     // File
+	TimestampTimezone string `mapstructure:"timestamp_timezone" json:"timestamp_timezone"` // File
+	// FullReadOnChange makes the whole file be read again each time its modification time or its size changes,
+	// only the lines that were not in its previous content are sent. It is meant for the small files that are
+	// rewritten in place instead of being appended to, the files bigger than logs_config.full_read_max_file_size
+	// are not read
+	FullReadOnChange bool `mapstructure:"full_read_on_change" json:"full_read_on_change"` // File
+	// AllowBinary makes the files that look binary be tailed, they are skipped by default so that a wildcard
+	// path matching e.g. a core dump doesn't send its content
+	AllowBinary bool `mapstructure:"allow_binary" json:"allow_binary"` // File
+	// RateWeight is the share of the source of logs_config.file_max_lines_per_second when the limit is reached,
+	// relative to the weights of the other sources, 1 by default
+	RateWeight float64 `mapstructure:"rate_weight" json:"rate_weight"` // File
+	// OnlyNewFiles makes the files last modified before the agent started be skipped, e.g. the old rotated files
+	// matching a wildcard path, so that their content is not sent again. A skipped file is tailed once it is
+	// written, from the end of the content it had when it was skipped
+	OnlyNewFiles bool `mapstructure:"only_new_files" json:"only_new_files"` // File
+	// IdleCloseTimeout is the number of seconds without new data after which the file is closed to free its file
+	// descriptor, its tailer keeps its offset and reopens it once it grows. 0 keeps the file open. It has no effect
+	// on Windows where the files are not kept open between reads
+	IdleCloseTimeout int `mapstructure:"idle_close_timeout" json:"idle_close_timeout"` // File
+	// HostPathPrefix and ContainerPathPrefix translate the paths of the files when the agent runs in a container and
+	// reads the files of the host through a bind mount, e.g. /var/log mounted on /host/var/log: the files are read
+	// under ContainerPathPrefix while their offsets are recorded in the registry under HostPathPrefix, so that they
+	// are kept when the mount point changes. The path of the source can be a host path or a container path
+	HostPathPrefix      string `mapstructure:"host_path_prefix" json:"host_path_prefix"`           // File
+	ContainerPathPrefix string `mapstructure:"container_path_prefix" json:"container_path_prefix"` // File
 
 	IncludeUnits  []string `mapstructure:"include_units" json:"include_units"`   // Journald
 	ExcludeUnits  []string `mapstructure:"exclude_units" json:"exclude_units"`   // Journald
@@ -116,6 +196,50 @@ func (c *LogsConfig) Validate() error {
 		if err != nil {
 			return err
 		}
+		if c.Heartbeat < 0 {
+			return fmt.Errorf("invalid heartbeat '%v' for %v", c.Heartbeat, c.Path)
+		}
+		if c.CollapseRepeatedLines < 0 {
+			return fmt.Errorf("invalid collapse_repeated_lines '%v' for %v", c.CollapseRepeatedLines, c.Path)
+		}
+		if c.MaxBacklogAge < 0 {
+			return fmt.Errorf("invalid max_backlog_age '%v' for %v", c.MaxBacklogAge, c.Path)
+		}
+		if c.PollInterval < 0 {
+			return fmt.Errorf("invalid poll interval '%v' for %v", c.PollInterval, c.Path)
+		}
+		if c.RateWeight < 0 {
+			return fmt.Errorf("invalid rate_weight '%v' for %v", c.RateWeight, c.Path)
+		}
+		if c.IdleCloseTimeout < 0 {
+			return fmt.Errorf("invalid idle_close_timeout '%v' for %v", c.IdleCloseTimeout, c.Path)
+		}
+		if c.TailDirectory && !c.LiteralPath && ContainsWildcard(c.Path) {
+			return fmt.Errorf("tailing a directory does not support wildcard paths: %v", c.Path)
+		}
+		if c.RotationDetection != "" && c.RotationDetection != ChecksumRotationDetection {
+			return fmt.Errorf("invalid rotation detection '%v' for %v", c.RotationDetection, c.Path)
+		}
+		if c.Format != "" && c.Format != JournalExportFormat {
+			return fmt.Errorf("invalid format '%v' for %v", c.Format, c.Path)
+		}
+		if err := c.validateTimestamp(); err != nil {
+			return err
+		}
+		if c.FullReadOnChange && c.Stream {
+			return fmt.Errorf("stream mode can't be used with full_read_on_change: %v", c.Path)
+		}
+		if c.Stream && c.IsWildcardPath() {
+			return fmt.Errorf("stream mode does not support wildcard paths: %v", c.Path)
+		}
+		if (c.HostPathPrefix == "") != (c.ContainerPathPrefix == "") {
+			return fmt.Errorf("host_path_prefix and container_path_prefix must be set together for %v", c.Path)
+		}
+		for _, excludePattern := range c.ExcludePaths {
+			if _, err := filepath.Match(excludePattern, ""); err != nil {
+				return fmt.Errorf("malformed exclusion pattern '%v' for %v: %v", excludePattern, c.Path, err)
+			}
+		}
 	case c.Type == TCPType && c.Port == 0:
 		return fmt.Errorf("tcp source must have a port")
 	case c.Type == UDPType && c.Port == 0:
@@ -128,17 +252,80 @@ func (c *LogsConfig) Validate() error {
 	return CompileProcessingRules(c.ProcessingRules)
 }
 
+// validateTimestamp returns an error if the timestamp pattern can't be used to parse the timestamps of the lines
+func (c *LogsConfig) validateTimestamp() error {
+	if c.TimestampPattern == "" {
+		if c.TimestampLayout != "" || c.TimestampTimezone != "" {
+			return fmt.Errorf("timestamp_layout and timestamp_timezone require a timestamp_pattern for %v", c.Path)
+		}
+		return nil
+	}
+	re, err := regexp.Compile(c.TimestampPattern)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp pattern '%v' for %v: %v", c.TimestampPattern, c.Path, err)
+	}
+	if re.NumSubexp() == 0 {
+		return fmt.Errorf("timestamp pattern '%v' for %v must have a capture group", c.TimestampPattern, c.Path)
+	}
+	if c.TimestampLayout == "" {
+		return fmt.Errorf("timestamp pattern '%v' for %v requires a timestamp_layout", c.TimestampPattern, c.Path)
+	}
+	if _, err := time.LoadLocation(c.TimestampTimezone); err != nil {
+		return fmt.Errorf("invalid timestamp timezone '%v' for %v: %v", c.TimestampTimezone, c.Path, err)
+	}
+	return nil
+}
+
 func (c *LogsConfig) validateTailingMode() error {
 	mode, found := TailingModeFromString(c.TailingMode)
 	if !found && c.TailingMode != "" {
 		return fmt.Errorf("invalid tailing mode '%v' for %v", c.TailingMode, c.Path)
 	}
-	if ContainsWildcard(c.Path) && (mode == Beginning || mode == ForceBeginning) {
+	if c.IsWildcardPath() && (mode == Beginning || mode == ForceBeginning) {
 		return fmt.Errorf("tailing from the beginning is not supported for wildcard path %v", c.Path)
 	}
 	return nil
 }
 
+// IsWildcardPath returns true if the path of the config must be expanded to find the files to tail,
+// either because it contains wildcards or because it is a directory to tail
+func (c *LogsConfig) IsWildcardPath() bool {
+	return c.TailDirectory || (!c.LiteralPath && ContainsWildcard(c.Path))
+}
+
+// HostPath translates the path of a file read by the agent into the path of the file on the host, the paths
+// outside of ContainerPathPrefix are returned as is
+func (c *LogsConfig) HostPath(path string) string {
+	return translatePathPrefix(path, c.ContainerPathPrefix, c.HostPathPrefix)
+}
+
+// ContainerPath translates the path of a file on the host into the path under which the agent reads it, the paths
+// outside of HostPathPrefix are returned as is
+func (c *LogsConfig) ContainerPath(path string) string {
+	return translatePathPrefix(path, c.HostPathPrefix, c.ContainerPathPrefix)
+}
+
+// translatePathPrefix replaces the from directory prefix of the path with to, the path is returned as is when it
+// isn't in the from directory or when a prefix is empty
+func translatePathPrefix(path, from, to string) string {
+	if from == "" || to == "" {
+		return path
+	}
+	from, to = filepath.Clean(from), filepath.Clean(to)
+	dir := from
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	switch {
+	case path == from:
+		return to
+	case strings.HasPrefix(path, dir):
+		return filepath.Join(to, path[len(dir):])
+	default:
+		return path
+	}
+}
+
 // ContainsWildcard returns true if the path contains any wildcard character
 func ContainsWildcard(path string) bool {
 	return strings.ContainsAny(path, "*?[")
@@ -8,6 +8,7 @@
 package config
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,6 +17,20 @@ import (
 func TestValidateShouldSucceedWithValidConfigs(t *testing.T) {
 	validConfigs := []*LogsConfig{
 		{Type: FileType, Path: "/var/log/foo.log"},
+		{Type: FileType, Path: "/var/log/foo.log", PollInterval: 10},
+		{Type: FileType, Path: "/proc/1/fd/1", Stream: true},
+		{Type: FileType, Path: "/var/log/app[1].log", LiteralPath: true, TailingMode: "beginning"},
+		{Type: FileType, Path: "/var/log/app", TailDirectory: true},
+		{Type: FileType, Path: "/var/log/app[1]", TailDirectory: true, LiteralPath: true},
+		{Type: FileType, Path: "/mnt/nfs/app.log", RotationDetection: ChecksumRotationDetection},
+		{Type: FileType, Path: "/var/log/journal.export", Format: JournalExportFormat},
+		{Type: FileType, Path: "/var/run/app/status", FullReadOnChange: true},
+		{Type: FileType, Path: "/var/log/foo.log", RateWeight: 2.5},
+		{Type: FileType, Path: "/var/log/foo.log", IdleCloseTimeout: 300},
+		{Type: FileType, Path: "/var/log/app.log", TimestampPattern: `^(\S+)`, TimestampLayout: "2006-01-02T15:04:05Z07:00"},
+		{Type: FileType, Path: "/var/log/app.log", TimestampPattern: `^\[([^]]+)\]`, TimestampLayout: "2006-01-02 15:04:05", TimestampTimezone: "Europe/Paris"},
+		{Type: FileType, Path: "/var/log/*.log", ExcludePaths: []string{"*-debug.log", "/var/log/audit*.log"}},
+		{Type: FileType, Path: "/var/log/app.log", HostPathPrefix: "/var/log", ContainerPathPrefix: "/host/var/log"},
 		{Type: TCPType, Port: 1234},
 		{Type: UDPType, Port: 5678},
 		{Type: DockerType},
@@ -33,6 +48,24 @@ func TestValidateShouldFailWithInvalidConfigs(t *testing.T) {
 	invalidConfigs := []*LogsConfig{
 		{},
 		{Type: FileType},
+		{Type: FileType, Path: "/var/log/foo.log", PollInterval: -1},
+		{Type: FileType, Path: "/var/log/foo.log", RateWeight: -1},
+		{Type: FileType, Path: "/var/log/foo.log", IdleCloseTimeout: -1},
+		{Type: FileType, Path: "/var/log/*.log", ExcludePaths: []string{"[-debug.log"}},
+		{Type: FileType, Path: "/proc/*/fd/1", Stream: true},
+		{Type: FileType, Path: "/var/log/app[1].log", TailingMode: "beginning"},
+		{Type: FileType, Path: "/var/log/*", TailDirectory: true},
+		{Type: FileType, Path: "/var/log/app", TailDirectory: true, TailingMode: "beginning"},
+		{Type: FileType, Path: "/mnt/nfs/app.log", RotationDetection: "inode"},
+		{Type: FileType, Path: "/var/log/journal.export", Format: "json"},
+		{Type: FileType, Path: "/proc/1/fd/1", Stream: true, FullReadOnChange: true},
+		{Type: FileType, Path: "/var/log/app.log", HostPathPrefix: "/var/log"},
+		{Type: FileType, Path: "/var/log/app.log", ContainerPathPrefix: "/host/var/log"},
+		{Type: FileType, Path: "/var/log/app.log", TimestampPattern: `^\S+`, TimestampLayout: "2006-01-02T15:04:05Z07:00"},
+		{Type: FileType, Path: "/var/log/app.log", TimestampPattern: `^(\S+`, TimestampLayout: "2006-01-02T15:04:05Z07:00"},
+		{Type: FileType, Path: "/var/log/app.log", TimestampPattern: `^(\S+)`},
+		{Type: FileType, Path: "/var/log/app.log", TimestampLayout: "2006-01-02T15:04:05Z07:00"},
+		{Type: FileType, Path: "/var/log/app.log", TimestampPattern: `^(\S+)`, TimestampLayout: "2006-01-02 15:04:05", TimestampTimezone: "Mars/Olympus"},
 		{Type: TCPType},
 		{Type: UDPType},
 		{Type: DockerType, ProcessingRules: []*ProcessingRule{{Name: "foo"}}},
@@ -49,3 +82,36 @@ func TestValidateShouldFailWithInvalidConfigs(t *testing.T) {
 		assert.NotNil(t, err)
 	}
 }
+
+func TestPathTranslation(t *testing.T) {
+	p := filepath.FromSlash
+	c := &LogsConfig{Type: FileType, HostPathPrefix: "/var/log", ContainerPathPrefix: "/host/var/log/"}
+
+	// host to container
+	assert.Equal(t, p("/host/var/log/app.log"), c.ContainerPath(p("/var/log/app.log")))
+	assert.Equal(t, p("/host/var/log/app/*.log"), c.ContainerPath(p("/var/log/app/*.log")))
+	assert.Equal(t, p("/host/var/log"), c.ContainerPath(p("/var/log")))
+	assert.Equal(t, p("/var/logs/app.log"), c.ContainerPath(p("/var/logs/app.log")))
+	assert.Equal(t, p("/tmp/app.log"), c.ContainerPath(p("/tmp/app.log")))
+
+	// container to host
+	assert.Equal(t, p("/var/log/app.log"), c.HostPath(p("/host/var/log/app.log")))
+	assert.Equal(t, p("/var/log/app/1.log"), c.HostPath(p("/host/var/log/app/1.log")))
+	assert.Equal(t, p("/var/log"), c.HostPath(p("/host/var/log")))
+	assert.Equal(t, p("/host/var/logs/app.log"), c.HostPath(p("/host/var/logs/app.log")))
+
+	// the translations are inverse of each other
+	for _, path := range []string{p("/var/log/app.log"), p("/var/log/a/b/c.log"), p("/tmp/app.log")} {
+		assert.Equal(t, path, c.HostPath(c.ContainerPath(path)))
+	}
+
+	// the root can be bind mounted
+	root := &LogsConfig{Type: FileType, HostPathPrefix: "/", ContainerPathPrefix: "/host"}
+	assert.Equal(t, p("/host/var/log/app.log"), root.ContainerPath(p("/var/log/app.log")))
+	assert.Equal(t, p("/var/log/app.log"), root.HostPath(p("/host/var/log/app.log")))
+
+	// no translation without prefixes
+	none := &LogsConfig{Type: FileType}
+	assert.Equal(t, p("/var/log/app.log"), none.ContainerPath(p("/var/log/app.log")))
+	assert.Equal(t, p("/var/log/app.log"), none.HostPath(p("/var/log/app.log")))
+}
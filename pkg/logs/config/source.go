@@ -8,6 +8,8 @@ package config
 import (
 	"expvar"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // SourceType used for log line parsing logic.
@@ -28,6 +30,9 @@ type LogSource struct {
 	// Put expvar Int first because it's modified with sync/atomic, so it needs to
 	// be 64-bit aligned on 32-bit systems. See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
 	BytesRead expvar.Int
+	// lastCommit is the time of the last offset committed to the registry in nanoseconds since the epoch,
+	// it is modified with sync/atomic too
+	lastCommit int64
 
 	Name     string
 	Config   *LogsConfig
@@ -111,6 +116,21 @@ func (s *LogSource) RemoveInfo(key string) {
 	s.lock.Unlock()
 }
 
+// SetLastCommit records the time of the last offset of the source committed to the registry.
+func (s *LogSource) SetLastCommit(t time.Time) {
+	atomic.StoreInt64(&s.lastCommit, t.UnixNano())
+}
+
+// GetLastCommit returns the time of the last offset of the source committed to the registry,
+// the zero time if none has been committed.
+func (s *LogSource) GetLastCommit() time.Time {
+	nanos := atomic.LoadInt64(&s.lastCommit)
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
 // GetInfo returns a list of info about the source
 func (s *LogSource) GetInfo() []string {
 	s.lock.Lock()
@@ -22,6 +22,7 @@ const (
 type LogStatus struct {
 	status status
 	err    string
+	paused bool
 	mu     *sync.Mutex
 }
 
@@ -49,6 +50,27 @@ func (s *LogStatus) Error(err error) {
 	s.err = fmt.Sprintf("Error: %s", err.Error())
 }
 
+// Pause marks the source as paused, its logs are not collected until it is resumed.
+func (s *LogStatus) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+}
+
+// Resume marks the source as not paused anymore.
+func (s *LogStatus) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+}
+
+// IsPaused returns whether the source is paused.
+func (s *LogStatus) IsPaused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
 // IsPending returns whether the current status is not yet determined.
 func (s *LogStatus) IsPending() bool {
 	return s.status == isPending
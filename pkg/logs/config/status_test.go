@@ -43,6 +43,17 @@ func (s *LogStatusSuite) TestError() {
 	s.Equal("Error: bar", s.status.GetError())
 }
 
+func (s *LogStatusSuite) TestPaused() {
+	s.status = NewLogStatus()
+	s.status.Success()
+	s.status.Pause()
+	s.True(s.status.IsPaused())
+	s.True(s.status.IsSuccess())
+	s.status.Resume()
+	s.False(s.status.IsPaused())
+	s.True(s.status.IsSuccess())
+}
+
 func TestLogStatusSuite(t *testing.T) {
 	suite.Run(t, new(LogStatusSuite))
 }
@@ -7,6 +7,7 @@ package decoder
 
 import (
 	"bytes"
+	"sync"
 
 	"github.com/DataDog/datadog-agent/pkg/logs/config"
 	"github.com/DataDog/datadog-agent/pkg/logs/parser"
@@ -19,6 +20,8 @@ const defaultContentLenLimit = 256 * 1000
 // Input represents a chunk of line.
 type Input struct {
 	content []byte
+	// release, when set, is called with the content once the decoder doesn't reference it anymore
+	release func([]byte)
 }
 
 // NewInput returns a new input.
@@ -28,6 +31,22 @@ func NewInput(content []byte) *Input {
 	}
 }
 
+// NewInputWithRelease returns a new input whose content is handed back to release once it has been
+// decoded, which makes it possible to reuse the buffers holding the raw data.
+func NewInputWithRelease(content []byte, release func([]byte)) *Input {
+	return &Input{
+		content: content,
+		release: release,
+	}
+}
+
+// done releases the content of the input
+func (i *Input) done() {
+	if i.release != nil {
+		i.release(i.content)
+	}
+}
+
 // DecodedInput represents a decoded line and the raw length
 type DecodedInput struct {
 	content    []byte
@@ -71,6 +90,11 @@ type Decoder struct {
 	lineParser      LineParser
 	contentLenLimit int
 	rawDataLen      int
+	// lineDecoder, when set, splits the raw data into lines instead of the matcher
+	lineDecoder LineDecoder
+	// err is the error that made the line decoder drop the remaining data, it is protected by errMutex
+	err      error
+	errMutex sync.Mutex
 }
 
 // InitializeDecoder returns a properly initialized Decoder
@@ -82,7 +106,23 @@ func InitializeDecoder(source *config.LogSource, parser parser.Parser) *Decoder
 func NewDecoderWithEndLineMatcher(source *config.LogSource, parser parser.Parser, matcher EndLineMatcher) *Decoder {
 	inputChan := make(chan *Input)
 	outputChan := make(chan *Message)
-	lineLimit := defaultContentLenLimit
+	lineParser := newLineParser(source, parser, outputChan, defaultContentLenLimit)
+	return New(inputChan, outputChan, lineParser, defaultContentLenLimit, matcher)
+}
+
+// NewDecoderWithLineDecoder initialize a decoder splitting the raw data into lines with the given line decoder,
+// for the formats that are not newline-delimited.
+func NewDecoderWithLineDecoder(source *config.LogSource, parser parser.Parser, lineDecoder LineDecoder) *Decoder {
+	inputChan := make(chan *Input)
+	outputChan := make(chan *Message)
+	lineParser := newLineParser(source, parser, outputChan, defaultContentLenLimit)
+	decoder := New(inputChan, outputChan, lineParser, defaultContentLenLimit, &NewLineMatcher{})
+	decoder.lineDecoder = lineDecoder
+	return decoder
+}
+
+// newLineParser returns the line parser and handler chain of a decoder of the source
+func newLineParser(source *config.LogSource, parser parser.Parser, outputChan chan *Message, lineLimit int) LineParser {
 	var lineHandler LineHandler
 	var lineParser LineParser
 
@@ -100,8 +140,7 @@ func NewDecoderWithEndLineMatcher(source *config.LogSource, parser parser.Parser
 	} else {
 		lineParser = NewSingleLineParser(parser, lineHandler)
 	}
-
-	return New(inputChan, outputChan, lineParser, lineLimit, matcher)
+	return lineParser
 }
 
 // New returns an initialized Decoder
@@ -128,10 +167,30 @@ func (d *Decoder) Stop() {
 	close(d.InputChan)
 }
 
+// Err returns the error that made the line decoder drop the remaining data, nil otherwise.
+// The records following the one it could not decode are lost, the data should not be sent anymore.
+func (d *Decoder) Err() error {
+	d.errMutex.Lock()
+	defer d.errMutex.Unlock()
+	return d.err
+}
+
+// setErr records the error that made the line decoder drop the remaining data
+func (d *Decoder) setErr(err error) {
+	d.errMutex.Lock()
+	defer d.errMutex.Unlock()
+	d.err = err
+}
+
 // run lets the Decoder handle data coming from InputChan
 func (d *Decoder) run() {
-	for data := range d.InputChan {
-		d.decodeIncomingData(data.content)
+	if d.lineDecoder != nil {
+		d.runLineDecoder()
+	} else {
+		for data := range d.InputChan {
+			d.decodeIncomingData(data.content)
+			data.done()
+		}
 	}
 	// finish to stop decoder
 	d.lineParser.Stop()
@@ -6,6 +6,8 @@
 package decoder
 
 import (
+	"errors"
+	"io"
 	"strings"
 	"testing"
 
@@ -303,3 +305,91 @@ func TestDecoderWithDecodingParser(t *testing.T) {
 
 	d.Stop()
 }
+
+func TestDecoderWithLineDecoderStopsOnInvalidRecord(t *testing.T) {
+	source := config.NewLogSource("config", &config.LogsConfig{})
+	d := NewDecoderWithLineDecoder(source, parser.NoopParser, lengthPrefixedDecoder{})
+	d.Start()
+
+	d.InputChan <- NewInput([]byte("\x05hello\xff\x05world"))
+	d.InputChan <- NewInput([]byte("\x02ok"))
+	assert.Equal(t, "hello", string((<-d.OutputChan).Content))
+
+	// the records following the invalid one are dropped and the error is reported
+	d.Stop()
+	_, isOpen := <-d.OutputChan
+	assert.False(t, isOpen)
+	assert.EqualError(t, d.Err(), "invalid frame")
+}
+
+func TestDecoderReleasesInputs(t *testing.T) {
+	source := config.NewLogSource("config", &config.LogsConfig{})
+	released := make(chan []byte, 2)
+	release := func(content []byte) { released <- content }
+
+	d := InitializeDecoder(source, parser.NoopParser)
+	d.Start()
+	d.InputChan <- NewInputWithRelease([]byte("hello\n"), release)
+	assert.Equal(t, "hello", string((<-d.OutputChan).Content))
+	assert.Equal(t, "hello\n", string(<-released))
+	d.Stop()
+
+	d = NewDecoderWithLineDecoder(source, parser.NoopParser, lengthPrefixedDecoder{})
+	d.Start()
+	d.InputChan <- NewInputWithRelease([]byte("\x05world"), release)
+	assert.Equal(t, "world", string((<-d.OutputChan).Content))
+	assert.Equal(t, "\x05world", string(<-released))
+	d.Stop()
+}
+
+// lengthPrefixedDecoder decodes records prefixed by their length on one byte, 0xff is an invalid length
+type lengthPrefixedDecoder struct{}
+
+func (lengthPrefixedDecoder) Decode(r io.Reader) ([]byte, int, error) {
+	header := make([]byte, 1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, err
+	}
+	if header[0] == 0xff {
+		return nil, 0, errors.New("invalid frame")
+	}
+	content := make([]byte, int(header[0]))
+	n, err := io.ReadFull(r, content)
+	if err != nil {
+		return nil, 0, err
+	}
+	return content, n + 1, nil
+}
+
+func TestDecoderWithLineDecoder(t *testing.T) {
+	source := config.NewLogSource("config", &config.LogsConfig{})
+	d := NewDecoderWithLineDecoder(source, parser.NoopParser, lengthPrefixedDecoder{})
+	d.Start()
+
+	// records can contain new lines and span several inputs
+	d.InputChan <- NewInput([]byte("\x05hello\x0dmulti\nli"))
+	d.InputChan <- NewInput([]byte("ne\nok\x00\x02hi"))
+
+	var output *Message
+	output = <-d.OutputChan
+	assert.Equal(t, "hello", string(output.Content))
+	assert.Equal(t, 6, output.RawDataLen)
+
+	output = <-d.OutputChan
+	assert.Equal(t, "multi\nline\nok", string(output.Content))
+	assert.Equal(t, 14, output.RawDataLen)
+
+	output = <-d.OutputChan
+	assert.Equal(t, "", string(output.Content))
+	assert.Equal(t, 1, output.RawDataLen)
+
+	output = <-d.OutputChan
+	assert.Equal(t, "hi", string(output.Content))
+	assert.Equal(t, 3, output.RawDataLen)
+
+	// an incomplete record is dropped when the decoder is stopped
+	d.InputChan <- NewInput([]byte("\x05hel"))
+	d.Stop()
+	_, isOpen := <-d.OutputChan
+	assert.False(t, isOpen)
+}
@@ -0,0 +1,91 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package decoder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// maxJournalFieldSize is the maximum size of a binary field of a journal entry,
+// a bigger size means that the data is corrupted
+const maxJournalFieldSize = 64 * 1024 * 1024
+
+// JournalExportDecoder splits a stream of journal entries in the journal export format into records,
+// one per entry, see https://www.freedesktop.org/wiki/Software/systemd/export/.
+// The entries are separated by an empty line, the records hold their fields without it.
+type JournalExportDecoder struct {
+	reader *bufio.Reader
+	// source is the reader wrapped by reader, a decoder is bound to a single stream
+	source io.Reader
+}
+
+// NewJournalExportDecoder returns a new JournalExportDecoder
+func NewJournalExportDecoder() *JournalExportDecoder {
+	return &JournalExportDecoder{}
+}
+
+// Decode returns the next journal entry of r. The data of r is buffered across the calls so
+// the same reader must be provided each time. An entry that is not terminated when r is closed
+// is dropped with io.ErrUnexpectedEOF, its offset is not advanced.
+func (d *JournalExportDecoder) Decode(r io.Reader) ([]byte, int, error) {
+	if d.source != r {
+		d.source = r
+		d.reader = bufio.NewReader(r)
+	}
+
+	var entry bytes.Buffer
+	consumed := 0
+	for {
+		line, err := d.reader.ReadBytes('\n')
+		consumed += len(line)
+		if err != nil {
+			return nil, 0, unexpectedEOF(err, consumed)
+		}
+		if len(line) == 1 {
+			if entry.Len() == 0 {
+				// skip the empty lines between the entries
+				continue
+			}
+			return entry.Bytes(), consumed, nil
+		}
+		entry.Write(line)
+		if bytes.IndexByte(line, '=') >= 0 {
+			continue
+		}
+
+		// binary field, its name is followed by the size of its value, the value and a new line
+		var size [8]byte
+		n, err := io.ReadFull(d.reader, size[:])
+		consumed += n
+		if err != nil {
+			return nil, 0, unexpectedEOF(err, consumed)
+		}
+		length := binary.LittleEndian.Uint64(size[:])
+		if length > maxJournalFieldSize {
+			return nil, 0, fmt.Errorf("invalid size %d for the binary field %q", length, bytes.TrimSpace(line))
+		}
+		value := make([]byte, length+1)
+		n, err = io.ReadFull(d.reader, value)
+		consumed += n
+		if err != nil {
+			return nil, 0, unexpectedEOF(err, consumed)
+		}
+		entry.Write(size[:])
+		entry.Write(value)
+	}
+}
+
+// unexpectedEOF returns io.ErrUnexpectedEOF when the stream ends in the middle of an entry
+func unexpectedEOF(err error, consumed int) error {
+	if consumed > 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package decoder
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalExportDecoder(t *testing.T) {
+	input := "MESSAGE=foo\n_PID=1\n\n" +
+		"\n" +
+		"MESSAGE\n\x07\x00\x00\x00\x00\x00\x00\x00foo\nbar\nPRIORITY=3\n\n" +
+		"MESSAGE=partial\n"
+	reader := strings.NewReader(input)
+	d := NewJournalExportDecoder()
+
+	content, consumed, err := d.Decode(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "MESSAGE=foo\n_PID=1\n", string(content))
+	assert.Equal(t, 20, consumed)
+
+	// the empty lines between the entries are consumed with the next entry
+	content, consumed, err = d.Decode(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "MESSAGE\n\x07\x00\x00\x00\x00\x00\x00\x00foo\nbar\nPRIORITY=3\n", string(content))
+	assert.Equal(t, 1+36, consumed)
+
+	// the partial entry at the end of the stream is dropped
+	_, consumed, err = d.Decode(reader)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, 0, consumed)
+}
+
+func TestJournalExportDecoderEOF(t *testing.T) {
+	d := NewJournalExportDecoder()
+	_, consumed, err := d.Decode(strings.NewReader(""))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 0, consumed)
+}
@@ -0,0 +1,58 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package decoder
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// LineDecoder splits a stream of raw data into records, it makes it possible to collect
+// formats that are not newline-delimited, like length-prefixed records.
+type LineDecoder interface {
+	// Decode reads the next record from r and returns its content along with
+	// the number of bytes of r it consumed, framing included, which is used to
+	// track the offset of the record. It must not read past the end of the record.
+	// io.EOF is returned once r is closed.
+	Decode(r io.Reader) ([]byte, int, error)
+}
+
+// runLineDecoder feeds the incoming data to the line decoder and passes the records
+// it returns to the line parser, until the decoder is stopped.
+func (d *Decoder) runLineDecoder() {
+	reader, writer := io.Pipe()
+	decoded := make(chan struct{})
+
+	go func() {
+		defer close(decoded)
+		for {
+			content, consumed, err := d.lineDecoder.Decode(reader)
+			if consumed > 0 {
+				d.lineParser.Handle(NewDecodedInput(content, consumed))
+			}
+			if err != nil {
+				if err != io.EOF && err != io.ErrUnexpectedEOF {
+					// the framing is lost, the records that follow can't be found
+					log.Errorf("Could not decode the record, dropping the remaining data: %v", err)
+					d.setErr(err)
+				}
+				// discard the data until the decoder is stopped, not to block the writer
+				io.Copy(ioutil.Discard, reader) //nolint:errcheck
+				return
+			}
+		}
+	}()
+
+	for data := range d.InputChan {
+		writer.Write(data.content) //nolint:errcheck
+		// the pipe returns once the line decoder has read the whole content
+		data.done()
+	}
+	writer.Close()
+	<-decoded
+}
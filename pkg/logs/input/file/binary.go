@@ -0,0 +1,129 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/status"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+const (
+	// binarySniffSize is the number of bytes read at the beginning of a file to find out whether it is binary
+	binarySniffSize = 4096
+	// binaryRatio is the ratio of non-text bytes above which a file is considered binary
+	binaryRatio = 0.3
+)
+
+// binaryFileWarningType is the prefix of the keys of the warnings about the binary files matched by a source
+const binaryFileWarningType = "binary_file_warning"
+
+// skipBinaryFiles removes the binary files, e.g. a core dump matching *.log, from the files to tail. Only the files
+// that are not tailed yet are sniffed, the files of the sources allowing binary content, of the streams and of the
+// sources with an encoding are never skipped. Each binary file is logged and reported in the status once,
+// its warning is removed when it does not match anymore.
+func (s *Scanner) skipBinaryFiles(files []*File) []*File {
+	matched := make(map[string]bool)
+	filtered := files[:0]
+	for _, file := range files {
+		if !s.shouldSniff(file) {
+			filtered = append(filtered, file)
+			continue
+		}
+		if !s.skippedBinaryFiles[file.Path] && !isBinaryFile(file.Path) {
+			filtered = append(filtered, file)
+			continue
+		}
+		matched[file.Path] = true
+		if s.skippedBinaryFiles[file.Path] {
+			continue
+		}
+		s.skippedBinaryFiles[file.Path] = true
+		log.Warnf("Skipping %s, it looks like a binary file, set allow_binary to tail it anyway", file.Path)
+		status.AddGlobalWarning(binaryFileWarningKey(file.Path), fmt.Sprintf("%s looks like a binary file, it is not tailed (source: %s)", file.Path, file.Source.Name))
+	}
+	for path := range s.skippedBinaryFiles {
+		if !matched[path] {
+			delete(s.skippedBinaryFiles, path)
+			status.RemoveGlobalWarning(binaryFileWarningKey(path))
+		}
+	}
+	return filtered
+}
+
+// shouldSniff returns true if the file must be checked for binary content before being tailed
+func (s *Scanner) shouldSniff(file *File) bool {
+	if _, isTailed := s.tailers[file.GetScanKey()]; isTailed {
+		return false
+	}
+	c := file.Source.Config
+	// the content of a stream can't be read twice and the encoded files, e.g. in UTF-16, are full of zeros
+	return !c.AllowBinary && !c.Stream && c.Encoding == ""
+}
+
+// binaryFileWarningKey returns the key of the warning about the binary file
+func binaryFileWarningKey(path string) string {
+	return fmt.Sprintf("%s:%s", binaryFileWarningType, path)
+}
+
+// isBinaryFile returns true if the beginning of the file looks binary, the files that can't be read
+// are left to the tailers to report
+func isBinaryFile(path string) bool {
+	f, err := openFile(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, binarySniffSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false
+	}
+	if d := detectEncoding(head[:n]); d.detected && d.encoding != "" {
+		// the UTF-16 text is full of zeros, it is decoded with its detected encoding
+		return false
+	}
+	return looksBinary(head[:n])
+}
+
+// looksBinary returns true if content holds a zero byte or a high ratio of non-text bytes, i.e. control
+// characters other than the whitespaces and the escape of the terminal colors, and invalid UTF-8 sequences
+func looksBinary(content []byte) bool {
+	if len(content) == 0 {
+		return false
+	}
+	nonText := 0
+	for i := 0; i < len(content); {
+		r, size := utf8.DecodeRune(content[i:])
+		switch {
+		case r == 0:
+			return true
+		case r == utf8.RuneError && size == 1:
+			if !utf8.FullRune(content[i:]) {
+				// the last character is cut by the end of the sniffed content
+				i = len(content)
+				continue
+			}
+			nonText++
+		case r < 0x20 && !isTextControl(r), r == 0x7f:
+			nonText++
+		}
+		i += size
+	}
+	return float64(nonText) > binaryRatio*float64(len(content))
+}
+
+// isTextControl returns true if the control character is commonly found in text files
+func isTextControl(r rune) bool {
+	switch r {
+	case '\t', '\n', '\r', '\f', '\v', '\b', 0x1b:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLooksBinary(t *testing.T) {
+	// text
+	assert.False(t, looksBinary(nil))
+	assert.False(t, looksBinary([]byte("2020-01-01 12:00:00 INFO hello world\n\tat foo.bar()\r\n")))
+	assert.False(t, looksBinary([]byte("\x1b[31merror\x1b[0m: café ☕\n")))
+
+	// zero bytes
+	assert.True(t, looksBinary([]byte("hello\x00world\n")))
+
+	// high ratio of non-text bytes
+	assert.True(t, looksBinary([]byte{0xff, 0xfe, 0x01, 0x02, 0x03, 'a', 'b'}))
+	assert.False(t, looksBinary(append([]byte{0x01}, bytes.Repeat([]byte("a"), 10)...)))
+
+	// a character cut by the end of the sniffed content is not counted
+	assert.False(t, looksBinary([]byte("caf\xc3")))
+}
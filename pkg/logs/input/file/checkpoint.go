@@ -0,0 +1,79 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// A checkpoint file is a JSON object holding the offsets of the tailed files, indexed by path, e.g.
+// {"/var/log/app.log": 1024}
+// It lets the offsets be managed outside of the agent, when the registry is not persisted.
+
+// loadCheckpoint returns the offsets recorded in the checkpoint file
+func loadCheckpoint(checkpointFile string) (map[string]int64, error) {
+	content, err := ioutil.ReadFile(checkpointFile)
+	if err != nil {
+		return nil, err
+	}
+	var offsets map[string]int64
+	if err := json.Unmarshal(content, &offsets); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file: %v", err)
+	}
+	return offsets, nil
+}
+
+// readCheckpoint returns the offset of the file recorded in the checkpoint file
+func readCheckpoint(checkpointFile string, path string) (int64, error) {
+	offsets, err := loadCheckpoint(checkpointFile)
+	if err != nil {
+		return 0, err
+	}
+	offset, exists := offsets[path]
+	if !exists {
+		return 0, fmt.Errorf("no offset recorded for %s", path)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid offset %d recorded for %s", offset, path)
+	}
+	return offset, nil
+}
+
+// writeCheckpoint records the offsets in the checkpoint file, the offsets of the other files
+// already recorded in the checkpoint file are kept. The file is replaced atomically.
+func writeCheckpoint(checkpointFile string, offsets map[string]int64) error {
+	checkpoint, err := loadCheckpoint(checkpointFile)
+	if err != nil {
+		// the checkpoint file is missing or corrupted, start from scratch
+		checkpoint = make(map[string]int64)
+	}
+	for path, offset := range offsets {
+		checkpoint[path] = offset
+	}
+
+	content, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(checkpointFile), filepath.Base(checkpointFile))
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), checkpointFile)
+}
@@ -0,0 +1,62 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// checksumPrefixSize is the number of bytes at the beginning of a file used to identify its content
+// with the checksum rotation detection, they are read at every scan.
+const checksumPrefixSize = 1024
+
+// recordPrefixChecksum records the checksum of the first bytes of the file of the tailer
+// when its source detects the file rotations from the checksum.
+func (s *Scanner) recordPrefixChecksum(tailer *Tailer) {
+	if tailer.file.Source.Config.RotationDetection != config.ChecksumRotationDetection {
+		return
+	}
+	prefix, err := readPrefix(tailer.file.Path)
+	if err != nil {
+		log.Warnf("Could not compute the checksum of %s: %v", tailer.file.Path, err)
+		return
+	}
+	tailer.prefixSize = len(prefix)
+	tailer.prefixChecksum = crc32.ChecksumIEEE(prefix)
+}
+
+// didPrefixChange returns true if the first bytes of the file differ from the recorded ones,
+// which means that the file has been replaced. The recorded prefix is extended while the file
+// is smaller than checksumPrefixSize. A file replaced while it was empty is not detected.
+func (t *Tailer) didPrefixChange() (bool, error) {
+	prefix, err := readPrefix(t.file.Path)
+	if err != nil {
+		return false, err
+	}
+	if len(prefix) < t.prefixSize || crc32.ChecksumIEEE(prefix[:t.prefixSize]) != t.prefixChecksum {
+		return true, nil
+	}
+	if len(prefix) > t.prefixSize {
+		t.prefixSize = len(prefix)
+		t.prefixChecksum = crc32.ChecksumIEEE(prefix)
+	}
+	return false, nil
+}
+
+// readPrefix returns the first checksumPrefixSize bytes of the file, less if the file is smaller
+func readPrefix(path string) ([]byte, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(io.LimitReader(f, checksumPrefixSize))
+}
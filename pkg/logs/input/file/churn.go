@@ -0,0 +1,114 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+	"github.com/DataDog/datadog-agent/pkg/logs/metrics"
+)
+
+const (
+	// churnWindow is the period over which the tailer churn is counted
+	churnWindow = time.Minute
+	// maxChurnedPaths is the maximum number of recently churned paths listed in the status of a source
+	maxChurnedPaths = 5
+	// tailerChurnInfoKey is the key of the source info holding the churn of its tailers
+	tailerChurnInfoKey = "tailer_churn"
+)
+
+// Actions of the churn events
+const (
+	tailerStarted = "started"
+	tailerStopped = "stopped"
+)
+
+// churnEvent is the start or the stop of a tailer
+type churnEvent struct {
+	at     time.Time
+	source *config.LogSource
+	path   string
+}
+
+// tailerChurn keeps track of the tailers started and stopped by the scanner during the last churn window.
+// A high churn, with tailers constantly replaced, usually comes from a misconfigured source or from a rotation
+// detection that mistakes the writes of a file for rotations.
+type tailerChurn struct {
+	// events holds the events of the last churn window, the oldest first
+	events []churnEvent
+	// reportedSources holds the sources whose churn is shown in their status
+	reportedSources map[*config.LogSource]bool
+}
+
+// newTailerChurn returns a new tailerChurn
+func newTailerChurn() *tailerChurn {
+	return &tailerChurn{
+		reportedSources: make(map[*config.LogSource]bool),
+	}
+}
+
+// record records that the tailer of the file has been started or stopped
+func (c *tailerChurn) record(file *File, action string, now time.Time) {
+	c.events = append(c.events, churnEvent{at: now, source: file.Source, path: file.Path})
+	metrics.TlmTailersChurned.Inc(action)
+}
+
+// count returns the number of tailers started and stopped during the last churn window
+func (c *tailerChurn) count(now time.Time) int {
+	c.expire(now)
+	return len(c.events)
+}
+
+// expire drops the events older than the churn window
+func (c *tailerChurn) expire(now time.Time) {
+	i := 0
+	for i < len(c.events) && now.Sub(c.events[i].at) >= churnWindow {
+		i++
+	}
+	c.events = c.events[i:]
+}
+
+// report updates the churn metrics and the status of the sources whose tailers churned during the last window,
+// with their most recently churned paths
+func (c *tailerChurn) report(now time.Time) {
+	count := c.count(now)
+	metrics.TailerChurn.Set(int64(count))
+	metrics.TlmTailerChurn.Set(float64(count))
+
+	counts := make(map[*config.LogSource]int)
+	paths := make(map[*config.LogSource][]string)
+	for i := len(c.events) - 1; i >= 0; i-- {
+		event := c.events[i]
+		counts[event.source]++
+		if len(paths[event.source]) < maxChurnedPaths && !containsString(paths[event.source], event.path) {
+			paths[event.source] = append(paths[event.source], event.path)
+		}
+	}
+
+	for source := range c.reportedSources {
+		if counts[source] == 0 {
+			source.RemoveInfo(tailerChurnInfoKey)
+			delete(c.reportedSources, source)
+		}
+	}
+	for source, count := range counts {
+		source.UpdateInfo(tailerChurnInfoKey, fmt.Sprintf("Tailer churn: %d tailers started or stopped during the last %s, recently: %s", count, churnWindow, strings.Join(paths[source], ", ")))
+		c.reportedSources[source] = true
+	}
+}
+
+// containsString returns true if values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
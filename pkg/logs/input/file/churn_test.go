@@ -0,0 +1,44 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+	"github.com/DataDog/datadog-agent/pkg/logs/metrics"
+)
+
+func TestTailerChurn(t *testing.T) {
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: "/var/log/*.log"})
+	otherSource := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: "/var/log/other.log"})
+	churn := newTailerChurn()
+	now := time.Now()
+
+	churn.record(NewFile("/var/log/a.log", source, true), tailerStarted, now)
+	churn.record(NewFile("/var/log/b.log", source, true), tailerStarted, now.Add(10*time.Second))
+	churn.record(NewFile("/var/log/a.log", source, true), tailerStopped, now.Add(20*time.Second))
+	churn.record(NewFile("/var/log/other.log", otherSource, false), tailerStarted, now.Add(30*time.Second))
+
+	churn.report(now.Add(30 * time.Second))
+	assert.Equal(t, int64(4), metrics.TailerChurn.Value())
+	// the most recently churned paths come first
+	assert.Equal(t, []string{"Tailer churn: 3 tailers started or stopped during the last 1m0s, recently: /var/log/a.log, /var/log/b.log"}, source.GetInfo())
+	assert.Equal(t, []string{"Tailer churn: 1 tailers started or stopped during the last 1m0s, recently: /var/log/other.log"}, otherSource.GetInfo())
+
+	// the events expire after the churn window
+	churn.report(now.Add(75 * time.Second))
+	assert.Equal(t, int64(2), metrics.TailerChurn.Value())
+	assert.Equal(t, []string{"Tailer churn: 1 tailers started or stopped during the last 1m0s, recently: /var/log/a.log"}, source.GetInfo())
+
+	churn.report(now.Add(2 * time.Minute))
+	assert.Equal(t, int64(0), metrics.TailerChurn.Value())
+	assert.Empty(t, source.GetInfo())
+	assert.Empty(t, otherSource.GetInfo())
+}
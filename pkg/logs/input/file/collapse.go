@@ -0,0 +1,65 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/message"
+)
+
+// repeatCountTagKey is the key of the tag holding the number of repeats collapsed into a message
+const repeatCountTagKey = "logs_repeat_count"
+
+// repeatedLine holds the line repeated by a tailer collapsing the consecutive identical lines
+type repeatedLine struct {
+	// last is the last repeat of the line, it carries the offset of the repeats and is sent when they are flushed
+	last            *message.Message
+	tags            []string
+	forwardedOffset int64
+	// count is the number of repeats not sent
+	count int
+	since time.Time
+}
+
+// collapse sends the message unless it repeats the previous one within the collapse window,
+// in which case it is counted and held until the repeats are flushed.
+func (t *Tailer) collapse(msg *message.Message, tags []string, forwardedOffset int64, now time.Time) {
+	r := &t.repeated
+	if r.last != nil && bytes.Equal(r.last.Content, msg.Content) && now.Sub(r.since) < t.collapseWindow {
+		r.last = msg
+		r.tags = tags
+		r.forwardedOffset = forwardedOffset
+		r.count++
+		return
+	}
+
+	t.flushRepeats()
+	t.send(msg, forwardedOffset)
+	t.repeated = repeatedLine{last: msg, tags: tags, forwardedOffset: forwardedOffset, since: now}
+}
+
+// flushRepeatsIfExpired flushes the repeats once the collapse window of the line expired
+func (t *Tailer) flushRepeatsIfExpired(now time.Time) {
+	if t.repeated.last != nil && now.Sub(t.repeated.since) >= t.collapseWindow {
+		t.flushRepeats()
+	}
+}
+
+// flushRepeats sends the last repeat of the line, tagged with the number of repeats it stands for,
+// and resets the collapse state. Its offset is the one of the last repeat, so the offsets committed
+// to the registry still cover all the repeats.
+func (t *Tailer) flushRepeats() {
+	r := t.repeated
+	t.repeated = repeatedLine{}
+	if r.count == 0 {
+		return
+	}
+	r.last.Origin.SetTags(append(append([]string{}, r.tags...), fmt.Sprintf("%s:%d", repeatCountTagKey, r.count)))
+	t.send(r.last, r.forwardedOffset)
+}
@@ -0,0 +1,198 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+const (
+	// encodingSampleSize is the number of bytes read at the beginning of a file to detect its encoding
+	encodingSampleSize = 4096
+	// utf16ZeroRatio is the ratio of the characters of a sample with a zero byte on the same side above which
+	// the sample is UTF-16 text, mostly ASCII characters, utf16OtherZeroRatio is the ratio of the characters
+	// with a zero byte on the other side it tolerates
+	utf16ZeroRatio      = 0.4
+	utf16OtherZeroRatio = 0.05
+	// encodingInfoKey is the prefix of the keys of the source info holding the encoding detected for its files
+	encodingInfoKey = "encoding"
+)
+
+// Line endings of the files
+const (
+	lineEndingLF   = "LF"
+	lineEndingCRLF = "CRLF"
+)
+
+// detectedEncoding is the encoding and the line ending style detected from the beginning of a file
+type detectedEncoding struct {
+	// encoding is config.UTF16LE or config.UTF16BE, empty for UTF-8
+	encoding   string
+	lineEnding string
+	// detected is false when the sample is ambiguous, the file is then read as UTF-8 with LF line endings
+	detected bool
+	// inode is the inode of the file the encoding was detected for, 0 when unknown
+	inode uint64
+}
+
+// detectEncoding guesses the encoding of a file from the first bytes of its content: its byte order mark,
+// the zero bytes of the UTF-16 encoded ASCII characters, or its validity as UTF-8. The line ending is
+// CRLF when most of the lines of the sample end with a carriage return.
+func detectEncoding(sample []byte) detectedEncoding {
+	d := detectedEncoding{lineEnding: lineEndingLF}
+	if len(sample) == 0 {
+		return d
+	}
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xef, 0xbb, 0xbf}):
+		d.detected = true
+	case bytes.HasPrefix(sample, []byte{0xff, 0xfe}):
+		d.encoding, d.detected = config.UTF16LE, true
+	case bytes.HasPrefix(sample, []byte{0xfe, 0xff}):
+		d.encoding, d.detected = config.UTF16BE, true
+	default:
+		d.encoding, d.detected = detectUTF16(sample)
+		if !d.detected {
+			d.detected = isValidUTF8(sample)
+		}
+	}
+
+	lf, crlf := []byte("\n"), []byte("\r\n")
+	switch d.encoding {
+	case config.UTF16LE:
+		lf, crlf = []byte("\n\x00"), []byte("\r\x00\n\x00")
+	case config.UTF16BE:
+		lf, crlf = []byte("\x00\n"), []byte("\x00\r\x00\n")
+	}
+	if lines := bytes.Count(sample, lf); lines > 0 && 2*bytes.Count(sample, crlf) > lines {
+		d.lineEnding = lineEndingCRLF
+	}
+	return d
+}
+
+// detectUTF16 returns the UTF-16 encoding of the sample when its characters mostly have a zero byte on the
+// same side, which is the case of the ASCII characters encoded in UTF-16
+func detectUTF16(sample []byte) (string, bool) {
+	chars := len(sample) / 2
+	if chars < 2 {
+		return "", false
+	}
+	var evenZeros, oddZeros int
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 {
+			evenZeros++
+		}
+		if sample[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	switch {
+	case float64(oddZeros) > utf16ZeroRatio*float64(chars) && float64(evenZeros) < utf16OtherZeroRatio*float64(chars):
+		return config.UTF16LE, true
+	case float64(evenZeros) > utf16ZeroRatio*float64(chars) && float64(oddZeros) < utf16OtherZeroRatio*float64(chars):
+		return config.UTF16BE, true
+	}
+	return "", false
+}
+
+// isValidUTF8 returns true if the sample is valid UTF-8 without zero bytes, the last character may be cut
+// by the end of the sample
+func isValidUTF8(sample []byte) bool {
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return false
+	}
+	for i := 0; i < utf8.UTFMax && i < len(sample); i++ {
+		if utf8.Valid(sample[:len(sample)-i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// name returns the name of the encoding
+func (d detectedEncoding) name() string {
+	if d.encoding == "" {
+		return "utf-8"
+	}
+	return d.encoding
+}
+
+// shouldDetectEncoding returns true if the encoding of the file must be detected, i.e. its source declares
+// no encoding nor format and the file is not a container log file nor a stream, which can't be read twice
+func shouldDetectEncoding(file *File) bool {
+	c := file.Source.Config
+	switch file.Source.GetSourceType() {
+	case config.DockerSourceType, config.KubernetesSourceType:
+		return false
+	}
+	return c.Encoding == "" && c.Format == "" && !c.Stream
+}
+
+// fileEncoding returns the encoding the file is decoded with, the encoding of its source or the encoding
+// detected from its content when its source declares none. The detection is cached by inode while the file
+// is tailed and shown in the status of the source. The trailing carriage returns are trimmed from the lines
+// anyway, the line ending is only reported.
+func (s *Scanner) fileEncoding(file *File) detectedEncoding {
+	if !shouldDetectEncoding(file) {
+		return detectedEncoding{encoding: file.Source.Config.Encoding}
+	}
+	f, err := openFile(file.Path)
+	if err != nil {
+		// the tailer reports the error
+		return detectedEncoding{}
+	}
+	defer f.Close()
+
+	ino := inode(f)
+	d, cached := s.encodings[ino]
+	if !cached || ino == 0 {
+		sample := make([]byte, encodingSampleSize)
+		n, err := io.ReadFull(f, sample)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return detectedEncoding{}
+		}
+		d = detectEncoding(sample[:n])
+		d.inode = ino
+		if d.detected && ino != 0 {
+			s.encodings[ino] = d
+		}
+	}
+
+	if !d.detected {
+		log.Debugf("Could not detect the encoding of %s, it is read as UTF-8 with LF line endings", file.Path)
+		file.Source.UpdateInfo(encodingInfoKeyFor(file), fmt.Sprintf("Encoding of %s: utf-8 with LF line endings (default, not detected)", file.Path))
+		return d
+	}
+	file.Source.UpdateInfo(encodingInfoKeyFor(file), fmt.Sprintf("Encoding of %s: %s with %s line endings (detected)", file.Path, d.name(), d.lineEnding))
+	return d
+}
+
+// expireEncodings forgets the encodings detected for the files that are not tailed anymore
+func (s *Scanner) expireEncodings() {
+	if len(s.encodings) == 0 {
+		return
+	}
+	tailed := make(map[uint64]bool, len(s.tailers))
+	for _, tailer := range s.tailers {
+		tailed[tailer.encodingInode] = true
+	}
+	for ino := range s.encodings {
+		if !tailed[ino] {
+			delete(s.encodings, ino)
+		}
+	}
+}
+
+// encodingInfoKeyFor returns the key of the source info holding the encoding of the file
+func encodingInfoKeyFor(file *File) string {
+	return fmt.Sprintf("%s:%s", encodingInfoKey, file.GetScanKey())
+}
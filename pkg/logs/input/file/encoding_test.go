@@ -0,0 +1,40 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		sample     []byte
+		encoding   string
+		lineEnding string
+		detected   bool
+	}{
+		{"empty", nil, "", lineEndingLF, false},
+		{"utf-8", []byte("hello\nwörld\n"), "", lineEndingLF, true},
+		{"utf-8 crlf", []byte("hello\r\nworld\r\n"), "", lineEndingCRLF, true},
+		{"utf-8 bom", []byte("\xef\xbb\xbfhello\n"), "", lineEndingLF, true},
+		{"utf-8 cut character", []byte("hello w\xc3"), "", lineEndingLF, true},
+		{"utf-16-le bom", []byte("\xff\xfeh\x00i\x00\n\x00"), config.UTF16LE, lineEndingLF, true},
+		{"utf-16-be bom", []byte("\xfe\xff\x00h\x00i\x00\r\x00\n"), config.UTF16BE, lineEndingCRLF, true},
+		{"utf-16-le", []byte("h\x00e\x00l\x00l\x00o\x00\r\x00\n\x00"), config.UTF16LE, lineEndingCRLF, true},
+		{"utf-16-be", []byte("\x00h\x00e\x00l\x00l\x00o\x00\n"), config.UTF16BE, lineEndingLF, true},
+		{"invalid", []byte("hello\x00\xff\xfe\xfdworld"), "", lineEndingLF, false},
+	} {
+		d := detectEncoding(test.sample)
+		assert.Equal(t, test.encoding, d.encoding, test.name)
+		assert.Equal(t, test.lineEnding, d.lineEnding, test.name)
+		assert.Equal(t, test.detected, d.detected, test.name)
+	}
+}
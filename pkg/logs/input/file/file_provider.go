@@ -7,11 +7,18 @@ package file
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	coreConfig "github.com/DataDog/datadog-agent/pkg/config"
 	"github.com/DataDog/datadog-agent/pkg/logs/status"
+	"github.com/DataDog/datadog-agent/pkg/util/filesystem"
 	"github.com/DataDog/datadog-agent/pkg/util/log"
 
 	"github.com/DataDog/datadog-agent/pkg/logs/config"
@@ -21,6 +28,18 @@ import (
 // files are tailed
 const openFilesLimitWarningType = "open_files_limit_warning"
 
+// Wildcard selection modes, they define which files matching a wildcard path are tailed first
+// when the limit on the number of files is reached
+const (
+	// WildcardSelectionByName selects the files in reverse lexicographic order of their names
+	WildcardSelectionByName = "by_name"
+	// WildcardSelectionByModificationTime selects the most recently modified files first
+	WildcardSelectionByModificationTime = "by_modification_time"
+)
+
+// statCacheMaxEntries is the maximum number of paths whose stats are cached during a scan
+const statCacheMaxEntries = 50000
+
 // File represents a file to tail
 type File struct {
 	Path string
@@ -30,7 +49,9 @@ type File struct {
 	Source         *config.LogSource
 }
 
-// NewFile returns a new File
+// NewFile returns a new File. isWildcardPath must be true when the path has been discovered by expanding
+// a wildcard path of the source, e.g. /var/log/app.log matching /var/log/*.log, it has no relation with
+// the tailing mode of the file, which is defined by the source, see IsTailingFromEnd.
 func NewFile(path string, source *config.LogSource, isWildcardPath bool) *File {
 	return &File{
 		Path:           path,
@@ -39,6 +60,39 @@ func NewFile(path string, source *config.LogSource, isWildcardPath bool) *File {
 	}
 }
 
+// hostPath returns the path of the file on the host, under which its offset is recorded in the registry and in the
+// checkpoint file of its source, see LogsConfig.HostPathPrefix
+func (t *File) hostPath() string {
+	if t.Source == nil || t.Source.Config == nil {
+		return t.Path
+	}
+	return t.Source.Config.HostPath(t.Path)
+}
+
+// registryIdentifier returns the identifier of the registry entry of the file: file:<hostPath>, followed by
+// the fingerprint of the processing rules of its source when it has some: file:<hostPath>#<fingerprint>,
+// so that the tailers processing the same file differently each record their own offset.
+func (t *File) registryIdentifier() string {
+	identifier := t.legacyRegistryIdentifier()
+	if fingerprint := t.processingFingerprint(); fingerprint != "" {
+		identifier = fmt.Sprintf("%s#%s", identifier, fingerprint)
+	}
+	return identifier
+}
+
+// legacyRegistryIdentifier returns the identifier of the registry entry of the file recorded before the
+// processing rules were part of the identifiers.
+func (t *File) legacyRegistryIdentifier() string {
+	return fmt.Sprintf("file:%s", t.hostPath())
+}
+
+// isRegistryIdentifierOf returns true if the registry entry identifier records an offset of the file,
+// whatever the processing rules of the tailer which recorded it.
+func (t *File) isRegistryIdentifierOf(identifier string) bool {
+	legacyID := t.legacyRegistryIdentifier()
+	return identifier == legacyID || strings.HasPrefix(identifier, legacyID+"#")
+}
+
 // getSourceIdentifier returns the source config identifier
 func (t *File) getSourceIdentifier() string {
 	if t.Source != nil && t.Source.Config != nil {
@@ -47,44 +101,199 @@ func (t *File) getSourceIdentifier() string {
 	return ""
 }
 
+// tailingMode returns the mode used to tail the file when no offset is recorded for it. The files of the
+// sources generated by a service discovery are tailed from the beginning to collect all their logs.
+func (t *File) tailingMode() config.TailingMode {
+	if t.Source == nil || t.Source.Config == nil {
+		return config.End
+	}
+	if t.Source.Config.Identifier != "" {
+		// FIXME: better detect a source that has been generated from a service discovery.
+		return config.Beginning
+	}
+	mode, _ := config.TailingModeFromString(t.Source.Config.TailingMode)
+	return mode
+}
+
+// IsTailingFromEnd returns true if the file is tailed from its end when no offset is recorded for it,
+// or always when its source forces it.
+func (t *File) IsTailingFromEnd() bool {
+	mode := t.tailingMode()
+	return mode == config.End || mode == config.ForceEnd
+}
+
 // GetScanKey returns a key used by the scanner to index the scanned file.
 // If it is a file scanned for a container, it will use the format: <filepath>/<container_id>
 // Otherwise, it will simply use the format: <filepath>
+// When the source has processing rules or a record format, their fingerprint is appended to the key:
+// <filepath>#<fingerprint>, so that the sources processing the same file differently each get their own
+// tailer, applying their own rules. Each of these tailers opens the file and counts against
+// logs_config.open_files_limit, and records its offset in its own registry entry, see registryIdentifier.
+// The tailing mode is not part of the key: the offset of a file is recorded in the registry by path,
+// the tailers of two sources differing only by their tailing mode would send each line twice and
+// overwrite each other's offset, so the file is tailed once, by the first source matching it.
 func (t *File) GetScanKey() string {
+	key := t.Path
 	if t.Source != nil && t.Source.Config != nil && t.Source.Config.Identifier != "" {
-		return fmt.Sprintf("%s/%s", t.Path, t.Source.Config.Identifier)
+		key = fmt.Sprintf("%s/%s", t.Path, t.Source.Config.Identifier)
+	}
+	if fingerprint := t.processingFingerprint(); fingerprint != "" {
+		key = fmt.Sprintf("%s#%s", key, fingerprint)
 	}
-	return t.Path
+	return key
+}
+
+// processingFingerprint returns a hash of the configuration defining how the records of the file are processed,
+// i.e. the processing rules and the record format of its source, empty when the source has neither.
+func (t *File) processingFingerprint() string {
+	if t.Source == nil || t.Source.Config == nil {
+		return ""
+	}
+	c := t.Source.Config
+	if len(c.ProcessingRules) == 0 && c.Format == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(c.Format)
+	for _, rule := range c.ProcessingRules {
+		fmt.Fprintf(&b, "\x00%s\x00%s\x00%s", rule.Type, rule.Pattern, rule.ReplacePlaceholder)
+	}
+	return strconv.FormatUint(hashBytes([]byte(b.String())), 16)
 }
 
 // Provider implements the logic to retrieve at most filesLimit Files defined in sources
 type Provider struct {
-	filesLimit      int
-	shouldLogErrors bool
+	filesLimit            int
+	wildcardSelectionMode string
+	shouldLogErrors       bool
+	// scanConcurrency is the maximum number of sources searched concurrently
+	scanConcurrency int
+	// skippedFiles holds the paths of the files that matched a source during the
+	// last call to FilesToTail but were not returned because of filesLimit
+	skippedFiles []string
+	// stats caches the stats of the files during a scan, they are stated several times to be sorted and filtered
+	stats *filesystem.StatCache
+	// sourcePaths holds the paths the files of the sources are searched with when they differ from the paths
+	// of their config, e.g. once expanded, see setSourcePath. The configs of the sources are left untouched.
+	sourcePaths map[*config.LogSource]string
 }
 
 // NewProvider returns a new Provider
 func NewProvider(filesLimit int) *Provider {
+	wildcardSelectionMode := coreConfig.Datadog.GetString("logs_config.file_wildcard_selection_mode")
+	switch wildcardSelectionMode {
+	case WildcardSelectionByName, WildcardSelectionByModificationTime:
+	default:
+		log.Warnf("Invalid wildcard selection mode %q, defaulting to %q", wildcardSelectionMode, WildcardSelectionByName)
+		wildcardSelectionMode = WildcardSelectionByName
+	}
 	return &Provider{
-		filesLimit:      filesLimit,
-		shouldLogErrors: true,
+		filesLimit:            filesLimit,
+		wildcardSelectionMode: wildcardSelectionMode,
+		shouldLogErrors:       true,
+		scanConcurrency:       coreConfig.Datadog.GetInt("logs_config.file_scan_concurrency"),
+		stats:                 filesystem.NewStatCache(time.Duration(coreConfig.Datadog.GetInt("logs_config.file_stat_cache_ttl"))*time.Millisecond, statCacheMaxEntries),
+		sourcePaths:           make(map[*config.LogSource]string),
+	}
+}
+
+// setSourcePath sets the path the files of the source are searched with, in place of the path of its config
+func (p *Provider) setSourcePath(source *config.LogSource, path string) {
+	if path == source.Config.Path {
+		delete(p.sourcePaths, source)
+		return
+	}
+	p.sourcePaths[source] = path
+}
+
+// removeSourcePath forgets the path set for the source
+func (p *Provider) removeSourcePath(source *config.LogSource) {
+	delete(p.sourcePaths, source)
+}
+
+// sourcePath returns the path the files of the source are searched with
+func (p *Provider) sourcePath(source *config.LogSource) string {
+	if path, ok := p.sourcePaths[source]; ok {
+		return path
+	}
+	return source.Config.Path
+}
+
+// isWildcardPath returns true if the files of the source are searched with a wildcard, like
+// LogsConfig.IsWildcardPath but with the path the files are searched with
+func (p *Provider) isWildcardPath(source *config.LogSource) bool {
+	return source.Config.TailDirectory || (!source.Config.LiteralPath && config.ContainsWildcard(p.sourcePath(source)))
+}
+
+// collectedFiles holds the files matching a source
+type collectedFiles struct {
+	files []*File
+	err   error
+}
+
+// collectAllFiles returns the files matching each source, in the order of the sources. The sources are searched
+// by at most scanConcurrency workers as the searches mostly wait on the file system, e.g. on a slow network file
+// system, the files matching a wildcard path are sorted by the workers too as sorting them can stat each file.
+func (p *Provider) collectAllFiles(sources []*config.LogSource) []collectedFiles {
+	collected := make([]collectedFiles, len(sources))
+	collect := func(i int) {
+		files, err := p.CollectFiles(sources[i])
+		if err == nil && p.isWildcardPath(sources[i]) {
+			p.sortFiles(files)
+		}
+		collected[i] = collectedFiles{files: files, err: err}
+	}
+
+	workers := p.scanConcurrency
+	if workers > len(sources) {
+		workers = len(sources)
+	}
+	if workers <= 1 {
+		for i := range sources {
+			collect(i)
+		}
+		return collected
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				collect(i)
+			}
+		}()
+	}
+	for i := range sources {
+		indexes <- i
 	}
+	close(indexes)
+	wg.Wait()
+	return collected
 }
 
 // FilesToTail returns all the Files matching paths in sources,
 // it cannot return more than filesLimit Files.
-// For now, there is no way to prioritize specific Files over others,
-// they are just returned in reverse lexicographical order, see `searchFiles`
+// The Files matching a wildcard path are prioritized according to the
+// wildcard selection mode, see `sortFiles`.
+// The sources can be searched concurrently, see `collectAllFiles`, the limit is then
+// applied to their files in the order of the sources.
 func (p *Provider) FilesToTail(sources []*config.LogSource) []*File {
 	var filesToTail []*File
 	shouldLogErrors := p.shouldLogErrors
 	p.shouldLogErrors = false // Let's log errors on first run only
+	p.skippedFiles = nil
+	// each scan starts with fresh stats
+	p.stats.Purge()
+	collected := p.collectAllFiles(sources)
 
 	for i := 0; i < len(sources); i++ {
 		source := sources[i]
 		tailedFileCounter := 0
-		files, err := p.CollectFiles(source)
-		isWildcardPath := config.ContainsWildcard(source.Config.Path)
+		files, err := collected[i].files, collected[i].err
+		isWildcardPath := p.isWildcardPath(source)
 		if err != nil {
 			source.Status.Error(err)
 			if isWildcardPath {
@@ -95,8 +304,11 @@ func (p *Provider) FilesToTail(sources []*config.LogSource) []*File {
 			}
 			continue
 		}
-		for j := 0; j < len(files) && len(filesToTail) < p.filesLimit; j++ {
-			file := files[j]
+		for _, file := range files {
+			if len(filesToTail) >= p.filesLimit {
+				p.skippedFiles = append(p.skippedFiles, file.Path)
+				continue
+			}
 			filesToTail = append(filesToTail, file)
 			tailedFileCounter++
 		}
@@ -126,16 +338,103 @@ func (p *Provider) FilesToTail(sources []*config.LogSource) []*File {
 	return filesToTail
 }
 
+// FilesForPath returns the files for the given path, one per source matching it.
+// Unlike FilesToTail, the directories of the sources are not searched.
+func (p *Provider) FilesForPath(path string, sources []*config.LogSource) []*File {
+	// the path was just created or changed
+	p.stats.Invalidate(path)
+	if !p.exists(path) {
+		return nil
+	}
+
+	var files []*File
+	for _, source := range sources {
+		switch {
+		case source.Config.TailDirectory:
+			if filepath.Dir(path) != filepath.Clean(p.sourcePath(source)) || !p.isRegular(path) {
+				continue
+			}
+			if excluded, err := p.isExcluded(path, source); err != nil || excluded {
+				continue
+			}
+			files = append(files, NewFile(path, source, true))
+		case p.sourcePath(source) == path:
+			files = append(files, NewFile(path, source, false))
+		case p.isWildcardPath(source):
+			if matched, err := filepath.Match(p.sourcePath(source), path); err != nil || !matched {
+				continue
+			}
+			if excluded, err := p.isExcluded(path, source); err != nil || excluded {
+				continue
+			}
+			files = append(files, NewFile(path, source, true))
+		}
+	}
+	return files
+}
+
+// isExcluded returns true if the path matches one of the exclusion patterns of the source.
+// A pattern without any directory, e.g. *-debug.log, is matched against the file name only,
+// the other ones are translated like the path of the source, see translateSourcePath.
+func (p *Provider) isExcluded(path string, source *config.LogSource) (bool, error) {
+	for _, excludePattern := range source.Config.ExcludePaths {
+		name := path
+		if filepath.Base(excludePattern) == excludePattern {
+			name = filepath.Base(path)
+		} else {
+			excludePattern = translateSourcePath(source.Config, excludePattern)
+		}
+		matched, err := filepath.Match(excludePattern, name)
+		if err != nil {
+			return false, fmt.Errorf("malformed exclusion pattern: %s, %s", excludePattern, err)
+		}
+		if matched {
+			log.Debugf("Excluding path %s matching %s", path, excludePattern)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sortFiles sorts the files matching a wildcard path according to the wildcard selection mode.
+// The files returned by `searchFiles` are already sorted in reverse lexicographical order of their names,
+// when sorting by modification time, this order is kept for the files modified at the same time.
+func (p *Provider) sortFiles(files []*File) {
+	if p.wildcardSelectionMode != WildcardSelectionByModificationTime {
+		return
+	}
+	modTimes := make(map[*File]int64, len(files))
+	for _, file := range files {
+		if info, err := p.stats.Stat(file.Path); err == nil {
+			modTimes[file] = info.ModTime().UnixNano()
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return modTimes[files[i]] > modTimes[files[j]]
+	})
+}
+
+// SkippedFiles returns the paths of the files that matched a source during the
+// last call to FilesToTail but were not returned because the limit was reached.
+func (p *Provider) SkippedFiles() []string {
+	return p.skippedFiles
+}
+
 // CollectFiles returns all the files matching the source path.
 func (p *Provider) CollectFiles(source *config.LogSource) ([]*File, error) {
-	path := source.Config.Path
+	path := p.sourcePath(source)
+	// the path of a new source may have been stated before it was created
+	p.stats.Invalidate(path)
+	if source.Config.TailDirectory {
+		return p.searchDirectory(path, source)
+	}
 	fileExists := p.exists(path)
 	switch {
 	case fileExists:
 		return []*File{
 			NewFile(path, source, false),
 		}, nil
-	case config.ContainsWildcard(path):
+	case p.isWildcardPath(source):
 		pattern := path
 		return p.searchFiles(pattern, source)
 	default:
@@ -153,7 +452,6 @@ func (p *Provider) searchFiles(pattern string, source *config.LogSource) ([]*Fil
 		// no file was found, its parent directories might have wrong permissions or it just does not exist
 		return nil, fmt.Errorf("could not find any file matching pattern %s, check that all its subdirectories are executable", pattern)
 	}
-	var files []*File
 
 	// Files are sorted because of a heuristic on the filename: often the filename and/or the folder name
 	// contains information in the file datetime. Most of the time we want the most recent files.
@@ -170,36 +468,62 @@ func (p *Provider) searchFiles(pattern string, source *config.LogSource) ([]*Fil
 		return filepath.Base(paths[i]) > filepath.Base(paths[j])
 	})
 
-	// Resolve excluded path(s)
-	excludedPaths := make(map[string]int)
-	for _, excludePattern := range source.Config.ExcludePaths {
-		excludedGlob, err := filepath.Glob(excludePattern)
-		if err != nil {
-			return nil, fmt.Errorf("malformed exclusion pattern: %s, %s", excludePattern, err)
-		}
-		for _, excludedPath := range excludedGlob {
-			log.Debugf("Adding excluded path: %s", excludedPath)
-			excludedPaths[excludedPath]++
-			if excludedPaths[excludedPath] > 1 {
-				log.Debugf("Overlapping excluded path: %s", excludedPath)
+	return p.newFiles(paths, source)
+}
+
+// searchDirectory returns all the regular files of the directory, in reverse lexicographical order.
+func (p *Provider) searchDirectory(dir string, source *config.LogSource) ([]*File, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read directory %s: %v", dir, err)
+	}
+	var paths []string
+	// the entries are sorted by name, iterate backwards to get the most recent files first
+	for i := len(entries) - 1; i >= 0; i-- {
+		path := filepath.Join(dir, entries[i].Name())
+		info := entries[i]
+		if info.Mode()&os.ModeSymlink != 0 {
+			// follow the symlinks to the files
+			if info, err = p.stats.Stat(path); err != nil {
+				continue
 			}
 		}
+		if info.Mode().IsRegular() {
+			paths = append(paths, path)
+		}
 	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("could not find any file in directory %s", dir)
+	}
+	return p.newFiles(paths, source)
+}
 
+// newFiles returns the files of the source for the paths that are not excluded.
+func (p *Provider) newFiles(paths []string, source *config.LogSource) ([]*File, error) {
+	var files []*File
+	// Remove the excluded path(s), they are evaluated at each scan so that the
+	// tailers of the files matching an updated exclusion pattern get stopped
 	for _, path := range paths {
-		if excludedPaths[path] == 0 {
+		excluded, err := p.isExcluded(path, source)
+		if err != nil {
+			return nil, err
+		}
+		if !excluded {
 			files = append(files, NewFile(path, source, true))
 		}
 	}
 	return files, nil
 }
 
+// isRegular returns true if the path is a regular file or a symlink to a regular file
+func (p *Provider) isRegular(path string) bool {
+	info, err := p.stats.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
 // exists returns true if the file at path filePath exists
 // Note: we can't rely on os.IsNotExist for windows, so we check error nullity.
 // As we're tailing with *, the error is related to the path being malformed.
 func (p *Provider) exists(filePath string) bool {
-	if _, err := os.Stat(filePath); err != nil {
-		return false
-	}
-	return true
+	return p.stats.Exists(filePath)
 }
@@ -12,9 +12,11 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/suite"
 
+	coreConfig "github.com/DataDog/datadog-agent/pkg/config"
 	"github.com/DataDog/datadog-agent/pkg/logs/config"
 	"github.com/DataDog/datadog-agent/pkg/logs/status"
 )
@@ -272,6 +274,240 @@ func (suite *ProviderTestSuite) TestExcludePath() {
 	suite.Equal(fmt.Sprintf("%s/1/1.log", suite.testDir), files[2].Path)
 }
 
+func (suite *ProviderTestSuite) TestExcludeFileNamePattern() {
+	filesLimit := 6
+	path := fmt.Sprintf("%s/*/*.log", suite.testDir)
+	fileProvider := NewProvider(filesLimit)
+	logSources := []*config.LogSource{
+		config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, ExcludePaths: []string{"2.*", "3.log"}}),
+	}
+
+	files := fileProvider.FilesToTail(logSources)
+	suite.Equal(2, len(files))
+	suite.Equal(fmt.Sprintf("%s/2/1.log", suite.testDir), files[0].Path)
+	suite.Equal(fmt.Sprintf("%s/1/1.log", suite.testDir), files[1].Path)
+}
+
+func (suite *ProviderTestSuite) TestWildcardSelectionMode() {
+	path := fmt.Sprintf("%s/*/*.log", suite.testDir)
+	now := time.Now()
+	modTimes := map[string]time.Time{
+		"1/1.log": now,
+		"2/1.log": now.Add(-time.Minute),
+		"1/2.log": now.Add(-2 * time.Minute),
+		"2/2.log": now.Add(-3 * time.Minute),
+		"1/3.log": now.Add(-4 * time.Minute),
+	}
+	for name, modTime := range modTimes {
+		suite.Nil(os.Chtimes(fmt.Sprintf("%s/%s", suite.testDir, name), modTime, modTime))
+	}
+
+	for _, test := range []struct {
+		mode     string
+		expected []string
+	}{
+		{WildcardSelectionByName, []string{"1/3.log", "2/2.log", "1/2.log"}},
+		{WildcardSelectionByModificationTime, []string{"1/1.log", "2/1.log", "1/2.log"}},
+	} {
+		fileProvider := NewProvider(suite.filesLimit)
+		fileProvider.wildcardSelectionMode = test.mode
+		logSources := suite.newLogSources(path)
+		status.InitStatus(config.CreateSources(logSources))
+
+		files := fileProvider.FilesToTail(logSources)
+		suite.Equal(len(test.expected), len(files), test.mode)
+		for i, file := range files {
+			suite.Equal(fmt.Sprintf("%s/%s", suite.testDir, test.expected[i]), file.Path, test.mode)
+		}
+	}
+}
+
+func (suite *ProviderTestSuite) TestFilesToTailWithConcurrentScan() {
+	var logSources []*config.LogSource
+	for _, path := range []string{"2/*.log", "missing/*.log", "1/1.log", "1/*.log", "*/2.log"} {
+		logSources = append(logSources, config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: fmt.Sprintf("%s/%s", suite.testDir, path)}))
+	}
+	status.InitStatus(config.CreateSources(logSources))
+
+	serialProvider := NewProvider(6)
+	serialProvider.scanConcurrency = 1
+	concurrentProvider := NewProvider(6)
+	concurrentProvider.scanConcurrency = 3
+
+	// the files are the same and in the same order, the limit applies in the order of the sources
+	expected := []string{"2/2.log", "2/1.log", "1/1.log", "1/3.log", "1/2.log", "1/1.log"}
+	for _, provider := range []*Provider{serialProvider, concurrentProvider} {
+		files := provider.FilesToTail(logSources)
+		suite.Equal(len(expected), len(files))
+		for i, file := range files {
+			suite.Equal(fmt.Sprintf("%s/%s", suite.testDir, expected[i]), file.Path)
+		}
+		suite.Equal([]string{fmt.Sprintf("%s/2/2.log", suite.testDir), fmt.Sprintf("%s/1/2.log", suite.testDir)}, provider.SkippedFiles())
+		suite.True(logSources[1].Status.IsError())
+	}
+}
+
+func (suite *ProviderTestSuite) TestInvalidWildcardSelectionMode() {
+	coreConfig.Datadog.Set("logs_config.file_wildcard_selection_mode", "random")
+	defer coreConfig.Datadog.Set("logs_config.file_wildcard_selection_mode", WildcardSelectionByName)
+	suite.Equal(WildcardSelectionByName, NewProvider(suite.filesLimit).wildcardSelectionMode)
+}
+
+func (suite *ProviderTestSuite) TestLiteralPath() {
+	dir := fmt.Sprintf("%s/literal", suite.testDir)
+	suite.Nil(os.MkdirAll(dir, os.ModePerm))
+	// the files that the path would match as a glob
+	for _, name := range []string{"app1.log", "app].log", "app[1]*.log", "app[1]x.log"} {
+		f, err := os.Create(fmt.Sprintf("%s/%s", dir, name))
+		suite.Nil(err)
+		suite.Nil(f.Close())
+	}
+
+	for _, name := range []string{"app[1].log", "app].log", "app[1]*.log"} {
+		path := fmt.Sprintf("%s/%s", dir, name)
+		source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, LiteralPath: true})
+		fileProvider := NewProvider(suite.filesLimit)
+
+		// the file does not exist yet
+		if name == "app[1].log" {
+			suite.Empty(fileProvider.FilesToTail([]*config.LogSource{source}))
+			f, err := os.Create(path)
+			suite.Nil(err)
+			suite.Nil(f.Close())
+		}
+
+		files := fileProvider.FilesToTail([]*config.LogSource{source})
+		suite.Equal(1, len(files), name)
+		suite.Equal(path, files[0].Path)
+		suite.False(files[0].IsWildcardPath)
+		suite.Empty(source.Messages.GetMessages())
+		suite.Equal([]*File{NewFile(path, source, false)}, fileProvider.FilesForPath(path, []*config.LogSource{source}))
+	}
+}
+
+func (suite *ProviderTestSuite) TestTailDirectory() {
+	dir := fmt.Sprintf("%s/directory", suite.testDir)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: dir, TailDirectory: true, ExcludePaths: []string{"*.gz"}})
+	fileProvider := NewProvider(suite.filesLimit)
+
+	// the directory does not exist yet
+	suite.Empty(fileProvider.FilesToTail([]*config.LogSource{source}))
+
+	suite.Nil(os.MkdirAll(fmt.Sprintf("%s/subdirectory", dir), os.ModePerm))
+	for _, name := range []string{"2020-10-01.log", "2020-10-02", "2020-09-30.log.gz", "subdirectory/nested.log"} {
+		f, err := os.Create(fmt.Sprintf("%s/%s", dir, name))
+		suite.Nil(err)
+		suite.Nil(f.Close())
+	}
+	suite.Nil(os.Symlink(fmt.Sprintf("%s/1/1.log", suite.testDir), fmt.Sprintf("%s/link.log", dir)))
+
+	files := fileProvider.FilesToTail([]*config.LogSource{source})
+	suite.Equal(3, len(files))
+	suite.Equal(fmt.Sprintf("%s/link.log", dir), files[0].Path)
+	suite.Equal(fmt.Sprintf("%s/2020-10-02", dir), files[1].Path)
+	suite.Equal(fmt.Sprintf("%s/2020-10-01.log", dir), files[2].Path)
+	for _, file := range files {
+		suite.True(file.IsWildcardPath)
+	}
+
+	// the files created later on are tailed too
+	f, err := os.Create(fmt.Sprintf("%s/2020-10-03.log", dir))
+	suite.Nil(err)
+	suite.Nil(f.Close())
+	suite.Equal([]*File{NewFile(f.Name(), source, true)}, fileProvider.FilesForPath(f.Name(), []*config.LogSource{source}))
+	suite.Empty(fileProvider.FilesForPath(fmt.Sprintf("%s/2020-09-30.log.gz", dir), []*config.LogSource{source}))
+	suite.Empty(fileProvider.FilesForPath(fmt.Sprintf("%s/subdirectory", dir), []*config.LogSource{source}))
+	suite.Empty(fileProvider.FilesForPath(fmt.Sprintf("%s/subdirectory/nested.log", dir), []*config.LogSource{source}))
+}
+
+func (suite *ProviderTestSuite) TestFilesForPath() {
+	path := fmt.Sprintf("%s/1/1.log", suite.testDir)
+	sources := []*config.LogSource{
+		config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path}),
+		config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: fmt.Sprintf("%s/1/*.log", suite.testDir)}),
+		config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: fmt.Sprintf("%s/*/*.log", suite.testDir), ExcludePaths: []string{path}}),
+		config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: fmt.Sprintf("%s/2/*.log", suite.testDir)}),
+	}
+	fileProvider := NewProvider(suite.filesLimit)
+
+	files := fileProvider.FilesForPath(path, sources)
+	suite.Equal(2, len(files))
+	suite.Equal(sources[0], files[0].Source)
+	suite.False(files[0].IsWildcardPath)
+	suite.Equal(sources[1], files[1].Source)
+	suite.True(files[1].IsWildcardPath)
+
+	files = fileProvider.FilesForPath(fmt.Sprintf("%s/1/4.log", suite.testDir), sources)
+	suite.Equal(0, len(files))
+}
+
+func (suite *ProviderTestSuite) TestStatsAreFreshForEachScan() {
+	path := fmt.Sprintf("%s/1/new.log", suite.testDir)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path})
+	fileProvider := NewProvider(suite.filesLimit)
+
+	// the stats are cached during a scan
+	suite.Empty(fileProvider.FilesToTail([]*config.LogSource{source}))
+	suite.False(fileProvider.exists(path))
+	suite.Equal(1, fileProvider.stats.Len())
+
+	// but not from one scan to the next
+	f, err := os.Create(path)
+	suite.Nil(err)
+	suite.Nil(f.Close())
+	suite.Equal(1, len(fileProvider.FilesToTail([]*config.LogSource{source})))
+
+	// the paths reported as changed are stated again
+	suite.Nil(os.Remove(path))
+	suite.Empty(fileProvider.FilesForPath(path, []*config.LogSource{source}))
+}
+
 func TestProviderTestSuite(t *testing.T) {
 	suite.Run(t, new(ProviderTestSuite))
 }
+
+func (suite *ProviderTestSuite) TestFileIsTailingFromEnd() {
+	path := fmt.Sprintf("%s/1/1.log", suite.testDir)
+	for _, test := range []struct {
+		tailingMode string
+		identifier  string
+		fromEnd     bool
+	}{
+		{"", "", true},
+		{"end", "", true},
+		{"forceEnd", "", true},
+		{"beginning", "", false},
+		{"forceBeginning", "", false},
+		// the files of the sources generated by a service discovery are tailed from the beginning
+		{"end", "123456789", false},
+	} {
+		source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, TailingMode: test.tailingMode, Identifier: test.identifier})
+		suite.Equal(test.fromEnd, NewFile(path, source, false).IsTailingFromEnd(), "tailing mode %q", test.tailingMode)
+	}
+}
+
+func (suite *ProviderTestSuite) TestScanKeyIgnoresTailingMode() {
+	path := fmt.Sprintf("%s/1/1.log", suite.testDir)
+	fromBeginning := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, TailingMode: "beginning"})
+	fromEnd := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, TailingMode: "end"})
+
+	// the offset of the file is recorded by path, the file must be tailed once
+	suite.Equal(NewFile(path, fromBeginning, false).GetScanKey(), NewFile(path, fromEnd, false).GetScanKey())
+}
+
+func (suite *ProviderTestSuite) TestScanKeyIncludesProcessingRules() {
+	path := fmt.Sprintf("%s/1/1.log", suite.testDir)
+	newFile := func(format string, rules ...*config.ProcessingRule) *File {
+		return NewFile(path, config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, Format: format, ProcessingRules: rules}), false)
+	}
+	multiLine := &config.ProcessingRule{Type: config.MultiLine, Name: "new_line", Pattern: `\d{4}-\d{2}-\d{2}`}
+	exclude := &config.ProcessingRule{Type: config.ExcludeAtMatch, Name: "exclude_debug", Pattern: "DEBUG"}
+
+	// the key of a file without processing rules is its path
+	suite.Equal(path, newFile("").GetScanKey())
+
+	suite.NotEqual(newFile("", multiLine).GetScanKey(), newFile("", exclude).GetScanKey())
+	suite.NotEqual(newFile("", multiLine).GetScanKey(), newFile("", multiLine, exclude).GetScanKey())
+	suite.NotEqual(newFile("").GetScanKey(), newFile("journal-export").GetScanKey())
+	suite.Equal(newFile("", multiLine, exclude).GetScanKey(), newFile("", multiLine, exclude).GetScanKey())
+}
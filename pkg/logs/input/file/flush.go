@@ -0,0 +1,114 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+const (
+	// flushPollInterval is how often Flush checks whether the tailers caught up with the end of their files
+	flushPollInterval = 10 * time.Millisecond
+	// flushChunkSize is the size of the chunks read backwards to find the end of the last complete line of a file
+	flushChunkSize = 4096
+)
+
+// Flush makes all the tailers read their files up to their current end and returns once all the complete lines
+// read have been sent to the pipeline, the tailers keep running. A trailing line without its line ending is not
+// waited for, the lines held by a multi-line aggregation are waited for until the aggregation completes.
+// The streams and the files read on change are only woken up as they have no end to wait for.
+// It returns the error of the context when the context is done before all the lines are sent.
+func (s *Scanner) Flush(ctx context.Context) error {
+	s.lock.Lock()
+	targets := make(map[*Tailer]int64, len(s.tailers))
+	for _, tailer := range s.tailers {
+		tailer.notify()
+		if tailer.isStream() || tailer.isFullRead() {
+			continue
+		}
+		target, err := tailer.flushTarget()
+		if err != nil {
+			log.Debugf("Could not find the end of %s to flush it: %v", tailer.file.Path, err)
+			continue
+		}
+		targets[tailer] = target
+	}
+	// the lock is released while waiting so that the scan keeps running
+	s.lock.Unlock()
+
+	ticker := time.NewTicker(flushPollInterval)
+	defer ticker.Stop()
+	for {
+		for tailer, target := range targets {
+			if tailer.getForwardedOffset() >= target || atomic.LoadInt32(&tailer.shouldStop) != 0 {
+				delete(targets, tailer)
+				continue
+			}
+			tailer.notify()
+		}
+		if len(targets) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// flushTarget returns the offset of the end of the last complete line of the file, the tailer
+// is flushed once it forwarded everything up to this offset
+func (t *Tailer) flushTarget() (int64, error) {
+	f, err := openFile(t.fullpath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	separator := []byte{'\n'}
+	if t.file.Source.Config.Format == config.JournalExportFormat {
+		// the journal entries are separated by an empty line
+		separator = []byte("\n\n")
+	}
+	return lastSeparatorEnd(f, t.getForwardedOffset(), info.Size(), separator)
+}
+
+// lastSeparatorEnd returns the offset following the last separator between from and size,
+// or from when there is none
+func lastSeparatorEnd(r io.ReaderAt, from, size int64, separator []byte) (int64, error) {
+	buf := make([]byte, flushChunkSize+len(separator)-1)
+	for end := size; end > from; {
+		start := end - flushChunkSize
+		if start < from {
+			start = from
+		}
+		// the chunk overlaps the next one so that a separator spanning both is found
+		stop := end + int64(len(separator)-1)
+		if stop > size {
+			stop = size
+		}
+		n, err := r.ReadAt(buf[:stop-start], start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := bytes.LastIndex(buf[:n], separator); i >= 0 {
+			return start + int64(i+len(separator)), nil
+		}
+		end = start
+	}
+	return from, nil
+}
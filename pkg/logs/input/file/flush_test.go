@@ -0,0 +1,37 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLastSeparatorEnd(t *testing.T) {
+	lastEnd := func(content string, from int64, separator string) int64 {
+		end, err := lastSeparatorEnd(strings.NewReader(content), from, int64(len(content)), []byte(separator))
+		assert.Nil(t, err)
+		return end
+	}
+
+	assert.Equal(t, int64(12), lastEnd("hello\nworld\n", 0, "\n"))
+	assert.Equal(t, int64(6), lastEnd("hello\nwor", 0, "\n"))
+	assert.Equal(t, int64(0), lastEnd("hello", 0, "\n"))
+	assert.Equal(t, int64(0), lastEnd("", 0, "\n"))
+
+	// the content before from is not searched
+	assert.Equal(t, int64(8), lastEnd("hello\nwor", 8, "\n"))
+
+	// a separator spanning two chunks is found
+	content := strings.Repeat("a", flushChunkSize*2-1) + "\n\n" + strings.Repeat("b", flushChunkSize-1)
+	assert.Equal(t, int64(flushChunkSize*2+1), lastEnd(content, 0, "\n\n"))
+	content = string(bytes.Repeat([]byte("a"), flushChunkSize*3)) + "\n"
+	assert.Equal(t, int64(flushChunkSize*3+1), lastEnd(content, 0, "\n"))
+	assert.Equal(t, int64(0), lastEnd(strings.Repeat("a\n", flushChunkSize)[1:], 0, "\n\n"))
+}
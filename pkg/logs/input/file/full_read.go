@@ -0,0 +1,149 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"bytes"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	coreConfig "github.com/DataDog/datadog-agent/pkg/config"
+	"github.com/DataDog/datadog-agent/pkg/logs/decoder"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// fullReadState is the state of a tailer re-reading its whole file each time it changes,
+// for the small files that are rewritten in place instead of being appended to.
+type fullReadState struct {
+	// maxSize is the size above which the file is not read anymore
+	maxSize int64
+	modTime time.Time
+	size    int64
+	// checksum is the hash of the whole content, lines counts the lines of the content by hash
+	checksum uint64
+	lines    map[uint64]int
+}
+
+// newFullReadState returns the state of a file that has not been read yet
+func newFullReadState() *fullReadState {
+	return &fullReadState{
+		maxSize: coreConfig.Datadog.GetInt64("logs_config.full_read_max_file_size"),
+		lines:   make(map[uint64]int),
+	}
+}
+
+// isFullRead returns true if the tailer re-reads its whole file each time it changes instead of tailing it
+func (t *Tailer) isFullRead() bool {
+	return t.file.Source.Config.FullReadOnChange
+}
+
+// setupFullRead reads the current content of the file, it is only sent when the file is tailed from the
+// beginning, otherwise only the lines added or changed later on are sent. The offsets are not tracked.
+func (t *Tailer) setupFullRead(offset int64, whence int) error {
+	if _, err := os.Stat(t.fullpath); err != nil {
+		return err
+	}
+	t.fullRead = newFullReadState()
+	t.readOffset = 0
+	t.decodedOffset = 0
+	if offset == 0 && whence == io.SeekStart {
+		return nil
+	}
+	if _, err := t.readFullFile(false); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readFullFile reads the whole file when its modification time or its size changed since the last read,
+// and sends the lines that were not in the previous content, when send is true. It returns the number
+// of bytes sent.
+func (t *Tailer) readFullFile(send bool) (int, error) {
+	state := t.fullRead
+	info, err := os.Stat(t.fullpath)
+	if err != nil {
+		// the file may be in the middle of a rewrite, it's read again once it's back
+		log.Debugf("Could not stat %s: %v", t.file.Path, err)
+		return 0, nil
+	}
+	if info.ModTime().Equal(state.modTime) && info.Size() == state.size {
+		return 0, nil
+	}
+	state.modTime = info.ModTime()
+	state.size = info.Size()
+	if state.maxSize > 0 && info.Size() > state.maxSize {
+		log.Warnf("%s is too big to be read on change (%d bytes, the maximum is %d), its changes are ignored", t.file.Path, info.Size(), state.maxSize)
+		return 0, nil
+	}
+
+	f, err := openFile(t.fullpath)
+	if err != nil {
+		log.Debugf("Could not open %s: %v", t.file.Path, err)
+		return 0, nil
+	}
+	content, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.file.Source.Status.Error(err)
+		return 0, log.Error("Unexpected error occurred while reading file: ", err)
+	}
+
+	if len(content) == 0 {
+		// the file is being rewritten, its previous content is kept to compare it with the new one
+		return 0, nil
+	}
+	changed := state.update(content)
+	if !send || len(changed) == 0 {
+		return 0, nil
+	}
+	t.decoder.InputChan <- decoder.NewInput(changed)
+	return len(changed), nil
+}
+
+// update records the new content of the file and returns its lines that were not in the previous content,
+// with their new lines. A line repeated in the new content is only returned for the repeats the previous
+// content doesn't have.
+func (s *fullReadState) update(content []byte) []byte {
+	checksum := hashBytes(content)
+	if checksum == s.checksum {
+		return nil
+	}
+	s.checksum = checksum
+
+	previous := s.lines
+	s.lines = make(map[uint64]int)
+	var changed []byte
+	for len(content) > 0 {
+		line := content
+		if end := bytes.IndexByte(content, '\n'); end >= 0 {
+			line, content = content[:end], content[end+1:]
+		} else {
+			content = nil
+		}
+		if len(line) == 0 {
+			continue
+		}
+		hash := hashBytes(line)
+		s.lines[hash]++
+		if previous[hash] > 0 {
+			previous[hash]--
+			continue
+		}
+		changed = append(changed, line...)
+		changed = append(changed, '\n')
+	}
+	return changed
+}
+
+// hashBytes returns the 64-bit FNV-1a hash of data
+func hashBytes(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data) //nolint:errcheck
+	return h.Sum64()
+}
@@ -0,0 +1,27 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFullReadStateUpdate(t *testing.T) {
+	state := newFullReadState()
+	assert.Equal(t, "first\nsecond\n", string(state.update([]byte("first\nsecond\n"))))
+
+	// the same content has no changes
+	assert.Nil(t, state.update([]byte("first\nsecond\n")))
+
+	// only the new and changed lines are returned, in the order of the file
+	assert.Equal(t, "third\nfourth\n", string(state.update([]byte("third\nfirst\nfourth"))))
+
+	// the repeats of a line are returned when the previous content has less of them
+	assert.Equal(t, "first\n", string(state.update([]byte("third\nfirst\nfirst\nfourth\n"))))
+	assert.Nil(t, state.update([]byte("first\n\nthird\n")))
+}
@@ -0,0 +1,111 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// idleClosedInfoKey is the prefix of the keys of the source info listing the files closed because they are idle
+const idleClosedInfoKey = "idle_closed"
+
+// closeIfIdle closes the file when no new data was read from it during the idle close timeout of its source,
+// to free its file descriptor on the hosts with many mostly idle files. The tailer keeps its offset and reopens
+// the file once it grows. It is only called by the reading goroutine.
+func (t *Tailer) closeIfIdle() {
+	if t.idleCloseTimeout <= 0 || t.isStream() || t.isIdleClosed() || atomic.LoadInt32(&t.didFileRotate) == 1 {
+		// the rotated files are kept open to finish reading them, they can't be reopened by path
+		return
+	}
+	if time.Since(t.lastReadAt) < t.idleCloseTimeout {
+		return
+	}
+	info, err := t.osFile.Stat()
+	if err != nil {
+		return
+	}
+	t.fileLock.Lock()
+	t.osFile.Close()
+	t.osFile = nil
+	t.closedInfo = info
+	t.fileLock.Unlock()
+	atomic.StoreInt32(&t.idleClosed, 1)
+
+	log.Debugf("Closing %s, no new data since %s", t.file.Path, t.idleCloseTimeout)
+	t.file.Source.UpdateInfo(t.idleClosedInfoKey(), fmt.Sprintf("Idle closed: %s, no new data since %s, offset %d", t.file.Path, t.idleCloseTimeout, t.GetReadOffset()))
+}
+
+// reopenIfGrown reopens the idle closed file at its offset when it grew, it returns false while the file stays
+// closed. A file replaced or truncated in the meantime stays closed, the scanner detects the rotation and
+// replaces the tailer. It is only called by the reading goroutine.
+func (t *Tailer) reopenIfGrown() bool {
+	offset := t.GetReadOffset()
+	info, err := os.Stat(t.fullpath)
+	if err != nil || !os.SameFile(info, t.closedInfo) || info.Size() <= offset {
+		return false
+	}
+	f, err := openFile(t.fullpath)
+	if err != nil {
+		log.Debugf("Could not reopen %s: %v", t.file.Path, err)
+		return false
+	}
+	if info, err = f.Stat(); err != nil || !os.SameFile(info, t.closedInfo) {
+		f.Close()
+		return false
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return false
+	}
+	t.fileLock.Lock()
+	t.osFile = f
+	t.closedInfo = nil
+	t.fileLock.Unlock()
+	atomic.StoreInt32(&t.idleClosed, 0)
+	t.lastReadAt = time.Now()
+
+	log.Debugf("Reopening %s at offset %d", t.file.Path, offset)
+	t.file.Source.RemoveInfo(t.idleClosedInfoKey())
+	return true
+}
+
+// isIdleClosed returns true if the file is closed because it is idle
+func (t *Tailer) isIdleClosed() bool {
+	return atomic.LoadInt32(&t.idleClosed) == 1
+}
+
+// idleClosedInfoKey returns the key of the source info telling that the file of the tailer is idle closed
+func (t *Tailer) idleClosedInfoKey() string {
+	return fmt.Sprintf("%s:%s", idleClosedInfoKey, t.file.GetScanKey())
+}
+
+// didRotate returns true if the file of the tailer has been rotated. While the file is idle closed,
+// it is rotated when the path leads to another file or when the file is smaller than the offset read.
+func (t *Tailer) didRotate() (bool, error) {
+	t.fileLock.Lock()
+	defer t.fileLock.Unlock()
+	if t.closedInfo == nil {
+		return DidRotate(t.osFile, t.GetReadOffset())
+	}
+	info, err := os.Stat(t.fullpath)
+	if err != nil {
+		return false, err
+	}
+	return !os.SameFile(info, t.closedInfo) || info.Size() < t.GetReadOffset(), nil
+}
+
+// getOSFile returns the file read by the tailer, nil while it is idle closed
+func (t *Tailer) getOSFile() *os.File {
+	t.fileLock.Lock()
+	defer t.fileLock.Unlock()
+	return t.osFile
+}
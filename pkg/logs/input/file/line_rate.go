@@ -0,0 +1,145 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+	"github.com/DataDog/datadog-agent/pkg/logs/metrics"
+)
+
+// lineRateInfoKey is the key of the source info holding its share of the global line rate limit
+const lineRateInfoKey = "line_rate_share"
+
+// lineRateLimiter caps the number of lines per second sent by all the tailers of the scanner. While the global limit
+// is not reached, any source can send as many lines as it reads. Once it's reached, each source gets a share of the
+// limit proportional to its rate_weight, so that a busy source can't starve the others. The tailers waiting for
+// their share stop forwarding lines, which makes them stop reading their files until they can send again.
+type lineRateLimiter struct {
+	limit  rate.Limit
+	burst  int
+	global *rate.Limiter
+	lock   sync.Mutex
+	shares map[*config.LogSource]*lineRateShare
+	// lastReport is the time of the last report, it's only used by the scanner
+	lastReport time.Time
+}
+
+// lineRateShare is the share of the global limit of a source
+type lineRateShare struct {
+	weight  float64
+	limiter *rate.Limiter
+	// lines counts the lines sent since the last report
+	lines int64
+}
+
+// newLineRateLimiter returns a limiter of linesPerSecond lines per second shared by all the sources,
+// it returns nil when linesPerSecond is 0 or less, which disables the limit
+func newLineRateLimiter(linesPerSecond int) *lineRateLimiter {
+	if linesPerSecond <= 0 {
+		return nil
+	}
+	return &lineRateLimiter{
+		limit:      rate.Limit(linesPerSecond),
+		burst:      linesPerSecond,
+		global:     rate.NewLimiter(rate.Limit(linesPerSecond), linesPerSecond),
+		shares:     make(map[*config.LogSource]*lineRateShare),
+		lastReport: time.Now(),
+	}
+}
+
+// wait blocks until the source is allowed to send a line or the context is done
+func (l *lineRateLimiter) wait(ctx context.Context, source *config.LogSource) error {
+	if l == nil {
+		return nil
+	}
+	share := l.share(source)
+	if !l.global.Allow() {
+		// the limit is reached, the source waits for its share of the limit before competing for the global one
+		if err := share.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		if err := l.global.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	atomic.AddInt64(&share.lines, 1)
+	return nil
+}
+
+// share returns the share of the source, the shares of all the sources are updated when a new source sends lines
+func (l *lineRateLimiter) share(source *config.LogSource) *lineRateShare {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	share, exists := l.shares[source]
+	if exists {
+		return share
+	}
+	weight := source.Config.RateWeight
+	if weight <= 0 {
+		weight = 1
+	}
+	share = &lineRateShare{
+		weight:  weight,
+		limiter: rate.NewLimiter(l.limit, l.burst),
+	}
+	l.shares[source] = share
+	l.rebalance()
+	return share
+}
+
+// rebalance splits the limit between the sources according to their weights, it must be called with the lock held
+func (l *lineRateLimiter) rebalance() {
+	var total float64
+	for _, share := range l.shares {
+		total += share.weight
+	}
+	for _, share := range l.shares {
+		share.limiter.SetLimit(l.limit * rate.Limit(share.weight/total))
+	}
+}
+
+// report updates the line rate metric and the status of the sources with their share of the limit and their rate
+// since the last report. The sources that sent no lines are not given a share of the limit anymore.
+func (l *lineRateLimiter) report(now time.Time) {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	elapsed := now.Sub(l.lastReport).Seconds()
+	l.lastReport = now
+	if elapsed <= 0 {
+		return
+	}
+	var total float64
+	for _, share := range l.shares {
+		total += share.weight
+	}
+	var lines int64
+	for source, share := range l.shares {
+		sent := atomic.SwapInt64(&share.lines, 0)
+		if sent == 0 {
+			delete(l.shares, source)
+			source.RemoveInfo(lineRateInfoKey)
+			continue
+		}
+		lines += sent
+		source.UpdateInfo(lineRateInfoKey, fmt.Sprintf("Line rate: %.1f lines/s, share of the limit: %.0f%% of %d lines/s (weight %g)", float64(sent)/elapsed, 100*share.weight/total, l.burst, share.weight))
+	}
+	l.rebalance()
+	linesPerSecond := float64(lines) / elapsed
+	metrics.FileLinesPerSecond.Set(int64(linesPerSecond))
+	metrics.TlmFileLinesPerSecond.Set(linesPerSecond)
+}
@@ -0,0 +1,78 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+	"github.com/DataDog/datadog-agent/pkg/logs/metrics"
+)
+
+func TestLineRateLimiterDisabled(t *testing.T) {
+	limiter := newLineRateLimiter(0)
+	assert.Nil(t, limiter)
+	assert.Nil(t, limiter.wait(context.Background(), config.NewLogSource("", &config.LogsConfig{})))
+	limiter.report(time.Now())
+}
+
+func TestLineRateLimiterWaitsOnceTheLimitIsReached(t *testing.T) {
+	limiter := newLineRateLimiter(10)
+	source := config.NewLogSource("", &config.LogsConfig{})
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, limiter.wait(context.Background(), source))
+	}
+	// the next line has to wait for the limit to refill
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.NotNil(t, limiter.wait(ctx, source))
+}
+
+func TestLineRateLimiterShares(t *testing.T) {
+	limiter := newLineRateLimiter(100)
+	light := config.NewLogSource("light", &config.LogsConfig{})
+	heavy := config.NewLogSource("heavy", &config.LogsConfig{RateWeight: 3})
+
+	assert.Nil(t, limiter.wait(context.Background(), light))
+	assert.Equal(t, rate.Limit(100), limiter.shares[light].limiter.Limit())
+	assert.Nil(t, limiter.wait(context.Background(), heavy))
+	assert.Equal(t, rate.Limit(25), limiter.shares[light].limiter.Limit())
+	assert.Equal(t, rate.Limit(75), limiter.shares[heavy].limiter.Limit())
+}
+
+func TestLineRateLimiterReport(t *testing.T) {
+	defer metrics.FileLinesPerSecond.Set(0)
+	limiter := newLineRateLimiter(100)
+	light := config.NewLogSource("light", &config.LogsConfig{})
+	heavy := config.NewLogSource("heavy", &config.LogsConfig{RateWeight: 3})
+
+	now := time.Now()
+	limiter.lastReport = now
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, limiter.wait(context.Background(), light))
+	}
+	for i := 0; i < 15; i++ {
+		assert.Nil(t, limiter.wait(context.Background(), heavy))
+	}
+	limiter.report(now.Add(time.Second))
+	assert.Equal(t, int64(20), metrics.FileLinesPerSecond.Value())
+	assert.Contains(t, light.GetInfo(), "Line rate: 5.0 lines/s, share of the limit: 25% of 100 lines/s (weight 1)")
+	assert.Contains(t, heavy.GetInfo(), "Line rate: 15.0 lines/s, share of the limit: 75% of 100 lines/s (weight 3)")
+
+	// the idle sources don't keep a share of the limit
+	assert.Nil(t, limiter.wait(context.Background(), heavy))
+	limiter.report(now.Add(2 * time.Second))
+	assert.Equal(t, int64(1), metrics.FileLinesPerSecond.Value())
+	assert.NotContains(t, limiter.shares, light)
+	assert.Empty(t, light.GetInfo())
+	assert.Equal(t, rate.Limit(100), limiter.shares[heavy].limiter.Limit())
+}
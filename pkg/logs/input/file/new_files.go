@@ -0,0 +1,72 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"fmt"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+)
+
+// oldFilesInfoKey is the key of the source info holding the number of its files skipped because they are older
+// than the scanner
+const oldFilesInfoKey = "old_files"
+
+// skipOldFiles removes from the files to tail the files of the sources following only new files that were last
+// modified before the scanner started, they are skipped until they are written. The size of each skipped file is
+// recorded so that its tailer starts after the content it had when it was skipped. The number of files skipped
+// is shown in the status of each of the sources.
+func (s *Scanner) skipOldFiles(sources []*config.LogSource, files []*File) []*File {
+	counts := make(map[*config.LogSource]int)
+	filtered := files[:0]
+	for _, file := range files {
+		if !s.shouldCheckAge(file) {
+			filtered = append(filtered, file)
+			continue
+		}
+		info, err := s.fileProvider.stats.Stat(file.Path)
+		if err != nil || info.ModTime().After(s.startTime) {
+			// the files that can't be stat are left to the tailers to report
+			filtered = append(filtered, file)
+			continue
+		}
+		s.oldFiles[file.GetScanKey()] = info.Size()
+		counts[file.Source]++
+	}
+	for _, source := range sources {
+		if counts[source] == 0 {
+			source.RemoveInfo(oldFilesInfoKey)
+			continue
+		}
+		source.UpdateInfo(oldFilesInfoKey, fmt.Sprintf("Only new files: %d files last modified before the agent started are not tailed until they are written", counts[source]))
+	}
+	return filtered
+}
+
+// shouldCheckAge returns true if the file must be skipped when it was last modified before the scanner started
+func (s *Scanner) shouldCheckAge(file *File) bool {
+	if _, isTailed := s.tailers[file.GetScanKey()]; isTailed {
+		return false
+	}
+	// the modification time of a stream doesn't tell whether it has new content
+	return file.Source.Config.OnlyNewFiles && !file.Source.Config.Stream
+}
+
+// expireOldFiles forgets the skipped files that are not matched anymore
+func (s *Scanner) expireOldFiles(files []*File) {
+	if len(s.oldFiles) == 0 {
+		return
+	}
+	matched := make(map[string]bool, len(files))
+	for _, file := range files {
+		matched[file.GetScanKey()] = true
+	}
+	for key := range s.oldFiles {
+		if !matched[key] {
+			delete(s.oldFiles, key)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+	"github.com/DataDog/datadog-agent/pkg/logs/status"
+)
+
+const (
+	// openRetries is the number of times the tailer of a newly matched file is started again between two scans
+	// when its file can't be opened, the first retry happens after openRetryBackoff, which doubles each time
+	openRetries      = 3
+	openRetryBackoff = 20 * time.Millisecond
+	// pendingOpenWarningScans is the number of scans a file can fail to open before a warning is shown in the status
+	pendingOpenWarningScans = 3
+)
+
+// pendingOpenWarningType is the prefix of the keys of the warnings about the files that can't be opened
+const pendingOpenWarningType = "pending_open_warning"
+
+// pendingOpen is a file matched by a source that could not be opened yet
+type pendingOpen struct {
+	file *File
+	// retries is the number of retries scheduled between the scans, retryAt is the time of the next one,
+	// it's zero when there is none, and retrying is set while it runs
+	retries  int
+	retryAt  time.Time
+	retrying bool
+	// failures is the number of scans during which the file failed to open
+	failures int
+}
+
+// startTailer starts the tailer of a newly matched file. A file can be matched before it can be opened,
+// e.g. when it's created then its permissions are set, so the start is retried a few times with a short
+// backoff by the run loop, without holding the lock of the scanner while waiting. The files that keep
+// failing are tried once per scan and reported in the status once they failed for pendingOpenWarningScans scans.
+func (s *Scanner) startTailer(tailer *Tailer, offset int64, whence int) error {
+	key := tailer.file.GetScanKey()
+	pending, isPending := s.pendingOpens[key]
+
+	err := tailer.Start(offset, whence)
+	if err == nil {
+		if isPending {
+			delete(s.pendingOpens, key)
+			status.RemoveGlobalWarning(pendingOpenWarningKey(key))
+		}
+		return nil
+	}
+	if !isPending {
+		pending = &pendingOpen{file: tailer.file}
+		s.pendingOpens[key] = pending
+	}
+	if !isPending || pending.retrying {
+		s.scheduleOpenRetry(pending)
+	}
+	if pending.retrying {
+		// the retries between the scans are not failed scans
+		return err
+	}
+	pending.failures++
+	if pending.failures >= pendingOpenWarningScans {
+		status.AddGlobalWarning(pendingOpenWarningKey(key), fmt.Sprintf("%s could not be opened during the last %d scans: %v", pending.file.Path, pending.failures, err))
+	}
+	return err
+}
+
+// scheduleOpenRetry schedules the next retry of the pending file until openRetries is reached
+func (s *Scanner) scheduleOpenRetry(pending *pendingOpen) {
+	if pending.retries >= openRetries {
+		pending.retryAt = time.Time{}
+		return
+	}
+	delay := openRetryBackoff << uint(pending.retries)
+	pending.retries++
+	pending.retryAt = time.Now().Add(delay)
+	time.AfterFunc(delay, func() {
+		select {
+		case s.openRetry <- struct{}{}:
+		default:
+			// a retry is already requested
+		}
+	})
+}
+
+// retryPendingOpens starts the tailers of the pending files whose retry is due
+func (s *Scanner) retryPendingOpens(now time.Time) {
+	for _, pending := range s.pendingOpens {
+		if pending.retryAt.IsZero() || pending.retryAt.After(now) {
+			continue
+		}
+		pending.retryAt = time.Time{}
+		file := pending.file
+		if _, isTailed := s.tailers[file.GetScanKey()]; isTailed || s.isPaused(file) || !s.isActive(file.Source) || len(s.tailers) >= s.tailingLimit {
+			continue
+		}
+		pending.retrying = true
+		s.startNewTailer(file, file.tailingMode())
+		pending.retrying = false
+	}
+}
+
+// isActive returns true if the source has not been removed
+func (s *Scanner) isActive(source *config.LogSource) bool {
+	for _, active := range s.activeSources {
+		if active == source {
+			return true
+		}
+	}
+	return false
+}
+
+// expirePendingOpens forgets the pending files that are not matched anymore
+func (s *Scanner) expirePendingOpens(files []*File) {
+	if len(s.pendingOpens) == 0 {
+		return
+	}
+	matched := make(map[string]bool, len(files))
+	for _, file := range files {
+		matched[file.GetScanKey()] = true
+	}
+	for key := range s.pendingOpens {
+		if !matched[key] {
+			delete(s.pendingOpens, key)
+			status.RemoveGlobalWarning(pendingOpenWarningKey(key))
+		}
+	}
+}
+
+// pendingOpenWarningKey returns the key of the warning about the file that can't be opened
+func pendingOpenWarningKey(key string) string {
+	return fmt.Sprintf("%s:%s", pendingOpenWarningType, key)
+}
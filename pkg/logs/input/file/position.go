@@ -6,6 +6,7 @@
 package file
 
 import (
+	"fmt"
 	"io"
 	"strconv"
 
@@ -15,8 +16,16 @@ import (
 
 // Position returns the position from where logs should be collected.
 func Position(registry auditor.Registry, identifier string, mode config.TailingMode) (int64, int, error) {
+	offset, whence, _, err := positionWithReason(registry, identifier, mode)
+	return offset, whence, err
+}
+
+// positionWithReason returns the position from where logs should be collected
+// along with a description of the decision that led to it.
+func positionWithReason(registry auditor.Registry, identifier string, mode config.TailingMode) (int64, int, string, error) {
 	var offset int64
 	var whence int
+	var reason string
 	var err error
 
 	value := registry.GetOffset(identifier)
@@ -24,12 +33,15 @@ func Position(registry auditor.Registry, identifier string, mode config.TailingM
 	switch {
 	case mode == config.ForceBeginning:
 		offset, whence = 0, io.SeekStart
+		reason = fmt.Sprintf("tailing mode %s, the registry is ignored", mode)
 	case mode == config.ForceEnd:
 		offset, whence = 0, io.SeekEnd
+		reason = fmt.Sprintf("tailing mode %s, the registry is ignored", mode)
 	case value != "":
 		// an offset was registered, tailing mode is not forced, tail from the offset
 		whence = io.SeekStart
 		offset, err = strconv.ParseInt(value, 10, 64)
+		reason = fmt.Sprintf("registry entry at offset %d", offset)
 		if err != nil {
 			offset = 0
 			if mode == config.End {
@@ -37,13 +49,16 @@ func Position(registry auditor.Registry, identifier string, mode config.TailingM
 			} else if mode == config.Beginning {
 				whence = io.SeekStart
 			}
+			reason = fmt.Sprintf("invalid registry entry %q, tailing mode %s", value, mode)
 		}
 	case mode == config.Beginning:
 		offset, whence = 0, io.SeekStart
+		reason = fmt.Sprintf("no registry entry, tailing mode %s", mode)
 	case mode == config.End:
 		fallthrough
 	default:
 		offset, whence = 0, io.SeekEnd
+		reason = fmt.Sprintf("no registry entry, tailing mode %s", config.TailingMode(config.End))
 	}
-	return offset, whence, err
+	return offset, whence, reason, err
 }
@@ -68,3 +68,24 @@ func TestPosition(t *testing.T) {
 	assert.Equal(t, int64(0), offset)
 	assert.Equal(t, io.SeekEnd, whence)
 }
+
+func TestPositionReason(t *testing.T) {
+	registry := mock.NewRegistry()
+
+	for _, tc := range []struct {
+		offset string
+		mode   config.TailingMode
+		reason string
+	}{
+		{"", config.End, "no registry entry, tailing mode end"},
+		{"", config.Beginning, "no registry entry, tailing mode beginning"},
+		{"123", config.End, "registry entry at offset 123"},
+		{"123", config.ForceBeginning, "tailing mode forceBeginning, the registry is ignored"},
+		{"123", config.ForceEnd, "tailing mode forceEnd, the registry is ignored"},
+		{"foo", config.Beginning, `invalid registry entry "foo", tailing mode beginning`},
+	} {
+		registry.SetOffset(tc.offset)
+		_, _, reason, _ := positionWithReason(registry, "", tc.mode)
+		assert.Equal(t, tc.reason, reason)
+	}
+}
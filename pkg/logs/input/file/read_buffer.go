@@ -0,0 +1,143 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/metrics"
+)
+
+const (
+	// defaultReadBufferSize is the size of the read buffers when there is no memory budget
+	defaultReadBufferSize = 4096
+	// minReadBufferSize and maxReadBufferSize bound the size of the read buffers, it's
+	// a power of two between them
+	minReadBufferSize = 512
+	maxReadBufferSize = 64 * 1024
+)
+
+// readBufferClasses is the number of buffer sizes, one per power of two from minReadBufferSize to maxReadBufferSize
+const readBufferClasses = 8
+
+// readBufferPool hands out the buffers the tailers read their files into. The size of the buffers is the memory
+// budget shared by all the tailers divided by their number: the buffers shrink when many files are tailed and grow
+// when few are. A buffer is only held while its content is decoded, then it goes back to the pool of its size,
+// so the read loops of the tailers don't allocate a new buffer for each read.
+// The budget is a cap: the buffers handed out shrink to fit in what is left of it, and the tailers wait for a
+// buffer to be released when even the smallest one does not fit.
+type readBufferPool struct {
+	budget  int64
+	tailers int64
+	// inUse is the memory held by the buffers handed out and not released yet, it is protected by mu
+	// and released is signaled each time a buffer is handed back
+	mu       sync.Mutex
+	released *sync.Cond
+	inUse    int64
+	pools    [readBufferClasses]sync.Pool
+}
+
+// newReadBufferPool returns a new pool sharing budget bytes between the tailers, 0 disables the budget
+func newReadBufferPool(budget int64) *readBufferPool {
+	p := &readBufferPool{
+		budget: budget,
+	}
+	p.released = sync.NewCond(&p.mu)
+	return p
+}
+
+// setTailers sets the number of tailers sharing the budget, the new size applies to the next buffers handed out
+func (p *readBufferPool) setTailers(tailers int) {
+	if p == nil {
+		return
+	}
+	atomic.StoreInt64(&p.tailers, int64(tailers))
+}
+
+// bufferSize returns the size of the buffers handed out to the tailers
+func (p *readBufferPool) bufferSize() int {
+	if p.budget <= 0 {
+		return defaultReadBufferSize
+	}
+	tailers := atomic.LoadInt64(&p.tailers)
+	if tailers < 1 {
+		tailers = 1
+	}
+	size := minReadBufferSize
+	for size < maxReadBufferSize && int64(size*2)*tailers <= p.budget {
+		size *= 2
+	}
+	return size
+}
+
+// get returns a read buffer, it must be handed back with put once its content is not used anymore
+func (p *readBufferPool) get() []byte {
+	if p == nil {
+		return make([]byte, defaultReadBufferSize)
+	}
+	size := p.reserve(p.bufferSize())
+	buf, ok := p.pools[readBufferClass(size)].Get().([]byte)
+	if !ok {
+		buf = make([]byte, size)
+	}
+	return buf[:size]
+}
+
+// reserve records a buffer of at most size bytes as handed out and returns its size. With a budget, the size
+// shrinks to fit in what is left of the budget, and reserve waits for buffers to be released when even the
+// smallest buffer does not fit, unless no buffer is handed out so that a budget too small can't block the tailers.
+func (p *readBufferPool) reserve(size int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.budget > 0 {
+		available := p.budget - p.inUse
+		for size > minReadBufferSize && int64(size) > available {
+			size /= 2
+		}
+		if int64(size) <= available || p.inUse == 0 {
+			break
+		}
+		p.released.Wait()
+	}
+	p.track(int64(size))
+	return size
+}
+
+// put hands a buffer returned by get back to the pool
+func (p *readBufferPool) put(buf []byte) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.track(-int64(cap(buf)))
+	p.released.Broadcast()
+	p.mu.Unlock()
+	p.pools[readBufferClass(cap(buf))].Put(buf[:cap(buf)])
+}
+
+// track records the memory held by the buffers handed out, it must be called with mu held
+func (p *readBufferPool) track(delta int64) {
+	p.inUse += delta
+	metrics.ReadBufferBytes.Add(delta)
+	metrics.TlmReadBufferBytes.Add(float64(delta))
+}
+
+// memoryInUse returns the memory held by the buffers handed out and not released yet
+func (p *readBufferPool) memoryInUse() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.inUse
+}
+
+// readBufferClass returns the index of the pool of the buffers of the given size
+func readBufferClass(size int) int {
+	class := 0
+	for s := minReadBufferSize; s < size && class < readBufferClasses-1; s *= 2 {
+		class++
+	}
+	return class
+}
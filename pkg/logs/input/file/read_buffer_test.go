@@ -0,0 +1,86 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadBufferPoolSize(t *testing.T) {
+	pool := newReadBufferPool(1024 * 1024)
+
+	// few tailers get big buffers
+	pool.setTailers(1)
+	assert.Equal(t, maxReadBufferSize, pool.bufferSize())
+	pool.setTailers(64)
+	assert.Equal(t, 16*1024, pool.bufferSize())
+
+	// many tailers share the budget
+	pool.setTailers(256)
+	assert.Equal(t, 4096, pool.bufferSize())
+	pool.setTailers(100000)
+	assert.Equal(t, minReadBufferSize, pool.bufferSize())
+
+	// without budget the buffers keep the default size
+	assert.Equal(t, defaultReadBufferSize, newReadBufferPool(0).bufferSize())
+}
+
+func TestReadBufferPoolMemoryInUse(t *testing.T) {
+	pool := newReadBufferPool(1024 * 1024)
+	pool.setTailers(256)
+
+	first := pool.get()
+	second := pool.get()
+	assert.Len(t, first, 4096)
+	assert.Equal(t, int64(2*4096), pool.memoryInUse())
+
+	// the buffers handed out before a resize keep their size
+	pool.setTailers(1)
+	third := pool.get()
+	assert.Len(t, third, maxReadBufferSize)
+	assert.Equal(t, int64(2*4096+maxReadBufferSize), pool.memoryInUse())
+
+	// a released buffer can be reused even if only a part of it was used
+	pool.put(first[:10])
+	pool.put(second)
+	pool.put(third)
+	assert.Equal(t, int64(0), pool.memoryInUse())
+}
+
+func TestReadBufferPoolBudgetIsACap(t *testing.T) {
+	pool := newReadBufferPool(8192)
+	pool.setTailers(2)
+	first := pool.get()
+	assert.Len(t, first, 4096)
+
+	// the buffers shrink to fit in what is left of the budget
+	pool.setTailers(1)
+	second := pool.get()
+	assert.Len(t, second, 4096)
+	assert.Equal(t, int64(8192), pool.memoryInUse())
+
+	// when the budget is exhausted the tailers wait for a buffer to be released
+	third := make(chan []byte)
+	go func() { third <- pool.get() }()
+	select {
+	case <-third:
+		assert.Fail(t, "the budget should not be exceeded")
+	case <-time.After(50 * time.Millisecond):
+	}
+	pool.put(first)
+	assert.Len(t, <-third, 4096)
+	assert.Equal(t, int64(8192), pool.memoryInUse())
+}
+
+func TestReadBufferPoolWithoutPool(t *testing.T) {
+	var pool *readBufferPool
+	assert.Len(t, pool.get(), defaultReadBufferSize)
+	pool.put(make([]byte, defaultReadBufferSize))
+	pool.setTailers(10)
+}
@@ -8,7 +8,11 @@
 package file
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 )
 
 // DidRotate returns true if the file has been log-rotated.
@@ -38,3 +42,61 @@ func DidRotate(file *os.File, lastReadOffset int64) (bool, error) {
 
 	return recreated || truncated, nil
 }
+
+// inode returns the inode of the file, 0 if it can't be determined
+func inode(file *os.File) uint64 {
+	if file == nil {
+		return 0
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return 0
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
+
+// device returns the ID of the device holding the file, 0 if it can't be determined
+func device(file *os.File) uint64 {
+	if file == nil {
+		return 0
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return 0
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Dev)
+	}
+	return 0
+}
+
+// findRotatedPath returns the path the rotated file has been renamed to, it looks
+// for a file with the same inode next to the live file, e.g. app.log.1 for app.log.
+// An empty string is returned if the rotated file can't be found.
+func findRotatedPath(file *os.File, livePath string) string {
+	if file == nil {
+		return ""
+	}
+	rotatedInfo, err := file.Stat()
+	if err != nil {
+		return ""
+	}
+
+	dir, base := filepath.Dir(livePath), filepath.Base(livePath)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, info := range infos {
+		if info.Name() == base || !strings.HasPrefix(info.Name(), base) {
+			continue
+		}
+		if os.SameFile(info, rotatedInfo) {
+			return filepath.Join(dir, info.Name())
+		}
+	}
+	return ""
+}
@@ -16,3 +16,19 @@ import (
 func DidRotate(file *os.File, lastReadOffset int64) (bool, error) {
 	return false, nil
 }
+
+// findRotatedPath is not implemented on windows as log rotations are not
+// detected by the scanner.
+func findRotatedPath(file *os.File, livePath string) string {
+	return ""
+}
+
+// inode is not implemented on windows, 0 is always returned.
+func inode(file *os.File) uint64 {
+	return 0
+}
+
+// device is not implemented on windows, 0 is always returned.
+func device(file *os.File) uint64 {
+	return 0
+}
@@ -0,0 +1,74 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// gzipExtension is the extension appended to the rotated files once compressed, e.g. app.log.1.gz
+	gzipExtension = ".gz"
+	// rotatedFileRetention is how long the scanner waits for the compressed successor of a rotated file
+	// that has not been fully read.
+	rotatedFileRetention = 3 * scanPeriod
+)
+
+// rotatedFile is the lineage of a file that has been rotated while being tailed:
+// the tailer that kept reading the rotated content and the path the file was renamed to.
+type rotatedFile struct {
+	tailer      *Tailer
+	rotatedPath string
+	expiration  time.Time
+}
+
+// compressedPath returns the path of the compressed successor of the rotated file
+func (r *rotatedFile) compressedPath() string {
+	return r.rotatedPath + gzipExtension
+}
+
+// hasUnforwardedData returns true if the tailer of the rotated file stopped
+// before forwarding all the content it was expected to.
+func (r *rotatedFile) hasUnforwardedData() bool {
+	return atomic.LoadInt32(&r.tailer.unreadAfterRotation) != 0 || r.tailer.getForwardedOffset() < r.tailer.GetReadOffset()
+}
+
+// compressedReader reads the uncompressed content of a gzipped file
+type compressedReader struct {
+	*gzip.Reader
+	file *os.File
+}
+
+// openCompressedFile opens a gzipped file and skips its uncompressed content until offset,
+// the offsets of the uncompressed file remain valid in the compressed one.
+func openCompressedFile(path string, offset int64) (*compressedReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, gz, offset); err != nil {
+		gz.Close()
+		f.Close()
+		return nil, err
+	}
+	return &compressedReader{Reader: gz, file: f}, nil
+}
+
+// Close closes the gzip reader and the underlying file
+func (r *compressedReader) Close() error {
+	r.Reader.Close()
+	return r.file.Close()
+}
@@ -6,9 +6,18 @@
 package file
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
+
+	coreConfig "github.com/DataDog/datadog-agent/pkg/config"
 	"github.com/DataDog/datadog-agent/pkg/util/log"
 
 	"github.com/DataDog/datadog-agent/pkg/logs/auditor"
@@ -16,11 +25,40 @@ import (
 	"github.com/DataDog/datadog-agent/pkg/logs/message"
 	"github.com/DataDog/datadog-agent/pkg/logs/pipeline"
 	"github.com/DataDog/datadog-agent/pkg/logs/restart"
+	"github.com/DataDog/datadog-agent/pkg/logs/status"
 )
 
 // scanPeriod represents the period of time between two scans.
 const scanPeriod = 10 * time.Second
 
+// pollIntervalInfoKey is the key of the source info holding the poll interval of its tailers
+const pollIntervalInfoKey = "poll_interval"
+
+// filesNotTailedWarningType is the key of the warning listing the files not tailed because of the tailing limit
+const filesNotTailedWarningType = "files_not_tailed_warning"
+
+// maxReportedSkippedFiles is the maximum number of file names listed in the files not tailed warning
+const maxReportedSkippedFiles = 10
+
+// startPositionInfoKey is the prefix of the keys of the source info holding the start positions of its files
+const startPositionInfoKey = "start_position"
+
+// noFilesMatchedWarningType is the prefix of the keys of the warnings about the sources matching no files
+const noFilesMatchedWarningType = "no_files_matched_warning"
+
+// registryMismatchWarningType is the prefix of the keys of the warnings about the tailers resuming from a registry
+// entry owned by another source configuration
+const registryMismatchWarningType = "registry_mismatch_warning"
+
+// directoryMatchedWarningType is the prefix of the keys of the warnings about the directories matching a wildcard path
+const directoryMatchedWarningType = "directory_matched_warning"
+
+// MessageTransformer transforms or enriches a message of a file before it's sent to the pipeline,
+// e.g. to add tags or to redact a part of its content. It's called for each line so it must be fast.
+// The transformer is called concurrently by the tailers, it must be safe for concurrent use and must
+// not keep a reference to the message as the message belongs to the pipeline once it returns.
+type MessageTransformer func(msg *message.Message)
+
 // Scanner checks all files provided by fileProvider and create new tailers
 // or update the old ones if needed
 type Scanner struct {
@@ -31,9 +69,61 @@ type Scanner struct {
 	tailingLimit        int
 	fileProvider        *Provider
 	tailers             map[string]*Tailer
+	rotatedFiles        []*rotatedFile
 	registry            auditor.Registry
 	tailerSleepDuration time.Duration
 	stop                chan struct{}
+	// skippedFiles holds the files that matched a source during the last scan
+	// but are not tailed because the tailing limit is reached
+	skippedFiles []string
+	// onRotation is called each time a tailer is replaced because of a file rotation
+	onRotation func(path string, oldInode, newInode uint64)
+	// messageTransformer is applied to the messages of the tailers before they are sent to the pipeline
+	messageTransformer MessageTransformer
+	// noMatchScans counts the consecutive scans where an active source matched no files,
+	// a warning is shown once it reaches noMatchThreshold
+	noMatchScans     map[*config.LogSource]int
+	noMatchThreshold int
+	// pausedSources holds the offsets where the tailers of the paused sources stopped, indexed by source name
+	// and scan key, the files of the paused sources are not tailed until they are resumed
+	pausedSources map[string]map[string]int64
+	// skippedDirectories holds the directories matching a wildcard path, they are skipped by the scan
+	skippedDirectories map[string]bool
+	// skippedBinaryFiles holds the binary files matched by the sources, they are skipped by the scan
+	skippedBinaryFiles map[string]bool
+	// pendingOpens holds the matched files that could not be opened yet, indexed by scan key
+	pendingOpens map[string]*pendingOpen
+	// openRetry is signaled when the retry of a pending file is due
+	openRetry chan struct{}
+	// startTime is the time the scanner was created, the files of the sources following only new files
+	// that were last modified before it are skipped
+	startTime time.Time
+	// oldFiles holds the sizes of the files skipped because they are older than startTime, indexed by scan key
+	oldFiles map[string]int64
+	// encodings holds the encodings detected for the tailed files, indexed by inode
+	encodings map[uint64]detectedEncoding
+	// commitPolicy is the policy of the tailers to commit their offsets to the registry
+	commitPolicy CommitPolicy
+	// readOnlyRegistry is set when the registry is a snapshot, the tailers don't commit their offsets
+	readOnlyRegistry bool
+	// useInotify defines if the directories of the tailed files should be watched instead of polling the files,
+	// watcher is nil when inotify is disabled or unavailable
+	useInotify bool
+	watcher    *dirWatcher
+	// mergeSourceTags defines if the messages of a file matched by several sources carry the tags of all of them
+	mergeSourceTags bool
+	// readBuffers shares the read buffer memory budget between the tailers
+	readBuffers *readBufferPool
+	// churn keeps track of the tailers started and stopped by the scan
+	churn *tailerChurn
+	// rateLimiter caps the number of lines per second sent by all the tailers, it's nil when there is no limit
+	rateLimiter *lineRateLimiter
+	// lock protects the tailers and the active sources, as ScanPath can be
+	// called concurrently with the periodic scan
+	lock sync.Mutex
+	// pauseLock serializes PauseSource and ResumeSource, the tailers of a paused source are stopped
+	// without holding lock so that the scan is not blocked while they forward their last messages
+	pauseLock sync.Mutex
 }
 
 // NewScanner returns a new scanner.
@@ -45,14 +135,46 @@ func NewScanner(sources *config.LogSources, tailingLimit int, pipelineProvider p
 		removedSources:      sources.GetRemovedForType(config.FileType),
 		fileProvider:        NewProvider(tailingLimit),
 		tailers:             make(map[string]*Tailer),
+		noMatchScans:        make(map[*config.LogSource]int),
+		noMatchThreshold:    coreConfig.Datadog.GetInt("logs_config.file_scan_no_match_threshold"),
+		skippedDirectories:  make(map[string]bool),
+		skippedBinaryFiles:  make(map[string]bool),
+		pendingOpens:        make(map[string]*pendingOpen),
+		openRetry:           make(chan struct{}, 1),
+		startTime:           time.Now(),
+		oldFiles:            make(map[string]int64),
+		encodings:           make(map[uint64]detectedEncoding),
+		pausedSources:       make(map[string]map[string]int64),
+		commitPolicy:        commitPolicyFromConfig(),
+		useInotify:          coreConfig.Datadog.GetBool("logs_config.file_scan_use_inotify"),
+		mergeSourceTags:     coreConfig.Datadog.GetBool("logs_config.file_merge_overlapping_source_tags"),
+		readBuffers:         newReadBufferPool(coreConfig.Datadog.GetInt64("logs_config.file_read_buffer_budget")),
+		churn:               newTailerChurn(),
+		rateLimiter:         newLineRateLimiter(coreConfig.Datadog.GetInt("logs_config.file_max_lines_per_second")),
 		registry:            registry,
 		tailerSleepDuration: tailerSleepDuration,
 		stop:                make(chan struct{}),
 	}
 }
 
+// commitPolicyFromConfig returns the commit policy of the tailers defined in the configuration
+func commitPolicyFromConfig() CommitPolicy {
+	return CommitPolicy{
+		Interval: time.Duration(coreConfig.Datadog.GetInt("logs_config.registry_commit_interval")) * time.Second,
+		Bytes:    coreConfig.Datadog.GetInt64("logs_config.registry_commit_bytes"),
+	}
+}
+
 // Start starts the Scanner
 func (s *Scanner) Start() {
+	if s.useInotify {
+		watcher, err := newDirWatcher()
+		if err != nil {
+			log.Warnf("Could not watch the directories of the tailed files, the files are polled: %v", err)
+		} else {
+			s.watcher = watcher
+		}
+	}
 	go s.run()
 }
 
@@ -63,19 +185,62 @@ func (s *Scanner) Stop() {
 	s.cleanup()
 }
 
-// run checks periodically if there are new files to tail and the state of its tailers until stop
+// run checks periodically if there are new files to tail and the state of its tailers until stop.
+// When the directories of the tailed files are watched, the files are also rescanned when they are
+// created, removed or renamed, and their tailers are woken up when they are written.
 func (s *Scanner) run() {
 	scanTicker := time.NewTicker(scanPeriod)
 	defer scanTicker.Stop()
+
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	if s.watcher != nil {
+		defer s.watcher.close()
+		events = s.watcher.watcher.Events
+		watchErrors = s.watcher.watcher.Errors
+	}
+	var rescan <-chan time.Time
+
 	for {
 		select {
+		case event := <-events:
+			s.lock.Lock()
+			s.notifyTailers(event.Name)
+			s.lock.Unlock()
+			if event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 && rescan == nil {
+				rescan = time.After(rescanDelay)
+			}
+		case err := <-watchErrors:
+			// events may have been lost, e.g. when the event queue overflowed
+			log.Debugf("Error while watching the directories of the tailed files: %v", err)
+			s.lock.Lock()
+			s.notifyTailers("")
+			s.lock.Unlock()
+			if rescan == nil {
+				rescan = time.After(rescanDelay)
+			}
+		case <-rescan:
+			rescan = nil
+			s.lock.Lock()
+			s.scan()
+			s.lock.Unlock()
+		case <-s.openRetry:
+			s.lock.Lock()
+			s.retryPendingOpens(time.Now())
+			s.lock.Unlock()
 		case source := <-s.addedSources:
+			s.lock.Lock()
 			s.addSource(source)
+			s.lock.Unlock()
 		case source := <-s.removedSources:
+			s.lock.Lock()
 			s.removeSource(source)
+			s.lock.Unlock()
 		case <-scanTicker.C:
 			// check if there are new files to tail, tailers to stop and tailer to restart because of file rotation
+			s.lock.Lock()
 			s.scan()
+			s.lock.Unlock()
 		case <-s.stop:
 			// no more file should be tailed
 			return
@@ -85,12 +250,20 @@ func (s *Scanner) run() {
 
 // cleanup all tailers
 func (s *Scanner) cleanup() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
 	stopper := restart.NewParallelStopper()
+	tailers := make([]*Tailer, 0, len(s.tailers))
 	for _, tailer := range s.tailers {
 		stopper.Add(tailer)
+		tailers = append(tailers, tailer)
 		delete(s.tailers, tailer.file.GetScanKey())
 	}
+	s.readBuffers.setTailers(0)
 	stopper.Stop()
+	// record the final offsets of the tailers
+	s.writeCheckpoints(tailers)
 }
 
 // scan checks all the files we're expected to tail,
@@ -101,72 +274,390 @@ func (s *Scanner) cleanup() {
 // The Scanner needs to stop that previous tailer,
 // and start a new one for the new file.
 func (s *Scanner) scan() {
-	files := s.fileProvider.FilesToTail(s.activeSources)
+	s.drainRotatedFiles()
+
+	files := s.skipBinaryFiles(s.skipDirectories(s.fileProvider.FilesToTail(s.activeSources)))
+	s.expireOldFiles(files)
+	files = s.skipOldFiles(s.activeSources, files)
 	filesTailed := make(map[string]bool)
-	tailersLen := len(s.tailers)
 
 	for _, file := range files {
-		// We're using generated key here: in case this file has been found while
-		// scanning files for container, the key will use the format:
-		//   <filepath>/<containerID>
-		// If it has been found while scanning for a regular integration config,
-		// its format will be:
-		//   <filepath>
-		// It is a hack to let two tailers tail the same file (it's happening
-		// when a tailer for a dead container is still tailing the file, and another
-		// tailer is tailing the file for the new container).
-		tailerKey := file.GetScanKey()
-		tailer, isTailed := s.tailers[tailerKey]
-		if isTailed && atomic.LoadInt32(&tailer.shouldStop) != 0 {
-			// skip this tailer as it must be stopped
+		if s.tailFile(file) {
+			filesTailed[file.GetScanKey()] = true
+		}
+	}
+
+	s.skippedFiles = s.fileProvider.SkippedFiles()
+	s.reportSkippedFiles()
+	s.reportSourcesWithoutFiles(files)
+	s.expirePendingOpens(files)
+
+	tailers := make([]*Tailer, 0, len(s.tailers))
+	for _, tailer := range s.tailers {
+		// stop all tailers which have not been selected
+		_, shouldTail := filesTailed[tailer.file.GetScanKey()]
+		if !shouldTail {
+			s.stopTailer(tailer)
 			continue
 		}
-		if !isTailed && tailersLen >= s.tailingLimit {
-			// can't create new tailer because tailingLimit is reached
+		tailers = append(tailers, tailer)
+	}
+	if s.mergeSourceTags {
+		s.mergeOverlappingSourceTags(files)
+	}
+	s.writeCheckpoints(tailers)
+	s.syncWatchedDirectories()
+	s.churn.report(time.Now())
+	s.rateLimiter.report(time.Now())
+	s.expireEncodings()
+}
+
+// syncWatchedDirectories watches the directories of the tailed files, and the directories where the files of the
+// active sources are expected, so that new files are tailed as soon as they are created
+func (s *Scanner) syncWatchedDirectories() {
+	if s.watcher == nil {
+		return
+	}
+	dirs := make(map[string]bool)
+	for _, tailer := range s.tailers {
+		if !tailer.isStream() {
+			dirs[filepath.Dir(tailer.file.Path)] = true
+		}
+	}
+	for _, source := range s.activeSources {
+		switch {
+		case source.Config.Stream:
 			continue
+		case source.Config.TailDirectory:
+			dirs[s.fileProvider.sourcePath(source)] = true
+		case source.Config.LiteralPath || !config.ContainsWildcard(filepath.Dir(s.fileProvider.sourcePath(source))):
+			dirs[filepath.Dir(s.fileProvider.sourcePath(source))] = true
 		}
+	}
+	s.watcher.sync(dirs)
+}
 
-		if !isTailed && tailersLen < s.tailingLimit {
-			// create a new tailer tailing from the beginning of the file if no offset has been recorded
-			succeeded := s.startNewTailer(file, config.Beginning)
-			if !succeeded {
-				// the setup failed, let's try to tail this file in the next scan
-				continue
-			}
-			tailersLen++
-			filesTailed[tailerKey] = true
+// notifyTailers wakes up the tailers of the file, or all the tailers when path is empty
+func (s *Scanner) notifyTailers(path string) {
+	for _, tailer := range s.tailers {
+		if path == "" || tailer.file.Path == path {
+			tailer.notify()
+		}
+	}
+}
+
+// SetCommitPolicy sets the policy of the tailers to commit their offsets to the registry,
+// it applies to the tailers started afterwards.
+func (s *Scanner) SetCommitPolicy(policy CommitPolicy) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.commitPolicy = policy
+}
+
+// ReadOnlyRegistry makes the tailers start from the offsets recorded in the registry file at path, e.g. a snapshot
+// of the registry of another agent to replay its logs, instead of the registry of the agent. The snapshot is never
+// written and the tailers don't commit their offsets, so the replay can be started again from the same state.
+// It applies to the tailers started afterwards so it should be set before the scanner is started.
+func (s *Scanner) ReadOnlyRegistry(path string) error {
+	registry, err := auditor.NewSnapshotRegistry(path)
+	if err != nil {
+		return fmt.Errorf("could not load the registry snapshot %s: %v", path, err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.registry = registry
+	s.readOnlyRegistry = true
+	return nil
+}
+
+// OnRotation registers a callback invoked each time the scanner detects that a
+// file has been rotated, once the tailer of the new file has been created.
+// The inodes are the ones of the rotated and of the new file, they are equal
+// when the file has been truncated. They are always 0 on windows.
+func (s *Scanner) OnRotation(callback func(path string, oldInode, newInode uint64)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.onRotation = callback
+}
+
+// SetMessageTransformer registers a transformer applied to each message of the files before it's sent to the
+// pipeline, nil removes it. It only applies to the tailers started afterwards so it should be set before the
+// scanner is started.
+func (s *Scanner) SetMessageTransformer(transformer MessageTransformer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.messageTransformer = transformer
+}
+
+// PauseSource stops the tailers of the sources named id and keeps their offsets,
+// their files are not tailed by the scan until the sources are resumed.
+func (s *Scanner) PauseSource(id string) {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+
+	s.lock.Lock()
+	if _, isPaused := s.pausedSources[id]; isPaused {
+		s.lock.Unlock()
+		return
+	}
+	offsets := make(map[string]int64)
+	s.pausedSources[id] = offsets
+	for _, source := range s.activeSources {
+		if source.Name == id {
+			source.Status.Pause()
+		}
+	}
+	stopper := restart.NewParallelStopper()
+	tailers := make(map[string]*Tailer)
+	for key, tailer := range s.tailers {
+		if tailer.file.Source.Name != id {
 			continue
 		}
+		stopper.Add(tailer)
+		tailers[key] = tailer
+		delete(s.tailers, key)
+		tailer.file.Source.RemoveInfo(startPositionInfoKeyFor(tailer.file))
+	}
+	s.readBuffers.setTailers(len(s.tailers))
+	s.lock.Unlock()
 
-		didRotate, err := DidRotate(tailer.osFile, tailer.GetReadOffset())
-		if err != nil {
+	// wait for the tailers to forward their last messages to get their final offsets, the files of
+	// the paused source are skipped by the scans in the meantime
+	stopper.Stop()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for key, tailer := range tailers {
+		offsets[key] = tailer.getForwardedOffset()
+	}
+	log.Infof("Paused source %s, %d tailers stopped", id, len(offsets))
+}
+
+// ResumeSource restarts the tailers of the sources named id from the offsets where they were paused.
+func (s *Scanner) ResumeSource(id string) {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, isPaused := s.pausedSources[id]; !isPaused {
+		return
+	}
+	for _, source := range s.activeSources {
+		if source.Name != id {
 			continue
 		}
-		if didRotate {
-			// restart tailer because of file-rotation on file
-			succeeded := s.restartTailerAfterFileRotation(tailer, file)
-			if !succeeded {
-				// the setup failed, let's try to tail this file in the next scan
-				continue
-			}
+		source.Status.Resume()
+		s.launchTailers(source)
+	}
+	// the files not tailed anymore are tailed from the registry in the next scans
+	delete(s.pausedSources, id)
+	log.Infof("Resumed source %s", id)
+}
+
+// isPaused returns true if the source of the file is paused
+func (s *Scanner) isPaused(file *File) bool {
+	_, isPaused := s.pausedSources[file.Source.Name]
+	return isPaused
+}
+
+// ScanPath evaluates a single path against the active sources and starts or
+// updates the tailers of the matching files right away, instead of waiting for
+// the next scan. The limit on the number of tailers is respected.
+func (s *Scanner) ScanPath(path string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, file := range s.fileProvider.FilesForPath(path, s.activeSources) {
+		s.tailFile(file)
+	}
+}
+
+// tailFile starts a new tailer for the file if it is not tailed yet and the
+// tailing limit is not reached, or restarts its tailer if the file has been
+// rotated. Returns true if the file is tailed, false otherwise.
+func (s *Scanner) tailFile(file *File) bool {
+	// We're using generated key here: in case this file has been found while
+	// scanning files for container, the key will use the format:
+	//   <filepath>/<containerID>
+	// If it has been found while scanning for a regular integration config,
+	// its format will be:
+	//   <filepath>
+	// It is a hack to let two tailers tail the same file (it's happening
+	// when a tailer for a dead container is still tailing the file, and another
+	// tailer is tailing the file for the new container).
+	if s.isPaused(file) {
+		return false
+	}
+
+	tailerKey := file.GetScanKey()
+	tailer, isTailed := s.tailers[tailerKey]
+	if isTailed && atomic.LoadInt32(&tailer.shouldStop) != 0 {
+		// skip this tailer as it must be stopped
+		return false
+	}
+
+	if !isTailed {
+		if len(s.tailers) >= s.tailingLimit {
+			// can't create new tailer because tailingLimit is reached
+			return false
 		}
+		// create a new tailer tailing from the beginning of the file if no offset has been recorded
+		// if the setup fails, let's try to tail this file in the next scan
+		return s.startNewTailer(file, config.Beginning)
+	}
 
-		filesTailed[tailerKey] = true
+	if tailer.isStream() || tailer.isFullRead() {
+		// streams are reopened by their tailer and can't be rotated,
+		// the files read on change are re-read by their tailer when they are rewritten
+		return true
 	}
 
-	for _, tailer := range s.tailers {
-		// stop all tailers which have not been selected
-		_, shouldTail := filesTailed[tailer.file.GetScanKey()]
-		if !shouldTail {
-			s.stopTailer(tailer)
+	didRotate, err := s.didRotate(tailer)
+	if err != nil {
+		return false
+	}
+	if didRotate {
+		// restart tailer because of file-rotation on file
+		// if the setup fails, let's try to tail this file in the next scan
+		return s.restartTailerAfterFileRotation(tailer, file)
+	}
+	return true
+}
+
+// skipDirectories removes the directories matching a wildcard path from the files to tail, e.g. a directory
+// named weird.log matching *.log, as they can't be tailed. Each directory is logged and reported in the status once,
+// its warning is removed when it does not match anymore.
+func (s *Scanner) skipDirectories(files []*File) []*File {
+	matched := make(map[string]bool)
+	filtered := files[:0]
+	for _, file := range files {
+		if !file.IsWildcardPath || !s.isDirectory(file.Path) {
+			filtered = append(filtered, file)
+			continue
+		}
+		matched[file.Path] = true
+		if s.skippedDirectories[file.Path] {
+			continue
+		}
+		s.skippedDirectories[file.Path] = true
+		log.Debugf("Skipping %s, it matches a wildcard path but is a directory", file.Path)
+		status.AddGlobalWarning(directoryMatchedWarningKey(file.Path), fmt.Sprintf("%s is a directory matching a wildcard path, it is not tailed", file.Path))
+	}
+	for path := range s.skippedDirectories {
+		if !matched[path] {
+			delete(s.skippedDirectories, path)
+			status.RemoveGlobalWarning(directoryMatchedWarningKey(path))
+		}
+	}
+	return filtered
+}
+
+// directoryMatchedWarningKey returns the key of the warning about the directory matching a wildcard path
+func directoryMatchedWarningKey(path string) string {
+	return fmt.Sprintf("%s:%s", directoryMatchedWarningType, path)
+}
+
+// isDirectory returns true if path is an existing directory
+func (s *Scanner) isDirectory(path string) bool {
+	info, err := s.fileProvider.stats.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// didRotate returns true if the file of the tailer has been rotated, according to the rotation detection of its source
+func (s *Scanner) didRotate(tailer *Tailer) (bool, error) {
+	if tailer.file.Source.Config.RotationDetection == config.ChecksumRotationDetection {
+		return tailer.didPrefixChange()
+	}
+	return tailer.didRotate()
+}
+
+// reportSkippedFiles exposes the files not tailed during the last scan as a status warning,
+// the warning is removed once all the files matching a source are tailed.
+func (s *Scanner) reportSkippedFiles() {
+	if len(s.skippedFiles) == 0 {
+		status.RemoveGlobalWarning(filesNotTailedWarningType)
+		return
+	}
+
+	names := s.skippedFiles
+	if len(names) > maxReportedSkippedFiles {
+		names = append(names[:maxReportedSkippedFiles:maxReportedSkippedFiles], "...")
+	}
+	log.Debugf("%d files not tailed because the limit of %d files is reached: %s", len(s.skippedFiles), s.tailingLimit, strings.Join(s.skippedFiles, ", "))
+	status.AddGlobalWarning(filesNotTailedWarningType, fmt.Sprintf("%d files not tailed: limit reached (%s)", len(s.skippedFiles), strings.Join(names, ", ")))
+}
+
+// reportSourcesWithoutFiles counts the consecutive scans where each active source matched no files,
+// and warns in the status about the ones reaching the threshold, usually because of a misconfigured path.
+// The count is reset as soon as a file matches the source.
+func (s *Scanner) reportSourcesWithoutFiles(files []*File) {
+	if s.noMatchThreshold <= 0 {
+		return
+	}
+
+	matched := make(map[*config.LogSource]bool)
+	for _, file := range files {
+		matched[file.Source] = true
+	}
+	for _, source := range s.activeSources {
+		if matched[source] {
+			s.resetNoMatchScans(source)
+			continue
+		}
+		s.noMatchScans[source]++
+		if count := s.noMatchScans[source]; count >= s.noMatchThreshold {
+			status.AddGlobalWarning(noFilesMatchedWarningKey(source), fmt.Sprintf("Source %s matched no files for %d scans (path: %s)", source.Name, count, source.Config.Path))
 		}
 	}
 }
 
+// resetNoMatchScans resets the count of scans where the source matched no files and removes its warning
+func (s *Scanner) resetNoMatchScans(source *config.LogSource) {
+	if s.noMatchScans[source] >= s.noMatchThreshold {
+		status.RemoveGlobalWarning(noFilesMatchedWarningKey(source))
+	}
+	delete(s.noMatchScans, source)
+}
+
+// noFilesMatchedWarningKey returns the key of the warning about the source matching no files
+func noFilesMatchedWarningKey(source *config.LogSource) string {
+	return fmt.Sprintf("%s:%s:%s", noFilesMatchedWarningType, source.Name, source.Config.Path)
+}
+
 // addSource keeps track of the new source and launch new tailers for this source.
+// Its files are searched with its resolved path, see resolveSourcePath, the config of the source keeps
+// the path given by the user.
 func (s *Scanner) addSource(source *config.LogSource) {
+	s.fileProvider.setSourcePath(source, resolveSourcePath(source.Config))
 	s.activeSources = append(s.activeSources, source)
 	s.launchTailers(source)
+	s.syncWatchedDirectories()
+}
+
+// resolveSourcePath returns the path the files of the source are searched with: the environment variables and
+// the home directory referenced by its path are expanded first, unless the path is literal, then its host path is
+// translated into the path the agent reads.
+func resolveSourcePath(c *config.LogsConfig) string {
+	path := c.Path
+	if !c.LiteralPath {
+		path = expandPath(path)
+	}
+	return translateSourcePath(c, path)
+}
+
+// translateSourcePath translates a path of the source given as a host path into the path under which the agent
+// reads the files, the paths already under the container path prefix are kept
+func translateSourcePath(c *config.LogsConfig, path string) string {
+	if c.HostPathPrefix == "" || c.ContainerPathPrefix == "" || c.HostPath(path) != path {
+		return path
+	}
+	return c.ContainerPath(path)
 }
 
 // removeSource removes the source from cache.
@@ -175,6 +666,8 @@ func (s *Scanner) removeSource(source *config.LogSource) {
 		if src == source {
 			// no need to stop the tailer here, it will be stopped in the next iteration of scan.
 			s.activeSources = append(s.activeSources[:i], s.activeSources[i+1:]...)
+			s.fileProvider.removeSourcePath(source)
+			s.resetNoMatchScans(source)
 			break
 		}
 	}
@@ -188,23 +681,15 @@ func (s *Scanner) launchTailers(source *config.LogSource) {
 		log.Warnf("Could not collect files: %v", err)
 		return
 	}
-	for _, file := range files {
+	for _, file := range s.skipOldFiles([]*config.LogSource{source}, files) {
 		if len(s.tailers) >= s.tailingLimit {
 			return
 		}
-		if _, isTailed := s.tailers[file.GetScanKey()]; isTailed {
+		if _, isTailed := s.tailers[file.GetScanKey()]; isTailed || s.isPaused(file) {
 			continue
 		}
 
-		mode, _ := config.TailingModeFromString(source.Config.TailingMode)
-
-		if source.Config.Identifier != "" {
-			// only sources generated from a service discovery will contain a config identifier,
-			// in which case we want to collect all logs.
-			// FIXME: better detect a source that has been generated from a service discovery.
-			mode = config.Beginning
-		}
-		s.startNewTailer(file, mode)
+		s.startNewTailer(file, file.tailingMode())
 	}
 }
 
@@ -215,12 +700,15 @@ func (s *Scanner) startNewTailer(file *File, m config.TailingMode) bool {
 
 	var offset int64
 	var whence int
-	mode := s.handleTailingModeChange(tailer.Identifier(), m)
+	resumedID := s.resumedIdentifier(tailer)
+	mode := s.handleTailingModeChange(resumedID, m)
 
-	offset, whence, err := Position(s.registry, tailer.Identifier(), mode)
+	offset, whence, reason, err := s.position(file, resumedID, mode)
 	if err != nil {
 		log.Warnf("Could not recover offset for file with path %v: %v", file.Path, err)
 	}
+	s.reportStartPosition(file, reason)
+	s.checkRegistryConfigID(file, tailer.Identifier())
 
 	if sourceID := file.getSourceIdentifier(); sourceID != "" {
 		s.registry.SetConfigID(tailer.Identifier(), sourceID)
@@ -228,16 +716,115 @@ func (s *Scanner) startNewTailer(file *File, m config.TailingMode) bool {
 
 	log.Infof("Starting a new tailer for: %s (offset: %d, whence: %d) for tailer key %s", file.Path, offset, whence, file.GetScanKey())
 
-	err = tailer.Start(offset, whence)
+	err = s.startTailer(tailer, offset, whence)
 	if err != nil {
 		log.Warn(err)
 		return false
 	}
+	s.recordPrefixChecksum(tailer)
+	delete(s.oldFiles, file.GetScanKey())
 
 	s.tailers[tailer.file.GetScanKey()] = tailer
+	s.readBuffers.setTailers(len(s.tailers))
+	s.churn.record(file, tailerStarted, time.Now())
 	return true
 }
 
+// resumedIdentifier returns the identifier of the registry entry the tailer resumes from, its own entry or, when
+// it has none yet, the entry of the file updated last, e.g. recorded with the previous processing rules of its
+// source or before the processing rules were part of the identifiers.
+func (s *Scanner) resumedIdentifier(tailer *Tailer) string {
+	identifier := tailer.Identifier()
+	if s.registry.GetOffset(identifier) != "" {
+		return identifier
+	}
+	if fallbackID := s.registry.GetLastUpdatedIdentifier(tailer.file.isRegistryIdentifierOf); fallbackID != "" {
+		log.Infof("No registry entry %s for %s, resuming from the entry %s", identifier, tailer.file.Path, fallbackID)
+		return fallbackID
+	}
+	return identifier
+}
+
+// checkRegistryConfigID warns when the registry entry of the file is owned by another source configuration,
+// e.g. by the source of a previous container after a reconfiguration. The registry ignores the offsets of the
+// other configurations so the file would be read again from the entry offset after a restart.
+func (s *Scanner) checkRegistryConfigID(file *File, identifier string) {
+	key := registryMismatchWarningKey(file)
+	entryID := s.registry.GetCurrentConfigID(identifier)
+	sourceID := file.getSourceIdentifier()
+	if entryID == "" || entryID == sourceID || s.registry.GetOffset(identifier) == "" {
+		status.RemoveGlobalWarning(key)
+		return
+	}
+	log.Warnf("The registry entry %s of %s belongs to the source configuration %q instead of %q", identifier, file.Path, entryID, sourceID)
+	status.AddGlobalWarning(key, fmt.Sprintf("The registry entry %s resumed by the tailer of %s belongs to the source configuration %q instead of %q, its offsets may not be committed", identifier, file.Path, entryID, sourceID))
+}
+
+// registryMismatchWarningKey returns the key of the warning about the registry entry of the file
+func registryMismatchWarningKey(file *File) string {
+	return fmt.Sprintf("%s:%s", registryMismatchWarningType, file.GetScanKey())
+}
+
+// position returns the position from where the file should be tailed along with the reason
+// of this choice, the offset recorded in the checkpoint file of the source has precedence
+// over the registry.
+func (s *Scanner) position(file *File, identifier string, mode config.TailingMode) (int64, int, string, error) {
+	if file.Source.Config.Stream {
+		return 0, io.SeekStart, "stream, no offset", nil
+	}
+	if offset, isPaused := s.pausedSources[file.Source.Name][file.GetScanKey()]; isPaused {
+		if info, err := os.Stat(file.Path); err == nil && info.Size() < offset {
+			return 0, io.SeekStart, "file truncated while paused, tailing from the beginning", nil
+		}
+		return offset, io.SeekStart, fmt.Sprintf("resumed after pause at offset %d", offset), nil
+	}
+	if offset, isOld := s.oldFiles[file.GetScanKey()]; isOld {
+		if info, err := os.Stat(file.Path); err == nil && info.Size() < offset {
+			return 0, io.SeekStart, "file older than the agent truncated, tailing from the beginning", nil
+		}
+		return offset, io.SeekStart, fmt.Sprintf("file older than the agent written, tailing from offset %d", offset), nil
+	}
+	if checkpointFile := file.Source.Config.CheckpointFile; checkpointFile != "" {
+		offset, err := readCheckpoint(checkpointFile, file.hostPath())
+		if err == nil {
+			return offset, io.SeekStart, fmt.Sprintf("checkpoint file %s at offset %d", checkpointFile, offset), nil
+		}
+		log.Warnf("Could not read the offset of %s from the checkpoint file %s, falling back to the tailing mode: %v", file.Path, checkpointFile, err)
+	}
+	return positionWithReason(s.registry, identifier, mode)
+}
+
+// reportStartPosition exposes in the source info why its file is tailed from its start position,
+// e.g. to understand why a file has been read again from the beginning.
+func (s *Scanner) reportStartPosition(file *File, reason string) {
+	file.Source.UpdateInfo(startPositionInfoKeyFor(file), fmt.Sprintf("Start position of %s: %s", file.Path, reason))
+}
+
+// startPositionInfoKeyFor returns the key of the source info holding the start position of the file
+func startPositionInfoKeyFor(file *File) string {
+	return fmt.Sprintf("%s:%s", startPositionInfoKey, file.GetScanKey())
+}
+
+// writeCheckpoints records the offsets of the tailers in the checkpoint files of their sources
+func (s *Scanner) writeCheckpoints(tailers []*Tailer) {
+	offsets := make(map[string]map[string]int64)
+	for _, tailer := range tailers {
+		checkpointFile := tailer.file.Source.Config.CheckpointFile
+		if checkpointFile == "" || !tailer.shouldTrackOffset() {
+			continue
+		}
+		if _, exists := offsets[checkpointFile]; !exists {
+			offsets[checkpointFile] = make(map[string]int64)
+		}
+		offsets[checkpointFile][tailer.file.hostPath()] = tailer.getForwardedOffset()
+	}
+	for checkpointFile, fileOffsets := range offsets {
+		if err := writeCheckpoint(checkpointFile, fileOffsets); err != nil {
+			log.Warnf("Could not write the checkpoint file %s: %v", checkpointFile, err)
+		}
+	}
+}
+
 // handleTailingModeChange determines the tailing behaviour when the tailing mode for a given file has its
 // configuration change. Two case may happen we can switch from "end" to "beginning" (1) and from "beginning" to
 // "end" (2). If the tailing mode is set to forceEnd or forceBeginning it will remain unchanged.
@@ -264,13 +851,29 @@ func (s *Scanner) handleTailingModeChange(tailerID string, currentTailingMode co
 func (s *Scanner) stopTailer(tailer *Tailer) {
 	go tailer.Stop()
 	delete(s.tailers, tailer.file.GetScanKey())
+	s.readBuffers.setTailers(len(s.tailers))
+	s.churn.record(tailer.file, tailerStopped, time.Now())
+	tailer.file.Source.RemoveInfo(startPositionInfoKeyFor(tailer.file))
+	tailer.file.Source.RemoveInfo(encodingInfoKeyFor(tailer.file))
+	status.RemoveGlobalWarning(registryMismatchWarningKey(tailer.file))
 }
 
 // restartTailer safely stops tailer and starts a new one
 // returns true if the new tailer is up and running, false if an error occurred
 func (s *Scanner) restartTailerAfterFileRotation(tailer *Tailer, file *File) bool {
 	log.Info("Log rotation happened to ", file.Path)
+	oldFile := tailer.getOSFile()
+	oldInode := inode(oldFile)
+	if rotatedPath := findRotatedPath(oldFile, file.Path); rotatedPath != "" {
+		// keep track of the rotated file in case its tailer doesn't reach its end before it gets compressed
+		s.rotatedFiles = append(s.rotatedFiles, &rotatedFile{
+			tailer:      tailer,
+			rotatedPath: rotatedPath,
+			expiration:  time.Now().Add(tailer.closeTimeout + rotatedFileRetention),
+		})
+	}
 	tailer.StopAfterFileRotation()
+	s.churn.record(tailer.file, tailerStopped, time.Now())
 	tailer = s.createTailer(file, tailer.outputChan)
 	// force reading file from beginning since it has been log-rotated
 	err := tailer.StartFromBeginning()
@@ -278,11 +881,85 @@ func (s *Scanner) restartTailerAfterFileRotation(tailer *Tailer, file *File) boo
 		log.Warn(err)
 		return false
 	}
+	s.recordPrefixChecksum(tailer)
+	s.reportStartPosition(file, "file rotation detected, tailing from the beginning")
 	s.tailers[file.GetScanKey()] = tailer
+	s.churn.record(file, tailerStarted, time.Now())
+	if s.onRotation != nil {
+		s.onRotation(file.Path, oldInode, inode(tailer.getOSFile()))
+	}
 	return true
 }
 
-// createTailer returns a new initialized tailer
+// drainRotatedFiles checks the files that have been rotated while being tailed,
+// when the tailer of a rotated file stopped before forwarding all its content
+// and the rotated file has been compressed, the remaining content is read from
+// the compressed file.
+func (s *Scanner) drainRotatedFiles() {
+	now := time.Now()
+	rotatedFiles := s.rotatedFiles[:0]
+	for _, rotated := range s.rotatedFiles {
+		if atomic.LoadInt32(&rotated.tailer.shouldStop) == 0 {
+			// the tailer is still reading the rotated file
+			rotatedFiles = append(rotatedFiles, rotated)
+			continue
+		}
+		if !rotated.hasUnforwardedData() {
+			continue
+		}
+		if _, err := os.Stat(rotated.compressedPath()); err != nil {
+			if now.Before(rotated.expiration) {
+				rotatedFiles = append(rotatedFiles, rotated)
+			} else {
+				log.Warnf("Could not find the compressed file of %s, its remaining content is lost", rotated.rotatedPath)
+			}
+			continue
+		}
+		go s.drainCompressedFile(rotated)
+	}
+	s.rotatedFiles = rotatedFiles
+}
+
+// drainCompressedFile forwards the content of the compressed rotated file
+// that has not been forwarded by the tailer of the rotated file.
+func (s *Scanner) drainCompressedFile(rotated *rotatedFile) {
+	path := rotated.compressedPath()
+	offset := rotated.tailer.getForwardedOffset()
+	reader, err := openCompressedFile(path, offset)
+	if err != nil {
+		log.Warnf("Could not read the compressed file %s from offset %d: %v", path, offset, err)
+		return
+	}
+	defer reader.Close()
+
+	log.Infof("Reading the remaining content of %s from %s (offset: %d)", rotated.rotatedPath, path, offset)
+	tailer := s.createTailer(rotated.tailer.file, rotated.tailer.outputChan)
+	// the offsets of the drained lines are the ones of the uncompressed content
+	tailer.readOffset = offset
+	tailer.decodedOffset = offset
+	if err := tailer.drain(reader); err != nil {
+		log.Warnf("Could not read the compressed file %s: %v", path, err)
+	}
+}
+
+// createTailer returns a new initialized tailer, the poll interval of the source
+// of the file overrides the default sleep duration of the scanner when set.
 func (s *Scanner) createTailer(file *File, outputChan chan *message.Message) *Tailer {
-	return NewTailer(outputChan, file, s.tailerSleepDuration)
+	sleepDuration := s.tailerSleepDuration
+	if pollInterval := file.Source.Config.PollInterval; pollInterval > 0 {
+		sleepDuration = time.Duration(pollInterval) * time.Millisecond
+	} else if s.watcher != nil && !file.Source.Config.Stream && s.watcher.watch(filepath.Dir(file.Path)) && sleepDuration < watchedFilePollPeriod {
+		// the tailer is woken up when its file is written
+		sleepDuration = watchedFilePollPeriod
+	}
+	file.Source.UpdateInfo(pollIntervalInfoKey, fmt.Sprintf("Poll interval: %s", sleepDuration))
+	encoding := s.fileEncoding(file)
+	tailer := newTailer(outputChan, file, sleepDuration, nil, encoding.encoding)
+	tailer.encodingInode = encoding.inode
+	tailer.commitPolicy = s.commitPolicy
+	tailer.readOnlyRegistry = s.readOnlyRegistry
+	tailer.readBuffers = s.readBuffers
+	tailer.transform = s.messageTransformer
+	tailer.rateLimiter = s.rateLimiter
+	return tailer
 }
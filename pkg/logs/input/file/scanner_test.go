@@ -8,7 +8,10 @@
 package file
 
 import (
+	"compress/gzip"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -135,6 +138,68 @@ func (suite *ScannerTestSuite) TestScannerScanWithLogRotation() {
 	suite.Equal("hello again", string(msg.Content))
 }
 
+func (suite *ScannerTestSuite) TestScannerBytesReadAfterLogRotation() {
+	s := suite.s
+
+	_, err := suite.testFile.WriteString("hello world\n")
+	suite.Nil(err)
+	<-suite.outputChan
+
+	os.Rename(suite.testPath, suite.testRotatedPath)
+	f, err := os.Create(suite.testPath)
+	suite.Nil(err)
+	s.scan()
+
+	_, err = f.WriteString("hello again\n")
+	suite.Nil(err)
+	<-suite.outputChan
+
+	// the bytes read by the tailer of the rotated file are kept
+	suite.Equal(int64(len("hello world\n")+len("hello again\n")), suite.source.BytesRead.Value())
+}
+
+func (suite *ScannerTestSuite) TestScannerOnRotation() {
+	s := suite.s
+
+	type rotation struct {
+		path               string
+		oldInode, newInode uint64
+	}
+	var rotations []rotation
+	s.OnRotation(func(path string, oldInode, newInode uint64) {
+		rotations = append(rotations, rotation{path, oldInode, newInode})
+	})
+
+	_, err := suite.testFile.WriteString("hello world\n")
+	suite.Nil(err)
+	<-suite.outputChan
+	oldInode := inode(suite.testFile)
+
+	// rename and recreate
+	os.Rename(suite.testPath, suite.testRotatedPath)
+	f, err := os.Create(suite.testPath)
+	suite.Nil(err)
+	defer f.Close()
+	s.scan()
+
+	suite.Equal(1, len(rotations))
+	suite.Equal(suite.testPath, rotations[0].path)
+	suite.Equal(oldInode, rotations[0].oldInode)
+	suite.Equal(inode(f), rotations[0].newInode)
+	suite.NotEqual(rotations[0].oldInode, rotations[0].newInode)
+
+	// copytruncate
+	_, err = f.WriteString("hello again\n")
+	suite.Nil(err)
+	<-suite.outputChan
+	suite.Nil(f.Truncate(0))
+	s.scan()
+
+	suite.Equal(2, len(rotations))
+	suite.Equal(inode(f), rotations[1].oldInode)
+	suite.Equal(inode(f), rotations[1].newInode)
+}
+
 func (suite *ScannerTestSuite) TestScannerScanWithLogRotationCopyTruncate() {
 	s := suite.s
 	var tailer *Tailer
@@ -306,6 +371,38 @@ func TestScannerWithConcurrentContainerTailer(t *testing.T) {
 	assert.Equal(t, "file:"+path, registry.GetIdentifier())
 }
 
+func TestScannerWarnsOnRegistryConfigIDMismatch(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/test.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(path, []byte("hello\n"), 0644))
+
+	// the registry entry of the file is owned by the source of a previous container
+	registry := auditor.NewRegistry()
+	registry.SetConfigID("file:"+path, "previous-container")
+	registry.SetOffset("3")
+
+	scanner := NewScanner(config.NewLogSources(), 2, mock.NewMockProvider(), registry, 10*time.Millisecond)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, Identifier: "new-container"})
+	status.Clear()
+	status.InitStatus(config.CreateSources([]*config.LogSource{source}))
+	defer status.Clear()
+
+	file := NewFile(path, source, false)
+	assert.True(t, scanner.startNewTailer(file, config.End))
+	warning := fmt.Sprintf("The registry entry file:%s resumed by the tailer of %s belongs to the source configuration \"previous-container\" instead of \"new-container\", its offsets may not be committed", path, path)
+	assert.Equal(t, []string{warning}, status.Get().Warnings)
+
+	// the warning is removed with the tailer, the entry now belongs to the new source
+	scanner.stopTailer(scanner.tailers[file.GetScanKey()])
+	assert.Empty(t, status.Get().Warnings)
+	assert.True(t, scanner.startNewTailer(file, config.End))
+	assert.Empty(t, status.Get().Warnings)
+	scanner.cleanup()
+}
+
 func TestScannerTailFromTheBeginning(t *testing.T) {
 	testDir, err := ioutil.TempDir("", "log-scanner-test-")
 	assert.Nil(t, err)
@@ -392,6 +489,8 @@ func TestScannerScanWithTooManyFiles(t *testing.T) {
 	// test at scan
 	scanner.scan()
 	assert.Equal(t, 2, len(scanner.tailers))
+	assert.Equal(t, []string{fmt.Sprintf("%s/1.log", testDir)}, scanner.skippedFiles)
+	assert.Contains(t, status.Get().Warnings, fmt.Sprintf("1 files not tailed: limit reached (%s/1.log)", testDir))
 
 	path = fmt.Sprintf("%s/2.log", testDir)
 	err = os.Remove(path)
@@ -399,11 +498,1148 @@ func TestScannerScanWithTooManyFiles(t *testing.T) {
 
 	scanner.scan()
 	assert.Equal(t, 1, len(scanner.tailers))
+	assert.Empty(t, scanner.skippedFiles)
+	assert.NotContains(t, status.Get().Warnings, fmt.Sprintf("1 files not tailed: limit reached (%s/1.log)", testDir))
+
+	scanner.scan()
+	assert.Equal(t, 2, len(scanner.tailers))
+}
+
+func TestScannerStopsTailersOfExcludedFiles(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/app.log", testDir)
+	debugPath := fmt.Sprintf("%s/app-debug.log", testDir)
+	_, err = os.Create(path)
+	assert.Nil(t, err)
+	_, err = os.Create(debugPath)
+	assert.Nil(t, err)
+
+	scanner := NewScanner(config.NewLogSources(), 10, mock.NewMockProvider(), auditor.NewRegistry(), 20*time.Millisecond)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: fmt.Sprintf("%s/*.log", testDir)})
+	scanner.activeSources = append(scanner.activeSources, source)
+	status.Clear()
+	status.InitStatus(config.CreateSources([]*config.LogSource{source}))
+	defer status.Clear()
+	defer scanner.cleanup()
 
 	scanner.scan()
 	assert.Equal(t, 2, len(scanner.tailers))
+
+	// the debug file gets excluded after a config update
+	source.Config.ExcludePaths = []string{"*-debug.log"}
+	scanner.scan()
+	assert.Equal(t, 1, len(scanner.tailers))
+	assert.NotNil(t, scanner.tailers[getScanKey(path, source)])
+	assert.Nil(t, scanner.tailers[getScanKey(debugPath, source)])
+}
+
+func TestScannerScanPath(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	scanner := NewScanner(config.NewLogSources(), 1, mock.NewMockProvider(), auditor.NewRegistry(), 20*time.Millisecond)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: fmt.Sprintf("%s/*.log", testDir)})
+	scanner.activeSources = append(scanner.activeSources, source)
+	defer scanner.cleanup()
+
+	firstPath := fmt.Sprintf("%s/1.log", testDir)
+	secondPath := fmt.Sprintf("%s/2.log", testDir)
+
+	// the file does not exist yet
+	scanner.ScanPath(firstPath)
+	assert.Equal(t, 0, len(scanner.tailers))
+
+	_, err = os.Create(firstPath)
+	assert.Nil(t, err)
+	_, err = os.Create(secondPath)
+	assert.Nil(t, err)
+
+	scanner.ScanPath(firstPath)
+	assert.Equal(t, 1, len(scanner.tailers))
+	assert.NotNil(t, scanner.tailers[getScanKey(firstPath, source)])
+
+	// the tailing limit is reached
+	scanner.ScanPath(secondPath)
+	assert.Equal(t, 1, len(scanner.tailers))
+	assert.Nil(t, scanner.tailers[getScanKey(secondPath, source)])
+}
+
+func TestScannerPollInterval(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	scanner := NewScanner(config.NewLogSources(), 2, mock.NewMockProvider(), auditor.NewRegistry(), 20*time.Millisecond)
+
+	defaultSource := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: fmt.Sprintf("%s/default.log", testDir)})
+	tailer := scanner.createTailer(NewFile(defaultSource.Config.Path, defaultSource, false), nil)
+	assert.Equal(t, 20*time.Millisecond, tailer.sleepDuration)
+	assert.Equal(t, []string{"Poll interval: 20ms"}, defaultSource.GetInfo())
+
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: fmt.Sprintf("%s/audit.log", testDir), PollInterval: 5000})
+	tailer = scanner.createTailer(NewFile(source.Config.Path, source, false), nil)
+	assert.Equal(t, 5*time.Second, tailer.sleepDuration)
+	assert.Equal(t, []string{"Poll interval: 5s"}, source.GetInfo())
+}
+
+func TestScannerDrainCompressedRotatedFile(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/test.log", testDir)
+	rotatedPath := path + ".1"
+
+	// the live file is renamed by the rotation, then compressed
+	file, err := os.Create(path)
+	assert.Nil(t, err)
+	_, err = file.WriteString("first\nsecond\nthird\n")
+	assert.Nil(t, err)
+	assert.Nil(t, os.Rename(path, rotatedPath))
+	assert.Equal(t, rotatedPath, findRotatedPath(file, path))
+	file.Close()
+
+	compressedFile, err := os.Create(rotatedPath + gzipExtension)
+	assert.Nil(t, err)
+	writer := gzip.NewWriter(compressedFile)
+	_, err = writer.Write([]byte("first\nsecond\nthird\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+	assert.Nil(t, compressedFile.Close())
+	assert.Nil(t, os.Remove(rotatedPath))
+
+	// the previous tailer only forwarded the first line before being stopped
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, AddOffset: true})
+	scanner := NewScanner(config.NewLogSources(), 1, mock.NewMockProvider(), auditor.NewRegistry(), 20*time.Millisecond)
+	outputChan := make(chan *message.Message, 10)
+	previousTailer := NewTailer(outputChan, NewFile(path, source, false), 20*time.Millisecond)
+	previousTailer.forwardedOffset = int64(len("first\n"))
+	previousTailer.readOffset = int64(len("first\nsecond\n"))
+	previousTailer.shouldStop = 1
+	scanner.rotatedFiles = []*rotatedFile{{tailer: previousTailer, rotatedPath: rotatedPath, expiration: time.Now().Add(time.Minute)}}
+
+	scanner.drainRotatedFiles()
+	assert.Empty(t, scanner.rotatedFiles)
+
+	// the offsets are the ones of the uncompressed content
+	msg := <-outputChan
+	assert.Equal(t, "second", string(msg.Content))
+	assert.Contains(t, msg.Origin.Tags(), "file.offset:6")
+	msg = <-outputChan
+	assert.Equal(t, "third", string(msg.Content))
+	assert.Contains(t, msg.Origin.Tags(), "file.offset:13")
 }
 
 func getScanKey(path string, source *config.LogSource) string {
 	return NewFile(path, source, false).GetScanKey()
 }
+
+func TestScannerCheckpointFile(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/test.log", testDir)
+	checkpointFile := fmt.Sprintf("%s/checkpoint.json", testDir)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, CheckpointFile: checkpointFile})
+	file := NewFile(path, source, false)
+	scanner := NewScanner(config.NewLogSources(), 1, mock.NewMockProvider(), auditor.NewRegistry(), 20*time.Millisecond)
+
+	// missing checkpoint file, fall back to the tailing mode
+	offset, whence, _, err := scanner.position(file, file.GetScanKey(), config.ForceBeginning)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), offset)
+	assert.Equal(t, io.SeekStart, whence)
+
+	// corrupted checkpoint file, fall back to the tailing mode
+	assert.Nil(t, ioutil.WriteFile(checkpointFile, []byte("{not json"), 0644))
+	offset, whence, _, err = scanner.position(file, file.GetScanKey(), config.ForceEnd)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), offset)
+	assert.Equal(t, io.SeekEnd, whence)
+
+	// valid checkpoint file
+	assert.Nil(t, ioutil.WriteFile(checkpointFile, []byte(fmt.Sprintf(`{"%s": 6, "/other.log": 42}`, path)), 0644))
+	offset, whence, reason, err := scanner.position(file, file.GetScanKey(), config.ForceEnd)
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("checkpoint file %s at offset 6", checkpointFile), reason)
+	assert.Equal(t, int64(6), offset)
+	assert.Equal(t, io.SeekStart, whence)
+
+	// the offsets are written back, keeping the other entries
+	tailer := NewTailer(make(chan *message.Message, 1), file, 20*time.Millisecond)
+	tailer.forwardedOffset = 13
+	scanner.writeCheckpoints([]*Tailer{tailer})
+	offsets, err := loadCheckpoint(checkpointFile)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{path: 13, "/other.log": 42}, offsets)
+}
+
+func TestScannerWarnsAboutSourcesMatchingNoFiles(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	scanner := NewScanner(config.NewLogSources(), 2, mock.NewMockProvider(), auditor.NewRegistry(), 20*time.Millisecond)
+	scanner.noMatchThreshold = 2
+	path := fmt.Sprintf("%s/*.log", testDir)
+	source := config.NewLogSource("app", &config.LogsConfig{Type: config.FileType, Path: path})
+	scanner.activeSources = append(scanner.activeSources, source)
+	status.Clear()
+	status.InitStatus(config.CreateSources([]*config.LogSource{source}))
+	defer status.Clear()
+
+	warning := fmt.Sprintf("Source app matched no files for 2 scans (path: %s)", path)
+
+	scanner.scan()
+	assert.Empty(t, status.Get().Warnings)
+	scanner.scan()
+	assert.Contains(t, status.Get().Warnings, warning)
+
+	// the warning is removed once a file matches
+	_, err = os.Create(fmt.Sprintf("%s/1.log", testDir))
+	assert.Nil(t, err)
+	scanner.scan()
+	assert.NotContains(t, status.Get().Warnings, warning)
+	assert.Empty(t, scanner.noMatchScans)
+
+	// and when the source is removed
+	assert.Nil(t, os.Remove(fmt.Sprintf("%s/1.log", testDir)))
+	scanner.scan()
+	scanner.scan()
+	assert.Contains(t, status.Get().Warnings, warning)
+	scanner.removeSource(source)
+	assert.NotContains(t, status.Get().Warnings, warning)
+}
+
+func TestScannerReportsStartPosition(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/test.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(path, []byte("hello\n"), 0644))
+
+	registry := auditor.NewRegistry()
+	scanner := NewScanner(config.NewLogSources(), 2, mock.NewMockProvider(), registry, 20*time.Millisecond)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path})
+	file := NewFile(path, source, false)
+
+	// no registry entry
+	assert.True(t, scanner.startNewTailer(file, config.End))
+	assert.Contains(t, source.GetInfo(), fmt.Sprintf("Start position of %s: no registry entry, tailing mode end", path))
+	scanner.stopTailer(scanner.tailers[path])
+	assert.Equal(t, []string{"Poll interval: 20ms"}, source.GetInfo())
+
+	// registry hit
+	registry.SetOffset("3")
+	assert.True(t, scanner.startNewTailer(file, config.End))
+	assert.Contains(t, source.GetInfo(), fmt.Sprintf("Start position of %s: registry entry at offset 3", path))
+
+	// file rotation
+	assert.True(t, scanner.restartTailerAfterFileRotation(scanner.tailers[path], file))
+	assert.Contains(t, source.GetInfo(), fmt.Sprintf("Start position of %s: file rotation detected, tailing from the beginning", path))
+	scanner.cleanup()
+}
+
+func TestScannerSkipsDirectoriesMatchingWildcardPath(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	dirPath := fmt.Sprintf("%s/weird.log", testDir)
+	filePath := fmt.Sprintf("%s/app.log", testDir)
+	assert.Nil(t, os.Mkdir(dirPath, 0755))
+	_, err = os.Create(filePath)
+	assert.Nil(t, err)
+
+	scanner := NewScanner(config.NewLogSources(), 2, mock.NewMockProvider(), auditor.NewRegistry(), 20*time.Millisecond)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: fmt.Sprintf("%s/*.log", testDir)})
+	scanner.activeSources = append(scanner.activeSources, source)
+	status.Clear()
+	status.InitStatus(config.CreateSources([]*config.LogSource{source}))
+	defer status.Clear()
+
+	warning := fmt.Sprintf("%s is a directory matching a wildcard path, it is not tailed", dirPath)
+
+	scanner.scan()
+	assert.Len(t, scanner.tailers, 1)
+	assert.NotNil(t, scanner.tailers[filePath])
+	assert.Equal(t, map[string]bool{dirPath: true}, scanner.skippedDirectories)
+	assert.Equal(t, []string{warning}, status.Get().Warnings)
+
+	// the directory is reported once
+	scanner.scan()
+	assert.Len(t, scanner.tailers, 1)
+	assert.Equal(t, []string{warning}, status.Get().Warnings)
+
+	// the warning is removed once the directory does not match anymore
+	assert.Nil(t, os.Remove(dirPath))
+	scanner.scan()
+	assert.Empty(t, scanner.skippedDirectories)
+	assert.Empty(t, status.Get().Warnings)
+	scanner.cleanup()
+}
+
+func TestScannerSkipsBinaryFiles(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	binaryPath := fmt.Sprintf("%s/core.log", testDir)
+	filePath := fmt.Sprintf("%s/app.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(binaryPath, []byte("\x7fELF\x02\x01\x01\x00\x00\x00"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filePath, []byte("hello\n"), 0644))
+
+	scanner := NewScanner(config.NewLogSources(), 3, mock.NewMockProvider(), auditor.NewRegistry(), 20*time.Millisecond)
+	source := config.NewLogSource("app", &config.LogsConfig{Type: config.FileType, Path: fmt.Sprintf("%s/*.log", testDir)})
+	scanner.activeSources = append(scanner.activeSources, source)
+	status.Clear()
+	status.InitStatus(config.CreateSources([]*config.LogSource{source}))
+	defer status.Clear()
+
+	warning := fmt.Sprintf("%s looks like a binary file, it is not tailed (source: app)", binaryPath)
+
+	scanner.scan()
+	assert.Len(t, scanner.tailers, 1)
+	assert.NotNil(t, scanner.tailers[filePath])
+	assert.Equal(t, []string{warning}, status.Get().Warnings)
+
+	// the binary file is reported once
+	scanner.scan()
+	assert.Len(t, scanner.tailers, 1)
+	assert.Equal(t, []string{warning}, status.Get().Warnings)
+
+	// the warning is removed once the file does not match anymore
+	assert.Nil(t, os.Remove(binaryPath))
+	scanner.scan()
+	assert.Empty(t, scanner.skippedBinaryFiles)
+	assert.Empty(t, status.Get().Warnings)
+	scanner.cleanup()
+
+	// the binary files are tailed when the source allows it
+	assert.Nil(t, ioutil.WriteFile(binaryPath, []byte("\x7fELF\x02\x01\x01\x00\x00\x00"), 0644))
+	source.Config.AllowBinary = true
+	scanner.scan()
+	assert.Len(t, scanner.tailers, 2)
+	assert.NotNil(t, scanner.tailers[binaryPath])
+	assert.Empty(t, status.Get().Warnings)
+	scanner.cleanup()
+}
+
+func TestScannerPauseAndResumeSource(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/test.log", testDir)
+	file, err := os.Create(path)
+	assert.Nil(t, err)
+	defer file.Close()
+	_, err = file.WriteString("hello\n")
+	assert.Nil(t, err)
+
+	scanner := NewScanner(config.NewLogSources(), 2, mock.NewMockProvider(), auditor.NewRegistry(), 20*time.Millisecond)
+	source := config.NewLogSource("app", &config.LogsConfig{Type: config.FileType, Path: path})
+	scanner.activeSources = append(scanner.activeSources, source)
+
+	scanner.scan()
+	msg := <-scanner.tailers[path].outputChan
+	assert.Equal(t, "hello", string(msg.Content))
+
+	// the paused source is not tailed by the scan
+	scanner.PauseSource("app")
+	assert.True(t, source.Status.IsPaused())
+	assert.Empty(t, scanner.tailers)
+	assert.Equal(t, map[string]int64{path: 6}, scanner.pausedSources["app"])
+	_, err = file.WriteString("world\n")
+	assert.Nil(t, err)
+	scanner.scan()
+	assert.Empty(t, scanner.tailers)
+
+	// the source is tailed again from where it was paused
+	scanner.ResumeSource("app")
+	assert.False(t, source.Status.IsPaused())
+	assert.Empty(t, scanner.pausedSources)
+	assert.Len(t, scanner.tailers, 1)
+	assert.Contains(t, source.GetInfo(), fmt.Sprintf("Start position of %s: resumed after pause at offset 6", path))
+	msg = <-scanner.tailers[path].outputChan
+	assert.Equal(t, "world", string(msg.Content))
+	scanner.cleanup()
+}
+
+func TestScannerScansWhilePausingSource(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/test.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(path, []byte("hello\n"), 0644))
+
+	pipelineProvider := mock.NewMockProvider()
+	outputChan := pipelineProvider.NextPipelineChan()
+	scanner := NewScanner(config.NewLogSources(), 2, pipelineProvider, auditor.NewRegistry(), 20*time.Millisecond)
+	source := config.NewLogSource("app", &config.LogsConfig{Type: config.FileType, Path: path, TailingMode: "beginning"})
+	scanner.activeSources = append(scanner.activeSources, source)
+	scanner.scan()
+	defer scanner.cleanup()
+
+	// the tailer can't stop before its message is read from the output channel
+	paused := make(chan struct{})
+	go func() {
+		scanner.PauseSource("app")
+		close(paused)
+	}()
+	assert.Eventually(t, source.Status.IsPaused, 5*time.Second, 10*time.Millisecond)
+
+	// the scan is not blocked while the tailer stops
+	scanned := make(chan struct{})
+	go func() {
+		scanner.scan()
+		close(scanned)
+	}()
+	select {
+	case <-scanned:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the scan is blocked by the paused source")
+	}
+
+	assert.Equal(t, "hello", string((<-outputChan).Content))
+	<-paused
+	scanner.lock.Lock()
+	defer scanner.lock.Unlock()
+	assert.Empty(t, scanner.tailers)
+	assert.Equal(t, map[string]int64{path: 6}, scanner.pausedSources["app"])
+}
+
+func TestScannerChecksumRotationDetection(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/test.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(path, []byte("hello\n"), 0644))
+
+	scanner := NewScanner(config.NewLogSources(), 2, mock.NewMockProvider(), auditor.NewRegistry(), 20*time.Millisecond)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, RotationDetection: config.ChecksumRotationDetection})
+	assert.True(t, scanner.startNewTailer(NewFile(path, source, false), config.End))
+	tailer := scanner.tailers[path]
+	assert.Equal(t, 6, tailer.prefixSize)
+
+	// appending data extends the prefix
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = f.WriteString("world\n")
+	assert.Nil(t, err)
+	f.Close()
+	didRotate, err := scanner.didRotate(tailer)
+	assert.Nil(t, err)
+	assert.False(t, didRotate)
+	assert.Equal(t, 12, tailer.prefixSize)
+
+	// the file content is replaced in place, keeping its inode and a larger size
+	assert.Nil(t, ioutil.WriteFile(path, []byte("replaced content\n"), 0644))
+	didRotate, err = DidRotate(tailer.osFile, tailer.GetReadOffset())
+	assert.Nil(t, err)
+	assert.False(t, didRotate)
+	didRotate, err = scanner.didRotate(tailer)
+	assert.Nil(t, err)
+	assert.True(t, didRotate)
+	scanner.cleanup()
+}
+
+func TestScannerAddsFileMetadataTags(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/test.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(path, nil, 0644))
+
+	pipelineProvider := mock.NewMockProvider()
+	outputChan := pipelineProvider.NextPipelineChan()
+	scanner := NewScanner(config.NewLogSources(), 2, pipelineProvider, auditor.NewRegistry(), 10*time.Millisecond)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, AddFileMetadata: true})
+	scanner.activeSources = append(scanner.activeSources, source)
+	status.InitStatus(config.CreateSources([]*config.LogSource{source}))
+	defer status.Clear()
+	scanner.scan()
+	defer scanner.cleanup()
+
+	fileTags := func(path string) []string {
+		f, err := os.Open(path)
+		assert.Nil(t, err)
+		defer f.Close()
+		return []string{fmt.Sprintf("file.inode:%d", inode(f)), fmt.Sprintf("file.device:%d", device(f))}
+	}
+
+	expectedTags := fileTags(path)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = f.WriteString("hello\n")
+	assert.Nil(t, err)
+	f.Close()
+	msg := <-outputChan
+	assert.Equal(t, "hello", string(msg.Content))
+	assert.Subset(t, msg.Origin.Tags(), expectedTags)
+
+	// the messages of the new file carry its inode once the file is rotated
+	assert.Nil(t, os.Rename(path, path+".1"))
+	assert.Nil(t, ioutil.WriteFile(path, []byte("world\n"), 0644))
+	rotatedTags := fileTags(path)
+	assert.NotEqual(t, expectedTags, rotatedTags)
+	scanner.scan()
+	msg = <-outputChan
+	assert.Equal(t, "world", string(msg.Content))
+	assert.Subset(t, msg.Origin.Tags(), rotatedTags)
+}
+
+func TestScannerMessageTransformer(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/test.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(path, nil, 0644))
+
+	pipelineProvider := mock.NewMockProvider()
+	outputChan := pipelineProvider.NextPipelineChan()
+	scanner := NewScanner(config.NewLogSources(), 2, pipelineProvider, auditor.NewRegistry(), 10*time.Millisecond)
+	scanner.SetMessageTransformer(func(msg *message.Message) {
+		msg.Content = append([]byte("transformed "), msg.Content...)
+		msg.Origin.SetTags(append(msg.Origin.Tags(), "enriched:true"))
+	})
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path})
+	scanner.activeSources = append(scanner.activeSources, source)
+	status.InitStatus(config.CreateSources([]*config.LogSource{source}))
+	defer status.Clear()
+	scanner.scan()
+	defer scanner.cleanup()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = f.WriteString("hello\nworld\n")
+	assert.Nil(t, err)
+	f.Close()
+
+	msg := <-outputChan
+	assert.Equal(t, "transformed hello", string(msg.Content))
+	assert.Contains(t, msg.Origin.Tags(), "enriched:true")
+	msg = <-outputChan
+	assert.Equal(t, "transformed world", string(msg.Content))
+	assert.Contains(t, msg.Origin.Tags(), "enriched:true")
+}
+
+func TestScannerMergesOverlappingSourceTags(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/app.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(path, nil, 0644))
+
+	pipelineProvider := mock.NewMockProvider()
+	outputChan := pipelineProvider.NextPipelineChan()
+	scanner := NewScanner(config.NewLogSources(), 2, pipelineProvider, auditor.NewRegistry(), 10*time.Millisecond)
+	scanner.mergeSourceTags = true
+	narrow := config.NewLogSource("narrow", &config.LogsConfig{Type: config.FileType, Path: path, Tags: []string{"team:payments"}})
+	broad := config.NewLogSource("broad", &config.LogsConfig{Type: config.FileType, Path: fmt.Sprintf("%s/*.log", testDir), Tags: []string{"env:prod", "team:platform"}})
+	scanner.activeSources = append(scanner.activeSources, narrow, broad)
+	status.InitStatus(config.CreateSources([]*config.LogSource{narrow, broad}))
+	defer status.Clear()
+	scanner.scan()
+	defer scanner.cleanup()
+
+	// the file is tailed once, by the first source matching it
+	assert.Len(t, scanner.tailers, 1)
+	assert.Equal(t, narrow, scanner.tailers[path].file.Source)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	defer f.Close()
+	_, err = f.WriteString("hello\n")
+	assert.Nil(t, err)
+	msg := <-outputChan
+	assert.Equal(t, "hello", string(msg.Content))
+	assert.Subset(t, msg.Origin.Tags(), []string{"team:payments", "env:prod"})
+	assert.NotContains(t, msg.Origin.Tags(), "team:platform")
+
+	// the tags of a removed source are not sent anymore
+	scanner.activeSources = scanner.activeSources[:1]
+	scanner.scan()
+	_, err = f.WriteString("world\n")
+	assert.Nil(t, err)
+	msg = <-outputChan
+	assert.Equal(t, "world", string(msg.Content))
+	assert.NotContains(t, msg.Origin.Tags(), "env:prod")
+}
+
+func TestScannerTailsFileOncePerProcessingRules(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/app.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(path, nil, 0644))
+
+	pipelineProvider := mock.NewMockProvider()
+	outputChan := pipelineProvider.NextPipelineChan()
+	scanner := NewScanner(config.NewLogSources(), 4, pipelineProvider, auditor.NewRegistry(), 10*time.Millisecond)
+	rules := []*config.ProcessingRule{{Type: config.ExcludeAtMatch, Name: "exclude_debug", Pattern: "DEBUG"}}
+	plain := config.NewLogSource("plain", &config.LogsConfig{Type: config.FileType, Path: path})
+	filtered := config.NewLogSource("filtered", &config.LogsConfig{Type: config.FileType, Path: path, ProcessingRules: rules})
+	duplicate := config.NewLogSource("duplicate", &config.LogsConfig{Type: config.FileType, Path: path})
+	scanner.activeSources = append(scanner.activeSources, plain, filtered, duplicate)
+	status.InitStatus(config.CreateSources([]*config.LogSource{plain, filtered, duplicate}))
+	defer status.Clear()
+	scanner.scan()
+	defer scanner.cleanup()
+
+	// the sources with the same processing rules share a tailer
+	assert.Len(t, scanner.tailers, 2)
+	assert.Equal(t, plain, scanner.tailers[getScanKey(path, plain)].file.Source)
+	assert.Equal(t, filtered, scanner.tailers[getScanKey(path, filtered)].file.Source)
+	assert.NotEqual(t, getScanKey(path, plain), getScanKey(path, filtered))
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	defer f.Close()
+	_, err = f.WriteString("hello\n")
+	assert.Nil(t, err)
+	sources := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		msg := <-outputChan
+		assert.Equal(t, "hello", string(msg.Content))
+		sources[msg.Origin.LogSource.Name] = true
+	}
+	assert.Equal(t, map[string]bool{"plain": true, "filtered": true}, sources)
+}
+
+func TestScannerSourceStatus(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	firstPath := fmt.Sprintf("%s/1.log", testDir)
+	secondPath := fmt.Sprintf("%s/2.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(firstPath, nil, 0644))
+	assert.Nil(t, ioutil.WriteFile(secondPath, nil, 0644))
+
+	pipelineProvider := mock.NewMockProvider()
+	outputChan := pipelineProvider.NextPipelineChan()
+	registry := auditor.NewRegistry()
+	// only the second file is tailed, the files are tailed in reverse lexicographic order
+	scanner := NewScanner(config.NewLogSources(), 1, pipelineProvider, registry, 10*time.Millisecond)
+	wildcard := config.NewLogSource("wildcard", &config.LogsConfig{Type: config.FileType, Path: fmt.Sprintf("%s/*.log", testDir)})
+	missing := config.NewLogSource("missing", &config.LogsConfig{Type: config.FileType, Path: fmt.Sprintf("%s/missing.log", testDir)})
+	scanner.activeSources = append(scanner.activeSources, wildcard, missing)
+	status.InitStatus(config.CreateSources([]*config.LogSource{wildcard, missing}))
+	defer status.Clear()
+	scanner.scan()
+	defer scanner.cleanup()
+
+	registry.SetOffset("42")
+	assert.Nil(t, ioutil.WriteFile(secondPath, []byte("hello\n"), 0644))
+	msg := <-outputChan
+	assert.Equal(t, "hello", string(msg.Content))
+	tailer := scanner.tailers[getScanKey(secondPath, wildcard)]
+	assert.Eventually(t, func() bool { return tailer.getForwardedOffset() == 6 }, time.Second, 10*time.Millisecond)
+
+	statuses := scanner.SourceStatus()
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, SourceStatus{
+		Name:    "wildcard",
+		Pattern: wildcard.Config.Path,
+		Files: []FileStatus{
+			{Path: secondPath, Offset: 6, Tailed: true},
+			{Path: firstPath, Offset: 42, Tailed: false},
+		},
+	}, statuses[0])
+	assert.Equal(t, "missing", statuses[1].Name)
+	assert.Empty(t, statuses[1].Files)
+	assert.NotEmpty(t, statuses[1].Error)
+}
+
+func TestScannerSkipsOldFiles(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/app.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(path, []byte("old\n"), 0644))
+	lastHour := time.Now().Add(-time.Hour)
+	assert.Nil(t, os.Chtimes(path, lastHour, lastHour))
+
+	pipelineProvider := mock.NewMockProvider()
+	outputChan := pipelineProvider.NextPipelineChan()
+	scanner := NewScanner(config.NewLogSources(), 2, pipelineProvider, auditor.NewRegistry(), 10*time.Millisecond)
+	scanner.startTime = time.Now().Add(-time.Minute)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: fmt.Sprintf("%s/*.log", testDir), TailingMode: "beginning", OnlyNewFiles: true})
+	scanner.activeSources = append(scanner.activeSources, source)
+	status.InitStatus(config.CreateSources([]*config.LogSource{source}))
+	defer status.Clear()
+	scanner.scan()
+	defer scanner.cleanup()
+
+	// the file has not been modified since the agent started
+	assert.Len(t, scanner.tailers, 0)
+	assert.Contains(t, source.GetInfo(), "Only new files: 1 files last modified before the agent started are not tailed until they are written")
+
+	// once written, the file is tailed after the content it had when it was skipped
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	defer f.Close()
+	_, err = f.WriteString("new\n")
+	assert.Nil(t, err)
+	scanner.scan()
+	assert.Len(t, scanner.tailers, 1)
+	assert.Empty(t, scanner.oldFiles)
+	assert.NotContains(t, source.GetInfo(), "Only new files: 1 files last modified before the agent started are not tailed until they are written")
+	msg := <-outputChan
+	assert.Equal(t, "new", string(msg.Content))
+}
+
+func TestScannerReadOnlyRegistry(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/app.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(path, []byte("first\nsecond\n"), 0644))
+	snapshotPath := fmt.Sprintf("%s/registry.json", testDir)
+	snapshot := fmt.Sprintf(`{"Version": 2, "Registry": {"file:%s": {"Offset": "6", "LastUpdated": "2006-01-12T01:01:01Z"}}}`, path)
+	assert.Nil(t, ioutil.WriteFile(snapshotPath, []byte(snapshot), 0644))
+
+	pipelineProvider := mock.NewMockProvider()
+	outputChan := pipelineProvider.NextPipelineChan()
+	scanner := NewScanner(config.NewLogSources(), 2, pipelineProvider, auditor.NewRegistry(), 10*time.Millisecond)
+	assert.NotNil(t, scanner.ReadOnlyRegistry(fmt.Sprintf("%s/missing.json", testDir)))
+	assert.Nil(t, scanner.ReadOnlyRegistry(snapshotPath))
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path})
+	scanner.activeSources = append(scanner.activeSources, source)
+	status.InitStatus(config.CreateSources([]*config.LogSource{source}))
+	defer status.Clear()
+	scanner.scan()
+	defer scanner.cleanup()
+
+	// the file is tailed from the offset of the snapshot and the offsets are not committed
+	msg := <-outputChan
+	assert.Equal(t, "second", string(msg.Content))
+	assert.Equal(t, "", msg.Origin.Identifier)
+	content, err := ioutil.ReadFile(snapshotPath)
+	assert.Nil(t, err)
+	assert.Equal(t, snapshot, string(content))
+}
+
+func TestScannerDetectsEncoding(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/app.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(path, []byte("h\x00e\x00l\x00l\x00o\x00\r\x00\n\x00"), 0644))
+
+	pipelineProvider := mock.NewMockProvider()
+	outputChan := pipelineProvider.NextPipelineChan()
+	scanner := NewScanner(config.NewLogSources(), 2, pipelineProvider, auditor.NewRegistry(), 10*time.Millisecond)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, TailingMode: "beginning"})
+	scanner.activeSources = append(scanner.activeSources, source)
+	status.InitStatus(config.CreateSources([]*config.LogSource{source}))
+	defer status.Clear()
+	scanner.scan()
+	defer scanner.cleanup()
+
+	// the file is not skipped as binary, it's decoded from UTF-16
+	msg := <-outputChan
+	assert.Equal(t, "hello", string(msg.Content))
+	assert.Contains(t, source.GetInfo(), fmt.Sprintf("Encoding of %s: utf-16-le with CRLF line endings (detected)", path))
+	assert.Len(t, scanner.encodings, 1)
+
+	// the detection is forgotten once the file is not tailed anymore
+	scanner.activeSources = nil
+	scanner.scan()
+	assert.Len(t, scanner.encodings, 0)
+	assert.NotContains(t, source.GetInfo(), fmt.Sprintf("Encoding of %s: utf-16-le with CRLF line endings (detected)", path))
+}
+
+func TestScannerResumesEachProcessingRulesFromItsOwnEntry(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/app.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(path, []byte("first\nsecond\nthird\n"), 0644))
+	newSources := func() (*config.LogSource, *config.LogSource) {
+		debug := []*config.ProcessingRule{{Type: config.ExcludeAtMatch, Name: "exclude_debug", Pattern: "DEBUG"}}
+		trace := []*config.ProcessingRule{{Type: config.ExcludeAtMatch, Name: "exclude_trace", Pattern: "TRACE"}}
+		return config.NewLogSource("debug", &config.LogsConfig{Type: config.FileType, Path: path, ProcessingRules: debug}),
+			config.NewLogSource("trace", &config.LogsConfig{Type: config.FileType, Path: path, ProcessingRules: trace})
+	}
+	// restart runs a scanner on the registry snapshot and returns the first line read by each source
+	restart := func(snapshot string) map[string]string {
+		snapshotPath := fmt.Sprintf("%s/registry.json", testDir)
+		assert.Nil(t, ioutil.WriteFile(snapshotPath, []byte(snapshot), 0644))
+		pipelineProvider := mock.NewMockProvider()
+		outputChan := pipelineProvider.NextPipelineChan()
+		scanner := NewScanner(config.NewLogSources(), 4, pipelineProvider, auditor.NewRegistry(), 10*time.Millisecond)
+		assert.Nil(t, scanner.ReadOnlyRegistry(snapshotPath))
+		debug, trace := newSources()
+		scanner.activeSources = append(scanner.activeSources, debug, trace)
+		status.InitStatus(config.CreateSources([]*config.LogSource{debug, trace}))
+		defer status.Clear()
+		scanner.scan()
+		defer scanner.cleanup()
+
+		lines := make(map[string]string)
+		for len(lines) < 2 {
+			msg := <-outputChan
+			if _, found := lines[msg.Origin.LogSource.Name]; !found {
+				lines[msg.Origin.LogSource.Name] = string(msg.Content)
+			}
+		}
+		return lines
+	}
+
+	// the tailers of the two sets of processing rules record their offsets in distinct entries
+	debug, trace := newSources()
+	debugID, traceID := NewFile(path, debug, false).registryIdentifier(), NewFile(path, trace, false).registryIdentifier()
+	assert.NotEqual(t, debugID, traceID)
+	assert.NotEqual(t, "file:"+path, debugID)
+
+	// each tailer resumes from its own entry
+	snapshot := fmt.Sprintf(`{"Version": 2, "Registry": {"%s": {"Offset": "6"}, "%s": {"Offset": "13"}, "file:%s": {"Offset": "0"}}}`, debugID, traceID, path)
+	assert.Equal(t, map[string]string{"debug": "second", "trace": "third"}, restart(snapshot))
+
+	// the entry recorded before the processing rules were part of the identifiers is resumed on the first start
+	snapshot = fmt.Sprintf(`{"Version": 2, "Registry": {"file:%s": {"Offset": "6"}}}`, path)
+	assert.Equal(t, map[string]string{"debug": "second", "trace": "second"}, restart(snapshot))
+
+	// the entry of the file updated last is resumed once the processing rules have been edited
+	snapshot = fmt.Sprintf(`{"Version": 2, "Registry": {"file:%[1]s#1234": {"Offset": "13", "LastUpdated": "2021-01-02T00:00:00Z"}, "file:%[1]s": {"Offset": "6", "LastUpdated": "2021-01-01T00:00:00Z"}, "file:%[1]s.1": {"Offset": "0", "LastUpdated": "2021-01-03T00:00:00Z"}}}`, path)
+	assert.Equal(t, map[string]string{"debug": "third", "trace": "third"}, restart(snapshot))
+}
+
+func TestScannerFlush(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/test.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(path, nil, 0644))
+
+	pipelineProvider := mock.NewMockProvider()
+	outputChan := pipelineProvider.NextPipelineChan()
+	// the tailers wait for much longer than the test, only Flush makes them read
+	scanner := NewScanner(config.NewLogSources(), 2, pipelineProvider, auditor.NewRegistry(), time.Hour)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path})
+	scanner.activeSources = append(scanner.activeSources, source)
+	status.InitStatus(config.CreateSources([]*config.LogSource{source}))
+	defer status.Clear()
+	scanner.scan()
+	defer scanner.cleanup()
+
+	received := make(chan string, 10)
+	go func() {
+		for msg := range outputChan {
+			received <- string(msg.Content)
+		}
+	}()
+
+	// the trailing line without line ending is not waited for
+	assert.Nil(t, ioutil.WriteFile(path, []byte("hello\nworld\npartial"), 0644))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	assert.Nil(t, scanner.Flush(ctx))
+	assert.Equal(t, "hello", <-received)
+	assert.Equal(t, "world", <-received)
+
+	// the tailers keep running
+	assert.Len(t, scanner.tailers, 1)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	defer f.Close()
+	_, err = f.WriteString(" line\n")
+	assert.Nil(t, err)
+	assert.Nil(t, scanner.Flush(ctx))
+	assert.Equal(t, "partial line", <-received)
+}
+
+func TestScannerRetriesToOpenNewFile(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	// the file is matched before it can be opened, as a symlink to a file not created yet
+	path := fmt.Sprintf("%s/test.log", testDir)
+	target := fmt.Sprintf("%s/target", testDir)
+	assert.Nil(t, os.Symlink(target, path))
+
+	scanner := NewScanner(config.NewLogSources(), 2, mock.NewMockProvider(), auditor.NewRegistry(), 10*time.Millisecond)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path})
+	scanner.activeSources = append(scanner.activeSources, source)
+
+	// the start is retried after a backoff by the run loop, the scan doesn't wait for it
+	assert.False(t, scanner.startNewTailer(NewFile(path, source, false), config.Beginning))
+	pending := scanner.pendingOpens[path]
+	assert.Equal(t, 1, pending.retries)
+	assert.Equal(t, 1, pending.failures)
+	select {
+	case <-scanner.openRetry:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the retry was not requested")
+	}
+
+	// a failed retry schedules the next one, it doesn't count as a failed scan
+	scanner.retryPendingOpens(time.Now())
+	assert.Empty(t, scanner.tailers)
+	assert.Equal(t, 2, pending.retries)
+	assert.Equal(t, 1, pending.failures)
+	assert.False(t, pending.retryAt.IsZero())
+
+	// the retry is not due yet
+	assert.Nil(t, ioutil.WriteFile(target, nil, 0644))
+	scanner.retryPendingOpens(pending.retryAt.Add(-time.Millisecond))
+	assert.Empty(t, scanner.tailers)
+
+	scanner.retryPendingOpens(pending.retryAt)
+	assert.Len(t, scanner.tailers, 1)
+	assert.Empty(t, scanner.pendingOpens)
+	scanner.cleanup()
+}
+
+func TestScannerReportsFilesFailingToOpen(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/test.log", testDir)
+	target := fmt.Sprintf("%s/target", testDir)
+	assert.Nil(t, os.Symlink(target, path))
+
+	scanner := NewScanner(config.NewLogSources(), 2, mock.NewMockProvider(), auditor.NewRegistry(), 10*time.Millisecond)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: fmt.Sprintf("%s/*.log", testDir)})
+	scanner.activeSources = append(scanner.activeSources, source)
+	status.Clear()
+	status.InitStatus(config.CreateSources([]*config.LogSource{source}))
+	defer status.Clear()
+
+	// the file is retried at each scan and reported once it failed for enough scans
+	for i := 1; i < pendingOpenWarningScans; i++ {
+		scanner.scan()
+		assert.Empty(t, scanner.tailers)
+		assert.Equal(t, i, scanner.pendingOpens[path].failures)
+		assert.Empty(t, status.Get().Warnings)
+	}
+	scanner.scan()
+	assert.Empty(t, scanner.tailers)
+	assert.Len(t, status.Get().Warnings, 1)
+	assert.Contains(t, status.Get().Warnings[0], fmt.Sprintf("%s could not be opened during the last %d scans", path, pendingOpenWarningScans))
+
+	// the warning is removed once the file can be opened
+	assert.Nil(t, ioutil.WriteFile(target, nil, 0644))
+	scanner.scan()
+	assert.Len(t, scanner.tailers, 1)
+	assert.Empty(t, scanner.pendingOpens)
+	assert.Empty(t, status.Get().Warnings)
+	scanner.cleanup()
+}
+
+func TestScannerPollsWhenInotifyIsDisabled(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	path := fmt.Sprintf("%s/app.log", testDir)
+	file, err := os.Create(path)
+	assert.Nil(t, err)
+	defer file.Close()
+
+	pipelineProvider := mock.NewMockProvider()
+	scanner := NewScanner(config.NewLogSources(), 1, pipelineProvider, auditor.NewRegistry(), 20*time.Millisecond)
+	scanner.Start()
+	scanner.Stop()
+	assert.Nil(t, scanner.watcher)
+
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path})
+	scanner.addSource(source)
+	defer scanner.cleanup()
+
+	// the tailer keeps polling its file at the tailer sleep duration
+	tailer := scanner.tailers[getScanKey(path, source)]
+	assert.NotNil(t, tailer)
+	assert.Equal(t, 20*time.Millisecond, tailer.sleepDuration)
+
+	_, err = file.WriteString("hello world\n")
+	assert.Nil(t, err)
+	msg := <-pipelineProvider.NextPipelineChan()
+	assert.Equal(t, "hello world", string(msg.Content))
+}
+
+func TestScannerWatchesDirectoriesWithInotify(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+
+	sources := config.NewLogSources()
+	pipelineProvider := mock.NewMockProvider()
+	scanner := NewScanner(sources, 1, pipelineProvider, auditor.NewRegistry(), 20*time.Millisecond)
+	scanner.useInotify = true
+	scanner.Start()
+	defer scanner.Stop()
+	if scanner.watcher == nil {
+		t.Skip("inotify is not available")
+	}
+
+	// the directory of the source is watched before the file exists
+	path := fmt.Sprintf("%s/app.log", testDir)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path})
+	sources.AddSource(source)
+	assert.Eventually(t, func() bool {
+		scanner.lock.Lock()
+		defer scanner.lock.Unlock()
+		return scanner.watcher.dirs[testDir]
+	}, time.Second, 10*time.Millisecond)
+
+	// the creation of the file triggers a scan, without waiting for the scan period
+	file, err := os.Create(path)
+	assert.Nil(t, err)
+	defer file.Close()
+	var tailer *Tailer
+	assert.Eventually(t, func() bool {
+		scanner.lock.Lock()
+		defer scanner.lock.Unlock()
+		tailer = scanner.tailers[getScanKey(path, source)]
+		return tailer != nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, watchedFilePollPeriod, tailer.sleepDuration)
+
+	// the write wakes the tailer up, without waiting for its poll period
+	_, err = file.WriteString("hello world\n")
+	assert.Nil(t, err)
+	select {
+	case msg := <-pipelineProvider.NextPipelineChan():
+		assert.Equal(t, "hello world", string(msg.Content))
+	case <-time.After(watchedFilePollPeriod / 2):
+		assert.Fail(t, "the tailer was not woken up by the write")
+	}
+}
+
+func TestScannerExpandsSourcePaths(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(testDir)
+	path := fmt.Sprintf("%s/app.log", testDir)
+	assert.Nil(t, ioutil.WriteFile(path, []byte("hello\n"), 0644))
+	os.Setenv("DD_TEST_LOG_DIR", testDir)
+	defer os.Unsetenv("DD_TEST_LOG_DIR")
+
+	scanner := NewScanner(config.NewLogSources(), 2, mock.NewMockProvider(), auditor.NewRegistry(), 10*time.Millisecond)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: "${DD_TEST_LOG_DIR}/*.log", TailingMode: "beginning"})
+	scanner.addSource(source)
+	assert.Equal(t, fmt.Sprintf("%s/*.log", testDir), scanner.fileProvider.sourcePath(source))
+	assert.NotNil(t, scanner.tailers[getScanKey(path, source)])
+	// the config keeps the path given by the user
+	assert.Equal(t, "${DD_TEST_LOG_DIR}/*.log", source.Config.Path)
+
+	// a literal path is used as is
+	literal := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: "${DD_TEST_LOG_DIR}/app.log", LiteralPath: true})
+	scanner.addSource(literal)
+	assert.Equal(t, "${DD_TEST_LOG_DIR}/app.log", scanner.fileProvider.sourcePath(literal))
+
+	// the path is forgotten with the source
+	scanner.removeSource(source)
+	assert.NotContains(t, scanner.fileProvider.sourcePaths, source)
+	scanner.cleanup()
+}
+
+func TestScannerTranslatesBindMountedPaths(t *testing.T) {
+	containerDir, err := ioutil.TempDir("", "log-scanner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(containerDir)
+	hostDir := "/var/log/dd-scanner-host-test"
+	path := fmt.Sprintf("%s/app.log", containerDir)
+	hostPath := fmt.Sprintf("%s/app.log", hostDir)
+	assert.Nil(t, ioutil.WriteFile(path, []byte("hello\nworld\n"), 0644))
+
+	// the offset recorded under the host path is used to tail the file read under the container path
+	checkpointFile := fmt.Sprintf("%s/offsets.json", containerDir)
+	assert.Nil(t, writeCheckpoint(checkpointFile, map[string]int64{hostPath: 6}))
+
+	registry := auditor.NewRegistry()
+	scanner := NewScanner(config.NewLogSources(), 2, mock.NewMockProvider(), registry, 10*time.Millisecond)
+	source := config.NewLogSource("", &config.LogsConfig{
+		Type:                config.FileType,
+		Path:                hostPath,
+		Identifier:          "123456789",
+		CheckpointFile:      checkpointFile,
+		HostPathPrefix:      hostDir,
+		ContainerPathPrefix: containerDir,
+	})
+	scanner.addSource(source)
+	assert.Equal(t, path, scanner.fileProvider.sourcePath(source))
+	assert.Equal(t, hostPath, source.Config.Path)
+
+	tailer := scanner.tailers[getScanKey(path, source)]
+	if !assert.NotNil(t, tailer) {
+		return
+	}
+	assert.Equal(t, "file:"+hostPath, tailer.Identifier())
+	assert.Equal(t, "file:"+hostPath, registry.GetIdentifier())
+	msg := <-tailer.outputChan
+	assert.Equal(t, "world", string(msg.Content))
+
+	// the offsets are recorded under the host path
+	scanner.writeCheckpoints([]*Tailer{tailer})
+	offsets, err := loadCheckpoint(checkpointFile)
+	assert.Nil(t, err)
+	assert.Contains(t, offsets, hostPath)
+	assert.NotContains(t, offsets, path)
+	scanner.cleanup()
+}
+
+func TestResolveSourcePath(t *testing.T) {
+	os.Setenv("DD_TEST_LOG_DIR", "/var/log/app")
+	defer os.Unsetenv("DD_TEST_LOG_DIR")
+
+	c := &config.LogsConfig{
+		Type:                config.FileType,
+		Path:                "${DD_TEST_LOG_DIR}/*.log",
+		HostPathPrefix:      "/var/log",
+		ContainerPathPrefix: "/host/var/log",
+	}
+	assert.Equal(t, "/host/var/log/app/*.log", resolveSourcePath(c))
+	assert.Equal(t, "${DD_TEST_LOG_DIR}/*.log", c.Path)
+
+	// the container paths are kept
+	assert.Equal(t, "/host/var/log/app/*.log", translateSourcePath(c, "/host/var/log/app/*.log"))
+
+	// the paths are not translated without prefixes
+	c = &config.LogsConfig{Type: config.FileType, Path: "/var/log/app/*.log"}
+	assert.Equal(t, "/var/log/app/*.log", resolveSourcePath(c))
+}
+
+func TestProviderTranslatesExcludePaths(t *testing.T) {
+	p := NewProvider(10)
+	source := config.NewLogSource("", &config.LogsConfig{
+		Type:                config.FileType,
+		Path:                "/var/log/app/*.log",
+		ExcludePaths:        []string{"*-debug.log", "/var/log/app/audit*.log", "/host/var/log/app/trace*.log"},
+		HostPathPrefix:      "/var/log",
+		ContainerPathPrefix: "/host/var/log",
+	})
+	for path, excluded := range map[string]bool{
+		"/host/var/log/app/app-debug.log": true,
+		"/host/var/log/app/audit.log":     true,
+		"/host/var/log/app/trace.log":     true,
+		"/host/var/log/app/app.log":       false,
+	} {
+		isExcluded, err := p.isExcluded(path, source)
+		assert.Nil(t, err)
+		assert.Equal(t, excluded, isExcluded, path)
+	}
+	assert.Equal(t, []string{"*-debug.log", "/var/log/app/audit*.log", "/host/var/log/app/trace*.log"}, source.Config.ExcludePaths)
+}
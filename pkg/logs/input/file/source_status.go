@@ -0,0 +1,77 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// SourceStatus is the state of an active file source
+type SourceStatus struct {
+	// Name is the name of the source
+	Name string
+	// Pattern is the path of the source, possibly with wildcards
+	Pattern string
+	// Files holds the files currently matching the pattern
+	Files []FileStatus
+	// Error is the reason why no file could be resolved, empty otherwise
+	Error string
+}
+
+// FileStatus is the state of a file matching an active file source
+type FileStatus struct {
+	Path string
+	// Offset is the offset forwarded by the tailer of the file when it is tailed,
+	// otherwise the offset committed to the registry, 0 when there is none
+	Offset int64
+	// Tailed is true when a tailer is reading the file, a file matching several sources
+	// with the same processing rules is read by the tailer of the first of them
+	Tailed bool
+	// IdleClosed is true when the tailer of the file closed it because it is idle, it reopens it once it grows
+	IdleClosed bool
+}
+
+// SourceStatus returns the state of the active sources, in the order they were added, with the files
+// currently matching them. The snapshot is taken while the scanner is locked so that the files and their
+// tailers are consistent with each other.
+func (s *Scanner) SourceStatus() []SourceStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	statuses := make([]SourceStatus, 0, len(s.activeSources))
+	for _, source := range s.activeSources {
+		status := SourceStatus{
+			Name:    source.Name,
+			Pattern: source.Config.Path,
+		}
+		files, err := s.fileProvider.CollectFiles(source)
+		if err != nil {
+			status.Error = err.Error()
+		}
+		for _, file := range files {
+			status.Files = append(status.Files, s.fileStatus(file))
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// fileStatus returns the state of the file, it must be called with the lock held
+func (s *Scanner) fileStatus(file *File) FileStatus {
+	status := FileStatus{Path: file.Path}
+	if tailer, isTailed := s.tailers[file.GetScanKey()]; isTailed && atomic.LoadInt32(&tailer.shouldStop) == 0 {
+		status.Tailed = true
+		status.IdleClosed = tailer.isIdleClosed()
+		status.Offset = tailer.getForwardedOffset()
+		return status
+	}
+	// the registry entry of the file is the identifier of its tailer
+	if offset, err := strconv.ParseInt(s.registry.GetOffset(file.registryIdentifier()), 10, 64); err == nil {
+		status.Offset = offset
+	}
+	return status
+}
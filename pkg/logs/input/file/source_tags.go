@@ -0,0 +1,71 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"strings"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+)
+
+// mergeOverlappingSourceTags sets on each tailer the tags of the other sources matching its file, when several
+// sources resolve to the same file it is tailed once, by the first source matching it, and its messages carry
+// the tags of all of them, e.g. a broad source adding base tags and a narrow source adding specific ones.
+// The tags are updated at each scan so that the tags of a removed source stop being sent.
+func (s *Scanner) mergeOverlappingSourceTags(files []*File) {
+	sources := make(map[string][]*config.LogSource)
+	for _, file := range files {
+		key := file.GetScanKey()
+		sources[key] = append(sources[key], file.Source)
+	}
+	for key, tailer := range s.tailers {
+		tailer.setSourceTags(mergeSourceTags(tailer.file.Source, sources[key]))
+	}
+}
+
+// mergeSourceTags returns the tags of the sources to add to the messages of the owner source, i.e. the source
+// of the tailer. For a tag key defined by several sources, the value of the owner wins, then the value of the first
+// source in the order the sources match the file. The tags without a value are added once.
+func mergeSourceTags(owner *config.LogSource, sources []*config.LogSource) []string {
+	keys := make(map[string]bool)
+	for _, tag := range owner.Config.Tags {
+		keys[tagKey(tag)] = true
+	}
+	var tags []string
+	for _, source := range sources {
+		if source == owner {
+			continue
+		}
+		for _, tag := range source.Config.Tags {
+			key := tagKey(tag)
+			if keys[key] {
+				continue
+			}
+			keys[key] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// tagKey returns the key of the tag, the whole tag when it has no value
+func tagKey(tag string) string {
+	if i := strings.IndexByte(tag, ':'); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
+
+// setSourceTags sets the tags of the other sources matching the file of the tailer
+func (t *Tailer) setSourceTags(tags []string) {
+	t.sourceTags.Store(tags)
+}
+
+// getSourceTags returns the tags of the other sources matching the file of the tailer
+func (t *Tailer) getSourceTags() []string {
+	tags, _ := t.sourceTags.Load().([]string)
+	return tags
+}
@@ -0,0 +1,27 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+)
+
+func TestMergeSourceTags(t *testing.T) {
+	owner := config.NewLogSource("narrow", &config.LogsConfig{Tags: []string{"team:payments", "critical"}})
+	broad := config.NewLogSource("broad", &config.LogsConfig{Tags: []string{"env:prod", "team:platform", "critical"}})
+	other := config.NewLogSource("other", &config.LogsConfig{Tags: []string{"env:staging", "region:eu"}})
+
+	// the owner wins, then the first source matching the file
+	assert.Equal(t, []string{"env:prod", "region:eu"}, mergeSourceTags(owner, []*config.LogSource{owner, broad, other}))
+	assert.Equal(t, []string{"region:eu"}, mergeSourceTags(broad, []*config.LogSource{owner, broad, other}))
+
+	// a file matched by its source only has no tags to merge
+	assert.Empty(t, mergeSourceTags(owner, []*config.LogSource{owner}))
+}
@@ -0,0 +1,88 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+// +build !windows
+
+package file
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// openStream opens a stream without blocking when it has no writer yet,
+// the reads then wait for the data through the runtime poller.
+func openStream(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+}
+
+// setupStream opens the stream of the tailer, streams are read from their current position
+func (t *Tailer) setupStream() error {
+	f, err := openStream(t.fullpath)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if fi.Mode().IsRegular() {
+		f.Close()
+		return fmt.Errorf("stream mode can't be used on the regular file %s", t.file.Path)
+	}
+
+	t.osFile = f
+	t.readOffset = 0
+	t.decodedOffset = 0
+
+	return nil
+}
+
+// readStream reads the data available in the stream, the stream is reopened
+// once its writer closed it.
+func (t *Tailer) readStream() (int, error) {
+	// don't block forever on an idle stream so that the tailer can be stopped,
+	// not all the streams support deadlines though.
+	t.osFile.SetReadDeadline(time.Now().Add(t.sleepDuration)) //nolint:errcheck
+	inBuf := t.readBuffers.get()
+	n, err := t.osFile.Read(inBuf)
+	if n > 0 {
+		t.decoder.InputChan <- t.newInput(inBuf, n)
+		t.incrementReadOffset(n)
+	} else {
+		t.readBuffers.put(inBuf)
+	}
+	switch {
+	case err == nil, os.IsTimeout(err):
+		return n, nil
+	case err == io.EOF:
+		if n == 0 {
+			t.reopenStream()
+		}
+		return n, nil
+	default:
+		// an unexpected error occurred, stop the tailer
+		t.file.Source.Status.Error(err)
+		return 0, log.Error("Unexpected error occurred while reading stream: ", err)
+	}
+}
+
+// reopenStream replaces the stream of the tailer by a new one,
+// the current stream is kept if the path can't be opened.
+func (t *Tailer) reopenStream() {
+	f, err := openStream(t.fullpath)
+	if err != nil {
+		log.Debugf("Could not reopen the stream %s: %v", t.file.Path, err)
+		return
+	}
+	t.osFile.Close()
+	t.osFile = f
+}
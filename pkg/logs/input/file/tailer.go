@@ -12,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -25,16 +26,41 @@ import (
 	"github.com/DataDog/datadog-agent/pkg/logs/input/docker"
 	"github.com/DataDog/datadog-agent/pkg/logs/input/kubernetes"
 	"github.com/DataDog/datadog-agent/pkg/logs/message"
+	"github.com/DataDog/datadog-agent/pkg/logs/metrics"
 	"github.com/DataDog/datadog-agent/pkg/logs/tag"
 )
 
 // DefaultSleepDuration represents the amount of time the tailer waits before reading new data when no data is received
 const DefaultSleepDuration = 1 * time.Second
 
+const (
+	// heartbeatContent is the content of the heartbeat messages
+	heartbeatContent = "heartbeat"
+	// heartbeatTag is added to the heartbeat messages to distinguish them from the content of the file
+	heartbeatTag = "logs_heartbeat:true"
+)
+
+// Keys of the tags holding the inode and the device of the file, added when the source has add_file_metadata set
+const (
+	fileInodeTagKey  = "file.inode"
+	fileDeviceTagKey = "file.device"
+)
+
+// fileOffsetTagKey is the key of the tag holding the offset of the first byte of a line, added when the source has
+// add_offset set. The offsets of a compressed file are the ones of its uncompressed content.
+const fileOffsetTagKey = "file.offset"
+
+// idleCommitInterval is the time after which the offset read since the last commit is committed when the
+// tailer is idle, for the commit policies only defining a number of bytes.
+const idleCommitInterval = 5 * time.Second
+
 // Tailer tails one file and sends messages to an output channel
 type Tailer struct {
 	readOffset    int64
 	decodedOffset int64
+	// forwardedOffset is the position in the file of the last byte forwarded to the output channel,
+	// it keeps being tracked after a file rotation.
+	forwardedOffset int64
 
 	// file contains the logs configuration for the file to parse (path, source, ...)
 	// If you are looking for the os.file use to read on the FS, see osFile.
@@ -47,21 +73,125 @@ type Tailer struct {
 	outputChan  chan *message.Message
 	decoder     *decoder.Decoder
 	tagProvider tag.Provider
+	// buffer holds the decoded messages waiting to be sent to the output channel,
+	// it lets the tailer keep reading the file during short pipeline stalls.
+	// It is nil when buffering is disabled.
+	buffer chan bufferedMessage
 
 	sleepDuration time.Duration
 
+	// readBuffers hands out the buffers the file is read into, the buffers are allocated for each read when it's nil
+	readBuffers *readBufferPool
+
+	// sourceTags holds the tags of the other sources matching the file, it's set by the scanner when
+	// logs_config.file_merge_overlapping_source_tags is enabled
+	sourceTags atomic.Value
+
+	// rateLimiter caps the number of lines sent by all the tailers of the scanner, it's nil when there is no limit
+	rateLimiter *lineRateLimiter
+
+	// transform is applied to the messages before they are sent to the output channel, when set
+	transform MessageTransformer
+
+	// fullRead is the state of the tailer when it re-reads its whole file each time it changes
+	fullRead *fullReadState
+
+	// encodingInode is the inode of the file whose encoding was detected by the scanner, 0 when it was not detected
+	encodingInode uint64
+
+	// timestampParser parses the time of the messages from their content, it's nil when the source has no timestamp pattern
+	timestampParser *timestampParser
+
+	// commitPolicy defines which messages carry the offset to commit to the registry,
+	// lastCommit and lastCommitOffset are only used by the forwarding goroutine
+	commitPolicy     CommitPolicy
+	lastCommit       time.Time
+	lastCommitOffset int64
+	// readOnlyRegistry is set when the registry is a snapshot, no offset is committed
+	readOnlyRegistry bool
+
+	// prefixSize and prefixChecksum identify the content of the file with the checksum rotation detection,
+	// they are only used by the scanner
+	prefixSize     int
+	prefixChecksum uint32
+
+	// heartbeatInterval is the amount of time without new data after which a heartbeat message is sent,
+	// heartbeats are disabled when it is 0.
+	heartbeatInterval time.Duration
+
+	// maxBacklogAge is the amount of time after which a message not sent yet is dropped, 0 disables it.
+	// staleDropped counts the dropped messages.
+	maxBacklogAge time.Duration
+	staleDropped  int64
+
+	// collapseWindow is the amount of time during which the consecutive identical lines are collapsed into
+	// one message, the lines are not collapsed when it is 0. repeated is only used by the forwarding goroutine.
+	collapseWindow time.Duration
+	repeated       repeatedLine
+	// idleOffset and idleSince are used by the reading goroutine to detect that the file is idle
+	idleOffset int64
+	idleSince  time.Time
+
+	// idleCloseTimeout is the amount of time without new data after which the file is closed until it grows,
+	// the file is kept open when it is 0. lastReadAt is only used by the reading goroutine.
+	idleCloseTimeout time.Duration
+	lastReadAt       time.Time
+	idleClosed       int32
+	// fileLock protects osFile and closedInfo, they are changed by the reading goroutine when the file is idle
+	// closed and reopened, while the scanner checks the file for rotations. closedInfo is the info of the idle
+	// closed file, nil while the file is open.
+	fileLock   sync.Mutex
+	closedInfo os.FileInfo
+
 	closeTimeout  time.Duration
 	shouldStop    int32
 	didFileRotate int32
-	stop          chan struct{}
-	done          chan struct{}
+	// unreadAfterRotation is set when the tailer was stopped after a file rotation
+	// before reaching the end of the rotated file.
+	unreadAfterRotation int32
+	stop                chan struct{}
+	done                chan struct{}
+	// wake interrupts the wait for new data when the file is known to have changed
+	wake chan struct{}
 
 	forwardContext context.Context
 	stopForward    context.CancelFunc
 }
 
+// CommitPolicy defines how often a tailer commits its offset to the registry: the offset is
+// committed once Interval elapsed or Bytes bytes were read since the last commit. The offset
+// is committed for every message when both are zero. The logs read after the last commit are
+// read again when the agent restarts, so committing less often trades durability for fewer
+// registry updates. The offset read since the last commit is also committed once the tailer
+// is idle for Interval, or idleCommitInterval without Interval, and when the tailer stops.
+type CommitPolicy struct {
+	Interval time.Duration
+	Bytes    int64
+}
+
+// bufferedMessage is a message waiting in the buffer of the tailer along with
+// the position in the file of its last byte. Its message is nil for the lines
+// that must only update the position.
+type bufferedMessage struct {
+	message         *message.Message
+	forwardedOffset int64
+	readAt          time.Time
+}
+
 // NewTailer returns an initialized Tailer
 func NewTailer(outputChan chan *message.Message, file *File, sleepDuration time.Duration) *Tailer {
+	return NewTailerWithLineDecoder(outputChan, file, sleepDuration, nil)
+}
+
+// NewTailerWithLineDecoder returns an initialized Tailer splitting the content of the file
+// into records with lineDecoder, the content is split on new lines when it is nil.
+func NewTailerWithLineDecoder(outputChan chan *message.Message, file *File, sleepDuration time.Duration, lineDecoder decoder.LineDecoder) *Tailer {
+	return newTailer(outputChan, file, sleepDuration, lineDecoder, file.Source.Config.Encoding)
+}
+
+// newTailer returns an initialized Tailer decoding the content of the file with the given encoding,
+// the encoding of its source or the one detected from its content.
+func newTailer(outputChan chan *message.Message, file *File, sleepDuration time.Duration, lineDecoder decoder.LineDecoder, encoding string) *Tailer {
 	// TODO: remove those checks and add to source a reference to a tagProvider and a lineParser.
 	var parser lineParser.Parser
 	var matcher decoder.EndLineMatcher
@@ -73,7 +203,7 @@ func NewTailer(outputChan chan *message.Message, file *File, sleepDuration time.
 		parser = docker.JSONParser
 		matcher = &decoder.NewLineMatcher{}
 	default:
-		switch file.Source.Config.Encoding {
+		switch encoding {
 		case config.UTF16BE:
 			parser = lineParser.NewDecodingParser(lineParser.UTF16BE)
 			matcher = decoder.NewBytesSequenceMatcher(decoder.Utf16beEOL)
@@ -84,6 +214,12 @@ func NewTailer(outputChan chan *message.Message, file *File, sleepDuration time.
 			parser = lineParser.NoopParser
 			matcher = &decoder.NewLineMatcher{}
 		}
+		if file.Source.Config.Format == config.JournalExportFormat {
+			parser = lineParser.JournalExportParser
+			if lineDecoder == nil {
+				lineDecoder = decoder.NewJournalExportDecoder()
+			}
+		}
 	}
 
 	var tagProvider tag.Provider
@@ -96,18 +232,37 @@ func NewTailer(outputChan chan *message.Message, file *File, sleepDuration time.
 	forwardContext, stopForward := context.WithCancel(context.Background())
 	closeTimeout := coreConfig.Datadog.GetDuration("logs_config.close_timeout") * time.Second
 
+	var fileDecoder *decoder.Decoder
+	if lineDecoder != nil {
+		fileDecoder = decoder.NewDecoderWithLineDecoder(file.Source, parser, lineDecoder)
+	} else {
+		fileDecoder = decoder.NewDecoderWithEndLineMatcher(file.Source, parser, matcher)
+	}
+
+	var buffer chan bufferedMessage
+	if bufferSize := coreConfig.Datadog.GetInt("logs_config.file_tailer_buffer_size"); bufferSize > 0 {
+		buffer = make(chan bufferedMessage, bufferSize)
+	}
+
 	return &Tailer{
-		file:           file,
-		outputChan:     outputChan,
-		decoder:        decoder.NewDecoderWithEndLineMatcher(file.Source, parser, matcher),
-		tagProvider:    tagProvider,
-		readOffset:     0,
-		sleepDuration:  sleepDuration,
-		closeTimeout:   closeTimeout,
-		stop:           make(chan struct{}, 1),
-		done:           make(chan struct{}, 1),
-		forwardContext: forwardContext,
-		stopForward:    stopForward,
+		file:              file,
+		outputChan:        outputChan,
+		decoder:           fileDecoder,
+		tagProvider:       tagProvider,
+		buffer:            buffer,
+		readOffset:        0,
+		sleepDuration:     sleepDuration,
+		heartbeatInterval: time.Duration(file.Source.Config.Heartbeat) * time.Second,
+		collapseWindow:    time.Duration(file.Source.Config.CollapseRepeatedLines) * time.Second,
+		maxBacklogAge:     time.Duration(file.Source.Config.MaxBacklogAge) * time.Second,
+		timestampParser:   newTimestampParser(file.Source.Config),
+		idleCloseTimeout:  time.Duration(file.Source.Config.IdleCloseTimeout) * time.Second,
+		closeTimeout:      closeTimeout,
+		stop:              make(chan struct{}, 1),
+		done:              make(chan struct{}, 1),
+		wake:              make(chan struct{}, 1),
+		forwardContext:    forwardContext,
+		stopForward:       stopForward,
 	}
 }
 
@@ -117,8 +272,10 @@ func NewTailer(outputChan chan *message.Message, file *File, sleepDuration time.
 // the same value for different tailers. It is happening during container rotation
 // where the dead container still has a tailer running on the log file, and the tailer
 // of the freshly spawned container starts tailing this file as well.
+// The path is the host path of the file when its source translates the paths, so that the
+// offset is kept when the host directory is mounted elsewhere in the agent container.
 func (t *Tailer) Identifier() string {
-	return fmt.Sprintf("file:%s", t.file.Path)
+	return t.file.registryIdentifier()
 }
 
 // Start let's the tailer open a file and tail from whence
@@ -133,6 +290,9 @@ func (t *Tailer) Start(offset int64, whence int) error {
 
 	go t.forwardMessages()
 	t.decoder.Start()
+	t.idleOffset = t.GetReadOffset()
+	t.idleSince = time.Now()
+	t.lastReadAt = t.idleSince
 	go t.readForever()
 
 	return nil
@@ -147,17 +307,26 @@ func (t *Tailer) readForever() {
 		if err != nil {
 			return
 		}
+		if err := t.decoder.Err(); err != nil {
+			// the records can't be found anymore, the offset stays at the end of the last decoded one
+			t.file.Source.Status.Error(fmt.Errorf("could not decode the records of %s, the tailer is stopped: %v", t.file.Path, err))
+			log.Errorf("Could not decode the records of %s, stopping the tailer: %v", t.file.Path, err)
+			return
+		}
 		t.file.Source.BytesRead.Add(int64(n))
+		t.updateBufferInfo()
 
 		select {
 		case <-t.stop:
 			if n != 0 && atomic.LoadInt32(&t.didFileRotate) == 1 {
 				log.Warn("Tailer stopped after rotation close timeout with remaining unread data")
+				atomic.StoreInt32(&t.unreadAfterRotation, 1)
 			}
 			// stop reading data from file
 			return
 		default:
 			if n == 0 {
+				t.heartbeatIfIdle()
 				// wait for new data to come
 				t.wait()
 			}
@@ -174,6 +343,23 @@ func (t *Tailer) buildTailerTags() []string {
 	return tags
 }
 
+// buildFileMetadataTags returns the device and inode tags of the file when the source asks for them,
+// they identify the file the messages come from even after it has been rotated.
+// No tags are returned when they can't be determined, e.g. on windows.
+func (t *Tailer) buildFileMetadataTags(f *os.File) []string {
+	if !t.file.Source.Config.AddFileMetadata {
+		return nil
+	}
+	ino := inode(f)
+	if ino == 0 {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("%s:%d", fileInodeTagKey, ino),
+		fmt.Sprintf("%s:%d", fileDeviceTagKey, device(f)),
+	}
+}
+
 // StartFromBeginning lets the tailer start tailing its file
 // from the beginning
 func (t *Tailer) StartFromBeginning() error {
@@ -208,44 +394,254 @@ func (t *Tailer) startStopTimer() {
 // onStop finishes to stop the tailer
 func (t *Tailer) onStop() {
 	log.Info("Closing", t.file.Path, "for tailer key", t.file.GetScanKey())
+	if t.buffer != nil {
+		t.file.Source.RemoveInfo(t.bufferInfoKey())
+	}
+	t.file.Source.RemoveInfo(t.idleClosedInfoKey())
+	t.fileLock.Lock()
 	t.osFile.Close()
+	t.fileLock.Unlock()
 	t.decoder.Stop()
 }
 
 // forwardMessages lets the Tailer forward log messages to the output channel
 func (t *Tailer) forwardMessages() {
+	var bufferFlushed chan struct{}
+	if t.buffer != nil {
+		bufferFlushed = make(chan struct{})
+		go t.sendBufferedMessages(bufferFlushed)
+	}
 	defer func() {
+		if t.buffer != nil {
+			close(t.buffer)
+			<-bufferFlushed
+		}
 		// the decoder has successfully been flushed
 		atomic.StoreInt32(&t.shouldStop, 1)
 		close(t.done)
 	}()
-	for output := range t.decoder.OutputChan {
+	forwardedOffset := t.decodedOffset
+	atomic.StoreInt64(&t.forwardedOffset, forwardedOffset)
+	t.lastCommit = time.Now()
+	t.lastCommitOffset = t.decodedOffset
+
+	// the repeats of a line are flushed when its collapse window expires, even if no other line is read
+	var collapseTicks <-chan time.Time
+	if t.collapseWindow > 0 {
+		ticker := time.NewTicker(t.collapseWindow)
+		defer ticker.Stop()
+		collapseTicks = ticker.C
+	}
+	var commitTicks <-chan time.Time
+	if interval := t.idleCommitInterval(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		commitTicks = ticker.C
+	}
+	// the pending offset is committed once the repeats have been flushed
+	defer t.commitPending()
+	defer t.flushRepeats()
+
+	for {
+		var output *decoder.Message
+		var ok bool
+		select {
+		case output, ok = <-t.decoder.OutputChan:
+		case now := <-collapseTicks:
+			t.flushRepeatsIfExpired(now)
+			continue
+		case now := <-commitTicks:
+			t.commitIfIdle(now)
+			continue
+		}
+		if !ok {
+			return
+		}
+
+		startOffset := forwardedOffset
+		forwardedOffset += int64(output.RawDataLen)
 		offset := t.decodedOffset + int64(output.RawDataLen)
 		identifier := t.Identifier()
 		if !t.shouldTrackOffset() {
 			offset = 0
 			identifier = ""
+		} else if !t.shouldCommit(offset) {
+			// the offset is not committed to the registry
+			identifier = ""
 		}
 		t.decodedOffset = offset
 		origin := message.NewOrigin(t.file.Source)
 		origin.Identifier = identifier
 		origin.Offset = strconv.FormatInt(offset, 10)
-		origin.SetTags(append(t.tags, t.tagProvider.GetTags()...))
+		tags := append(t.tags, t.tagProvider.GetTags()...)
+		if t.file.Source.Config.AddOffset && !t.isStream() && !t.isFullRead() {
+			// the tags can share their backing array with the tailer tags, copy them as the offset is per message
+			tags = append(tags[:len(tags):len(tags)], fmt.Sprintf("%s:%d", fileOffsetTagKey, startOffset))
+		}
+		if sourceTags := t.getSourceTags(); len(sourceTags) > 0 {
+			tags = append(tags[:len(tags):len(tags)], sourceTags...)
+		}
+		origin.SetTags(tags)
 		// Ignore empty lines once the registry offset is updated
 		if len(output.Content) == 0 {
+			t.flushRepeats()
+			t.send(nil, forwardedOffset)
 			continue
 		}
-		// Make the write to the output chan cancellable to be able to stop the tailer
-		// after a file rotation when it is stuck on it.
-		// We don't return directly to keep the same shutdown sequence that in the
-		// normal case.
+		// the lines are not sent anyway once the forward context is cancelled
+		t.rateLimiter.wait(t.forwardContext, t.file.Source) //nolint:errcheck
+		msg := message.NewMessage(output.Content, origin, output.Status)
+		if t.timestampParser != nil {
+			t.setTimestamp(msg)
+		}
+		if t.collapseWindow > 0 {
+			t.collapse(msg, tags, forwardedOffset, time.Now())
+			continue
+		}
+		t.send(msg, forwardedOffset)
+	}
+}
+
+// send sends the message to the output channel, or to the buffer when it is enabled.
+// A nil message only updates the position of the last byte forwarded.
+func (t *Tailer) send(msg *message.Message, forwardedOffset int64) {
+	// Make the writes cancellable to be able to stop the tailer
+	// after a file rotation when it is stuck on it.
+	// We don't return directly to keep the same shutdown sequence that in the
+	// normal case.
+	if t.buffer != nil {
 		select {
-		case t.outputChan <- message.NewMessage(output.Content, origin, output.Status):
+		case t.buffer <- bufferedMessage{message: msg, forwardedOffset: forwardedOffset, readAt: time.Now()}:
 		case <-t.forwardContext.Done():
 		}
+		return
+	}
+
+	if msg == nil {
+		if t.forwardContext.Err() == nil {
+			atomic.StoreInt64(&t.forwardedOffset, forwardedOffset)
+		}
+		return
+	}
+	t.deliver(msg, forwardedOffset, time.Now())
+}
+
+// sendBufferedMessages sends the buffered messages to the output channel until the buffer is closed
+func (t *Tailer) sendBufferedMessages(flushed chan struct{}) {
+	defer close(flushed)
+	for buffered := range t.buffer {
+		if buffered.message == nil {
+			if t.forwardContext.Err() == nil {
+				atomic.StoreInt64(&t.forwardedOffset, buffered.forwardedOffset)
+			}
+			continue
+		}
+		t.deliver(buffered.message, buffered.forwardedOffset, buffered.readAt)
 	}
 }
 
+// deliver sends the message to the output channel. When a max backlog age is set, the message is dropped
+// instead if the pipeline doesn't accept it before it becomes older than the max backlog age.
+func (t *Tailer) deliver(msg *message.Message, forwardedOffset int64, readAt time.Time) {
+	var expired <-chan time.Time
+	if t.maxBacklogAge > 0 {
+		remaining := t.maxBacklogAge - time.Since(readAt)
+		if remaining <= 0 {
+			t.dropStale(forwardedOffset)
+			return
+		}
+		timer := time.NewTimer(remaining)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	if msg.IsCommit() {
+		select {
+		case t.outputChan <- msg:
+		case <-t.forwardContext.Done():
+		}
+		return
+	}
+	if t.transform != nil {
+		t.transform(msg)
+	}
+	select {
+	case t.outputChan <- msg:
+		atomic.StoreInt64(&t.forwardedOffset, forwardedOffset)
+	case <-expired:
+		t.dropStale(forwardedOffset)
+	case <-t.forwardContext.Done():
+	}
+}
+
+// dropStale counts a message dropped because it is older than the max backlog age, its content
+// is considered forwarded so that it is not read again.
+func (t *Tailer) dropStale(forwardedOffset int64) {
+	atomic.StoreInt64(&t.forwardedOffset, forwardedOffset)
+	dropped := atomic.AddInt64(&t.staleDropped, 1)
+	metrics.LogsStaleDropped.Add(1)
+	metrics.TlmLogsStaleDropped.Inc()
+	t.file.Source.UpdateInfo(t.staleDroppedInfoKey(), fmt.Sprintf("Dropped %d lines of %s older than %s", dropped, t.file.Path, t.maxBacklogAge))
+}
+
+// staleDroppedInfoKey returns the key of the source info holding the number of messages dropped because
+// they were older than the max backlog age
+func (t *Tailer) staleDroppedInfoKey() string {
+	return "stale_dropped:" + t.file.Path
+}
+
+// bufferInfoKey returns the key of the source info holding the fill level of the buffer
+func (t *Tailer) bufferInfoKey() string {
+	return "buffer:" + t.file.Path
+}
+
+// updateBufferInfo exposes the fill level of the buffer in the source info
+func (t *Tailer) updateBufferInfo() {
+	if t.buffer == nil {
+		return
+	}
+	t.file.Source.UpdateInfo(t.bufferInfoKey(), fmt.Sprintf("Buffer of %s: %d/%d messages", t.file.Path, len(t.buffer), cap(t.buffer)))
+}
+
+// drain lets the tailer decode and forward the whole content of the reader,
+// it returns once all the content has been forwarded to the output channel.
+// The offsets of a draining tailer are not committed to the registry.
+func (t *Tailer) drain(reader io.Reader) error {
+	atomic.StoreInt32(&t.didFileRotate, 1)
+	t.tags = t.buildTailerTags()
+
+	go t.forwardMessages()
+	t.decoder.Start()
+	defer func() {
+		t.decoder.Stop()
+		// wait for the decoder to be flushed
+		<-t.done
+	}()
+
+	for {
+		inBuf := t.readBuffers.get()
+		n, err := reader.Read(inBuf)
+		if n > 0 {
+			t.decoder.InputChan <- t.newInput(inBuf, n)
+			t.incrementReadOffset(n)
+			t.file.Source.BytesRead.Add(int64(n))
+		} else {
+			t.readBuffers.put(inBuf)
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// newInput returns the input of the decoder holding the n bytes read into inBuf,
+// the buffer goes back to the pool once it has been decoded
+func (t *Tailer) newInput(inBuf []byte, n int) *decoder.Input {
+	return decoder.NewInputWithRelease(inBuf[:n], t.readBuffers.put)
+}
+
 func (t *Tailer) incrementReadOffset(n int) {
 	atomic.AddInt64(&t.readOffset, int64(n))
 }
@@ -261,6 +657,11 @@ func (t *Tailer) GetReadOffset() int64 {
 	return atomic.LoadInt64(&t.readOffset)
 }
 
+// getForwardedOffset returns the position in the file of the last byte forwarded to the output channel
+func (t *Tailer) getForwardedOffset() int64 {
+	return atomic.LoadInt64(&t.forwardedOffset)
+}
+
 // SetDecodedOffset sets the position of the last byte decoded in the
 // file
 func (t *Tailer) SetDecodedOffset(off int64) {
@@ -269,13 +670,114 @@ func (t *Tailer) SetDecodedOffset(off int64) {
 
 // shouldTrackOffset returns whether the tailer should track the file offset or not
 func (t *Tailer) shouldTrackOffset() bool {
-	if atomic.LoadInt32(&t.didFileRotate) != 0 {
+	if atomic.LoadInt32(&t.didFileRotate) != 0 || t.isStream() || t.isFullRead() {
 		return false
 	}
 	return true
 }
 
+// shouldCommit returns whether the offset must be committed to the registry according to the commit policy
+func (t *Tailer) shouldCommit(offset int64) bool {
+	if t.readOnlyRegistry {
+		return false
+	}
+	policy := t.commitPolicy
+	if policy.Interval <= 0 && policy.Bytes <= 0 {
+		return true
+	}
+	now := time.Now()
+	if (policy.Interval > 0 && now.Sub(t.lastCommit) >= policy.Interval) || (policy.Bytes > 0 && offset-t.lastCommitOffset >= policy.Bytes) {
+		t.lastCommit = now
+		t.lastCommitOffset = offset
+		return true
+	}
+	return false
+}
+
+// idleCommitInterval returns the interval at which the tailer checks whether it is idle with an offset
+// left to commit, zero when every offset is committed or none is.
+func (t *Tailer) idleCommitInterval() time.Duration {
+	policy := t.commitPolicy
+	switch {
+	case t.readOnlyRegistry || (policy.Interval <= 0 && policy.Bytes <= 0):
+		return 0
+	case policy.Interval > 0:
+		return policy.Interval
+	default:
+		return idleCommitInterval
+	}
+}
+
+// commitIfIdle commits the offset left to commit when nothing has been committed for the idle commit interval,
+// unless repeats of a line are still collapsed.
+func (t *Tailer) commitIfIdle(now time.Time) {
+	if t.repeated.count == 0 && now.Sub(t.lastCommit) >= t.idleCommitInterval() {
+		t.commitPending()
+	}
+}
+
+// commitPending commits the offset decoded since the last commit, if any, with a commit message sent after the
+// forwarded messages, so that it is committed once they have been sent.
+func (t *Tailer) commitPending() {
+	if t.idleCommitInterval() <= 0 || !t.shouldTrackOffset() || t.decodedOffset == t.lastCommitOffset {
+		return
+	}
+	t.lastCommit = time.Now()
+	t.lastCommitOffset = t.decodedOffset
+	origin := message.NewOrigin(t.file.Source)
+	origin.Identifier = t.Identifier()
+	origin.Offset = strconv.FormatInt(t.decodedOffset, 10)
+	t.send(message.NewCommitMessage(origin), atomic.LoadInt64(&t.forwardedOffset))
+}
+
+// isStream returns true if the tailer reads an append-only stream instead of a regular file,
+// the offsets of a stream are meaningless.
+func (t *Tailer) isStream() bool {
+	return t.file.Source.Config.Stream
+}
+
+// heartbeatIfIdle sends a heartbeat message when no new data has been read for
+// the heartbeat interval. The heartbeat doesn't carry any offset so that it is
+// never committed to the registry, and it is dropped if the pipeline is full.
+func (t *Tailer) heartbeatIfIdle() {
+	if t.heartbeatInterval <= 0 {
+		return
+	}
+
+	now := time.Now()
+	if offset := t.GetReadOffset(); offset != t.idleOffset {
+		t.idleOffset = offset
+		t.idleSince = now
+		return
+	}
+	if now.Sub(t.idleSince) < t.heartbeatInterval {
+		return
+	}
+	t.idleSince = now
+
+	origin := message.NewOrigin(t.file.Source)
+	origin.SetTags(append(append([]string{}, t.tags...), heartbeatTag))
+	select {
+	case t.outputChan <- message.NewMessage([]byte(heartbeatContent), origin, message.StatusDebug):
+	default:
+		log.Debugf("Dropping heartbeat of %s, the pipeline is full", t.file.Path)
+	}
+}
+
 // wait lets the tailer sleep for a bit
 func (t *Tailer) wait() {
-	time.Sleep(t.sleepDuration)
+	timer := time.NewTimer(t.sleepDuration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-t.wake:
+	}
+}
+
+// notify wakes the tailer up if it is waiting for new data
+func (t *Tailer) notify() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
 }
@@ -10,8 +10,8 @@ package file
 import (
 	"io"
 	"path/filepath"
+	"time"
 
-	"github.com/DataDog/datadog-agent/pkg/logs/decoder"
 	"github.com/DataDog/datadog-agent/pkg/util/log"
 )
 
@@ -27,12 +27,19 @@ func (t *Tailer) setup(offset int64, whence int) error {
 	t.tags = t.buildTailerTags()
 
 	log.Info("Opening", t.file.Path, "for tailer key", t.file.GetScanKey())
+	if t.isStream() {
+		return t.setupStream()
+	}
+	if t.isFullRead() {
+		return t.setupFullRead(offset, whence)
+	}
 	f, err := openFile(fullpath)
 	if err != nil {
 		return err
 	}
 
 	t.osFile = f
+	t.tags = append(t.tags, t.buildFileMetadataTags(f)...)
 	ret, _ := f.Seek(offset, whence)
 	t.readOffset = ret
 	t.decodedOffset = ret
@@ -43,18 +50,31 @@ func (t *Tailer) setup(offset int64, whence int) error {
 // read lets the tailer tail the content of a file
 // until it is closed or the tailer is stopped.
 func (t *Tailer) read() (int, error) {
+	if t.isStream() {
+		return t.readStream()
+	}
+	if t.isFullRead() {
+		return t.readFullFile(true)
+	}
+	if t.isIdleClosed() && !t.reopenIfGrown() {
+		return 0, nil
+	}
 	// keep reading data from file
-	inBuf := make([]byte, 4096)
+	inBuf := t.readBuffers.get()
 	n, err := t.osFile.Read(inBuf)
 	if err != nil && err != io.EOF {
+		t.readBuffers.put(inBuf)
 		// an unexpected error occurred, stop the tailor
 		t.file.Source.Status.Error(err)
 		return 0, log.Error("Unexpected error occurred while reading file: ", err)
 	}
 	if n == 0 {
+		t.readBuffers.put(inBuf)
+		t.closeIfIdle()
 		return 0, nil
 	}
-	t.decoder.InputChan <- decoder.NewInput(inBuf[:n])
+	t.lastReadAt = time.Now()
+	t.decoder.InputChan <- t.newInput(inBuf, n)
 	t.incrementReadOffset(n)
 	return n, nil
 }
@@ -8,11 +8,14 @@
 package file
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"strconv"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
@@ -93,6 +96,427 @@ func (suite *TailerTestSuite) TestStopAfterFileRotationWhenStuck() {
 	}
 }
 
+func (suite *TailerTestSuite) TestHeartbeatWhenIdle() {
+	suite.tailer.heartbeatInterval = 50 * time.Millisecond
+	err := suite.tailer.StartFromBeginning()
+	suite.Nil(err)
+
+	_, err = suite.testFile.WriteString("hello world\n")
+	suite.Nil(err)
+	msg := <-suite.outputChan
+	suite.Equal("hello world", string(msg.Content))
+	offset := msg.Origin.Offset
+
+	msg = <-suite.outputChan
+	suite.Equal(heartbeatContent, string(msg.Content))
+	suite.Equal(message.StatusDebug, msg.GetStatus())
+	suite.Contains(msg.Origin.Tags(), heartbeatTag)
+	// heartbeats must not be committed to the registry
+	suite.Equal("", msg.Origin.Identifier)
+	suite.Equal("", msg.Origin.Offset)
+
+	_, err = suite.testFile.WriteString("hello again\n")
+	suite.Nil(err)
+	for msg = <-suite.outputChan; string(msg.Content) == heartbeatContent; msg = <-suite.outputChan {
+	}
+	suite.Equal("hello again", string(msg.Content))
+	suite.Equal(toInt(offset)+len("hello again\n"), toInt(msg.Origin.Offset))
+}
+
+func (suite *TailerTestSuite) TestIdleCloseReopensWhenFileGrows() {
+	suite.tailer.idleCloseTimeout = 50 * time.Millisecond
+	err := suite.tailer.StartFromBeginning()
+	suite.Nil(err)
+
+	_, err = suite.testFile.WriteString("hello world\n")
+	suite.Nil(err)
+	msg := <-suite.outputChan
+	suite.Equal("hello world", string(msg.Content))
+
+	suite.Eventually(suite.tailer.isIdleClosed, time.Second, 10*time.Millisecond)
+	suite.Nil(suite.tailer.getOSFile())
+	suite.Contains(suite.source.GetInfo(), fmt.Sprintf("Idle closed: %s, no new data since 50ms, offset 12", suite.testPath))
+	// the idle closed file is not rotated as long as the path leads to it
+	didRotate, err := suite.tailer.didRotate()
+	suite.Nil(err)
+	suite.False(didRotate)
+
+	_, err = suite.testFile.WriteString("hello again\n")
+	suite.Nil(err)
+	msg = <-suite.outputChan
+	suite.Equal("hello again", string(msg.Content))
+	suite.Equal(len("hello world\nhello again\n"), toInt(msg.Origin.Offset))
+	suite.Empty(suite.source.GetInfo())
+}
+
+func (suite *TailerTestSuite) TestIdleClosedFileRotation() {
+	suite.tailer.idleCloseTimeout = 50 * time.Millisecond
+	err := suite.tailer.StartFromBeginning()
+	suite.Nil(err)
+	suite.Eventually(suite.tailer.isIdleClosed, time.Second, 10*time.Millisecond)
+
+	// the file is replaced while it is closed
+	suite.Nil(os.Rename(suite.testPath, suite.testPath+".1"))
+	f, err := os.Create(suite.testPath)
+	suite.Nil(err)
+	defer f.Close()
+	_, err = f.WriteString("new file\n")
+	suite.Nil(err)
+
+	didRotate, err := suite.tailer.didRotate()
+	suite.Nil(err)
+	suite.True(didRotate)
+	// the tailer does not read the new file, it's read by the tailer replacing it
+	time.Sleep(50 * time.Millisecond)
+	suite.True(suite.tailer.isIdleClosed())
+	suite.Len(suite.outputChan, 0)
+}
+
+func (suite *TailerTestSuite) TestCollapseRepeatedLines() {
+	suite.tailer.collapseWindow = time.Hour
+	err := suite.tailer.StartFromBeginning()
+	suite.Nil(err)
+
+	_, err = suite.testFile.WriteString("error\nerror\nerror\nerror\nok\n")
+	suite.Nil(err)
+
+	msg := <-suite.outputChan
+	suite.Equal("error", string(msg.Content))
+	suite.NotContains(msg.Origin.Tags(), repeatCountTagKey+":3")
+	suite.Equal(len("error\n"), toInt(msg.Origin.Offset))
+
+	// the repeats are collapsed into one message carrying the offset of the last one
+	msg = <-suite.outputChan
+	suite.Equal("error", string(msg.Content))
+	suite.Contains(msg.Origin.Tags(), repeatCountTagKey+":3")
+	suite.Equal(4*len("error\n"), toInt(msg.Origin.Offset))
+
+	msg = <-suite.outputChan
+	suite.Equal("ok", string(msg.Content))
+	suite.Equal(4*len("error\n")+len("ok\n"), toInt(msg.Origin.Offset))
+}
+
+func (suite *TailerTestSuite) TestCollapseRepeatedLinesWindowExpiry() {
+	suite.tailer.collapseWindow = 50 * time.Millisecond
+	err := suite.tailer.StartFromBeginning()
+	suite.Nil(err)
+
+	_, err = suite.testFile.WriteString("error\nerror\nerror\n")
+	suite.Nil(err)
+
+	msg := <-suite.outputChan
+	suite.Equal("error", string(msg.Content))
+
+	// the repeats are flushed once the window expires, without waiting for another line
+	msg = <-suite.outputChan
+	suite.Equal("error", string(msg.Content))
+	suite.Contains(msg.Origin.Tags(), repeatCountTagKey+":2")
+	suite.Equal(3*len("error\n"), toInt(msg.Origin.Offset))
+}
+
+func (suite *TailerTestSuite) TestMaxBacklogAgeDropsStaleLines() {
+	// To satisfy the suite level tailer
+	suite.tailer.StartFromBeginning()
+
+	path := fmt.Sprintf("%s/stale.log", suite.testDir)
+	f, err := os.Create(path)
+	suite.Nil(err)
+	defer f.Close()
+
+	var size int
+	for i := 0; i < 3; i++ {
+		line := fmt.Sprintf("line %d\n", i)
+		_, err := f.WriteString(line)
+		suite.Nil(err)
+		size += len(line)
+	}
+
+	// the output channel only accepts the first line, the other ones become stale
+	outputChan := make(chan *message.Message, 1)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path})
+	tailer := NewTailer(outputChan, NewFile(path, source, false), 10*time.Millisecond)
+	tailer.maxBacklogAge = 50 * time.Millisecond
+	suite.Nil(tailer.StartFromBeginning())
+	defer tailer.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for tailer.getForwardedOffset() != int64(size) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	suite.Equal(int64(size), tailer.getForwardedOffset())
+	suite.Equal(int64(2), atomic.LoadInt64(&tailer.staleDropped))
+	suite.Contains(source.GetInfo(), fmt.Sprintf("Dropped 2 lines of %s older than 50ms", path))
+
+	msg := <-outputChan
+	suite.Equal("line 0", string(msg.Content))
+
+	// the lines are sent as usual once the pipeline is unblocked
+	_, err = f.WriteString("fresh line\n")
+	suite.Nil(err)
+	msg = <-outputChan
+	suite.Equal("fresh line", string(msg.Content))
+}
+
+func (suite *TailerTestSuite) TestBufferWhenPipelineIsFull() {
+	coreConfig.Datadog.Set("logs_config.file_tailer_buffer_size", 20)
+	defer coreConfig.Datadog.Set("logs_config.file_tailer_buffer_size", 0)
+
+	// To satisfy the suite level tailer
+	suite.tailer.StartFromBeginning()
+
+	path := fmt.Sprintf("%s/buffer.log", suite.testDir)
+	f, err := os.Create(path)
+	suite.Nil(err)
+	defer f.Close()
+
+	var size int
+	for i := 0; i < chanSize+5; i++ {
+		line := fmt.Sprintf("line %d\n", i)
+		_, err := f.WriteString(line)
+		suite.Nil(err)
+		size += len(line)
+	}
+
+	outputChan := make(chan *message.Message, chanSize)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path})
+	tailer := NewTailer(outputChan, NewFile(path, source, false), 10*time.Millisecond)
+	suite.Nil(tailer.StartFromBeginning())
+	defer tailer.Stop()
+
+	// the output channel is full, the remaining messages are buffered
+	expectedInfo := fmt.Sprintf("Buffer of %s: 5/20 messages", path)
+	deadline := time.Now().Add(5 * time.Second)
+	for !containsString(source.GetInfo(), expectedInfo) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	suite.Contains(source.GetInfo(), expectedInfo)
+
+	for i := 0; i < chanSize+5; i++ {
+		msg := <-outputChan
+		suite.Equal(fmt.Sprintf("line %d", i), string(msg.Content))
+	}
+	for tailer.getForwardedOffset() != int64(size) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	suite.Equal(int64(size), tailer.getForwardedOffset())
+}
+
+func (suite *TailerTestSuite) TestTailStream() {
+	// To satisfy the suite level tailer
+	suite.tailer.StartFromBeginning()
+
+	path := fmt.Sprintf("%s/stream", suite.testDir)
+	suite.Nil(syscall.Mkfifo(path, 0600))
+
+	outputChan := make(chan *message.Message, chanSize)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, Stream: true})
+	tailer := NewTailer(outputChan, NewFile(path, source, false), 10*time.Millisecond)
+	suite.Nil(tailer.StartFromBeginning())
+
+	// the stream is reopened when its writer closes it
+	for _, line := range []string{"hello", "world"} {
+		writer, err := os.OpenFile(path, os.O_WRONLY, 0)
+		suite.Nil(err)
+		_, err = writer.WriteString(line + "\n")
+		suite.Nil(err)
+		suite.Nil(writer.Close())
+
+		msg := <-outputChan
+		suite.Equal(line, string(msg.Content))
+		// no offset is recorded for streams
+		suite.Equal("", msg.Origin.Identifier)
+		suite.Equal("0", msg.Origin.Offset)
+	}
+
+	// an idle stream doesn't prevent the tailer from stopping
+	tailer.Stop()
+}
+
+func (suite *TailerTestSuite) TestStreamModeRejectsRegularFiles() {
+	// To satisfy the suite level tailer
+	suite.tailer.StartFromBeginning()
+
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: suite.testPath, Stream: true})
+	tailer := NewTailer(make(chan *message.Message, chanSize), NewFile(suite.testPath, source, false), 10*time.Millisecond)
+	suite.NotNil(tailer.StartFromBeginning())
+}
+
+// lengthPrefixedDecoder decodes records prefixed by their length on one byte, 0xff is an invalid length
+type lengthPrefixedDecoder struct{}
+
+func (lengthPrefixedDecoder) Decode(r io.Reader) ([]byte, int, error) {
+	header := make([]byte, 1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, err
+	}
+	if header[0] == 0xff {
+		return nil, 0, errors.New("invalid frame")
+	}
+	content := make([]byte, int(header[0]))
+	n, err := io.ReadFull(r, content)
+	if err != nil {
+		return nil, 0, err
+	}
+	return content, n + 1, nil
+}
+
+func (suite *TailerTestSuite) TestTailWithLineDecoder() {
+	// To satisfy the suite level tailer
+	suite.tailer.StartFromBeginning()
+
+	path := fmt.Sprintf("%s/framed.log", suite.testDir)
+	content := "\x05hello\x0bmulti\nlines\x05world"
+	suite.Nil(ioutil.WriteFile(path, []byte(content), 0644))
+
+	outputChan := make(chan *message.Message, chanSize)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path})
+	tailer := NewTailerWithLineDecoder(outputChan, NewFile(path, source, false), 10*time.Millisecond, lengthPrefixedDecoder{})
+	suite.Nil(tailer.StartFromBeginning())
+	defer tailer.Stop()
+
+	for _, expected := range []struct {
+		content string
+		offset  int
+	}{
+		{"hello", 6},
+		{"multi\nlines", 18},
+		{"world", 24},
+	} {
+		msg := <-outputChan
+		suite.Equal(expected.content, string(msg.Content))
+		// the offsets are the ones of the end of the records
+		suite.Equal(strconv.Itoa(expected.offset), msg.Origin.Offset)
+	}
+}
+
+func (suite *TailerTestSuite) TestTailJournalExportFormat() {
+	// To satisfy the suite level tailer
+	suite.tailer.StartFromBeginning()
+
+	path := fmt.Sprintf("%s/journal.export", suite.testDir)
+	content := "MESSAGE=hello\nPRIORITY=3\n_PID=42\n\n" +
+		"MESSAGE=world\n_PID=43\n\n" +
+		"MESSAGE=partial\n"
+	suite.Nil(ioutil.WriteFile(path, []byte(content), 0644))
+
+	outputChan := make(chan *message.Message, chanSize)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, Format: config.JournalExportFormat})
+	tailer := NewTailer(outputChan, NewFile(path, source, false), 10*time.Millisecond)
+	suite.Nil(tailer.StartFromBeginning())
+	defer tailer.Stop()
+
+	msg := <-outputChan
+	suite.Equal(`{"journald":{"PRIORITY":"3","_PID":"42"},"message":"hello"}`, string(msg.Content))
+	suite.Equal(message.StatusError, msg.GetStatus())
+	suite.Equal("34", msg.Origin.Offset)
+
+	msg = <-outputChan
+	suite.Equal(`{"journald":{"_PID":"43"},"message":"world"}`, string(msg.Content))
+	suite.Equal(message.StatusInfo, msg.GetStatus())
+	suite.Equal("57", msg.Origin.Offset)
+
+	// the partial entry is sent once it is complete
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	suite.Nil(err)
+	_, err = f.WriteString("_PID=44\n\n")
+	suite.Nil(err)
+	suite.Nil(f.Close())
+
+	msg = <-outputChan
+	suite.Equal(`{"journald":{"_PID":"44"},"message":"partial"}`, string(msg.Content))
+	suite.Equal("82", msg.Origin.Offset)
+}
+
+func (suite *TailerTestSuite) TestTailerAddsLineOffsets() {
+	// To satisfy the suite level tailer
+	suite.tailer.StartFromBeginning()
+
+	path := fmt.Sprintf("%s/offsets.log", suite.testDir)
+	suite.Nil(ioutil.WriteFile(path, []byte("hello\n\nworld\n"), 0644))
+
+	outputChan := make(chan *message.Message, chanSize)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, AddOffset: true})
+	tailer := NewTailer(outputChan, NewFile(path, source, false), 10*time.Millisecond)
+	suite.Nil(tailer.StartFromBeginning())
+	defer tailer.Stop()
+
+	// the tags hold the offsets of the first bytes of the lines, the empty lines are accounted for
+	msg := <-outputChan
+	suite.Equal("hello", string(msg.Content))
+	suite.Contains(msg.Origin.Tags(), "file.offset:0")
+	suite.Equal("6", msg.Origin.Offset)
+	msg = <-outputChan
+	suite.Equal("world", string(msg.Content))
+	suite.Contains(msg.Origin.Tags(), "file.offset:7")
+	suite.NotContains(msg.Origin.Tags(), "file.offset:0")
+}
+
+func (suite *TailerTestSuite) TestTailerFullReadOnChange() {
+	// To satisfy the suite level tailer
+	suite.tailer.StartFromBeginning()
+
+	path := fmt.Sprintf("%s/status", suite.testDir)
+	modTime := time.Now()
+	// rewrite replaces the file atomically, with a new modification time
+	rewrite := func(content string) {
+		modTime = modTime.Add(time.Minute)
+		suite.Nil(ioutil.WriteFile(path+".tmp", []byte(content), 0644))
+		suite.Nil(os.Chtimes(path+".tmp", modTime, modTime))
+		suite.Nil(os.Rename(path+".tmp", path))
+	}
+	rewrite("state: ok\ncount: 1\n")
+
+	outputChan := make(chan *message.Message, chanSize)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path, FullReadOnChange: true})
+	tailer := NewTailer(outputChan, NewFile(path, source, false), 10*time.Millisecond)
+	suite.Nil(tailer.StartFromBeginning())
+	defer tailer.Stop()
+
+	msg := <-outputChan
+	suite.Equal("state: ok", string(msg.Content))
+	msg = <-outputChan
+	suite.Equal("count: 1", string(msg.Content))
+
+	// the file is rewritten with the same size, only the changed line is sent
+	rewrite("state: ok\ncount: 2\n")
+	msg = <-outputChan
+	suite.Equal("count: 2", string(msg.Content))
+	suite.Equal("0", msg.Origin.Offset)
+
+	// a rewrite with the same content sends nothing
+	rewrite("state: ok\ncount: 2\n")
+	rewrite("state: ko\ncount: 2\n")
+	msg = <-outputChan
+	suite.Equal("state: ko", string(msg.Content))
+}
+
+func (suite *TailerTestSuite) TestTailWithLineDecoderStopsOnInvalidRecord() {
+	// To satisfy the suite level tailer
+	suite.tailer.StartFromBeginning()
+
+	path := fmt.Sprintf("%s/framed.log", suite.testDir)
+	suite.Nil(ioutil.WriteFile(path, []byte("\x05hello\xff\x05world\x02ok"), 0644))
+
+	outputChan := make(chan *message.Message, chanSize)
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: path})
+	tailer := NewTailerWithLineDecoder(outputChan, NewFile(path, source, false), 10*time.Millisecond, lengthPrefixedDecoder{})
+	suite.Nil(tailer.StartFromBeginning())
+	defer tailer.Stop()
+
+	msg := <-outputChan
+	suite.Equal("hello", string(msg.Content))
+
+	// the tailer stops at the invalid record, the records following it are not sent
+	suite.Eventually(source.Status.IsError, 5*time.Second, 10*time.Millisecond)
+	suite.Contains(source.Status.GetError(), "invalid frame")
+	select {
+	case msg := <-outputChan:
+		suite.Fail("unexpected message", string(msg.Content))
+	case <-time.After(100 * time.Millisecond):
+	}
+	suite.Equal(int64(6), tailer.getForwardedOffset())
+}
+
 func (suite *TailerTestSuite) TestTialerTimeDurationConfig() {
 	// To satisfy the suite level tailer
 	suite.tailer.StartFromBeginning()
@@ -138,6 +562,74 @@ func (suite *TailerTestSuite) TestTailFromBeginning() {
 	suite.Equal(len(lines[0])+len(lines[1])+len(lines[2]), int(suite.tailer.decodedOffset))
 }
 
+func (suite *TailerTestSuite) TestCommitPolicyBytes() {
+	lines := []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"}
+	suite.tailer.commitPolicy = CommitPolicy{Bytes: 2 * int64(len(lines[0]))}
+
+	for _, line := range lines {
+		_, err := suite.testFile.WriteString(line)
+		suite.Nil(err)
+	}
+	suite.tailer.StartFromBeginning()
+
+	// only every second message carries the offset to commit
+	for i := range lines {
+		msg := <-suite.outputChan
+		suite.Equal((i+1)*len(lines[0]), toInt(msg.Origin.Offset))
+		if i%2 == 1 {
+			suite.Equal(suite.tailer.Identifier(), msg.Origin.Identifier)
+		} else {
+			suite.Equal("", msg.Origin.Identifier)
+		}
+	}
+}
+
+func (suite *TailerTestSuite) TestCommitPolicyCommitsWhenIdle() {
+	lines := []string{"line 1\n", "line 2\n", "line 3\n"}
+	suite.tailer.commitPolicy = CommitPolicy{Interval: 200 * time.Millisecond}
+
+	for _, line := range lines {
+		_, err := suite.testFile.WriteString(line)
+		suite.Nil(err)
+	}
+	suite.tailer.StartFromBeginning()
+
+	// the offset of the last line is committed even though no other line is read
+	var msg *message.Message
+	for msg == nil || !msg.IsCommit() {
+		select {
+		case msg = <-suite.outputChan:
+		case <-time.After(5 * time.Second):
+			suite.FailNow("the offset has not been committed")
+		}
+	}
+	suite.Equal(suite.tailer.Identifier(), msg.Origin.Identifier)
+	suite.Equal(len(lines)*len(lines[0]), toInt(msg.Origin.Offset))
+	suite.Nil(msg.Content)
+}
+
+func (suite *TailerTestSuite) TestCommitPolicyCommitsOnStop() {
+	lines := []string{"line 1\n", "line 2\n"}
+	outputChan := make(chan *message.Message, chanSize)
+	tailer := NewTailer(outputChan, NewFile(suite.testPath, suite.source, false), 10*time.Millisecond)
+	tailer.commitPolicy = CommitPolicy{Bytes: 1000}
+
+	for _, line := range lines {
+		_, err := suite.testFile.WriteString(line)
+		suite.Nil(err)
+	}
+	tailer.StartFromBeginning()
+	for range lines {
+		suite.Equal("", (<-outputChan).Origin.Identifier)
+	}
+	tailer.Stop()
+
+	msg := <-outputChan
+	suite.True(msg.IsCommit())
+	suite.Equal(tailer.Identifier(), msg.Origin.Identifier)
+	suite.Equal(len(lines)*len(lines[0]), toInt(msg.Origin.Offset))
+}
+
 func (suite *TailerTestSuite) TestTailFromEnd() {
 	lines := []string{"hello world\n", "hello again\n", "good bye\n"}
 
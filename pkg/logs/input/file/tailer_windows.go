@@ -8,11 +8,11 @@
 package file
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 
-	"github.com/DataDog/datadog-agent/pkg/logs/decoder"
 	"github.com/DataDog/datadog-agent/pkg/util/log"
 )
 
@@ -27,11 +27,19 @@ func (t *Tailer) setup(offset int64, whence int) error {
 	// adds metadata to enable users to filter logs by filename
 	t.tags = t.buildTailerTags()
 
+	if t.isStream() {
+		return fmt.Errorf("stream mode is not supported on Windows: %s", t.file.Path)
+	}
+	if t.isFullRead() {
+		return t.setupFullRead(offset, whence)
+	}
+
 	log.Info("Opening ", t.fullpath)
 	f, err := openFile(t.fullpath)
 	if err != nil {
 		return err
 	}
+	t.tags = append(t.tags, t.buildFileMetadataTags(f)...)
 	filePos, _ := f.Seek(offset, whence)
 	f.Close()
 
@@ -69,15 +77,18 @@ func (t *Tailer) readAvailable() (err error) {
 	f.Seek(t.GetReadOffset(), io.SeekStart)
 
 	for {
-		inBuf := make([]byte, 4096)
+		inBuf := t.readBuffers.get()
 		n, err := f.Read(inBuf)
 		if n == 0 || err != nil {
+			t.readBuffers.put(inBuf)
 			log.Debugf("Done reading")
 			return err
 		}
 		log.Debugf("Sending %d bytes to input channel", n)
-		t.decoder.InputChan <- decoder.NewInput(inBuf[:n])
+		t.decoder.InputChan <- t.newInput(inBuf, n)
 		t.incrementReadOffset(n)
+		// read always reports 0 bytes on windows, account for the bytes read here
+		t.file.Source.BytesRead.Add(int64(n))
 	}
 }
 
@@ -85,6 +96,9 @@ func (t *Tailer) readAvailable() (err error) {
 // windows version open and close the file between each call to 'read'. This is
 // needed in order not to block the file and prevent the user from renaming it.
 func (t *Tailer) read() (int, error) {
+	if t.isFullRead() {
+		return t.readFullFile(true)
+	}
 	err := t.readAvailable()
 	if err == io.EOF || os.IsNotExist(err) {
 		return 0, nil
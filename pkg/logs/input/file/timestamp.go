@@ -0,0 +1,71 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+	"github.com/DataDog/datadog-agent/pkg/logs/message"
+	"github.com/DataDog/datadog-agent/pkg/logs/metrics"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// timestampParser parses the timestamps of the lines of a file with the timestamp pattern of its source
+type timestampParser struct {
+	regex    *regexp.Regexp
+	layout   string
+	location *time.Location
+}
+
+// newTimestampParser returns the timestamp parser of the source, nil when the source has no timestamp pattern.
+// The config has been validated so it can't fail unless the timezone database went missing in the meantime.
+func newTimestampParser(c *config.LogsConfig) *timestampParser {
+	if c.TimestampPattern == "" {
+		return nil
+	}
+	regex, err := regexp.Compile(c.TimestampPattern)
+	if err != nil {
+		log.Warnf("Could not compile the timestamp pattern of %s, the ingestion time is used: %v", c.Path, err)
+		return nil
+	}
+	location, err := time.LoadLocation(c.TimestampTimezone)
+	if err != nil {
+		log.Warnf("Could not load the timestamp timezone of %s, UTC is used: %v", c.Path, err)
+		location = time.UTC
+	}
+	return &timestampParser{
+		regex:    regex,
+		layout:   c.TimestampLayout,
+		location: location,
+	}
+}
+
+// parse returns the timestamp of the line, it returns false when the line has no timestamp matching the pattern
+// and the layout. The timestamps whose layout has no timezone are in the timezone of the source.
+func (p *timestampParser) parse(content []byte) (time.Time, bool) {
+	match := p.regex.FindSubmatch(content)
+	if match == nil {
+		return time.Time{}, false
+	}
+	timestamp, err := time.ParseInLocation(p.layout, string(match[1]), p.location)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return timestamp, true
+}
+
+// setTimestamp sets the timestamp parsed from the content of the message as its time,
+// the message keeps the ingestion time when no timestamp can be parsed.
+func (t *Tailer) setTimestamp(msg *message.Message) {
+	if timestamp, ok := t.timestampParser.parse(msg.Content); ok {
+		msg.Timestamp = timestamp
+		return
+	}
+	metrics.LogsTimestampNotParsed.Add(1)
+	metrics.TlmLogsTimestampNotParsed.Inc()
+}
@@ -0,0 +1,60 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+	"github.com/DataDog/datadog-agent/pkg/logs/message"
+	"github.com/DataDog/datadog-agent/pkg/logs/metrics"
+)
+
+func TestTimestampParser(t *testing.T) {
+	assert.Nil(t, newTimestampParser(&config.LogsConfig{}))
+
+	parser := newTimestampParser(&config.LogsConfig{TimestampPattern: `^(\S+) `, TimestampLayout: time.RFC3339})
+	timestamp, ok := parser.parse([]byte("2020-06-01T10:00:00+02:00 hello"))
+	assert.True(t, ok)
+	assert.True(t, time.Date(2020, 6, 1, 8, 0, 0, 0, time.UTC).Equal(timestamp))
+
+	_, ok = parser.parse([]byte("hello"))
+	assert.False(t, ok)
+	_, ok = parser.parse([]byte("yesterday hello"))
+	assert.False(t, ok)
+
+	// the timestamps without timezone are in the timezone of the source, UTC by default
+	parser = newTimestampParser(&config.LogsConfig{TimestampPattern: `^\[([^]]+)\]`, TimestampLayout: "2006-01-02 15:04:05"})
+	timestamp, ok = parser.parse([]byte("[2020-06-01 10:00:00] hello"))
+	assert.True(t, ok)
+	assert.True(t, time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC).Equal(timestamp))
+
+	paris, err := time.LoadLocation("Europe/Paris")
+	assert.Nil(t, err)
+	parser = newTimestampParser(&config.LogsConfig{TimestampPattern: `^\[([^]]+)\]`, TimestampLayout: "2006-01-02 15:04:05", TimestampTimezone: "Europe/Paris"})
+	timestamp, ok = parser.parse([]byte("[2020-06-01 10:00:00] hello"))
+	assert.True(t, ok)
+	assert.True(t, time.Date(2020, 6, 1, 10, 0, 0, 0, paris).Equal(timestamp))
+}
+
+func TestTailerSetTimestamp(t *testing.T) {
+	source := config.NewLogSource("", &config.LogsConfig{Type: config.FileType, Path: "/var/log/app.log", TimestampPattern: `^(\S+) `, TimestampLayout: time.RFC3339})
+	tailer := NewTailer(make(chan *message.Message), NewFile(source.Config.Path, source, false), 10*time.Millisecond)
+
+	msg := message.NewMessage([]byte("2020-06-01T10:00:00Z hello"), nil, "")
+	tailer.setTimestamp(msg)
+	assert.True(t, time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC).Equal(msg.Timestamp))
+
+	// the lines without timestamp keep the ingestion time
+	notParsed := metrics.LogsTimestampNotParsed.Value()
+	msg = message.NewMessage([]byte("hello"), nil, "")
+	tailer.setTimestamp(msg)
+	assert.True(t, msg.Timestamp.IsZero())
+	assert.Equal(t, notParsed+1, metrics.LogsTimestampNotParsed.Value())
+}
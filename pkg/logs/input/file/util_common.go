@@ -0,0 +1,48 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expandPath expands the $VAR and ${VAR} references of the path with the environment variables and its
+// leading ~ with the home directory of the user running the agent. The references to undefined variables
+// are left as is rather than replaced with an empty string, which could make the path match other files,
+// so are the $ not followed by a variable name, e.g. the ones of the glob patterns.
+func expandPath(path string) string {
+	path = os.Expand(path, func(name string) string {
+		if value, found := os.LookupEnv(name); found {
+			return value
+		}
+		if isEnvName(name) {
+			return "${" + name + "}"
+		}
+		return "$" + name
+	})
+	if path == "~" || strings.HasPrefix(path, "~"+string(filepath.Separator)) || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home + path[1:]
+		}
+	}
+	return path
+}
+
+// isEnvName returns true if the name is a valid environment variable name, os.Expand also hands
+// the shell special parameters, e.g. $* or $1, to the mapping function
+func isEnvName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range name {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandPath(t *testing.T) {
+	os.Setenv("DD_TEST_LOG_DIR", "/var/log/app")
+	defer os.Unsetenv("DD_TEST_LOG_DIR")
+	os.Unsetenv("DD_TEST_UNDEFINED")
+
+	// defined variables
+	assert.Equal(t, "/var/log/app/app.log", expandPath("$DD_TEST_LOG_DIR/app.log"))
+	assert.Equal(t, "/var/log/app/*.log", expandPath("${DD_TEST_LOG_DIR}/*.log"))
+	assert.Equal(t, "/var/log/app-1/app.log", expandPath("${DD_TEST_LOG_DIR}-1/app.log"))
+
+	// undefined variables are kept
+	assert.Equal(t, "${DD_TEST_UNDEFINED}/app.log", expandPath("$DD_TEST_UNDEFINED/app.log"))
+	assert.Equal(t, "${DD_TEST_UNDEFINED}/app.log", expandPath("${DD_TEST_UNDEFINED}/app.log"))
+
+	// paths without variables are unchanged
+	assert.Equal(t, "/var/log/app.log", expandPath("/var/log/app.log"))
+	assert.Equal(t, "/var/log/[ab]*.log", expandPath("/var/log/[ab]*.log"))
+	assert.Equal(t, "/var/log/$*.log", expandPath("/var/log/$*.log"))
+	assert.Equal(t, "/var/log/app$", expandPath("/var/log/app$"))
+}
+
+func TestExpandPathHome(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+
+	assert.Equal(t, home, expandPath("~"))
+	assert.Equal(t, filepath.Join(home, "logs", "*.log"), expandPath(filepath.Join("~", "logs", "*.log")))
+
+	// only a leading ~ is the home directory
+	assert.Equal(t, "/var/log/~/app.log", expandPath("/var/log/~/app.log"))
+	assert.Equal(t, "~user/app.log", expandPath("~user/app.log"))
+}
@@ -0,0 +1,93 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package file
+
+import (
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+const (
+	// watchedFilePollPeriod is the poll period of the tailers of the files whose directory is watched,
+	// they are woken up by the events of their directory and only poll as a safety net
+	watchedFilePollPeriod = 5 * time.Second
+	// rescanDelay is how long the scanner waits after a file was created, removed or renamed in a watched
+	// directory before scanning, so that the events of a file rotation trigger a single scan
+	rescanDelay = 100 * time.Millisecond
+)
+
+// dirWatcher watches the directories of the tailed files with inotify, or the equivalent
+// of the platform, to read the files and rescan them only when they change.
+type dirWatcher struct {
+	watcher *fsnotify.Watcher
+	// dirs holds the watched directories
+	dirs map[string]bool
+	// failedDirs holds the directories that can't be watched, e.g. on network filesystems or
+	// when the watch limit is reached, their files are polled
+	failedDirs map[string]bool
+}
+
+// newDirWatcher returns a new directory watcher, it fails when inotify is not available
+func newDirWatcher() (*dirWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &dirWatcher{
+		watcher:    watcher,
+		dirs:       make(map[string]bool),
+		failedDirs: make(map[string]bool),
+	}, nil
+}
+
+// watch starts watching the directory if it's not already watched,
+// it returns false if the directory can't be watched.
+func (w *dirWatcher) watch(dir string) bool {
+	if w.dirs[dir] {
+		return true
+	}
+	if w.failedDirs[dir] {
+		return false
+	}
+	if err := w.watcher.Add(dir); err != nil {
+		log.Warnf("Could not watch %s, its files are polled: %v", dir, err)
+		w.failedDirs[dir] = true
+		return false
+	}
+	log.Debugf("Watching %s", dir)
+	w.dirs[dir] = true
+	return true
+}
+
+// sync watches the provided directories and stops watching the other ones
+func (w *dirWatcher) sync(dirs map[string]bool) {
+	for dir := range w.failedDirs {
+		if !dirs[dir] {
+			delete(w.failedDirs, dir)
+		}
+	}
+	for dir := range w.dirs {
+		if !dirs[dir] {
+			if err := w.watcher.Remove(dir); err != nil {
+				log.Debugf("Could not stop watching %s: %v", dir, err)
+			}
+			delete(w.dirs, dir)
+		}
+	}
+	for dir := range dirs {
+		w.watch(dir)
+	}
+}
+
+// close stops watching all the directories
+func (w *dirWatcher) close() {
+	if err := w.watcher.Close(); err != nil {
+		log.Debugf("Could not close the directory watcher: %v", err)
+	}
+}
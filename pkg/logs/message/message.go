@@ -5,13 +5,21 @@
 
 package message
 
-import "github.com/DataDog/datadog-agent/pkg/logs/config"
+import (
+	"time"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/config"
+)
 
 // Message represents a log line sent to datadog, with its metadata
 type Message struct {
 	Content []byte
 	Origin  *Origin
 	status  string
+	// Timestamp is the time of the event, the time the message is encoded is used when it's zero
+	Timestamp time.Time
+	// commit is set for the messages only carrying the offset of their origin, see NewCommitMessage
+	commit bool
 }
 
 // NewMessageWithSource constructs message with content, status and log source.
@@ -28,6 +36,21 @@ func NewMessage(content []byte, origin *Origin, status string) *Message {
 	}
 }
 
+// NewCommitMessage constructs a message without content only carrying the offset of its origin to commit
+// to the registry. It goes through the pipeline in order with the other messages of its origin, so that the
+// offset is committed once they have been sent, but it is never sent itself.
+func NewCommitMessage(origin *Origin) *Message {
+	return &Message{
+		Origin: origin,
+		commit: true,
+	}
+}
+
+// IsCommit returns true if the message only carries the offset of its origin, see NewCommitMessage.
+func (m *Message) IsCommit() bool {
+	return m.commit
+}
+
 // GetStatus gets the status of the message.
 // if status is not set, StatusInfo will be returned.
 func (m *Message) GetStatus() string {
@@ -36,3 +59,11 @@ func (m *Message) GetStatus() string {
 	}
 	return m.status
 }
+
+// GetTimestamp returns the time of the event, or now if it's unknown.
+func (m *Message) GetTimestamp() time.Time {
+	if m.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return m.Timestamp
+}
@@ -40,6 +40,36 @@ var (
 	// TlmLogsDropped is the total number of logs dropped per Destination
 	TlmLogsDropped = telemetry.NewCounter("logs", "dropped",
 		[]string{"destination"}, "Total number of logs dropped per Destination")
+	// LogsStaleDropped is the total number of logs dropped because they were older than the max backlog age of their source
+	LogsStaleDropped = expvar.Int{}
+	// TlmLogsStaleDropped is the total number of logs dropped because they were older than the max backlog age of their source
+	TlmLogsStaleDropped = telemetry.NewCounter("logs", "stale_dropped",
+		nil, "Total number of logs dropped because they were older than the max backlog age of their source")
+	// LogsTimestampNotParsed is the total number of logs sent with the ingestion time because no timestamp could
+	// be parsed from them with the timestamp pattern of their source
+	LogsTimestampNotParsed = expvar.Int{}
+	// TlmLogsTimestampNotParsed is the total number of logs sent with the ingestion time because no timestamp could
+	// be parsed from them with the timestamp pattern of their source
+	TlmLogsTimestampNotParsed = telemetry.NewCounter("logs", "timestamp_not_parsed",
+		nil, "Total number of logs sent with the ingestion time because no timestamp could be parsed from them")
+	// ReadBufferBytes is the memory held by the read buffers of the file tailers
+	ReadBufferBytes = expvar.Int{}
+	// TlmReadBufferBytes is the memory held by the read buffers of the file tailers
+	TlmReadBufferBytes = telemetry.NewGauge("logs", "read_buffer_bytes",
+		nil, "Memory held by the read buffers of the file tailers")
+	// TailerChurn is the number of file tailers started and stopped during the last minute
+	TailerChurn = expvar.Int{}
+	// TlmTailerChurn is the number of file tailers started and stopped during the last minute
+	TlmTailerChurn = telemetry.NewGauge("logs", "tailer_churn",
+		nil, "Number of file tailers started and stopped during the last minute")
+	// TlmTailersChurned is the total number of file tailers started and stopped
+	TlmTailersChurned = telemetry.NewCounter("logs", "tailers_churned",
+		[]string{"action"}, "Total number of file tailers started and stopped")
+	// FileLinesPerSecond is the number of lines per second sent by the file tailers when their rate is limited
+	FileLinesPerSecond = expvar.Int{}
+	// TlmFileLinesPerSecond is the number of lines per second sent by the file tailers when their rate is limited
+	TlmFileLinesPerSecond = telemetry.NewGauge("logs", "file_lines_per_second",
+		nil, "Number of lines per second sent by the file tailers when their rate is limited")
 	// BytesSent is the total number of sent bytes before encoding if any
 	BytesSent = expvar.Int{}
 	// TlmBytesSent is the total number of sent bytes before encoding if any
@@ -62,6 +92,11 @@ func init() {
 	LogsExpvars.Set("LogsSent", &LogsSent)
 	LogsExpvars.Set("DestinationErrors", &DestinationErrors)
 	LogsExpvars.Set("DestinationLogsDropped", &DestinationLogsDropped)
+	LogsExpvars.Set("LogsStaleDropped", &LogsStaleDropped)
+	LogsExpvars.Set("LogsTimestampNotParsed", &LogsTimestampNotParsed)
+	LogsExpvars.Set("ReadBufferBytes", &ReadBufferBytes)
+	LogsExpvars.Set("TailerChurn", &TailerChurn)
+	LogsExpvars.Set("FileLinesPerSecond", &FileLinesPerSecond)
 	LogsExpvars.Set("BytesSent", &BytesSent)
 	LogsExpvars.Set("EncodedBytesSent", &EncodedBytesSent)
 }
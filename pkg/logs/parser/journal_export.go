@@ -0,0 +1,108 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/message"
+)
+
+// Journal export fields with a special meaning
+const (
+	journalMessageField  = "MESSAGE"
+	journalPriorityField = "PRIORITY"
+)
+
+// JournalExportParser parses the journal entries in the journal export format,
+// see https://www.freedesktop.org/wiki/Software/systemd/export/
+var JournalExportParser *journalExportParser
+
+type journalExportParser struct{}
+
+// journalPriorityStatusMapping represents the 1:1 mapping between journal entry priorities and statuses.
+var journalPriorityStatusMapping = map[string]string{
+	"0": message.StatusEmergency,
+	"1": message.StatusAlert,
+	"2": message.StatusCritical,
+	"3": message.StatusError,
+	"4": message.StatusWarning,
+	"5": message.StatusNotice,
+	"6": message.StatusInfo,
+	"7": message.StatusDebug,
+}
+
+// Parse returns the fields of the journal entry as a json-string, like the journald tailer does:
+// "MESSAGE" is remapped into "message" and all the other fields, like "PRIORITY" or "_PID",
+// are bundled in a "journald" attribute. The status is the one of the priority of the entry.
+func (p *journalExportParser) Parse(msg []byte) ([]byte, string, string, bool, error) {
+	fields, err := ParseJournalExportFields(msg)
+	if err != nil {
+		return msg, message.StatusInfo, "", false, err
+	}
+
+	payload := make(map[string]interface{})
+	if value, exists := fields[journalMessageField]; exists {
+		payload["message"] = value
+		delete(fields, journalMessageField)
+	}
+	payload["journald"] = fields
+
+	status, exists := journalPriorityStatusMapping[fields[journalPriorityField]]
+	if !exists {
+		status = message.StatusInfo
+	}
+
+	content, err := json.Marshal(payload)
+	if err != nil {
+		return msg, status, "", false, err
+	}
+	return content, status, "", false, nil
+}
+
+// SupportsPartialLine returns false as a journal entry is always complete
+func (p *journalExportParser) SupportsPartialLine() bool {
+	return false
+}
+
+// ParseJournalExportFields returns the fields of a journal entry in the journal export format, without its
+// terminating empty line. A field is either "KEY=value\n" or, when its value is binary or holds new lines,
+// "KEY\n" followed by the size of the value as a little endian uint64, the value and "\n".
+func ParseJournalExportFields(entry []byte) (map[string]string, error) {
+	fields := make(map[string]string)
+	for len(entry) > 0 {
+		line := entry
+		if end := bytes.IndexByte(entry, '\n'); end >= 0 {
+			line, entry = entry[:end], entry[end+1:]
+		} else {
+			entry = nil
+		}
+		if sep := bytes.IndexByte(line, '='); sep >= 0 {
+			fields[string(line[:sep])] = string(line[sep+1:])
+			continue
+		}
+
+		// binary field
+		key := string(line)
+		if len(entry) < 8 {
+			return fields, fmt.Errorf("missing the size of the binary field %s", key)
+		}
+		size := binary.LittleEndian.Uint64(entry[:8])
+		entry = entry[8:]
+		if size > uint64(len(entry)) {
+			return fields, fmt.Errorf("truncated binary field %s: %d bytes expected, %d available", key, size, len(entry))
+		}
+		fields[key] = string(entry[:size])
+		entry = entry[size:]
+		if len(entry) > 0 && entry[0] == '\n' {
+			entry = entry[1:]
+		}
+	}
+	return fields, nil
+}
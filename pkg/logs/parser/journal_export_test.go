@@ -0,0 +1,41 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DataDog/datadog-agent/pkg/logs/message"
+)
+
+func TestParseJournalExportFields(t *testing.T) {
+	entry := []byte("MESSAGE=foo\n_PID=42\nBINARY\n\x07\x00\x00\x00\x00\x00\x00\x00foo\nbar\nEMPTY=\n")
+	fields, err := ParseJournalExportFields(entry)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"MESSAGE": "foo", "_PID": "42", "BINARY": "foo\nbar", "EMPTY": ""}, fields)
+
+	_, err = ParseJournalExportFields([]byte("BINARY\n\x07\x00\x00"))
+	assert.NotNil(t, err)
+	_, err = ParseJournalExportFields([]byte("BINARY\n\x07\x00\x00\x00\x00\x00\x00\x00foo"))
+	assert.NotNil(t, err)
+}
+
+func TestJournalExportParserHandleMessages(t *testing.T) {
+	parser := JournalExportParser
+	msg, status, _, partial, err := parser.Parse([]byte("MESSAGE=foo\nPRIORITY=3\n_PID=42\n"))
+	assert.Nil(t, err)
+	assert.False(t, partial)
+	assert.Equal(t, message.StatusError, status)
+	assert.Equal(t, `{"journald":{"PRIORITY":"3","_PID":"42"},"message":"foo"}`, string(msg))
+
+	// the status defaults to info
+	msg, status, _, _, err = parser.Parse([]byte("MESSAGE=bar\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, message.StatusInfo, status)
+	assert.Equal(t, `{"journald":{},"message":"bar"}`, string(msg))
+}
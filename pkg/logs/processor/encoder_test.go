@@ -221,6 +221,19 @@ func TestJsonEncoder(t *testing.T) {
 	assert.NotEmpty(t, log.Timestamp)
 }
 
+func TestJsonEncoderUsesMessageTimestamp(t *testing.T) {
+	source := config.NewLogSource("", &config.LogsConfig{})
+	msg := newMessage([]byte("message"), source, message.StatusInfo)
+	msg.Timestamp = time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	jsonMessage, err := JSONEncoder.Encode(msg, msg.Content)
+	assert.Nil(t, err)
+
+	log := &jsonPayload{}
+	assert.Nil(t, json.Unmarshal(jsonMessage, log))
+	assert.Equal(t, msg.Timestamp.UnixNano()/nanoToMillis, log.Timestamp)
+}
+
 func TestEncoderToValidUTF8(t *testing.T) {
 	assert.Equal(t, "a�z", toValidUtf8([]byte("a\xfez")))
 	assert.Equal(t, "a��z", toValidUtf8([]byte("a\xc0\xafz")))
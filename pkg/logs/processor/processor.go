@@ -52,6 +52,11 @@ func (p *Processor) run() {
 		p.done <- struct{}{}
 	}()
 	for msg := range p.inputChan {
+		if msg.IsCommit() {
+			// nothing to process, the offset is forwarded in order with the other messages
+			p.outputChan <- msg
+			continue
+		}
 		metrics.LogsDecoded.Add(1)
 		metrics.TlmLogsDecoded.Inc()
 		if shouldProcess, redactedMsg := p.applyRedactingRules(msg); shouldProcess {
@@ -24,6 +24,9 @@ type batchStrategy struct {
 	buffer     *MessageBuffer
 	serializer Serializer
 	batchWait  time.Duration
+	// commits are the commit messages received after the messages of the buffer,
+	// they are forwarded once the buffer has been sent
+	commits []*message.Message
 }
 
 // NewBatchStrategy returns a new batchStrategy.
@@ -50,6 +53,14 @@ func (s *batchStrategy) Send(inputChan chan *message.Message, outputChan chan *m
 				s.sendBuffer(outputChan, send)
 				return
 			}
+			if message.IsCommit() {
+				if s.buffer.IsEmpty() {
+					outputChan <- message
+				} else {
+					s.commits = append(s.commits, message)
+				}
+				continue
+			}
 			added := s.buffer.AddMessage(message)
 			if !added || s.buffer.IsFull() {
 				// message buffer is full, either reaching max batch size or max content size,
@@ -102,4 +113,8 @@ func (s *batchStrategy) sendBuffer(outputChan chan *message.Message, send func([
 	for _, message := range messages {
 		outputChan <- message
 	}
+	for _, commit := range s.commits {
+		outputChan <- commit
+	}
+	s.commits = nil
 }
@@ -113,6 +113,32 @@ func TestBatchStrategySendsPayloadWhenClosingInput(t *testing.T) {
 	assert.True(t, now.Before(end) || now.Equal(end))
 }
 
+func TestBatchStrategyForwardsCommitsAfterThePayload(t *testing.T) {
+	input := make(chan *message.Message)
+	output := make(chan *message.Message)
+
+	success := func(payload []byte) error {
+		assert.Equal(t, []byte("a"), payload)
+		return nil
+	}
+
+	go newBatchStrategyWithLimits(LineSerializer, 2, 10, 100*time.Millisecond).Send(input, output, success)
+
+	// nothing is buffered, the commit is forwarded right away
+	commit1 := message.NewCommitMessage(nil)
+	input <- commit1
+	assert.Equal(t, commit1, <-output)
+
+	// the commit waits for the buffered message to be sent, it is not part of the payload
+	message1 := message.NewMessage([]byte("a"), nil, "")
+	input <- message1
+	commit2 := message.NewCommitMessage(nil)
+	input <- commit2
+	close(input)
+	assert.Equal(t, message1, <-output)
+	assert.Equal(t, commit2, <-output)
+}
+
 func TestBatchStrategyShouldNotBlockWhenForceStopping(t *testing.T) {
 	input := make(chan *message.Message)
 	output := make(chan *message.Message)
@@ -21,6 +21,11 @@ type streamStrategy struct{}
 // Send sends one message at a time and forwards them to the next stage of the pipeline.
 func (s *streamStrategy) Send(inputChan chan *message.Message, outputChan chan *message.Message, send func([]byte) error) {
 	for message := range inputChan {
+		if message.IsCommit() {
+			// the previous messages have been sent, the offset can be committed
+			outputChan <- message
+			continue
+		}
 		err := send(message.Content)
 		if err != nil {
 			if shouldStopSending(err) {
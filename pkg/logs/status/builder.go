@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/DataDog/datadog-agent/pkg/logs/config"
 )
@@ -129,7 +130,7 @@ func (b *Builder) getIntegrations() []Integration {
 				Status:        b.toString(source.Status),
 				Inputs:        source.GetInputs(),
 				Messages:      source.Messages.GetMessages(),
-				Info:          source.GetInfo(),
+				Info:          b.getInfo(source),
 			})
 		}
 		integrations = append(integrations, Integration{
@@ -140,6 +141,15 @@ func (b *Builder) getIntegrations() []Integration {
 	return integrations
 }
 
+// getInfo returns the info about the source, along with the time of its last offset committed to the registry.
+func (b *Builder) getInfo(source *config.LogSource) []string {
+	info := source.GetInfo()
+	if lastCommit := source.GetLastCommit(); !lastCommit.IsZero() {
+		info = append(info, fmt.Sprintf("Last registry commit: %s", lastCommit.UTC().Format(time.RFC3339)))
+	}
+	return info
+}
+
 // groupSourcesByName groups all logs sources by name so that they get properly displayed
 // on the agent status.
 func (b *Builder) groupSourcesByName() map[string][]*config.LogSource {
@@ -156,7 +166,9 @@ func (b *Builder) groupSourcesByName() map[string][]*config.LogSource {
 // toString returns a representation of a status.
 func (b *Builder) toString(status *config.LogStatus) string {
 	var value string
-	if status.IsPending() {
+	if status.IsPaused() {
+		value = "Paused"
+	} else if status.IsPending() {
 		value = "Pending"
 	} else if status.IsSuccess() {
 		value = "OK"
@@ -202,5 +214,8 @@ func (b *Builder) getMetricsStatus() map[string]int64 {
 	metrics["LogsSent"] = b.logsExpVars.Get("LogsSent").(*expvar.Int).Value()
 	metrics["BytesSent"] = b.logsExpVars.Get("BytesSent").(*expvar.Int).Value()
 	metrics["EncodedBytesSent"] = b.logsExpVars.Get("EncodedBytesSent").(*expvar.Int).Value()
+	metrics["ReadBufferBytes"] = b.logsExpVars.Get("ReadBufferBytes").(*expvar.Int).Value()
+	metrics["TailerChurn"] = b.logsExpVars.Get("TailerChurn").(*expvar.Int).Value()
+	metrics["FileLinesPerSecond"] = b.logsExpVars.Get("FileLinesPerSecond").(*expvar.Int).Value()
 	return metrics
 }
@@ -6,9 +6,11 @@
 package status
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -44,6 +46,34 @@ func TestSourceAreGroupedByIntegrations(t *testing.T) {
 	}
 }
 
+func TestStatusBytesRead(t *testing.T) {
+	defer Clear()
+	source := config.NewLogSource("foo", &config.LogsConfig{Type: "foo"})
+	InitStatus(config.CreateSources([]*config.LogSource{source}))
+
+	source.BytesRead.Add(42)
+	source.BytesRead.Add(8)
+
+	status := Get()
+	assert.Equal(t, 1, len(status.Integrations))
+	assert.Equal(t, int64(50), status.Integrations[0].Sources[0].BytesRead)
+
+	payload, err := json.Marshal(status)
+	assert.Nil(t, err)
+	assert.Contains(t, string(payload), `"bytes_read":50`)
+}
+
+func TestStatusLastCommit(t *testing.T) {
+	defer Clear()
+	source := config.NewLogSource("foo", &config.LogsConfig{Type: "foo"})
+	InitStatus(config.CreateSources([]*config.LogSource{source}))
+
+	assert.Empty(t, Get().Integrations[0].Sources[0].Info)
+
+	source.SetLastCommit(time.Date(2021, time.March, 4, 5, 6, 7, 8, time.UTC))
+	assert.Equal(t, []string{"Last registry commit: 2021-03-04T05:06:07Z"}, Get().Integrations[0].Sources[0].Info)
+}
+
 func TestStatusDeduplicateWarnings(t *testing.T) {
 	defer Clear()
 	initStatus()
@@ -92,13 +122,13 @@ func TestStatusDeduplicateErrorsAndWarnings(t *testing.T) {
 func TestMetrics(t *testing.T) {
 	defer Clear()
 	Clear()
-	var expected = `{"BytesSent": 0, "DestinationErrors": 0, "DestinationLogsDropped": {}, "EncodedBytesSent": 0, "Errors": "", "IsRunning": false, "LogsDecoded": 0, "LogsProcessed": 0, "LogsSent": 0, "Warnings": ""}`
+	var expected = `{"BytesSent": 0, "DestinationErrors": 0, "DestinationLogsDropped": {}, "EncodedBytesSent": 0, "Errors": "", "FileLinesPerSecond": 0, "IsRunning": false, "LogsDecoded": 0, "LogsProcessed": 0, "LogsSent": 0, "LogsStaleDropped": 0, "LogsTimestampNotParsed": 0, "ReadBufferBytes": 0, "TailerChurn": 0, "Warnings": ""}`
 	assert.Equal(t, expected, metrics.LogsExpvars.String())
 
 	initStatus()
 	AddGlobalWarning("bar", "Unique Warning")
 	AddGlobalError("bar", "I am an error")
-	expected = `{"BytesSent": 0, "DestinationErrors": 0, "DestinationLogsDropped": {}, "EncodedBytesSent": 0, "Errors": "I am an error", "IsRunning": true, "LogsDecoded": 0, "LogsProcessed": 0, "LogsSent": 0, "Warnings": "Unique Warning"}`
+	expected = `{"BytesSent": 0, "DestinationErrors": 0, "DestinationLogsDropped": {}, "EncodedBytesSent": 0, "Errors": "I am an error", "FileLinesPerSecond": 0, "IsRunning": true, "LogsDecoded": 0, "LogsProcessed": 0, "LogsSent": 0, "LogsStaleDropped": 0, "LogsTimestampNotParsed": 0, "ReadBufferBytes": 0, "TailerChurn": 0, "Warnings": "Unique Warning"}`
 	assert.Equal(t, expected, metrics.LogsExpvars.String())
 }
 
@@ -111,17 +141,26 @@ func TestStatusMetrics(t *testing.T) {
 	assert.Equal(t, int64(0), status.StatusMetrics["LogsSent"])
 	assert.Equal(t, int64(0), status.StatusMetrics["BytesSent"])
 	assert.Equal(t, int64(0), status.StatusMetrics["EncodedBytesSent"])
+	assert.Equal(t, int64(0), status.StatusMetrics["ReadBufferBytes"])
+	assert.Equal(t, int64(0), status.StatusMetrics["TailerChurn"])
+	assert.Equal(t, int64(0), status.StatusMetrics["FileLinesPerSecond"])
 
 	metrics.LogsProcessed.Set(5)
 	metrics.LogsSent.Set(3)
 	metrics.BytesSent.Set(42)
 	metrics.EncodedBytesSent.Set(21)
+	metrics.ReadBufferBytes.Set(4096)
+	metrics.TailerChurn.Set(12)
+	metrics.FileLinesPerSecond.Set(250)
 	status = Get()
 
 	assert.Equal(t, int64(5), status.StatusMetrics["LogsProcessed"])
 	assert.Equal(t, int64(3), status.StatusMetrics["LogsSent"])
 	assert.Equal(t, int64(42), status.StatusMetrics["BytesSent"])
 	assert.Equal(t, int64(21), status.StatusMetrics["EncodedBytesSent"])
+	assert.Equal(t, int64(4096), status.StatusMetrics["ReadBufferBytes"])
+	assert.Equal(t, int64(12), status.StatusMetrics["TailerChurn"])
+	assert.Equal(t, int64(250), status.StatusMetrics["FileLinesPerSecond"])
 
 	metrics.LogsProcessed.Set(math.MaxInt64)
 	metrics.LogsProcessed.Add(1)
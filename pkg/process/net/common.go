@@ -137,6 +137,20 @@ func (r *RemoteSysProbeUtil) GetStats() (map[string]interface{}, error) {
 	return stats, nil
 }
 
+// GetRuntimeSecurityDiagnostics returns the diagnostics report of the runtime security module of the system probe
+func (r *RemoteSysProbeUtil) GetRuntimeSecurityDiagnostics() ([]byte, error) {
+	resp, err := r.httpClient.Get(runtimeSecurityDiagnosticsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("conn request failed: Path %s, url: %s, status code: %d", r.path, runtimeSecurityDiagnosticsURL, resp.StatusCode)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
 func newSystemProbe() *RemoteSysProbeUtil {
 	return &RemoteSysProbeUtil{
 		path: globalSocketPath,
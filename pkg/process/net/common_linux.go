@@ -12,6 +12,8 @@ const (
 	connectionsURL = "http://unix/connections"
 	statsURL       = "http://unix/debug/stats"
 	netType        = "unix"
+
+	runtimeSecurityDiagnosticsURL = "http://unix/debug/runtime_security_diagnostics"
 )
 
 // CheckPath is used in conjunction with calling the stats endpoint, since we are calling this
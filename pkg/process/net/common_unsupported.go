@@ -34,3 +34,8 @@ func (r *RemoteSysProbeUtil) GetConnections(clientID string) (*model.Connections
 func (r *RemoteSysProbeUtil) GetStats() (map[string]interface{}, error) {
 	return nil, ebpf.ErrNotImplemented
 }
+
+// GetRuntimeSecurityDiagnostics is not supported
+func (r *RemoteSysProbeUtil) GetRuntimeSecurityDiagnostics() ([]byte, error) {
+	return nil, ebpf.ErrNotImplemented
+}
@@ -9,6 +9,8 @@ const (
 	connectionsURL = "http://localhost:3333/connections"
 	statsURL       = "http://localhost:3333/debug/stats"
 	netType        = "tcp"
+
+	runtimeSecurityDiagnosticsURL = "http://localhost:3333/debug/runtime_security_diagnostics"
 )
 
 // CheckPath is used to make sure the globalSocketPath has been set before attempting to connect
@@ -7,6 +7,7 @@ package config
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	aconfig "github.com/DataDog/datadog-agent/pkg/config"
@@ -41,6 +42,14 @@ type Config struct {
 	SocketPath string
 	// SyscallMonitor defines if the syscall monitor should be activated or not
 	SyscallMonitor bool
+	// SyscallMonitorRequired defines if the probe should fail to start when the syscall monitor can't be initialized
+	SyscallMonitorRequired bool
+	// SyscallMonitorPerProcess defines if the syscall monitor should report the syscall counts of the noisiest
+	// processes, tagged with their pid and command
+	SyscallMonitorPerProcess bool
+	// SyscallMonitorTopN is the number of processes reported by the per process syscall counts, the syscalls of
+	// the other processes are reported together
+	SyscallMonitorTopN int
 	// EventServerBurst defines the maximum burst of events that can be sent over the grpc server
 	EventServerBurst int
 	// EventServerRate defines the grpc server rate at which events can be sent
@@ -54,6 +63,19 @@ type Config struct {
 	// LoadControllerControlPeriod defines the period at which the load controller will empty the user space counter used
 	// to evaluate the amount of events brought back to user space
 	LoadControllerControlPeriod time.Duration
+	// StatsEnabled defines if the probe monitor should collect statistics about the events received from the kernel
+	StatsEnabled bool
+	// StatsPollingInterval determines how often metrics should be polled and sent by the probe monitor. A value
+	// of 0 disables the stats loop of the probe monitor, its metrics are then sent along with the module stats.
+	StatsPollingInterval time.Duration
+	// StatsSampleRates holds the sample rates of the events stats by event type: with a rate of N, the probe monitor
+	// only counts 1 in N events of the type and the reported totals are estimates
+	StatsSampleRates map[string]uint64
+	// StatsSizeBuckets holds the upper bounds, in bytes, of the buckets of the event size histogram of the probe
+	// monitor, the default buckets are used when empty
+	StatsSizeBuckets []uint64
+	// StatsCounterMode defines whether reading the events stats resets them, either "cumulative" or "delta"
+	StatsCounterMode string
 	// StatsAddr defines the statsd address
 	StatsdAddr string
 }
@@ -68,6 +90,9 @@ func NewConfig(cfg *config.AgentConfig) (*Config, error) {
 		FlushDiscarderWindow:               aconfig.Datadog.GetInt("runtime_security_config.flush_discarder_window"),
 		SocketPath:                         aconfig.Datadog.GetString("runtime_security_config.socket"),
 		SyscallMonitor:                     aconfig.Datadog.GetBool("runtime_security_config.syscall_monitor.enabled"),
+		SyscallMonitorRequired:             aconfig.Datadog.GetBool("runtime_security_config.syscall_monitor.required"),
+		SyscallMonitorPerProcess:           aconfig.Datadog.GetBool("runtime_security_config.syscall_monitor.per_process.enabled"),
+		SyscallMonitorTopN:                 aconfig.Datadog.GetInt("runtime_security_config.syscall_monitor.per_process.top_n"),
 		PoliciesDir:                        aconfig.Datadog.GetString("runtime_security_config.policies.dir"),
 		EventServerBurst:                   aconfig.Datadog.GetInt("runtime_security_config.event_server.burst"),
 		EventServerRate:                    aconfig.Datadog.GetInt("runtime_security_config.event_server.rate"),
@@ -75,9 +100,34 @@ func NewConfig(cfg *config.AgentConfig) (*Config, error) {
 		LoadControllerEventsCountThreshold: int64(aconfig.Datadog.GetInt("runtime_security_config.load_controller.events_count_threshold")),
 		LoadControllerDiscarderTimeout:     time.Duration(aconfig.Datadog.GetInt("runtime_security_config.load_controller.discarder_timeout")) * time.Second,
 		LoadControllerControlPeriod:        time.Duration(aconfig.Datadog.GetInt("runtime_security_config.load_controller.control_period")) * time.Second,
+		StatsEnabled:                       aconfig.Datadog.GetBool("runtime_security_config.events_stats.enabled"),
+		StatsPollingInterval:               time.Duration(aconfig.Datadog.GetInt("runtime_security_config.events_stats.polling_interval")) * time.Second,
+		StatsCounterMode:                   aconfig.Datadog.GetString("runtime_security_config.events_stats.counter_mode"),
 		StatsdAddr:                         fmt.Sprintf("%s:%d", cfg.StatsdHost, cfg.StatsdPort),
 	}
 
+	sampleRates, err := parseSampleRates(aconfig.Datadog.GetStringMapString("runtime_security_config.events_stats.sample_rates"))
+	if err != nil {
+		return nil, err
+	}
+	c.StatsSampleRates = sampleRates
+
+	for _, bucket := range aconfig.Datadog.GetStringSlice("runtime_security_config.events_stats.size_buckets") {
+		size, err := strconv.ParseUint(bucket, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event size bucket '%s': %v", bucket, err)
+		}
+		c.StatsSizeBuckets = append(c.StatsSizeBuckets, size)
+	}
+
+	if c.StatsCounterMode != "cumulative" && c.StatsCounterMode != "delta" {
+		return nil, fmt.Errorf("invalid events stats counter mode '%s', it must be cumulative or delta", c.StatsCounterMode)
+	}
+
+	if c.SyscallMonitorPerProcess && c.SyscallMonitorTopN <= 0 {
+		return nil, fmt.Errorf("invalid syscall monitor per process top_n %d, it must be positive", c.SyscallMonitorTopN)
+	}
+
 	if cfg != nil {
 		c.BPFDir = cfg.SystemProbeBPFDir
 	}
@@ -100,3 +150,16 @@ func NewConfig(cfg *config.AgentConfig) (*Config, error) {
 
 	return c, nil
 }
+
+// parseSampleRates parses the sample rates of the events stats, indexed by event type
+func parseSampleRates(rates map[string]string) (map[string]uint64, error) {
+	sampleRates := make(map[string]uint64, len(rates))
+	for eventType, value := range rates {
+		rate, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || rate == 0 {
+			return nil, fmt.Errorf("invalid sample rate '%s' for event type %s", value, eventType)
+		}
+		sampleRates[eventType] = rate
+	}
+	return sampleRates, nil
+}
@@ -8,6 +8,7 @@
 package module
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"net"
@@ -70,7 +71,7 @@ func (m *Module) Register(httpMux *http.ServeMux) error {
 		}
 	}()
 
-	go m.statsMonitor(context.Background())
+	httpMux.HandleFunc("/debug/runtime_security_diagnostics", m.serveDiagnostics)
 
 	// initialize the eBPF manager and load the programs and maps in the kernel. At this stage, the probes are not
 	// running yet.
@@ -78,6 +79,10 @@ func (m *Module) Register(httpMux *http.ServeMux) error {
 		return errors.Wrap(err, "failed to init probe")
 	}
 
+	// the stats of the probe monitor are sent with the module stats when its stats loop is disabled, the monitor
+	// is created by Init
+	go m.statsMonitor(context.Background())
+
 	// start the manager and its probes / perf maps
 	if err := m.probe.Start(); err != nil {
 		return errors.Wrap(err, "failed to start probe")
@@ -101,6 +106,11 @@ func (m *Module) Register(httpMux *http.ServeMux) error {
 		for range m.sigupChan {
 			log.Info("Reload configuration")
 
+			// the rule set selects the probes of the reloaded manager
+			if err := m.probe.ReloadManager(); err != nil {
+				log.Errorf("failed to reload the eBPF manager: %s", err)
+			}
+
 			if err := m.Reload(); err != nil {
 				log.Errorf("failed to reload configuration: %s", err)
 			}
@@ -203,7 +213,7 @@ func (m *Module) statsMonitor(ctx context.Context) {
 	for {
 		select {
 		case <-ticker.C:
-			if err := m.probe.SendStats(m.statsdClient); err != nil {
+			if err := m.probe.SendStats(); err != nil {
 				log.Debug(err)
 			}
 			if err := m.rateLimiter.SendStats(m.statsdClient); err != nil {
@@ -230,6 +240,18 @@ func (m *Module) GetStats() map[string]interface{} {
 	}
 }
 
+// serveDiagnostics writes the diagnostics report of the probe, collected by the flare
+func (m *Module) serveDiagnostics(w http.ResponseWriter, req *http.Request) {
+	var diagnostics bytes.Buffer
+	if err := m.probe.DumpDiagnostics(&diagnostics); err != nil {
+		log.Errorf("failed to dump the probe diagnostics: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(diagnostics.Bytes()) //nolint:errcheck
+}
+
 // GetProbe returns the module's probe
 func (m *Module) GetProbe() *sprobe.Probe {
 	return m.probe
@@ -0,0 +1,161 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+// +build linux
+
+package probe
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+const (
+	// defaultStatsdFailureThreshold is the number of consecutive statsd failures that opens the circuit breaker
+	defaultStatsdFailureThreshold = 5
+	// defaultStatsdCooldown is how long the circuit breaker stays open before testing if statsd recovered
+	defaultStatsdCooldown = time.Minute
+)
+
+// Circuit breaker states
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// errStatsdCircuitOpen is returned instead of sending a metric while the circuit breaker is open
+var errStatsdCircuitOpen = errors.New("statsd circuit breaker is open, metric not sent")
+
+// StatsdCircuitBreakerStats contains the state of the statsd circuit breaker
+type StatsdCircuitBreakerStats struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	OpenUntil           string `json:"open_until,omitempty"`
+	SkippedMetrics      int64  `json:"skipped_metrics"`
+}
+
+// statsdCircuitBreaker is a StatsdClient that stops sending metrics to the underlying client after `threshold`
+// consecutive failures. The breaker then stays open for `cooldown`, the metrics are dropped and the failure is
+// only logged once. Once the cooldown expired, the breaker is half open: the next metric is sent to test if statsd
+// recovered, the breaker closes if it succeeds and opens again otherwise.
+type statsdCircuitBreaker struct {
+	sync.Mutex
+	client    StatsdClient
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	state               string
+	consecutiveFailures int
+	openUntil           time.Time
+	skippedMetrics      int64
+}
+
+// newStatsdCircuitBreaker returns a circuit breaker around the provided statsd client
+func newStatsdCircuitBreaker(client StatsdClient, threshold int, cooldown time.Duration) *statsdCircuitBreaker {
+	return &statsdCircuitBreaker{
+		client:    client,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     circuitClosed,
+	}
+}
+
+// Count sends a count metric unless the breaker is open
+func (cb *statsdCircuitBreaker) Count(name string, value int64, tags []string, rate float64) error {
+	if !cb.allow(1) {
+		return errStatsdCircuitOpen
+	}
+	return cb.record(cb.client.Count(name, value, tags, rate))
+}
+
+// Gauge sends a gauge metric unless the breaker is open
+func (cb *statsdCircuitBreaker) Gauge(name string, value float64, tags []string, rate float64) error {
+	if !cb.allow(1) {
+		return errStatsdCircuitOpen
+	}
+	return cb.record(cb.client.Gauge(name, value, tags, rate))
+}
+
+// send sends the metrics unless the breaker is open, in which case all of them are skipped. Like sendMetrics, it
+// stops at the first error.
+func (cb *statsdCircuitBreaker) send(metrics []Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	if !cb.allow(len(metrics)) {
+		return errStatsdCircuitOpen
+	}
+	return cb.record(sendMetrics(cb.client, metrics))
+}
+
+// IsOpen returns true if the breaker is open and its cooldown hasn't expired yet
+func (cb *statsdCircuitBreaker) IsOpen() bool {
+	cb.Lock()
+	defer cb.Unlock()
+	return cb.state == circuitOpen && cb.now().Before(cb.openUntil)
+}
+
+// allow returns true if the next n metrics can be sent, it half opens the breaker once its cooldown expired. This is
+// the only place where the metrics are dropped, they are counted as skipped.
+func (cb *statsdCircuitBreaker) allow(n int) bool {
+	cb.Lock()
+	defer cb.Unlock()
+
+	if cb.state != circuitOpen {
+		return true
+	}
+	if cb.now().Before(cb.openUntil) {
+		cb.skippedMetrics += int64(n)
+		return false
+	}
+	log.Debugf("statsd circuit breaker cooldown expired, testing if statsd recovered")
+	cb.state = circuitHalfOpen
+	return true
+}
+
+// record updates the state of the breaker with the result of a statsd call, and returns it
+func (cb *statsdCircuitBreaker) record(err error) error {
+	cb.Lock()
+	defer cb.Unlock()
+
+	if err == nil {
+		if cb.state != circuitClosed {
+			log.Infof("statsd recovered, resuming the runtime security metrics")
+		}
+		cb.state = circuitClosed
+		cb.consecutiveFailures = 0
+		return nil
+	}
+
+	cb.consecutiveFailures++
+	if cb.state == circuitHalfOpen || cb.consecutiveFailures >= cb.threshold {
+		cb.state = circuitOpen
+		cb.openUntil = cb.now().Add(cb.cooldown)
+		log.Warnf("statsd failed %d consecutive times, skipping the runtime security metrics for %s: %v", cb.consecutiveFailures, cb.cooldown, err)
+	}
+	return err
+}
+
+// GetStats returns the state of the breaker
+func (cb *statsdCircuitBreaker) GetStats() StatsdCircuitBreakerStats {
+	cb.Lock()
+	defer cb.Unlock()
+
+	stats := StatsdCircuitBreakerStats{
+		State:               cb.state,
+		ConsecutiveFailures: cb.consecutiveFailures,
+		SkippedMetrics:      cb.skippedMetrics,
+	}
+	if cb.state == circuitOpen {
+		stats.OpenUntil = cb.openUntil.Format(time.RFC3339)
+	}
+	return stats
+}
@@ -0,0 +1,137 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+// +build linux
+
+package probe
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// DumpDiagnostics writes a human readable report of the state of the Monitor, e.g. for the support bundles: the
+// enabled sub-monitors, their health, the events received and lost, the per-cpu breakdown, the configured perf
+// buffer sizes, the load controller and the statsd circuit breakers. The counters are read without being reset,
+// it is safe to call DumpDiagnostics at any time, even while events are being processed.
+func (m *Monitor) DumpDiagnostics(w io.Writer) error {
+	var buf bytes.Buffer
+	perfBufferMonitor, _ := m.getMonitors()
+
+	fmt.Fprintf(&buf, "Sub-monitors: %s\n", m.summary())
+	if healthy, problems := m.Healthy(); healthy {
+		fmt.Fprintln(&buf, "Health: OK")
+	} else {
+		fmt.Fprintln(&buf, "Health: unhealthy")
+		for _, problem := range problems {
+			fmt.Fprintf(&buf, "  - %s\n", problem)
+		}
+	}
+
+	if perfBufferMonitor != nil {
+		dumpPerfBufferDiagnostics(&buf, perfBufferMonitor)
+	}
+
+	if m.loadController != nil {
+		stats := m.loadController.GetStats()
+		fmt.Fprintln(&buf, "\nLoad controller:")
+		table := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(table, "  events count\t%d / %d\n", stats.EventsCount, stats.EventsCountThreshold)
+		fmt.Fprintf(table, "  active discarders\t%d\n", stats.ActiveDiscarders)
+		fmt.Fprintf(table, "  discarders pushed\t%d\n", stats.DiscardersPushed)
+		fmt.Fprintf(table, "  discarder timeout\t%s\n", stats.DiscarderTimeout)
+		fmt.Fprintf(table, "  controller period\t%s\n", stats.ControllerPeriod)
+		for _, eventType := range sortedKeys(stats.DiscardersPerEventType) {
+			fmt.Fprintf(table, "  discarders %s\t%d (%d events discarded)\n", eventType, stats.DiscardersPerEventType[eventType], stats.DiscardedEvents[eventType])
+		}
+		table.Flush()
+	}
+
+	if m.statsdBreaker != nil {
+		fmt.Fprintln(&buf, "\nStatsd circuit breakers:")
+		for i, breaker := range append([]*statsdCircuitBreaker{m.statsdBreaker}, m.secondaryStatsdBreakers...) {
+			stats := breaker.GetStats()
+			fmt.Fprintf(&buf, "  client %d: %s, %d consecutive failures, %d metrics skipped", i, stats.State, stats.ConsecutiveFailures, stats.SkippedMetrics)
+			if stats.OpenUntil != "" {
+				fmt.Fprintf(&buf, ", open until %s", stats.OpenUntil)
+			}
+			fmt.Fprintln(&buf)
+		}
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// dumpPerfBufferDiagnostics writes the configuration and the counters of the perf buffer monitor
+func dumpPerfBufferDiagnostics(buf *bytes.Buffer, perfBufferMonitor *PerfBufferMonitor) {
+	configs := perfBufferMonitor.GetPerfMapConfigs()
+	perfMaps := make([]string, 0, len(configs))
+	for perfMap := range configs {
+		perfMaps = append(perfMaps, perfMap)
+	}
+	sort.Strings(perfMaps)
+
+	fmt.Fprintln(buf, "\nPerf buffers:")
+	table := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "  map\tsize\tpages\tcpus\tlost\tpeak turnover")
+	for _, perfMap := range perfMaps {
+		config := configs[perfMap]
+		var peak float64
+		for _, turnover := range perfBufferMonitor.GetPeakTurnover(perfMap) {
+			if turnover > peak {
+				peak = turnover
+			}
+		}
+		fmt.Fprintf(table, "  %s\t%d\t%d\t%d\t%d\t%.1f%%/s\n", perfMap, config.Size, config.PageCount, config.NumCPU, perfBufferMonitor.GetLostCount(perfMap, -1), peak*100)
+	}
+	table.Flush()
+
+	fmt.Fprintln(buf, "\nEvents received:")
+	table = tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "  event type\tcount\tbytes")
+	for i := EventType(1); i < maxEventType; i++ {
+		stats := perfBufferMonitor.GetEventStats(i, "", -1)
+		if stats.Count == 0 {
+			continue
+		}
+		estimate := ""
+		if perfBufferMonitor.IsSampled(i) {
+			estimate = fmt.Sprintf(" (estimate, sample rate %d)", perfBufferMonitor.sampleRates[i])
+		}
+		fmt.Fprintf(table, "  %s\t%d\t%d%s\n", i, stats.Count, stats.Bytes, estimate)
+	}
+	fmt.Fprintf(table, "  lost\t%d\t\n", perfBufferMonitor.GetLostCount("", -1))
+	table.Flush()
+
+	cpuStats := perfBufferMonitor.GetCPUStats()
+	cpus := make([]int, 0, len(cpuStats))
+	for cpu := range cpuStats {
+		cpus = append(cpus, cpu)
+	}
+	sort.Ints(cpus)
+
+	fmt.Fprintln(buf, "\nPer cpu:")
+	table = tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "  cpu\tcount\tbytes\tlost")
+	for _, cpu := range cpus {
+		stats := cpuStats[cpu]
+		fmt.Fprintf(table, "  %d\t%d\t%d\t%d\n", cpu, stats.Count, stats.Bytes, stats.Lost)
+	}
+	table.Flush()
+}
+
+// sortedKeys returns the sorted keys of the map
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -33,18 +33,18 @@ func (p *Probe) discardPID(eventType EventType, pid uint32) error {
 	return p.pidDiscarders.Update(pid, &params, updateFlags)
 }
 
-func (p *Probe) discardPIDWithTimeout(eventType EventType, pid uint32, timeout time.Duration) error {
+func (p *Probe) discardPIDWithTimeout(pidDiscarders *libebpf.Map, eventType EventType, pid uint32, timeout time.Duration) error {
 	var params pidDiscarderParameters
 
 	updateFlags := libebpf.UpdateExist
-	if err := p.pidDiscarders.Lookup(pid, &params); err != nil {
+	if err := pidDiscarders.Lookup(pid, &params); err != nil {
 		updateFlags = libebpf.UpdateAny
 	}
 
 	params.EventType |= 1 << (eventType - 1)
 	params.Timestamps[eventType] = uint64(p.resolvers.TimeResolver.ComputeMonotonicTimestamp(time.Now().Add(timeout)))
 
-	return p.pidDiscarders.Update(pid, &params, updateFlags)
+	return pidDiscarders.Update(pid, &params, updateFlags)
 }
 
 type inodeDiscarder struct {
@@ -0,0 +1,88 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+// +build linux
+
+package probe
+
+import (
+	"fmt"
+)
+
+// EventTypeFilter selects the event types the Monitor counts, for example to focus an investigation on a few event
+// types. The events filtered out are still processed by the probe, they are only ignored by the perf buffer
+// monitor and by the load controller.
+type EventTypeFilter struct {
+	// Allow is the set of the event types counted, all the event types are counted when it is empty
+	Allow []EventType
+	// Deny is the set of the event types never counted, it takes precedence over Allow
+	Deny []EventType
+	// ForceLoadControl is the set of the event types always counted by the load controller, even when they are
+	// filtered out, so that the discarders keep protecting the host from the noisy processes generating
+	// security-critical events such as exec. The perf buffer monitor still ignores them.
+	ForceLoadControl []EventType
+}
+
+// eventTypeFilter is the compiled form of an EventTypeFilter, indexed by event type
+type eventTypeFilter struct {
+	counted          [maxEventType]bool
+	forceLoadControl [maxEventType]bool
+}
+
+// newEventTypeFilter compiles the filter, it returns nil when the filter selects all the event types
+func newEventTypeFilter(filter EventTypeFilter) (*eventTypeFilter, error) {
+	for _, types := range [][]EventType{filter.Allow, filter.Deny, filter.ForceLoadControl} {
+		for _, eventType := range types {
+			if eventType == UnknownEventType || eventType >= maxEventType {
+				return nil, fmt.Errorf("invalid event type %d", eventType)
+			}
+		}
+	}
+	if len(filter.Allow) == 0 && len(filter.Deny) == 0 {
+		return nil, nil
+	}
+
+	f := &eventTypeFilter{}
+	for i := EventType(1); i < maxEventType; i++ {
+		f.counted[i] = len(filter.Allow) == 0
+	}
+	for _, eventType := range filter.Allow {
+		f.counted[eventType] = true
+	}
+	for _, eventType := range filter.Deny {
+		f.counted[eventType] = false
+	}
+	for _, eventType := range filter.ForceLoadControl {
+		f.forceLoadControl[eventType] = true
+	}
+	return f, nil
+}
+
+// isCounted returns whether the events of the specified type are counted by the perf buffer monitor
+func (f *eventTypeFilter) isCounted(eventType EventType) bool {
+	return f == nil || eventType >= maxEventType || f.counted[eventType]
+}
+
+// isLoadControlled returns whether the events of the specified type are counted by the load controller
+func (f *eventTypeFilter) isLoadControlled(eventType EventType) bool {
+	return f.isCounted(eventType) || f.forceLoadControl[eventType]
+}
+
+// SetEventTypeFilter sets the event types counted by the Monitor, it can be called while events are being processed.
+// An empty filter counts all the event types again.
+func (m *Monitor) SetEventTypeFilter(filter EventTypeFilter) error {
+	f, err := newEventTypeFilter(filter)
+	if err != nil {
+		return err
+	}
+	m.eventTypeFilter.Store(f)
+	return nil
+}
+
+// getEventTypeFilter returns the current event type filter, nil when all the event types are counted
+func (m *Monitor) getEventTypeFilter() *eventTypeFilter {
+	f, _ := m.eventTypeFilter.Load().(*eventTypeFilter)
+	return f
+}
@@ -14,8 +14,10 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/DataDog/datadog-go/statsd"
+	lib "github.com/DataDog/ebpf"
+	"github.com/DataDog/ebpf/manager"
 	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/pkg/errors"
 
 	"github.com/DataDog/datadog-agent/pkg/util/log"
 )
@@ -25,13 +27,38 @@ type eventCounterLRUKey struct {
 	Event EventType
 }
 
+// LoadControllerStats holds the current state of the load controller
+type LoadControllerStats struct {
+	ActiveDiscarders     int    `json:"active_discarders"`
+	DiscardersPushed     int64  `json:"discarders_pushed"`
+	EventsCount          int64  `json:"events_count"`
+	EventsCountThreshold int64  `json:"events_count_threshold"`
+	DiscarderTimeout     string `json:"discarder_timeout"`
+	ControllerPeriod     string `json:"controller_period"`
+	// DiscardersPerEventType holds the number of discarders pushed since the start, by event type
+	DiscardersPerEventType map[string]int64 `json:"discarders_per_event_type"`
+	// DiscardedEvents holds the number of events that the discarded processes sent during the control period
+	// that triggered their discarders, by event type. The events dropped in kernel space while the discarders
+	// are active can't be counted, this is the load the discarders were pushed against.
+	DiscardedEvents map[string]int64 `json:"discarded_events"`
+}
+
 // LoadController is used to monitor and control the pressure put on the host
 type LoadController struct {
 	sync.RWMutex
-	probe        *Probe
-	total        int64
-	counters     *simplelru.LRU
-	statsdClient *statsd.Client
+	probe            *Probe
+	manager          *manager.Manager
+	total            int64
+	discardersPushed int64
+	counters         *simplelru.LRU
+	statsdClient     StatsdClient
+	// discarders holds the expiration date of the temporary discarders pushed by the load controller
+	discarders map[eventCounterLRUKey]time.Time
+	// discardersPerType and discardedEvents count the discarders pushed and the events of the discarded processes
+	// since the start, by event type. unsentDiscardedEvents holds the events not collected yet.
+	discardersPerType     [maxEventType]int64
+	discardedEvents       [maxEventType]int64
+	unsentDiscardedEvents [maxEventType]int64
 
 	EventsCountThreshold int64
 	DiscarderTimeout     time.Duration
@@ -39,7 +66,7 @@ type LoadController struct {
 }
 
 // NewLoadController instantiates a new load controller
-func NewLoadController(probe *Probe, statsdClient *statsd.Client) (*LoadController, error) {
+func NewLoadController(probe *Probe, statsdClient StatsdClient) (*LoadController, error) {
 	lru, err := simplelru.NewLRU(probe.config.PIDCacheSize, nil)
 	if err != nil {
 		return nil, err
@@ -47,8 +74,10 @@ func NewLoadController(probe *Probe, statsdClient *statsd.Client) (*LoadControll
 
 	lc := &LoadController{
 		probe:                probe,
+		manager:              probe.manager,
 		counters:             lru,
 		statsdClient:         statsdClient,
+		discarders:           make(map[eventCounterLRUKey]time.Time),
 		EventsCountThreshold: probe.config.LoadControllerEventsCountThreshold,
 		DiscarderTimeout:     probe.config.LoadControllerDiscarderTimeout,
 		ControllerPeriod:     probe.config.LoadControllerControlPeriod,
@@ -101,19 +130,32 @@ func (lc *LoadController) discardNoisiestProcess() {
 	}
 
 	// push a temporary discarder on the noisiest process & event type tuple
+	pidDiscarders, err := lc.getPIDDiscarders()
+	if err != nil {
+		log.Warnf("couldn't insert temporary discarder: %v", err)
+		return
+	}
 	log.Tracef("discarding %s events from pid %d for %s seconds", maxKey.Event, maxKey.Pid, lc.DiscarderTimeout)
-	if err := lc.probe.discardPIDWithTimeout(maxKey.Event, maxKey.Pid, lc.DiscarderTimeout); err != nil {
+	if err := lc.probe.discardPIDWithTimeout(pidDiscarders, maxKey.Event, maxKey.Pid, lc.DiscarderTimeout); err != nil {
 		log.Warnf("couldn't insert temporary discarder: %v", err)
 		return
 	}
 
+	// keep track of the active discarders
+	now := time.Now()
+	lc.pruneExpiredDiscarders(now)
+	lc.discarders[maxKey] = now.Add(lc.DiscarderTimeout)
+	atomic.AddInt64(&lc.discardersPushed, 1)
+
 	// update current total and remove biggest entry from cache
-	atomic.AddInt64(&lc.total, -int64(atomic.SwapUint64(maxCount, 0)))
+	discarded := int64(atomic.SwapUint64(maxCount, 0))
+	atomic.AddInt64(&lc.total, -discarded)
+	lc.recordDiscard(maxKey.Event, discarded)
 
 	if lc.statsdClient != nil {
 		// send load_controller.pids_discarder metric
 		tags := []string{
-			fmt.Sprintf("event_type:%s", maxKey.Event),
+			fmt.Sprintf("%s:%s", EventTypeTagKey, maxKey.Event),
 		}
 		if err := lc.statsdClient.Count(MetricPrefix+".load_controller.pids_discarder", 1, tags, 1.0); err != nil {
 			log.Warnf("couldn't send load_controller.pids_discarder metric: %v", err)
@@ -122,6 +164,105 @@ func (lc *LoadController) discardNoisiestProcess() {
 	}
 }
 
+// recordDiscard keeps track of a discarder pushed for the provided event type against a process that sent `count`
+// events. The caller must hold the write lock of the load controller.
+func (lc *LoadController) recordDiscard(eventType EventType, count int64) {
+	if eventType >= maxEventType {
+		return
+	}
+	lc.discardersPerType[eventType]++
+	lc.discardedEvents[eventType] += count
+	lc.unsentDiscardedEvents[eventType] += count
+}
+
+// Collect returns the number of events of the discarded processes by event type since the previous call
+func (lc *LoadController) Collect() []Metric {
+	lc.Lock()
+	defer lc.Unlock()
+
+	var metrics []Metric
+	for i := EventType(1); i < maxEventType; i++ {
+		if lc.unsentDiscardedEvents[i] == 0 {
+			continue
+		}
+		tags := []string{fmt.Sprintf("%s:%s", EventTypeTagKey, i)}
+		metrics = append(metrics, newCountMetric(MetricPrefix+".load_controller.discarded_events", lc.unsentDiscardedEvents[i], tags))
+		lc.unsentDiscardedEvents[i] = 0
+	}
+	return metrics
+}
+
+// ResetStats zeroes the number of discarders pushed and the discarded events counters. The active discarders are
+// left untouched.
+func (lc *LoadController) ResetStats() {
+	lc.Lock()
+	defer lc.Unlock()
+
+	atomic.StoreInt64(&lc.discardersPushed, 0)
+	lc.discardersPerType = [maxEventType]int64{}
+	lc.discardedEvents = [maxEventType]int64{}
+	lc.unsentDiscardedEvents = [maxEventType]int64{}
+}
+
+// getPIDDiscarders returns the pid discarders map of the manager the load controller is bound to. The caller must
+// hold the lock of the load controller.
+func (lc *LoadController) getPIDDiscarders() (*lib.Map, error) {
+	if lc.manager == nil {
+		return nil, errors.New("manager is null")
+	}
+	m, ok, err := lc.manager.GetMap("pid_discarders")
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("failed to get map 'pid_discarders'")
+	}
+	return m, nil
+}
+
+// OnManagerReload binds the load controller to the maps of the provided manager. The event counters are kept as is.
+func (lc *LoadController) OnManagerReload(m *manager.Manager) {
+	lc.Lock()
+	defer lc.Unlock()
+
+	lc.manager = m
+}
+
+// pruneExpiredDiscarders removes the expired discarders from the list of active discarders. The caller must hold
+// the write lock of the load controller.
+func (lc *LoadController) pruneExpiredDiscarders(now time.Time) {
+	for key, expiration := range lc.discarders {
+		if !now.Before(expiration) {
+			delete(lc.discarders, key)
+		}
+	}
+}
+
+// GetStats returns the current state of the load controller
+func (lc *LoadController) GetStats() LoadControllerStats {
+	lc.Lock()
+	defer lc.Unlock()
+
+	lc.pruneExpiredDiscarders(time.Now())
+
+	stats := LoadControllerStats{
+		ActiveDiscarders:       len(lc.discarders),
+		DiscardersPushed:       atomic.LoadInt64(&lc.discardersPushed),
+		EventsCount:            atomic.LoadInt64(&lc.total),
+		EventsCountThreshold:   lc.EventsCountThreshold,
+		DiscarderTimeout:       lc.DiscarderTimeout.String(),
+		ControllerPeriod:       lc.ControllerPeriod.String(),
+		DiscardersPerEventType: make(map[string]int64),
+		DiscardedEvents:        make(map[string]int64),
+	}
+	for i := EventType(1); i < maxEventType; i++ {
+		if lc.discardersPerType[i] > 0 {
+			stats.DiscardersPerEventType[i.String()] = lc.discardersPerType[i]
+			stats.DiscardedEvents[i.String()] = lc.discardedEvents[i]
+		}
+	}
+	return stats
+}
+
 // cleanup resets the internal counters
 func (lc *LoadController) cleanup() {
 	lc.RLock()
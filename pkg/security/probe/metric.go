@@ -0,0 +1,98 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+// +build linux
+
+package probe
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MetricType is the type of a metric collected by the Monitor
+type MetricType string
+
+const (
+	// CountMetricType is the type of the metrics holding a number of occurrences since the previous collection
+	CountMetricType MetricType = "count"
+	// GaugeMetricType is the type of the metrics holding a value sampled at collection time
+	GaugeMetricType MetricType = "gauge"
+)
+
+// Metric describes a metric collected by the Monitor along with its value. The metrics are independent of the
+// backend they are exported to, SendStats sends them to statsd.
+type Metric struct {
+	Name  string
+	Type  MetricType
+	Tags  []string
+	Value float64
+}
+
+// newCountMetric returns a count metric
+func newCountMetric(name string, value int64, tags []string) Metric {
+	return Metric{Name: name, Type: CountMetricType, Tags: tags, Value: float64(value)}
+}
+
+// newGaugeMetric returns a gauge metric
+func newGaugeMetric(name string, value float64, tags []string) Metric {
+	return Metric{Name: name, Type: GaugeMetricType, Tags: tags, Value: value}
+}
+
+// Send sends the metric to statsd
+func (m Metric) Send(statsdClient StatsdClient) error {
+	switch m.Type {
+	case CountMetricType:
+		return statsdClient.Count(m.Name, int64(m.Value), m.Tags, 1.0)
+	case GaugeMetricType:
+		return statsdClient.Gauge(m.Name, m.Value, m.Tags, 1.0)
+	default:
+		return fmt.Errorf("unknown metric type %s", m.Type)
+	}
+}
+
+// sendMetrics sends the metrics to statsd, it stops at the first error
+func sendMetrics(statsdClient StatsdClient, metrics []Metric) error {
+	for _, metric := range metrics {
+		if err := metric.Send(statsdClient); err != nil {
+			return errors.Wrapf(err, "failed to send %s metric", strings.TrimPrefix(metric.Name, MetricPrefix+"."))
+		}
+	}
+	return nil
+}
+
+// mergeCounts returns the metrics with the pending counts added to the counts of the same series. The pending counts
+// without a matching series are appended, the pending gauges are dropped as they are outdated.
+func mergeCounts(metrics []Metric, pending []Metric) []Metric {
+	merged := make([]Metric, 0, len(metrics)+len(pending))
+	series := make(map[string]int)
+	for _, metric := range metrics {
+		if metric.Type == CountMetricType {
+			series[metric.seriesKey()] = len(merged)
+		}
+		merged = append(merged, metric)
+	}
+
+	for _, metric := range pending {
+		if metric.Type != CountMetricType {
+			continue
+		}
+		key := metric.seriesKey()
+		if i, found := series[key]; found {
+			merged[i].Value += metric.Value
+			continue
+		}
+		series[key] = len(merged)
+		merged = append(merged, metric)
+	}
+	return merged
+}
+
+// seriesKey identifies the series of the metric by its name and tags
+func (m Metric) seriesKey() string {
+	return m.Name + "|" + strings.Join(m.Tags, ",")
+}
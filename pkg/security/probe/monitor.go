@@ -0,0 +1,715 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+// +build linux
+
+package probe
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DataDog/ebpf/manager"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+const (
+	// EventTypeTagKey is the key of the tag holding the event type of a metric
+	EventTypeTagKey = "event_type"
+	// MapTagKey is the key of the tag holding the name of the eBPF map a metric was collected from
+	MapTagKey = "map"
+	// SyscallTagKey is the key of the tag holding the syscall name of a metric
+	SyscallTagKey = "syscall"
+	// ProcessTagKey is the key of the tag holding the process name of a metric
+	ProcessTagKey = "process"
+	// PIDTagKey is the key of the tag holding the pid of the process of a metric
+	PIDTagKey = "pid"
+	// CommTagKey is the key of the tag holding the command of the process of a metric
+	CommTagKey = "comm"
+	// CPUTagKey is the key of the tag holding the cpu a metric was collected on
+	CPUTagKey = "cpu"
+	// EstimateTagKey is the key of the tag marking the metrics computed from sampled events
+	EstimateTagKey = "estimate"
+	// SizeBucketTagKey is the key of the tag holding the bucket of the event size histogram of a metric
+	SizeBucketTagKey = "size_bucket"
+)
+
+// Sections of the stats returned by Monitor.GetStats
+const (
+	// EventsStatsSection holds the count of lost events
+	EventsStatsSection = "events"
+	// SyscallsStatsSection holds the statistics of the syscall monitor
+	SyscallsStatsSection = "syscalls"
+	// LoadControllerStatsSection holds the statistics of the load controller
+	LoadControllerStatsSection = "load_controller"
+	// PerfBufferStatsSection holds the peak turnover of the perf buffers and the events received and lost on each cpu
+	PerfBufferStatsSection = "perf_buffer"
+	// PerEventTypeStatsSection holds the count, sampling and size histogram of the received events by event type
+	PerEventTypeStatsSection = "per_event_type"
+	// StatsdStatsSection holds the state of the statsd circuit breaker
+	StatsdStatsSection = "statsd"
+	// ConfigStatsSection holds the configured size of the ring buffers of the perf maps
+	ConfigStatsSection = "config"
+)
+
+// allStatsSections are the sections returned by Monitor.GetStats when none is selected
+var allStatsSections = []string{EventsStatsSection, SyscallsStatsSection, LoadControllerStatsSection, PerfBufferStatsSection, PerEventTypeStatsSection, StatsdStatsSection, ConfigStatsSection}
+
+// StatsdClient is the interface implemented by the statsd clients the Monitor and its sub-monitors report their
+// metrics to. *statsd.Client satisfies this interface.
+type StatsdClient interface {
+	Count(name string, value int64, tags []string, rate float64) error
+	Gauge(name string, value float64, tags []string, rate float64) error
+}
+
+// syscallStatsMonitor is the interface implemented by the syscall monitor
+type syscallStatsMonitor interface {
+	GetStats() (*SyscallStats, error)
+	Collect() ([]Metric, error)
+	ResetStats() error
+	Check() error
+}
+
+// Monitor regroups all the work we want to do to monitor the probes we pushed in the kernel
+type Monitor struct {
+	probe  *Probe
+	client StatsdClient
+	// statsdBreaker stops sending metrics to statsd while it repeatedly fails, client goes through it when set
+	statsdBreaker *statsdCircuitBreaker
+	// secondaryStatsdBreakers are the circuit breakers of the additional statsd clients, client sends the metrics
+	// to all of them besides statsdBreaker
+	secondaryStatsdBreakers []*statsdCircuitBreaker
+
+	loadController *LoadController
+	// monitors holds the *subMonitors bound to the maps of the eBPF manager, they are swapped when the manager is
+	// reloaded so that the events handlers don't have to take a lock
+	monitors atomic.Value
+	// unreadableMaps holds the read errors of the eBPF maps of the sub-monitors that failed on their last read,
+	// indexed by map name. A map is removed from it as soon as it's read successfully again.
+	unreadableMapsLock sync.Mutex
+	unreadableMaps     map[string]string
+
+	// statsEnabled defines if the events received from the kernel should be counted by the perf buffer monitor
+	statsEnabled bool
+	// eventTypeFilter holds the *eventTypeFilter selecting the event types counted, see SetEventTypeFilter
+	eventTypeFilter atomic.Value
+	// thresholdWatches are the thresholds evaluated each time the metrics are collected, see WatchThreshold
+	thresholdsLock   sync.Mutex
+	thresholdWatches []*thresholdWatch
+	// sendStatsLock serializes the calls to SendStats, from the stats loop and from OnManagerReload
+	sendStatsLock sync.Mutex
+	// deferredCounts are the counts collected to evaluate the thresholds while the circuit breakers of all the
+	// statsd clients were open, they are added to the next metrics sent. It's protected by sendStatsLock.
+	deferredCounts []Metric
+	// running is set to 1 while the goroutines of the Monitor are running
+	running int32
+	// statsPollingInterval is the period at which the Monitor sends its statistics, 0 disables the stats loop
+	statsPollingInterval time.Duration
+	cancelFnc            context.CancelFunc
+	wg                   sync.WaitGroup
+	// summaryOnce ensures that the summary of the enabled sub-monitors is only logged on the first start
+	summaryOnce sync.Once
+}
+
+// NewMonitor returns a new instance of a ProbeMonitor
+func NewMonitor(p *Probe, client StatsdClient) (*Monitor, error) {
+	var clients []StatsdClient
+	if client != nil {
+		clients = append(clients, client)
+	}
+	return NewMonitorWithClients(p, clients)
+}
+
+// NewMonitorWithClients returns a new instance of a ProbeMonitor pushing its metrics to all the given statsd clients.
+// The first client is the primary one, each client has its own circuit breaker so that a failing client doesn't
+// stop the metrics sent to the others.
+func NewMonitorWithClients(p *Probe, clients []StatsdClient) (*Monitor, error) {
+	var err error
+	m := &Monitor{
+		probe:                p,
+		statsEnabled:         p.config.StatsEnabled,
+		statsPollingInterval: p.config.StatsPollingInterval,
+	}
+	m.setStatsdClients(clients)
+
+	// instantiate a new load controller
+	m.loadController, err = NewLoadController(p, m.client)
+	if err != nil {
+		return nil, err
+	}
+
+	// instantiate a new event statistics monitor
+	perfBufferMonitor, err := m.newPerfBufferMonitor(p.manager, p.managerOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	var syscallMonitor syscallStatsMonitor
+	if p.config.SyscallMonitor {
+		if syscallMonitor, err = m.newSyscallMonitor(p.manager); err != nil {
+			return nil, err
+		}
+	}
+	m.setMonitors(p.manager, perfBufferMonitor, syscallMonitor)
+
+	return m, nil
+}
+
+// newPerfBufferMonitor instantiates a new perf buffer monitor for the provided manager, configured with
+// the sample rates of the events stats
+func (m *Monitor) newPerfBufferMonitor(mgr *manager.Manager, managerOptions manager.Options) (*PerfBufferMonitor, error) {
+	perfBufferMonitor, err := NewPerfBufferMonitor(mgr, managerOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't create the events statistics monitor")
+	}
+
+	if m.probe != nil && m.probe.config != nil {
+		if len(m.probe.config.StatsSizeBuckets) > 0 {
+			perfBufferMonitor.SetSizeBuckets(m.probe.config.StatsSizeBuckets)
+		}
+		if m.probe.config.StatsCounterMode != "" {
+			if err := perfBufferMonitor.SetCounterMode(CounterMode(m.probe.config.StatsCounterMode)); err != nil {
+				return nil, err
+			}
+		}
+		for eventType, rate := range m.probe.config.StatsSampleRates {
+			if t := parseEvalEventType(eventType); t != UnknownEventType {
+				perfBufferMonitor.SetSampleRate(t, rate)
+			} else {
+				log.Warnf("unknown event type %s in the events stats sample rates", eventType)
+			}
+		}
+	}
+	return perfBufferMonitor, nil
+}
+
+// newSyscallMonitor instantiates a new syscall monitor for the provided manager. The syscall monitor isn't
+// supported on all kernels, unless it is explicitly required, carry on without it so that the rest of the
+// monitoring keeps working.
+func (m *Monitor) newSyscallMonitor(mgr *manager.Manager) (syscallStatsMonitor, error) {
+	syscallMonitor, err := NewSyscallMonitor(mgr)
+	if err != nil {
+		if m.probe.config.SyscallMonitorRequired {
+			return nil, errors.Wrap(err, "couldn't create the syscall monitor")
+		}
+		log.Warnf("couldn't create the syscall monitor, syscall statistics won't be collected: %v", err)
+		return nil, nil
+	}
+	if m.probe.config.SyscallMonitorPerProcess {
+		syscallMonitor.SetPerProcessTopN(m.probe.config.SyscallMonitorTopN)
+	}
+	return syscallMonitor, nil
+}
+
+// OnManagerReload rebinds the load controller and the sub-monitors to the maps of the provided manager, it is called
+// by Probe.ReloadManager before the previous manager is stopped. The counts of the sub-monitors bound to the previous
+// manager are sent first, the counters of the new perf buffer monitor start from zero.
+func (m *Monitor) OnManagerReload(mgr *manager.Manager, managerOptions manager.Options) error {
+	perfBufferMonitor, err := m.newPerfBufferMonitor(mgr, managerOptions)
+	if err != nil {
+		return err
+	}
+
+	var syscallMonitor syscallStatsMonitor
+	if m.probe != nil && m.probe.config != nil && m.probe.config.SyscallMonitor {
+		if syscallMonitor, err = m.newSyscallMonitor(mgr); err != nil {
+			return err
+		}
+	}
+
+	// the counts of the previous manager would be lost with its sub-monitors, they are sent while its maps
+	// can still be read
+	if err := m.SendStats(); err != nil {
+		log.Debugf("failed to send the stats of the previous eBPF manager: %v", err)
+	}
+
+	m.loadController.OnManagerReload(mgr)
+
+	m.setMonitors(mgr, perfBufferMonitor, syscallMonitor)
+
+	return nil
+}
+
+// subMonitors are the sub-monitors bound to the maps of a given eBPF manager
+type subMonitors struct {
+	manager           *manager.Manager
+	perfBufferMonitor *PerfBufferMonitor
+	syscallMonitor    syscallStatsMonitor
+}
+
+// setMonitors replaces the sub-monitors bound to the eBPF manager
+func (m *Monitor) setMonitors(mgr *manager.Manager, perfBufferMonitor *PerfBufferMonitor, syscallMonitor syscallStatsMonitor) {
+	m.monitors.Store(&subMonitors{
+		manager:           mgr,
+		perfBufferMonitor: perfBufferMonitor,
+		syscallMonitor:    syscallMonitor,
+	})
+}
+
+// getMonitors returns the sub-monitors currently bound to the eBPF manager
+func (m *Monitor) getMonitors() (*PerfBufferMonitor, syscallStatsMonitor) {
+	monitors, _ := m.monitors.Load().(*subMonitors)
+	if monitors == nil {
+		return nil, nil
+	}
+	return monitors.perfBufferMonitor, monitors.syscallMonitor
+}
+
+// getManager returns the eBPF manager the sub-monitors are currently bound to
+func (m *Monitor) getManager() *manager.Manager {
+	monitors, _ := m.monitors.Load().(*subMonitors)
+	if monitors == nil {
+		return nil
+	}
+	return monitors.manager
+}
+
+// GetPerfBufferMonitor returns the perf buffer monitor
+func (m *Monitor) GetPerfBufferMonitor() *PerfBufferMonitor {
+	perfBufferMonitor, _ := m.getMonitors()
+	return perfBufferMonitor
+}
+
+// Start triggers the goroutines of all the underlying controllers and monitors of the Monitor. When a stats polling
+// interval is configured, the Monitor also sends its statistics and evaluates the watched thresholds periodically
+// until Stop is called.
+func (m *Monitor) Start(ctx context.Context) {
+	ctx, m.cancelFnc = context.WithCancel(ctx)
+	atomic.StoreInt32(&m.running, 1)
+
+	m.summaryOnce.Do(func() {
+		log.Infof("Starting the runtime security monitor: %s", m.summary())
+	})
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.loadController.Start(ctx)
+	}()
+
+	if m.statsPollingInterval > 0 {
+		m.wg.Add(1)
+		go m.statsLoop(ctx)
+	}
+}
+
+// summary describes the enabled sub-monitors of the Monitor along with their main configuration,
+// e.g. to understand why some metrics are missing.
+func (m *Monitor) summary() string {
+	perfBufferMonitor, syscallMonitor := m.getMonitors()
+	var parts []string
+
+	if m.loadController != nil {
+		parts = append(parts, fmt.Sprintf("load_controller=enabled (events_count_threshold=%d, discarder_timeout=%s, controller_period=%s)",
+			m.loadController.EventsCountThreshold, m.loadController.DiscarderTimeout, m.loadController.ControllerPeriod))
+	} else {
+		parts = append(parts, "load_controller=disabled")
+	}
+
+	if perfBufferMonitor != nil {
+		perfMaps := make([]string, 0, len(perfBufferMonitor.counters))
+		for perfMap, counters := range perfBufferMonitor.counters {
+			perfMaps = append(perfMaps, fmt.Sprintf("%s:%d", perfMap, counters.capacity))
+		}
+		sort.Strings(perfMaps)
+		parts = append(parts, fmt.Sprintf("perf_buffer_monitor=enabled (stats=%t, cpus=%d, perf_buffer_sizes=[%s])",
+			m.statsEnabled, perfBufferMonitor.numCPU, strings.Join(perfMaps, " ")))
+	} else {
+		parts = append(parts, "perf_buffer_monitor=disabled")
+	}
+
+	switch {
+	case syscallMonitor != nil:
+		parts = append(parts, "syscall_monitor=enabled")
+	case m.probe != nil && m.probe.config != nil && m.probe.config.SyscallMonitor:
+		parts = append(parts, "syscall_monitor=unavailable")
+	default:
+		parts = append(parts, "syscall_monitor=disabled")
+	}
+
+	switch {
+	case m.client == nil:
+		parts = append(parts, "stats_polling_interval=disabled")
+	case m.statsPollingInterval > 0:
+		parts = append(parts, fmt.Sprintf("stats_polling_interval=%s", m.statsPollingInterval))
+	default:
+		// the stats are sent along with the stats of the module
+		parts = append(parts, "stats_polling_interval=module")
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Stop stops all the goroutines spawned by Start and waits for them to exit
+func (m *Monitor) Stop() {
+	if m.cancelFnc != nil {
+		m.cancelFnc()
+	}
+	m.wg.Wait()
+	atomic.StoreInt32(&m.running, 0)
+}
+
+// Healthy returns whether the monitoring of the probe is functional, along with the list of the detected problems.
+// The eBPF programs are attached and the perf buffer readers started only once the manager of the probe is started,
+// each monitored perf map must then have a reader. No metric is sent.
+func (m *Monitor) Healthy() (bool, []string) {
+	var problems []string
+	perfBufferMonitor, syscallMonitor := m.getMonitors()
+
+	if atomic.LoadInt32(&m.running) == 0 {
+		problems = append(problems, "monitor not running")
+	}
+
+	mgr := m.getManager()
+	if mgr == nil {
+		problems = append(problems, "eBPF manager not initialized")
+	} else if m.probe == nil || atomic.LoadInt32(&m.probe.managerStarted) == 0 {
+		problems = append(problems, "eBPF programs not attached and perf buffer readers not started")
+	} else {
+		for perfMap := range perfBufferMonitor.counters {
+			if _, ok := mgr.GetPerfMap(perfMap); !ok {
+				problems = append(problems, fmt.Sprintf("perf buffer reader not running for map %s", perfMap))
+			}
+		}
+	}
+
+	if syscallMonitor != nil {
+		if err := syscallMonitor.Check(); err != nil {
+			problems = append(problems, fmt.Sprintf("syscall map unreadable: %v", err))
+		}
+	} else if m.probe != nil && m.probe.config != nil && m.probe.config.SyscallMonitor {
+		problems = append(problems, "syscall monitor not running")
+	}
+
+	return len(problems) == 0, problems
+}
+
+// statsLoop sends the statistics of the monitor periodically
+func (m *Monitor) statsLoop(ctx context.Context) {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.statsPollingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.SendStats(); err != nil {
+				log.Debug(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Collect returns the metrics of all the sub-monitors, and resets their counters. The metrics are described
+// independently of the backend they are exported to. All the sub-monitors are given a chance to return their
+// metrics, so that a failure in one of them doesn't prevent the others from reporting. The returned error
+// aggregates the errors of all the sub-monitors.
+func (m *Monitor) Collect() ([]Metric, error) {
+	var result *multierror.Error
+	var metrics []Metric
+	perfBufferMonitor, syscallMonitor := m.getMonitors()
+
+	if syscallMonitor != nil {
+		syscallMetrics, err := syscallMonitor.Collect()
+		m.updateUnreadableMaps(err)
+		if err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "failed to collect syscall monitor stats"))
+		}
+		metrics = append(metrics, syscallMetrics...)
+	}
+
+	metrics = append(metrics, perfBufferMonitor.Collect()...)
+
+	if m.loadController != nil {
+		metrics = append(metrics, m.loadController.Collect()...)
+	}
+
+	return metrics, result.ErrorOrNil()
+}
+
+// updateUnreadableMaps records the maps that couldn't be read by the last read of the syscall monitor, the maps
+// read successfully since their failure are dropped
+func (m *Monitor) updateUnreadableMaps(err error) {
+	m.unreadableMapsLock.Lock()
+	defer m.unreadableMapsLock.Unlock()
+
+	m.unreadableMaps = nil
+	if mapErr, ok := err.(*MapReadError); ok {
+		m.unreadableMaps = make(map[string]string, len(mapErr.Errors))
+		for name, err := range mapErr.Errors {
+			m.unreadableMaps[name] = err.Error()
+		}
+	}
+}
+
+// getUnreadableMaps returns a copy of the read errors of the maps that failed on their last read
+func (m *Monitor) getUnreadableMaps() map[string]string {
+	m.unreadableMapsLock.Lock()
+	defer m.unreadableMapsLock.Unlock()
+
+	if len(m.unreadableMaps) == 0 {
+		return nil
+	}
+	unreadableMaps := make(map[string]string, len(m.unreadableMaps))
+	for name, err := range m.unreadableMaps {
+		unreadableMaps[name] = err
+	}
+	return unreadableMaps
+}
+
+// setStatsdClients wraps each of the statsd clients in its own circuit breaker, the first one is the primary
+// client. The sub-monitors send their metrics to all the clients through m.client.
+func (m *Monitor) setStatsdClients(clients []StatsdClient) {
+	var breakers []*statsdCircuitBreaker
+	for _, client := range clients {
+		if client != nil {
+			breakers = append(breakers, newStatsdCircuitBreaker(client, defaultStatsdFailureThreshold, defaultStatsdCooldown))
+		}
+	}
+	switch len(breakers) {
+	case 0:
+		return
+	case 1:
+		m.client = breakers[0]
+	default:
+		multi := make(multiStatsdClient, 0, len(breakers))
+		for _, breaker := range breakers {
+			multi = append(multi, breaker)
+		}
+		m.client = multi
+	}
+	m.statsdBreaker = breakers[0]
+	m.secondaryStatsdBreakers = breakers[1:]
+}
+
+// statsdOpen returns true if the circuit breakers of all the statsd clients are open
+func (m *Monitor) statsdOpen() bool {
+	if m.statsdBreaker == nil || !m.statsdBreaker.IsOpen() {
+		return false
+	}
+	for _, breaker := range m.secondaryStatsdBreakers {
+		if !breaker.IsOpen() {
+			return false
+		}
+	}
+	return true
+}
+
+// SendStats sends the metrics returned by Collect to Datadog. The metrics are sent even if some of the sub-monitors
+// failed to collect theirs. When several statsd clients are set, the metrics are sent to each of them even if the
+// others fail, the metrics sent to a client are skipped, and counted as such, while its circuit breaker is open. The
+// watched thresholds are evaluated with the collected metrics, even when they are not sent: while the breakers of
+// all the clients are open, the collected counts are kept and sent along with the next metrics.
+func (m *Monitor) SendStats() error {
+	m.sendStatsLock.Lock()
+	defer m.sendStatsLock.Unlock()
+
+	watched := m.hasThresholdWatches()
+	if (m.client == nil || m.statsdOpen()) && !watched {
+		// no statsd client is set or statsd is failing, the sends are skipped until the cooldown of the circuit
+		// breaker expires, the counters keep accumulating meanwhile
+		return nil
+	}
+
+	var result *multierror.Error
+	metrics, err := m.Collect()
+	if err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	if watched {
+		m.evaluateThresholds(metrics)
+	}
+	if m.client == nil {
+		return result.ErrorOrNil()
+	}
+	if m.statsdOpen() {
+		// the metrics were only collected for the thresholds, the counts of the interval mustn't be lost
+		m.deferredCounts = mergeCounts(nil, append(m.deferredCounts, metrics...))
+		return result.ErrorOrNil()
+	}
+	if len(m.deferredCounts) > 0 {
+		metrics = mergeCounts(metrics, m.deferredCounts)
+		m.deferredCounts = nil
+	}
+
+	if m.statsdBreaker == nil {
+		if err := sendMetrics(m.client, metrics); err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "failed to send stats"))
+		}
+		return result.ErrorOrNil()
+	}
+
+	// the metrics are sent to each client separately so that a failing client doesn't stop the sends to the others,
+	// the breakers count the metrics they skip
+	breakers := append([]*statsdCircuitBreaker{m.statsdBreaker}, m.secondaryStatsdBreakers...)
+	for i, breaker := range breakers {
+		err := breaker.send(metrics)
+		switch {
+		case err == nil || err == errStatsdCircuitOpen:
+		case len(breakers) == 1:
+			result = multierror.Append(result, errors.Wrap(err, "failed to send stats"))
+		default:
+			result = multierror.Append(result, errors.Wrapf(err, "failed to send stats to statsd client %d", i))
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+// ResetStats zeroes the cumulative counters of the perf buffer monitor, the syscall monitor and the load controller,
+// for example to measure a time window. It is safe to call ResetStats while events are being processed. All the
+// sub-monitors are reset even if one of them fails, the returned error aggregates their errors.
+func (m *Monitor) ResetStats() error {
+	var result *multierror.Error
+	perfBufferMonitor, syscallMonitor := m.getMonitors()
+
+	if perfBufferMonitor != nil {
+		perfBufferMonitor.ResetStats()
+	}
+
+	if syscallMonitor != nil {
+		if err := syscallMonitor.ResetStats(); err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "failed to reset syscall monitor stats"))
+		}
+	}
+
+	if m.loadController != nil {
+		m.loadController.ResetStats()
+	}
+
+	return result.ErrorOrNil()
+}
+
+// GetStats returns Stats according to the system-probe module format. The sections to return can be selected,
+// e.g. GetStats(EventsStatsSection, SyscallsStatsSection), all the sections are returned when none is selected.
+func (m *Monitor) GetStats(sections ...string) (map[string]interface{}, error) {
+	if len(sections) == 0 {
+		sections = allStatsSections
+	}
+	selected := make(map[string]bool, len(sections))
+	for _, section := range sections {
+		switch section {
+		case EventsStatsSection, SyscallsStatsSection, LoadControllerStatsSection, PerfBufferStatsSection, PerEventTypeStatsSection, StatsdStatsSection, ConfigStatsSection:
+			selected[section] = true
+		default:
+			return nil, fmt.Errorf("unknown stats section %s", section)
+		}
+	}
+
+	stats := make(map[string]interface{})
+	perfBufferMonitor, syscallMonitor := m.getMonitors()
+	if perfBufferMonitor.GetCounterMode() == DeltaCounters && (selected[EventsStatsSection] || selected[PerfBufferStatsSection] || selected[PerEventTypeStatsSection]) {
+		// the statistics are the counts since the previous read, the counters sent to statsd are left untouched
+		perfBufferMonitor = perfBufferMonitor.readDeltas()
+	}
+
+	var err error
+	if selected[EventsStatsSection] || selected[SyscallsStatsSection] {
+		events := make(map[string]interface{})
+		stats["events"] = events
+		if selected[EventsStatsSection] {
+			events["lost"] = perfBufferMonitor.GetLostCount("", -1)
+		}
+		if selected[SyscallsStatsSection] {
+			var syscalls *SyscallStats
+			if syscallMonitor != nil {
+				syscalls, err = syscallMonitor.GetStats()
+				m.updateUnreadableMaps(err)
+			}
+			events["syscalls"] = syscalls
+			if unreadableMaps := m.getUnreadableMaps(); unreadableMaps != nil {
+				events["unreadable_maps"] = unreadableMaps
+			}
+		}
+	}
+
+	if selected[LoadControllerStatsSection] {
+		stats["load_controller"] = m.loadController.GetStats()
+	}
+
+	if selected[PerfBufferStatsSection] {
+		peakTurnover := make(map[string][]float64)
+		stats["perf_buffer_peak_turnover"] = peakTurnover
+		for perfMap := range perfBufferMonitor.counters {
+			peakTurnover[perfMap] = perfBufferMonitor.GetPeakTurnover(perfMap)
+		}
+		stats["per_cpu"] = perfBufferMonitor.GetCPUStats()
+	}
+
+	if selected[PerEventTypeStatsSection] {
+		m.getPerEventTypeStats(perfBufferMonitor, stats)
+	}
+
+	if selected[StatsdStatsSection] && m.statsdBreaker != nil {
+		stats["statsd_circuit_breaker"] = m.statsdBreaker.GetStats()
+		if len(m.secondaryStatsdBreakers) > 0 {
+			secondaryStats := make([]StatsdCircuitBreakerStats, 0, len(m.secondaryStatsdBreakers))
+			for _, breaker := range m.secondaryStatsdBreakers {
+				secondaryStats = append(secondaryStats, breaker.GetStats())
+			}
+			stats["secondary_statsd_circuit_breakers"] = secondaryStats
+		}
+	}
+
+	if selected[ConfigStatsSection] {
+		stats["config"] = map[string]interface{}{
+			"perf_buffers": perfBufferMonitor.GetPerfMapConfigs(),
+			"counter_mode": perfBufferMonitor.GetCounterMode(),
+		}
+	}
+
+	return stats, err
+}
+
+// getPerEventTypeStats adds the statistics of the received events by event type to stats
+func (m *Monitor) getPerEventTypeStats(perfBufferMonitor *PerfBufferMonitor, stats map[string]interface{}) {
+	// the counts of the sampled event types are estimates, they are listed along with their sample rate
+	perEventType := make(map[string]int64)
+	estimatedEventTypes := make(map[string]uint64)
+	sizeHistograms := make(map[string]map[string]uint64)
+	stats["per_event_type"] = perEventType
+	stats["estimated_event_types"] = estimatedEventTypes
+	stats["event_size_histogram"] = sizeHistograms
+	for i := EventType(1); i < maxEventType; i++ {
+		perEventType[i.String()] = int64(perfBufferMonitor.GetEventStats(i, "", -1).Count)
+		if histogram := perfBufferMonitor.GetSizeHistogram(i); len(histogram) > 0 {
+			sizeHistograms[i.String()] = histogram
+		}
+		if perfBufferMonitor.IsSampled(i) {
+			estimatedEventTypes[i.String()] = perfBufferMonitor.sampleRates[i]
+		}
+	}
+}
+
+// ProcessEvent processes an event through the various monitors and controllers of the probe. When stats are
+// disabled, the event isn't counted by the perf buffer monitor but the load controller still processes it. The
+// events filtered out by the event type filter are counted by none of them, unless their load control is forced.
+func (m *Monitor) ProcessEvent(event *Event, size uint64, CPU int, perfMap *manager.PerfMap) {
+	eventType := EventType(event.Type)
+	filter := m.getEventTypeFilter()
+	if m.statsEnabled && filter.isCounted(eventType) {
+		m.GetPerfBufferMonitor().CountEvent(eventType, 1, size, perfMap, CPU)
+	}
+	if filter.isLoadControlled(eventType) {
+		m.loadController.Count(eventType, event.Process.Pid)
+	}
+}
+
+// ProcessLostEvent processes a lost event through the various monitors and controllers of the probe
+func (m *Monitor) ProcessLostEvent(count uint64, CPU int, perfMap *manager.PerfMap) {
+	m.GetPerfBufferMonitor().CountLostEvent(count, perfMap, CPU)
+}
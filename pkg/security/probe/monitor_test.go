@@ -0,0 +1,1391 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+// +build linux
+
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DataDog/ebpf/manager"
+	"github.com/hashicorp/golang-lru/simplelru"
+
+	"github.com/DataDog/datadog-agent/pkg/security/config"
+)
+
+var testPerfMap = &manager.PerfMap{Map: manager.Map{Name: "events"}}
+
+type recordedMetric struct {
+	Kind  string
+	Name  string
+	Value float64
+	Tags  []string
+}
+
+func (r recordedMetric) String() string {
+	return fmt.Sprintf("%s %s:%v %v", r.Kind, r.Name, r.Value, r.Tags)
+}
+
+// recordingStatsdClient is a StatsdClient recording all the metrics it receives
+type recordingStatsdClient struct {
+	sync.Mutex
+	metrics []recordedMetric
+	err     error
+}
+
+func (c *recordingStatsdClient) record(kind, name string, value float64, tags []string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+
+	sortedTags := append([]string{}, tags...)
+	sort.Strings(sortedTags)
+	c.metrics = append(c.metrics, recordedMetric{Kind: kind, Name: name, Value: value, Tags: sortedTags})
+	return nil
+}
+
+func (c *recordingStatsdClient) Count(name string, value int64, tags []string, rate float64) error {
+	return c.record("count", name, float64(value), tags)
+}
+
+func (c *recordingStatsdClient) Gauge(name string, value float64, tags []string, rate float64) error {
+	return c.record("gauge", name, value, tags)
+}
+
+// find returns the recorded metrics matching the given kind and name
+func (c *recordingStatsdClient) find(kind, name string) []recordedMetric {
+	c.Lock()
+	defer c.Unlock()
+
+	var metrics []recordedMetric
+	for _, metric := range c.metrics {
+		if metric.Kind == kind && metric.Name == name {
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics
+}
+
+type failingSyscallMonitor struct{}
+
+func (f *failingSyscallMonitor) GetStats() (*SyscallStats, error) {
+	return nil, errors.New("syscall maps unreadable")
+}
+
+func (f *failingSyscallMonitor) Collect() ([]Metric, error) {
+	return nil, errors.New("syscall maps unreadable")
+}
+
+func (f *failingSyscallMonitor) ResetStats() error {
+	return errors.New("syscall maps unreadable")
+}
+
+func (f *failingSyscallMonitor) Check() error {
+	return errors.New("syscall maps unreadable")
+}
+
+// partialSyscallMonitor fails to read the maps listed in unreadable, the exec counts are read from the other maps
+type partialSyscallMonitor struct {
+	unreadable map[string]error
+}
+
+func (p *partialSyscallMonitor) err() error {
+	if len(p.unreadable) == 0 {
+		return nil
+	}
+	return &MapReadError{Errors: p.unreadable}
+}
+
+func (p *partialSyscallMonitor) GetStats() (*SyscallStats, error) {
+	return &SyscallStats{}, p.err()
+}
+
+func (p *partialSyscallMonitor) Collect() ([]Metric, error) {
+	return execMetrics("ls", 1, 0), p.err()
+}
+
+func (p *partialSyscallMonitor) ResetStats() error {
+	return p.err()
+}
+
+func (p *partialSyscallMonitor) Check() error {
+	return nil
+}
+
+func newTestPerfBufferMonitor(t testing.TB) *PerfBufferMonitor {
+	opts := manager.Options{DefaultPerfRingBufferSize: 4096}
+	pbm, err := NewPerfBufferMonitor(&manager.Manager{PerfMaps: []*manager.PerfMap{testPerfMap}}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pbm
+}
+
+func TestMonitorSendStats(t *testing.T) {
+	client := &recordingStatsdClient{}
+	m := &Monitor{
+		client: client,
+	}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), nil)
+
+	m.GetPerfBufferMonitor().CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+	m.GetPerfBufferMonitor().CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+	m.GetPerfBufferMonitor().CountEvent(ExecEventType, 1, 128, testPerfMap, 0)
+	m.GetPerfBufferMonitor().CountLostEvent(3, testPerfMap, 0)
+
+	if err := m.SendStats(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []recordedMetric{
+		{Kind: "count", Name: MetricPrefix + ".events.received", Value: 2, Tags: []string{EventTypeTagKey + ":open", MapTagKey + ":events"}},
+		{Kind: "count", Name: MetricPrefix + ".events.received", Value: 1, Tags: []string{EventTypeTagKey + ":exec", MapTagKey + ":events"}},
+	}
+	if received := client.find("count", MetricPrefix+".events.received"); !reflect.DeepEqual(received, expected) {
+		t.Errorf("unexpected events.received metrics: %v", received)
+	}
+
+	lost := client.find("count", MetricPrefix+".events.lost")
+	if len(lost) != 1 || lost[0].Value != 3 || !reflect.DeepEqual(lost[0].Tags, []string{MapTagKey + ":events"}) {
+		t.Errorf("unexpected events.lost metrics: %v", lost)
+	}
+}
+
+func TestMonitorSendStatsToMultipleClients(t *testing.T) {
+	primary, secondary := &recordingStatsdClient{}, &recordingStatsdClient{}
+	m := &Monitor{}
+	m.setStatsdClients([]StatsdClient{primary, nil, secondary})
+	if len(m.secondaryStatsdBreakers) != 1 {
+		t.Fatalf("expected 1 secondary client, got %d", len(m.secondaryStatsdBreakers))
+	}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), nil)
+
+	m.GetPerfBufferMonitor().CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+	m.GetPerfBufferMonitor().CountEvent(ExecEventType, 1, 128, testPerfMap, 0)
+	m.GetPerfBufferMonitor().CountLostEvent(3, testPerfMap, 0)
+
+	if err := m.SendStats(); err != nil {
+		t.Fatal(err)
+	}
+	if len(primary.metrics) == 0 {
+		t.Fatal("expected metrics to be sent")
+	}
+	if !reflect.DeepEqual(primary.metrics, secondary.metrics) {
+		t.Errorf("expected the clients to receive the same metrics, got %v and %v", primary.metrics, secondary.metrics)
+	}
+
+	// a failing client doesn't stop the sends to the other one
+	primary.metrics, secondary.metrics = nil, nil
+	secondary.err = errors.New("statsd unreachable")
+	m.GetPerfBufferMonitor().CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+
+	err := m.SendStats()
+	if err == nil || !strings.Contains(err.Error(), "statsd client 1") {
+		t.Errorf("expected the error of the secondary client, got %v", err)
+	}
+	if received := primary.find("count", MetricPrefix+".events.received"); len(received) != 1 || received[0].Value != 1 {
+		t.Errorf("unexpected events.received metrics: %v", received)
+	}
+	if len(primary.find("gauge", MetricPrefix+".perf_buffer.turnover")) == 0 {
+		t.Error("expected all the metrics to be sent to the primary client")
+	}
+
+	sectionStats, err := m.GetStats(StatsdStatsSection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secondaryStats, ok := sectionStats["secondary_statsd_circuit_breakers"].([]StatsdCircuitBreakerStats); !ok || len(secondaryStats) != 1 || secondaryStats[0].ConsecutiveFailures != 1 {
+		t.Errorf("unexpected secondary circuit breaker stats: %v", sectionStats)
+	}
+
+	// all the metrics not sent to a client while its breaker is open are counted as skipped
+	primary.metrics = nil
+	secondary.err = nil
+	breaker := m.secondaryStatsdBreakers[0]
+	breaker.state, breaker.openUntil = circuitOpen, time.Now().Add(time.Minute)
+	m.GetPerfBufferMonitor().CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+
+	if err := m.SendStats(); err != nil {
+		t.Fatal(err)
+	}
+	if len(primary.metrics) == 0 {
+		t.Fatal("expected metrics to be sent to the primary client")
+	}
+	if stats := breaker.GetStats(); stats.SkippedMetrics != int64(len(primary.metrics)) {
+		t.Errorf("expected %d skipped metrics, got %+v", len(primary.metrics), stats)
+	}
+}
+
+func TestPerfBufferMonitorTurnover(t *testing.T) {
+	client := &recordingStatsdClient{}
+	pbm := newTestPerfBufferMonitor(t)
+	now := time.Now()
+
+	// no turnover is sent on the first collection
+	pbm.CountEvent(FileOpenEventType, 1, 1024, testPerfMap, 0)
+	if err := sendMetrics(client, pbm.collect(now)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the turnover doesn't depend on the collection interval: 4096 bytes in 2 seconds and 2048 bytes in 1 second
+	// both fill half of the 4096 bytes ring buffer per second
+	pbm.CountEvent(FileOpenEventType, 4, 4096, testPerfMap, 0)
+	if err := sendMetrics(client, pbm.collect(now.Add(2*time.Second))); err != nil {
+		t.Fatal(err)
+	}
+	pbm.CountEvent(FileOpenEventType, 2, 2048, testPerfMap, 0)
+	if err := sendMetrics(client, pbm.collect(now.Add(3*time.Second))); err != nil {
+		t.Fatal(err)
+	}
+	pbm.CountEvent(FileOpenEventType, 1, 1024, testPerfMap, 0)
+	if err := sendMetrics(client, pbm.collect(now.Add(4*time.Second))); err != nil {
+		t.Fatal(err)
+	}
+
+	var turnovers []float64
+	for _, metric := range client.find("gauge", MetricPrefix+".perf_buffer.turnover") {
+		if reflect.DeepEqual(metric.Tags, []string{CPUTagKey + ":0", MapTagKey + ":events"}) {
+			turnovers = append(turnovers, metric.Value)
+		}
+	}
+	if !reflect.DeepEqual(turnovers, []float64{0.5, 0.5, 0.25}) {
+		t.Errorf("unexpected perf_buffer.turnover metrics for cpu 0: %v", turnovers)
+	}
+
+	if peak := pbm.GetPeakTurnover("events"); len(peak) == 0 || peak[0] != 0.5 {
+		t.Errorf("unexpected peak turnover: %v", peak)
+	}
+}
+
+func TestPerfBufferMonitorRates(t *testing.T) {
+	client := &recordingStatsdClient{}
+	pbm := newTestPerfBufferMonitor(t)
+	now := time.Now()
+
+	pbm.CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+	if err := sendMetrics(client, pbm.collect(now)); err != nil {
+		t.Fatal(err)
+	}
+	if rates := client.find("gauge", MetricPrefix+".events.received_rate"); len(rates) != 0 {
+		t.Errorf("no rate should be sent on the first call: %v", rates)
+	}
+
+	for i := 0; i != 10; i++ {
+		pbm.CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+	}
+	pbm.CountLostEvent(5, testPerfMap, 1)
+	if err := sendMetrics(client, pbm.collect(now.Add(2*time.Second))); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []recordedMetric{
+		{Kind: "gauge", Name: MetricPrefix + ".events.received_rate", Value: 5, Tags: []string{EventTypeTagKey + ":open", MapTagKey + ":events"}},
+	}
+	if rates := client.find("gauge", MetricPrefix+".events.received_rate"); !reflect.DeepEqual(rates, expected) {
+		t.Errorf("unexpected events.received_rate metrics: %v", rates)
+	}
+
+	expected = []recordedMetric{
+		{Kind: "gauge", Name: MetricPrefix + ".events.lost_rate", Value: 2.5, Tags: []string{MapTagKey + ":events"}},
+	}
+	if rates := client.find("gauge", MetricPrefix+".events.lost_rate"); !reflect.DeepEqual(rates, expected) {
+		t.Errorf("unexpected events.lost_rate metrics: %v", rates)
+	}
+}
+
+func TestPerfBufferMonitorSampling(t *testing.T) {
+	client := &recordingStatsdClient{}
+	pbm := newTestPerfBufferMonitor(t)
+	pbm.SetSampleRate(FileOpenEventType, 10)
+
+	for i := 0; i < 100; i++ {
+		pbm.CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+	}
+	pbm.CountEvent(ExecEventType, 1, 128, testPerfMap, 0)
+
+	if stats := pbm.GetEventStats(FileOpenEventType, "", -1); stats.Count != 100 || stats.Bytes != 6400 {
+		t.Errorf("expected scaled stats for the sampled event type, got %+v", stats)
+	}
+	if !pbm.IsSampled(FileOpenEventType) || pbm.IsSampled(ExecEventType) {
+		t.Error("only the open events should be sampled")
+	}
+
+	if err := sendMetrics(client, pbm.Collect()); err != nil {
+		t.Fatal(err)
+	}
+	expected := []recordedMetric{
+		{Kind: "count", Name: MetricPrefix + ".events.received", Value: 100, Tags: []string{EstimateTagKey + ":true", EventTypeTagKey + ":open", MapTagKey + ":events"}},
+		{Kind: "count", Name: MetricPrefix + ".events.received", Value: 1, Tags: []string{EventTypeTagKey + ":exec", MapTagKey + ":events"}},
+	}
+	if received := client.find("count", MetricPrefix+".events.received"); !reflect.DeepEqual(received, expected) {
+		t.Errorf("unexpected events.received metrics: %v", received)
+	}
+}
+
+func TestPerfBufferMonitorSizeHistogram(t *testing.T) {
+	client := &recordingStatsdClient{}
+	pbm := newTestPerfBufferMonitor(t)
+	pbm.SetSizeBuckets([]uint64{1024, 128})
+
+	pbm.CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+	pbm.CountEvent(FileOpenEventType, 1, 128, testPerfMap, 0)
+	pbm.CountEvent(FileOpenEventType, 2, 1024, testPerfMap, 0)
+	pbm.CountEvent(FileOpenEventType, 1, 8192, testPerfMap, 0)
+
+	expected := map[string]uint64{"le_128": 2, "le_1024": 2, "gt_1024": 1}
+	if histogram := pbm.GetSizeHistogram(FileOpenEventType); !reflect.DeepEqual(histogram, expected) {
+		t.Errorf("unexpected size histogram: %v", histogram)
+	}
+	if histogram := pbm.GetSizeHistogram(ExecEventType); len(histogram) != 0 {
+		t.Errorf("unexpected size histogram: %v", histogram)
+	}
+
+	if err := sendMetrics(client, pbm.Collect()); err != nil {
+		t.Fatal(err)
+	}
+	expectedMetrics := []recordedMetric{
+		{Kind: "count", Name: MetricPrefix + ".events.size", Value: 2, Tags: []string{EventTypeTagKey + ":open", SizeBucketTagKey + ":le_128"}},
+		{Kind: "count", Name: MetricPrefix + ".events.size", Value: 2, Tags: []string{EventTypeTagKey + ":open", SizeBucketTagKey + ":le_1024"}},
+		{Kind: "count", Name: MetricPrefix + ".events.size", Value: 1, Tags: []string{EventTypeTagKey + ":open", SizeBucketTagKey + ":gt_1024"}},
+	}
+	if sizes := client.find("count", MetricPrefix+".events.size"); !reflect.DeepEqual(sizes, expectedMetrics) {
+		t.Errorf("unexpected events.size metrics: %v", sizes)
+	}
+
+	// the histogram is reset once sent
+	if histogram := pbm.GetSizeHistogram(FileOpenEventType); len(histogram) != 0 {
+		t.Errorf("unexpected size histogram after SendStats: %v", histogram)
+	}
+}
+
+func TestMonitorSampleRates(t *testing.T) {
+	client := &recordingStatsdClient{}
+	m := &Monitor{
+		probe:          &Probe{config: &config.Config{StatsSampleRates: map[string]uint64{"open": 4, "unknown_type": 2}}},
+		client:         client,
+		loadController: &LoadController{},
+	}
+
+	pbm, err := m.newPerfBufferMonitor(&manager.Manager{PerfMaps: []*manager.PerfMap{testPerfMap}}, manager.Options{DefaultPerfRingBufferSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.setMonitors(nil, pbm, nil)
+
+	stats, err := m.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimated := stats["estimated_event_types"]; !reflect.DeepEqual(estimated, map[string]uint64{"open": 4}) {
+		t.Errorf("unexpected estimated event types: %v", estimated)
+	}
+}
+
+func TestMonitorCollect(t *testing.T) {
+	client := &recordingStatsdClient{}
+	m := &Monitor{
+		client:         client,
+		loadController: &LoadController{},
+	}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), nil)
+	m.GetPerfBufferMonitor().CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+	m.loadController.recordDiscard(ExecEventType, 10)
+
+	metrics, err := m.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Metric{
+		{Name: MetricPrefix + ".events.received", Type: CountMetricType, Tags: []string{EventTypeTagKey + ":open", MapTagKey + ":events"}, Value: 1},
+		{Name: MetricPrefix + ".load_controller.discarded_events", Type: CountMetricType, Tags: []string{EventTypeTagKey + ":exec"}, Value: 10},
+	}
+	for _, metric := range expected {
+		found := false
+		for _, collected := range metrics {
+			if reflect.DeepEqual(metric, collected) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("metric %+v not collected: %+v", metric, metrics)
+		}
+	}
+	if len(client.metrics) != 0 {
+		t.Errorf("no metric should be sent by Collect: %v", client.metrics)
+	}
+
+	// the counters were reset by Collect, SendStats sends the same descriptors
+	if err := m.SendStats(); err != nil {
+		t.Fatal(err)
+	}
+	if received := client.find("count", MetricPrefix+".events.received"); len(received) != 0 {
+		t.Errorf("unexpected events.received metrics: %v", received)
+	}
+	if lost := client.find("count", MetricPrefix+".events.lost"); len(lost) != 1 {
+		t.Errorf("events.lost metric not sent: %v", lost)
+	}
+}
+
+func TestSyscallMetricsCollectorRates(t *testing.T) {
+	collector := &SyscallMetricsCollector{}
+	if err := collector.CountExec("ls", 4); err != nil {
+		t.Fatal(err)
+	}
+
+	collector.elapsed = 2
+	if err := collector.CountExec("ls", 4); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &recordingStatsdClient{}
+	if err := sendMetrics(client, collector.metrics); err != nil {
+		t.Fatal(err)
+	}
+	// no rate is collected without a previous sample
+	if rates := client.find("gauge", execMetric+"_rate"); len(rates) != 1 || rates[0].Value != 2 {
+		t.Errorf("unexpected exec rate metrics: %v", rates)
+	}
+}
+
+func TestSyscallMetricsCollectorPerProcess(t *testing.T) {
+	collector := &SyscallMetricsCollector{topN: 2}
+	for _, call := range []struct {
+		process string
+		pid     uint32
+		count   uint64
+	}{
+		{"nginx", 100, 40},
+		{"nginx", 100, 20},
+		{"bash", 200, 50},
+		{"curl", 300, 5},
+		{"ls", 400, 3},
+	} {
+		if err := collector.CountSyscall(call.process, call.pid, SysOpen, call.count); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []Metric{
+		{Name: perProcessSyscallMetric, Type: CountMetricType, Tags: []string{PIDTagKey + ":100", CommTagKey + ":nginx"}, Value: 60},
+		{Name: perProcessSyscallMetric, Type: CountMetricType, Tags: []string{PIDTagKey + ":200", CommTagKey + ":bash"}, Value: 50},
+		{Name: perProcessSyscallMetric, Type: CountMetricType, Tags: []string{CommTagKey + ":other"}, Value: 8},
+	}
+	if metrics := collector.perProcessMetrics(); !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("unexpected per process metrics: %+v", metrics)
+	}
+
+	// the per process counts are disabled by default
+	collector = &SyscallMetricsCollector{}
+	if err := collector.CountSyscall("nginx", 100, SysOpen, 1); err != nil {
+		t.Fatal(err)
+	}
+	if metrics := collector.perProcessMetrics(); len(metrics) != 0 {
+		t.Errorf("unexpected per process metrics: %+v", metrics)
+	}
+}
+
+func TestMonitorSendStatsWithFailingSyscallMonitor(t *testing.T) {
+	client := &recordingStatsdClient{}
+	m := &Monitor{
+		client: client,
+	}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), &failingSyscallMonitor{})
+	m.GetPerfBufferMonitor().CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+
+	if err := m.SendStats(); err == nil {
+		t.Fatal("the syscall monitor error should be reported")
+	} else if !strings.Contains(err.Error(), "syscall maps unreadable") {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if received := client.find("count", MetricPrefix+".events.received"); len(received) != 1 {
+		t.Errorf("events.received metric not sent: %v", received)
+	}
+	if lost := client.find("count", MetricPrefix+".events.lost"); len(lost) != 1 {
+		t.Errorf("events.lost metric not sent: %v", lost)
+	}
+}
+
+func TestMonitorUnreadableMaps(t *testing.T) {
+	client := &recordingStatsdClient{}
+	m := &Monitor{
+		client:         client,
+		loadController: &LoadController{},
+	}
+	syscallMonitor := &partialSyscallMonitor{unreadable: map[string]error{"noisy_processes_bb": errors.New("bad file descriptor")}}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), syscallMonitor)
+	m.GetPerfBufferMonitor().CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+
+	// the healthy maps and the other sub-monitors are still reported
+	if err := m.SendStats(); err == nil || !strings.Contains(err.Error(), "noisy_processes_bb: bad file descriptor") {
+		t.Errorf("the unreadable map should be reported, got %v", err)
+	}
+	if received := client.find("count", MetricPrefix+".events.received"); len(received) != 1 {
+		t.Errorf("events.received metric not sent: %v", received)
+	}
+	if execs := client.find("count", execMetric); len(execs) != 1 {
+		t.Errorf("exec metric not sent: %v", execs)
+	}
+
+	stats, _ := m.GetStats(SyscallsStatsSection)
+	expected := map[string]string{"noisy_processes_bb": "bad file descriptor"}
+	if unreadable := stats["events"].(map[string]interface{})["unreadable_maps"]; !reflect.DeepEqual(unreadable, expected) {
+		t.Errorf("unexpected unreadable maps: %v", unreadable)
+	}
+
+	// the map is dropped from the unreadable maps once it can be read again
+	syscallMonitor.unreadable = nil
+	if err := m.SendStats(); err != nil {
+		t.Fatal(err)
+	}
+	if unreadable := m.getUnreadableMaps(); unreadable != nil {
+		t.Errorf("expected no unreadable map, got %v", unreadable)
+	}
+	stats, err := m.GetStats(SyscallsStatsSection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := stats["events"].(map[string]interface{})["unreadable_maps"]; found {
+		t.Errorf("unexpected unreadable maps: %v", stats)
+	}
+}
+
+func TestMonitorHealthy(t *testing.T) {
+	counters, err := simplelru.NewLRU(1024, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &recordingStatsdClient{}
+	mgr := &manager.Manager{PerfMaps: []*manager.PerfMap{testPerfMap}}
+	m := &Monitor{
+		probe:  &Probe{manager: mgr},
+		client: client,
+		loadController: &LoadController{
+			counters:         counters,
+			discarders:       make(map[eventCounterLRUKey]time.Time),
+			ControllerPeriod: time.Second,
+		},
+	}
+	m.setMonitors(mgr, newTestPerfBufferMonitor(t), nil)
+
+	if healthy, problems := m.Healthy(); healthy || !reflect.DeepEqual(problems, []string{"monitor not running", "eBPF programs not attached and perf buffer readers not started"}) {
+		t.Errorf("a monitor that isn't started shouldn't be healthy: %v", problems)
+	}
+
+	m.probe.managerStarted = 1
+	m.Start(context.Background())
+	if healthy, problems := m.Healthy(); !healthy {
+		t.Errorf("a started monitor should be healthy: %v", problems)
+	}
+
+	m.setMonitors(mgr, m.GetPerfBufferMonitor(), &failingSyscallMonitor{})
+	if healthy, problems := m.Healthy(); healthy || len(problems) != 1 || !strings.HasPrefix(problems[0], "syscall map unreadable") {
+		t.Errorf("an unreadable syscall map should be reported: %v", problems)
+	}
+	m.setMonitors(mgr, m.GetPerfBufferMonitor(), nil)
+
+	m.Stop()
+	if healthy, _ := m.Healthy(); healthy {
+		t.Error("a stopped monitor shouldn't be healthy")
+	}
+}
+
+func TestMonitorOnManagerReload(t *testing.T) {
+	client := &recordingStatsdClient{}
+	oldManager := &manager.Manager{PerfMaps: []*manager.PerfMap{testPerfMap}}
+	m := &Monitor{
+		probe:          &Probe{manager: oldManager, config: &config.Config{}},
+		client:         client,
+		loadController: &LoadController{manager: oldManager},
+	}
+	m.setMonitors(oldManager, newTestPerfBufferMonitor(t), nil)
+	m.ProcessLostEvent(3, 0, testPerfMap)
+
+	reloadedPerfMap := &manager.PerfMap{Map: manager.Map{Name: "reloaded_events"}, PerfMapOptions: manager.PerfMapOptions{PerfRingBufferSize: 8192}}
+	newManager := &manager.Manager{PerfMaps: []*manager.PerfMap{reloadedPerfMap}}
+	if err := m.OnManagerReload(newManager, manager.Options{DefaultPerfRingBufferSize: 4096}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the events lost on the previous manager are sent before its sub-monitors are replaced
+	lost := client.find("count", MetricPrefix+".events.lost")
+	if len(lost) != 1 || lost[0].Value != 3 || !reflect.DeepEqual(lost[0].Tags, []string{MapTagKey + ":events"}) {
+		t.Errorf("the events lost on the previous manager should be sent before the reload: %v", lost)
+	}
+
+	if m.loadController.manager != newManager {
+		t.Error("the load controller should be bound to the reloaded manager")
+	}
+	if m.getManager() != newManager {
+		t.Error("the sub-monitors should be bound to the reloaded manager")
+	}
+
+	perfBufferMonitor := m.GetPerfBufferMonitor()
+	if _, ok := perfBufferMonitor.counters[testPerfMap.Name]; ok {
+		t.Errorf("the perf map %s of the previous manager shouldn't be monitored anymore", testPerfMap.Name)
+	}
+	counters, ok := perfBufferMonitor.counters[reloadedPerfMap.Name]
+	if !ok {
+		t.Fatalf("the perf map %s of the reloaded manager should be monitored", reloadedPerfMap.Name)
+	}
+	if counters.capacity != 8192 {
+		t.Errorf("expected a capacity of 8192 bytes, got %d", counters.capacity)
+	}
+
+	m.ProcessLostEvent(2, 0, reloadedPerfMap)
+	if lost := perfBufferMonitor.GetLostCount("", -1); lost != 2 {
+		t.Errorf("expected 2 lost events after the reload, got %d", lost)
+	}
+}
+
+func TestMonitorSummary(t *testing.T) {
+	client := &recordingStatsdClient{}
+	m := &Monitor{
+		probe:  &Probe{config: &config.Config{SyscallMonitor: true}},
+		client: client,
+		loadController: &LoadController{
+			EventsCountThreshold: 1000,
+			DiscarderTimeout:     10 * time.Second,
+			ControllerPeriod:     time.Second,
+		},
+		statsEnabled:         true,
+		statsPollingInterval: 10 * time.Second,
+	}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), nil)
+
+	expected := fmt.Sprintf("load_controller=enabled (events_count_threshold=1000, discarder_timeout=10s, controller_period=1s), "+
+		"perf_buffer_monitor=enabled (stats=true, cpus=%d, perf_buffer_sizes=[events:4096]), "+
+		"syscall_monitor=unavailable, stats_polling_interval=10s", m.GetPerfBufferMonitor().numCPU)
+	if summary := m.summary(); summary != expected {
+		t.Errorf("unexpected summary:\n%s\nexpected:\n%s", summary, expected)
+	}
+
+	m.setMonitors(nil, m.GetPerfBufferMonitor(), &failingSyscallMonitor{})
+	m.statsPollingInterval = 0
+	if summary := m.summary(); !strings.HasSuffix(summary, "syscall_monitor=enabled, stats_polling_interval=module") {
+		t.Errorf("unexpected summary: %s", summary)
+	}
+
+	m.setMonitors(nil, m.GetPerfBufferMonitor(), nil)
+	m.probe.config.SyscallMonitor = false
+	if summary := m.summary(); !strings.Contains(summary, "syscall_monitor=disabled") {
+		t.Errorf("unexpected summary: %s", summary)
+	}
+}
+
+func TestMonitorResetStats(t *testing.T) {
+	client := &recordingStatsdClient{}
+	m := &Monitor{
+		client:         client,
+		loadController: &LoadController{statsdClient: client},
+	}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), &failingSyscallMonitor{})
+	pbm := m.GetPerfBufferMonitor()
+
+	now := time.Now()
+	pbm.sampleTurnovers(now)
+	pbm.CountEvent(FileOpenEventType, 3, 300, testPerfMap, 0)
+	pbm.CountLostEvent(2, testPerfMap, 1)
+	pbm.sampleTurnovers(now.Add(time.Second))
+	m.loadController.recordDiscard(ExecEventType, 10)
+
+	// the syscall monitor fails to reset, the other sub-monitors are still reset
+	if err := m.ResetStats(); err == nil {
+		t.Error("expected the syscall monitor error")
+	}
+
+	if stats := pbm.GetEventStats(FileOpenEventType, "", -1); stats != (PerfMapStats{}) {
+		t.Errorf("expected no event after reset, got %+v", stats)
+	}
+	if lost := pbm.GetLostCount("", -1); lost != 0 {
+		t.Errorf("expected no lost event after reset, got %d", lost)
+	}
+	if histogram := pbm.GetSizeHistogram(FileOpenEventType); len(histogram) != 0 {
+		t.Errorf("expected an empty size histogram after reset, got %v", histogram)
+	}
+	for cpu, turnover := range pbm.GetPeakTurnover(testPerfMap.Name) {
+		if turnover != 0 {
+			t.Errorf("expected no peak turnover on cpu %d after reset, got %f", cpu, turnover)
+		}
+	}
+	if stats := m.loadController.GetStats(); stats.DiscardersPushed != 0 || len(stats.DiscardedEvents) != 0 {
+		t.Errorf("unexpected load controller stats after reset: %+v", stats)
+	}
+
+	// the counters resume accumulating
+	pbm.CountEvent(FileOpenEventType, 1, 100, testPerfMap, 0)
+	pbm.CountLostEvent(1, testPerfMap, 0)
+	if stats := pbm.GetEventStats(FileOpenEventType, "", -1); stats != (PerfMapStats{Count: 1, Bytes: 100}) {
+		t.Errorf("unexpected event stats after reset: %+v", stats)
+	}
+	if lost := pbm.GetLostCount("", -1); lost != 1 {
+		t.Errorf("expected 1 lost event after reset, got %d", lost)
+	}
+}
+
+func TestLoadControllerDiscardedEvents(t *testing.T) {
+	client := &recordingStatsdClient{}
+	lc := &LoadController{statsdClient: client}
+	lc.recordDiscard(FileOpenEventType, 400)
+	lc.recordDiscard(FileOpenEventType, 100)
+	lc.recordDiscard(ExecEventType, 10)
+
+	stats := lc.GetStats()
+	if !reflect.DeepEqual(stats.DiscardedEvents, map[string]int64{"open": 500, "exec": 10}) {
+		t.Errorf("unexpected discarded events: %v", stats.DiscardedEvents)
+	}
+	if !reflect.DeepEqual(stats.DiscardersPerEventType, map[string]int64{"open": 2, "exec": 1}) {
+		t.Errorf("unexpected discarders per event type: %v", stats.DiscardersPerEventType)
+	}
+
+	if err := sendMetrics(client, lc.Collect()); err != nil {
+		t.Fatal(err)
+	}
+	expected := []recordedMetric{
+		{Kind: "count", Name: MetricPrefix + ".load_controller.discarded_events", Value: 500, Tags: []string{EventTypeTagKey + ":open"}},
+		{Kind: "count", Name: MetricPrefix + ".load_controller.discarded_events", Value: 10, Tags: []string{EventTypeTagKey + ":exec"}},
+	}
+	if discarded := client.find("count", MetricPrefix+".load_controller.discarded_events"); !reflect.DeepEqual(discarded, expected) {
+		t.Errorf("unexpected load_controller.discarded_events metrics: %v", discarded)
+	}
+
+	// only the new discards are sent, the stats keep the totals
+	lc.recordDiscard(ExecEventType, 5)
+	if err := sendMetrics(client, lc.Collect()); err != nil {
+		t.Fatal(err)
+	}
+	if discarded := client.find("count", MetricPrefix+".load_controller.discarded_events"); len(discarded) != 3 || discarded[2].Value != 5 {
+		t.Errorf("unexpected load_controller.discarded_events metrics: %v", discarded)
+	}
+	if stats := lc.GetStats(); stats.DiscardedEvents["exec"] != 15 {
+		t.Errorf("unexpected discarded events: %v", stats.DiscardedEvents)
+	}
+}
+
+func TestPerfBufferMonitorCPUStats(t *testing.T) {
+	if runtime.NumCPU() < 2 {
+		t.Skip("requires at least 2 cpus")
+	}
+
+	pbm := newTestPerfBufferMonitor(t)
+	pbm.CountEvent(FileOpenEventType, 3, 300, testPerfMap, 0)
+	pbm.CountEvent(ExecEventType, 1, 200, testPerfMap, 0)
+	pbm.CountLostEvent(2, testPerfMap, 1)
+
+	cpuStats := pbm.GetCPUStats()
+	if len(cpuStats) != runtime.NumCPU() {
+		t.Errorf("expected the stats of %d cpus, got %d", runtime.NumCPU(), len(cpuStats))
+	}
+	if cpuStats[0] != (CPUStats{Count: 4, Bytes: 500}) {
+		t.Errorf("unexpected stats for cpu 0: %+v", cpuStats[0])
+	}
+	if cpuStats[1] != (CPUStats{Lost: 2}) {
+		t.Errorf("unexpected stats for cpu 1: %+v", cpuStats[1])
+	}
+
+	// the aggregate totals are kept
+	if stats := pbm.GetEventStats(FileOpenEventType, "", -1); stats.Count != 3 {
+		t.Errorf("unexpected open event stats: %+v", stats)
+	}
+}
+
+func TestStatsdCircuitBreaker(t *testing.T) {
+	client := &recordingStatsdClient{err: errors.New("statsd unreachable")}
+	breaker := newStatsdCircuitBreaker(client, 2, time.Minute)
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	m := &Monitor{
+		client:        breaker,
+		statsdBreaker: breaker,
+	}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), nil)
+
+	// the breaker opens after 2 consecutive failures
+	for i := 0; i < 2; i++ {
+		if err := m.SendStats(); err == nil {
+			t.Error("expected the statsd error")
+		}
+	}
+	if !breaker.IsOpen() {
+		t.Fatal("expected the circuit breaker to be open")
+	}
+	if stats := breaker.GetStats(); stats.State != circuitOpen || stats.ConsecutiveFailures != 2 {
+		t.Errorf("unexpected circuit breaker stats: %+v", stats)
+	}
+
+	// the sends are skipped while the breaker is open
+	client.err = nil
+	if err := m.SendStats(); err != nil {
+		t.Error(err)
+	}
+	if err := breaker.Gauge("test", 1, nil, 1.0); err != errStatsdCircuitOpen {
+		t.Errorf("expected the metric to be skipped, got %v", err)
+	}
+	if len(client.metrics) != 0 {
+		t.Errorf("expected no metric while the circuit breaker is open, got %v", client.metrics)
+	}
+	if stats := breaker.GetStats(); stats.SkippedMetrics != 1 {
+		t.Errorf("unexpected circuit breaker stats: %+v", stats)
+	}
+
+	// once the cooldown expired, a failure opens the breaker again
+	now = now.Add(2 * time.Minute)
+	client.err = errors.New("statsd unreachable")
+	if err := breaker.Count("test", 1, nil, 1.0); err == nil || !breaker.IsOpen() {
+		t.Errorf("expected the half open circuit breaker to open again, got %v", err)
+	}
+
+	// and a success closes it
+	now = now.Add(2 * time.Minute)
+	client.err = nil
+	if err := m.SendStats(); err != nil {
+		t.Error(err)
+	}
+	if stats := breaker.GetStats(); stats.State != circuitClosed || stats.ConsecutiveFailures != 0 {
+		t.Errorf("unexpected circuit breaker stats: %+v", stats)
+	}
+	if len(client.metrics) == 0 {
+		t.Error("expected the metrics to be sent once the circuit breaker is closed")
+	}
+
+	sectionStats, err := m.GetStats(StatsdStatsSection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sectionStats["statsd_circuit_breaker"].(StatsdCircuitBreakerStats); !ok {
+		t.Errorf("expected the circuit breaker stats, got %v", sectionStats)
+	}
+}
+
+func TestMonitorGetStatsSections(t *testing.T) {
+	client := &recordingStatsdClient{}
+	m := &Monitor{
+		client:         client,
+		loadController: &LoadController{},
+	}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), nil)
+
+	sectionKeys := func(stats map[string]interface{}) []string {
+		var keys []string
+		for key, value := range stats {
+			if events, ok := value.(map[string]interface{}); ok {
+				for eventKey := range events {
+					keys = append(keys, key+"."+eventKey)
+				}
+				continue
+			}
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	for _, test := range []struct {
+		sections []string
+		expected []string
+	}{
+		{nil, []string{"config.counter_mode", "config.perf_buffers", "estimated_event_types", "event_size_histogram", "events.lost", "events.syscalls", "load_controller", "per_cpu", "per_event_type", "perf_buffer_peak_turnover"}},
+		{[]string{EventsStatsSection}, []string{"events.lost"}},
+		{[]string{SyscallsStatsSection}, []string{"events.syscalls"}},
+		{[]string{EventsStatsSection, SyscallsStatsSection}, []string{"events.lost", "events.syscalls"}},
+		{[]string{LoadControllerStatsSection}, []string{"load_controller"}},
+		{[]string{PerfBufferStatsSection}, []string{"per_cpu", "perf_buffer_peak_turnover"}},
+		{[]string{PerEventTypeStatsSection}, []string{"estimated_event_types", "event_size_histogram", "per_event_type"}},
+		{[]string{ConfigStatsSection}, []string{"config.counter_mode", "config.perf_buffers"}},
+		{[]string{PerfBufferStatsSection, PerEventTypeStatsSection, PerfBufferStatsSection}, []string{"estimated_event_types", "event_size_histogram", "per_cpu", "per_event_type", "perf_buffer_peak_turnover"}},
+	} {
+		stats, err := m.GetStats(test.sections...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keys := sectionKeys(stats); !reflect.DeepEqual(keys, test.expected) {
+			t.Errorf("unexpected stats for the sections %v: %v", test.sections, keys)
+		}
+	}
+
+	if _, err := m.GetStats(EventsStatsSection, "unknown"); err == nil {
+		t.Error("an unknown section should be rejected")
+	}
+
+	stats, err := m.GetStats(ConfigStatsSection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs := stats["config"].(map[string]interface{})["perf_buffers"].(map[string]PerfMapConfig)
+	expected := PerfMapConfig{
+		Size:        4096,
+		PageCount:   4096 / uint64(os.Getpagesize()),
+		DefaultSize: true,
+		PerCPU:      true,
+		NumCPU:      runtime.NumCPU(),
+	}
+	if !reflect.DeepEqual(configs, map[string]PerfMapConfig{"events": expected}) {
+		t.Errorf("unexpected perf buffers config: %+v", configs)
+	}
+}
+
+func TestMonitorEventTypeFilter(t *testing.T) {
+	counters, err := simplelru.NewLRU(1024, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &recordingStatsdClient{}
+	m := &Monitor{
+		client: client,
+		loadController: &LoadController{
+			counters:             counters,
+			discarders:           make(map[eventCounterLRUKey]time.Time),
+			EventsCountThreshold: math.MaxInt64,
+		},
+		statsEnabled: true,
+	}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), nil)
+
+	process := func(eventType EventType) {
+		event := &Event{Type: uint64(eventType)}
+		event.Process.Pid = 42
+		m.ProcessEvent(event, 64, 0, testPerfMap)
+	}
+
+	if err := m.SetEventTypeFilter(EventTypeFilter{Allow: []EventType{maxEventType}}); err == nil {
+		t.Error("an invalid event type should be rejected")
+	}
+
+	err = m.SetEventTypeFilter(EventTypeFilter{
+		Allow:            []EventType{FileOpenEventType, ExecEventType},
+		Deny:             []EventType{ExecEventType},
+		ForceLoadControl: []EventType{ForkEventType},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, eventType := range []EventType{FileOpenEventType, ExecEventType, ForkEventType, FileMkdirEventType} {
+		process(eventType)
+	}
+
+	for eventType, expected := range map[EventType]uint64{FileOpenEventType: 1, ExecEventType: 0, ForkEventType: 0, FileMkdirEventType: 0} {
+		if stats := m.GetPerfBufferMonitor().GetEventStats(eventType, "", -1); stats.Count != expected {
+			t.Errorf("expected %d %s events to be counted, got %+v", expected, eventType, stats)
+		}
+	}
+	// the open events are counted and the load control of the fork events is forced
+	if stats := m.loadController.GetStats(); stats.EventsCount != 2 {
+		t.Errorf("expected 2 events to be counted by the load controller, got %+v", stats)
+	}
+
+	// an empty filter counts all the event types again
+	if err := m.SetEventTypeFilter(EventTypeFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	process(FileMkdirEventType)
+	if stats := m.GetPerfBufferMonitor().GetEventStats(FileMkdirEventType, "", -1); stats.Count != 1 {
+		t.Errorf("expected the mkdir event to be counted, got %+v", stats)
+	}
+	if stats := m.loadController.GetStats(); stats.EventsCount != 3 {
+		t.Errorf("expected 3 events to be counted by the load controller, got %+v", stats)
+	}
+}
+
+func TestMonitorDumpDiagnostics(t *testing.T) {
+	client := &recordingStatsdClient{}
+	m := &Monitor{
+		client:         client,
+		loadController: &LoadController{EventsCountThreshold: 1000},
+	}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), nil)
+	m.setStatsdClients([]StatsdClient{client})
+
+	m.GetPerfBufferMonitor().CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+	m.GetPerfBufferMonitor().CountEvent(ExecEventType, 1, 128, testPerfMap, 0)
+	m.GetPerfBufferMonitor().CountLostEvent(3, testPerfMap, 0)
+
+	var buf strings.Builder
+	if err := m.DumpDiagnostics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	report := buf.String()
+	for _, expected := range []string{
+		"Sub-monitors: load_controller=enabled",
+		"Health: unhealthy",
+		"monitor not running",
+		"Perf buffers:",
+		"Events received:",
+		"Per cpu:",
+		"Load controller:",
+		"Statsd circuit breakers:",
+		"client 0: closed",
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("expected %q in the diagnostics report:\n%s", expected, report)
+		}
+	}
+	for _, pattern := range []string{`(?m)^\s+open\s+1\s+64$`, `(?m)^\s+exec\s+1\s+128$`, `(?m)^\s+lost\s+3\s*$`, `(?m)^\s+events\s+4096\s`} {
+		if !regexp.MustCompile(pattern).MatchString(report) {
+			t.Errorf("expected %s in the diagnostics report:\n%s", pattern, report)
+		}
+	}
+
+	// the counters are not reset by the report
+	if stats := m.GetPerfBufferMonitor().GetEventStats(FileOpenEventType, "", -1); stats.Count != 1 {
+		t.Errorf("unexpected open event stats: %+v", stats)
+	}
+}
+
+func benchmarkMonitorProcessEvent(b *testing.B, statsEnabled bool) {
+	counters, err := simplelru.NewLRU(1024, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	client := &recordingStatsdClient{}
+	m := &Monitor{
+		client: client,
+		loadController: &LoadController{
+			counters:             counters,
+			discarders:           make(map[eventCounterLRUKey]time.Time),
+			EventsCountThreshold: math.MaxInt64,
+		},
+		statsEnabled: statsEnabled,
+	}
+	m.setMonitors(nil, newTestPerfBufferMonitor(b), nil)
+
+	event := &Event{Type: uint64(FileOpenEventType)}
+	event.Process.Pid = 42
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.ProcessEvent(event, 64, i%m.GetPerfBufferMonitor().numCPU, testPerfMap)
+	}
+}
+
+func BenchmarkMonitorProcessEventStatsEnabled(b *testing.B) {
+	benchmarkMonitorProcessEvent(b, true)
+}
+
+func TestMonitorWatchThreshold(t *testing.T) {
+	m := &Monitor{}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), nil)
+	var fired []float64
+	m.WatchThreshold("events.lost", 2, func(value float64) {
+		fired = append(fired, value)
+	})
+	var turnoverFired int
+	m.WatchThreshold(MetricPrefix+".perf_buffer.turnover", 2, func(value float64) {
+		turnoverFired++
+	})
+
+	sendLost := func(lost uint64) {
+		if lost > 0 {
+			m.GetPerfBufferMonitor().CountLostEvent(lost, testPerfMap, 0)
+		}
+		// no statsd client is set, the thresholds are evaluated anyway
+		if err := m.SendStats(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sendLost(1)
+	if len(fired) != 0 {
+		t.Fatalf("expected no crossing below the threshold, got %v", fired)
+	}
+	sendLost(3)
+	if len(fired) != 1 || fired[0] != 3 {
+		t.Fatalf("expected a crossing with value 3, got %v", fired)
+	}
+
+	// the callback doesn't fire again while the metric flaps around the threshold
+	sendLost(5)
+	sendLost(0)
+	sendLost(4)
+	for i := 0; i < thresholdRearmIntervals-1; i++ {
+		sendLost(0)
+	}
+	if len(fired) != 1 {
+		t.Fatalf("expected a single crossing while flapping, got %v", fired)
+	}
+
+	// until it stays below the threshold long enough
+	sendLost(0)
+	sendLost(6)
+	if len(fired) != 2 || fired[1] != 6 {
+		t.Fatalf("expected a second crossing with value 6, got %v", fired)
+	}
+
+	if turnoverFired != 0 {
+		t.Errorf("expected the turnover threshold not to be crossed, got %d crossings", turnoverFired)
+	}
+}
+
+func TestMonitorWatchThresholdSendsStats(t *testing.T) {
+	client := &recordingStatsdClient{}
+	m := &Monitor{
+		client: client,
+	}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), nil)
+	var fired int
+	m.WatchThreshold("events.lost", 0, func(value float64) {
+		fired++
+	})
+
+	m.GetPerfBufferMonitor().CountLostEvent(1, testPerfMap, 0)
+	if err := m.SendStats(); err != nil {
+		t.Fatal(err)
+	}
+	if fired != 1 {
+		t.Errorf("expected the threshold to be crossed once, got %d", fired)
+	}
+	if len(client.metrics) == 0 {
+		t.Error("expected the metrics to be sent")
+	}
+}
+
+func TestMonitorGetStatsCounterModes(t *testing.T) {
+	client := &recordingStatsdClient{}
+	m := &Monitor{
+		client:         client,
+		loadController: &LoadController{},
+	}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), nil)
+	read := func() (int64, uint64) {
+		stats, err := m.GetStats(EventsStatsSection, PerEventTypeStatsSection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stats["per_event_type"].(map[string]int64)[FileOpenEventType.String()], stats["events"].(map[string]interface{})["lost"].(uint64)
+	}
+
+	// the cumulative mode keeps the counters when they are read
+	if mode := m.GetPerfBufferMonitor().GetCounterMode(); mode != CumulativeCounters {
+		t.Fatalf("expected the cumulative mode by default, got %s", mode)
+	}
+	m.GetPerfBufferMonitor().CountEvent(FileOpenEventType, 2, 128, testPerfMap, 0)
+	m.GetPerfBufferMonitor().CountLostEvent(3, testPerfMap, 0)
+	for i := 0; i < 2; i++ {
+		if opens, lost := read(); opens != 2 || lost != 3 {
+			t.Errorf("expected 2 open events and 3 lost events, got %d and %d", opens, lost)
+		}
+	}
+
+	// the delta mode returns the counts since the previous read
+	if err := m.GetPerfBufferMonitor().SetCounterMode(DeltaCounters); err != nil {
+		t.Fatal(err)
+	}
+	if opens, lost := read(); opens != 2 || lost != 3 {
+		t.Errorf("expected 2 open events and 3 lost events, got %d and %d", opens, lost)
+	}
+	if opens, lost := read(); opens != 0 || lost != 0 {
+		t.Errorf("expected no event since the previous read, got %d open events and %d lost events", opens, lost)
+	}
+	m.GetPerfBufferMonitor().CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+	if opens, _ := read(); opens != 1 {
+		t.Errorf("expected 1 open event since the previous read, got %d", opens)
+	}
+
+	// the reads don't reset the counters, and reading the configuration isn't a read of the counters
+	m.GetPerfBufferMonitor().CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+	stats, err := m.GetStats(ConfigStatsSection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := stats["config"].(map[string]interface{})["counter_mode"]; mode != DeltaCounters {
+		t.Errorf("expected the delta mode in the config stats, got %v", mode)
+	}
+	if stats := m.GetPerfBufferMonitor().GetEventStats(FileOpenEventType, "", -1); stats.Count != 4 {
+		t.Errorf("expected 4 open events, got %+v", stats)
+	}
+	if opens, _ := read(); opens != 1 {
+		t.Errorf("expected 1 open event since the previous read, got %d", opens)
+	}
+
+	if err := m.GetPerfBufferMonitor().SetCounterMode("unknown"); err == nil {
+		t.Error("an unknown counter mode should be rejected")
+	}
+}
+
+func TestMonitorDeltaReadsDontResetStatsdCounts(t *testing.T) {
+	client := &recordingStatsdClient{}
+	m := &Monitor{
+		client:         client,
+		loadController: &LoadController{},
+	}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), nil)
+	if err := m.GetPerfBufferMonitor().SetCounterMode(DeltaCounters); err != nil {
+		t.Fatal(err)
+	}
+
+	var read uint64
+	readLost := func() {
+		stats, err := m.GetStats(EventsStatsSection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read += stats["events"].(map[string]interface{})["lost"].(uint64)
+	}
+
+	// the reads and the sends are interleaved, each of them sees all the lost events once
+	m.GetPerfBufferMonitor().CountLostEvent(2, testPerfMap, 0)
+	readLost()
+	m.GetPerfBufferMonitor().CountLostEvent(3, testPerfMap, 1)
+	if err := m.SendStats(); err != nil {
+		t.Fatal(err)
+	}
+	m.GetPerfBufferMonitor().CountLostEvent(4, testPerfMap, 0)
+	readLost()
+	readLost()
+	m.GetPerfBufferMonitor().CountLostEvent(5, testPerfMap, 0)
+	if err := m.SendStats(); err != nil {
+		t.Fatal(err)
+	}
+	readLost()
+
+	var sent float64
+	for _, metric := range client.find("count", MetricPrefix+".events.lost") {
+		sent += metric.Value
+	}
+	if sent != 14 {
+		t.Errorf("expected 14 lost events sent to statsd, got %v", sent)
+	}
+	if read != 14 {
+		t.Errorf("expected 14 lost events read, got %d", read)
+	}
+}
+
+func TestPerfBufferMonitorReadDeltasConcurrently(t *testing.T) {
+	pbm := newTestPerfBufferMonitor(t)
+
+	const writers, eventsPerWriter = 4, 10000
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < eventsPerWriter; j++ {
+				pbm.CountEvent(FileOpenEventType, 1, 64, testPerfMap, 0)
+				pbm.CountLostEvent(1, testPerfMap, 0)
+			}
+		}()
+	}
+
+	// the events counted concurrently are either in a delta or in the next one, whatever the collections in between
+	var count, lost, collected uint64
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		deltas := pbm.readDeltas()
+		count += deltas.GetEventStats(FileOpenEventType, "", -1).Count
+		lost += deltas.GetLostCount("", -1)
+		collected += pbm.GetAndResetLostCount("", -1)
+	}
+	collected += pbm.GetAndResetLostCount("", -1)
+
+	if count != writers*eventsPerWriter || lost != writers*eventsPerWriter {
+		t.Errorf("expected %d events counted and lost, got %d and %d", writers*eventsPerWriter, count, lost)
+	}
+	if collected != writers*eventsPerWriter {
+		t.Errorf("expected %d lost events collected, got %d", writers*eventsPerWriter, collected)
+	}
+	if histogram := pbm.GetSizeHistogram(FileOpenEventType); histogram["le_64"] != writers*eventsPerWriter {
+		t.Errorf("expected the size histogram to be left untouched, got %v", histogram)
+	}
+}
+
+func BenchmarkMonitorProcessEventStatsDisabled(b *testing.B) {
+	benchmarkMonitorProcessEvent(b, false)
+}
+
+func TestMonitorWatchThresholdKeepsCountsWhileStatsdIsOpen(t *testing.T) {
+	client := &recordingStatsdClient{}
+	breaker := newStatsdCircuitBreaker(client, 1, time.Minute)
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+	m := &Monitor{
+		client:        breaker,
+		statsdBreaker: breaker,
+	}
+	m.setMonitors(nil, newTestPerfBufferMonitor(t), nil)
+	var fired int
+	m.WatchThreshold("events.lost", 0, func(value float64) {
+		fired++
+	})
+
+	breaker.state, breaker.openUntil = circuitOpen, now.Add(time.Minute)
+	m.GetPerfBufferMonitor().CountLostEvent(2, testPerfMap, 0)
+	if err := m.SendStats(); err != nil {
+		t.Fatal(err)
+	}
+	m.GetPerfBufferMonitor().CountLostEvent(3, testPerfMap, 0)
+	if err := m.SendStats(); err != nil {
+		t.Fatal(err)
+	}
+	if fired != 1 {
+		t.Errorf("expected the threshold to be crossed while statsd is open, got %d crossings", fired)
+	}
+	if len(client.metrics) != 0 {
+		t.Fatalf("expected no metric while the circuit breaker is open, got %v", client.metrics)
+	}
+
+	// the counts collected while the breaker was open are sent once it closes
+	now = now.Add(2 * time.Minute)
+	m.GetPerfBufferMonitor().CountLostEvent(1, testPerfMap, 0)
+	if err := m.SendStats(); err != nil {
+		t.Fatal(err)
+	}
+	if lost := client.find("count", MetricPrefix+".events.lost"); len(lost) != 1 || lost[0].Value != 6 {
+		t.Errorf("expected all the lost events to be sent, got %v", lost)
+	}
+	if len(m.deferredCounts) != 0 {
+		t.Errorf("unexpected deferred counts: %v", m.deferredCounts)
+	}
+}
+
+func TestMergeCounts(t *testing.T) {
+	tags := []string{MapTagKey + ":events"}
+	metrics := []Metric{
+		newCountMetric("lost", 1, tags),
+		newGaugeMetric("usage", 0.5, tags),
+	}
+	pending := []Metric{
+		newCountMetric("lost", 2, tags),
+		newCountMetric("received", 3, tags),
+		newGaugeMetric("usage", 0.9, tags),
+	}
+
+	expected := []Metric{
+		newCountMetric("lost", 3, tags),
+		newGaugeMetric("usage", 0.5, tags),
+		newCountMetric("received", 3, tags),
+	}
+	if merged := mergeCounts(metrics, pending); !reflect.DeepEqual(merged, expected) {
+		t.Errorf("unexpected merged metrics: %v", merged)
+	}
+}
@@ -0,0 +1,44 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+// +build linux
+
+package probe
+
+import (
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+// multiStatsdClient is a StatsdClient sending each metric to all of its clients, for example to push the
+// metrics to a local agent and to a shadow pipeline at the same time
+type multiStatsdClient []StatsdClient
+
+// Count sends the count to all the clients, the returned error aggregates their errors
+func (mc multiStatsdClient) Count(name string, value int64, tags []string, rate float64) error {
+	var result *multierror.Error
+	for i, client := range mc {
+		result = appendStatsdError(result, i, client.Count(name, value, tags, rate))
+	}
+	return result.ErrorOrNil()
+}
+
+// Gauge sends the gauge to all the clients, the returned error aggregates their errors
+func (mc multiStatsdClient) Gauge(name string, value float64, tags []string, rate float64) error {
+	var result *multierror.Error
+	for i, client := range mc {
+		result = appendStatsdError(result, i, client.Gauge(name, value, tags, rate))
+	}
+	return result.ErrorOrNil()
+}
+
+// appendStatsdError appends the error of the i-th client to the result. The metrics skipped by an open circuit
+// breaker are not errors, a client failing doesn't fail the sends to the other clients.
+func appendStatsdError(result *multierror.Error, i int, err error) *multierror.Error {
+	if err == nil || err == errStatsdCircuitOpen {
+		return result
+	}
+	return multierror.Append(result, errors.Wrapf(err, "statsd client %d", i))
+}
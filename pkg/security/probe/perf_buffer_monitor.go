@@ -0,0 +1,645 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+// +build linux
+
+package probe
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DataDog/ebpf/manager"
+	"github.com/pkg/errors"
+)
+
+// DefaultEventSizeBuckets are the default upper bounds, in bytes, of the buckets of the event size histogram
+var DefaultEventSizeBuckets = []uint64{64, 128, 256, 512, 1024, 2048, 4096}
+
+// CounterMode defines what the statistics of the perf buffer monitor read with Monitor.GetStats count. The metrics
+// sent to statsd are deltas in both modes, the collection resets the counters, and they aren't affected by the reads.
+type CounterMode string
+
+const (
+	// CumulativeCounters returns the counters as is when the statistics are read, they are only reset by the
+	// collection of the metrics and by ResetStats. It is the default mode.
+	CumulativeCounters CounterMode = "cumulative"
+	// DeltaCounters returns the counts since the previous read of the statistics, whatever the collections of the
+	// metrics in between. The turnover peaks are reset by each read.
+	DeltaCounters CounterMode = "delta"
+)
+
+// PerfMapStats contains the collected metrics for one event type and one cpu of a perf buffer
+type PerfMapStats struct {
+	Bytes uint64
+	Count uint64
+}
+
+// add aggregates the provided stats into the current ones
+func (s *PerfMapStats) add(other PerfMapStats) {
+	s.Bytes += other.Bytes
+	s.Count += other.Count
+}
+
+// CPUStats contains the statistics of the events received and lost on one cpu, across all the perf maps and event types
+type CPUStats struct {
+	Count uint64 `json:"count"`
+	Bytes uint64 `json:"bytes"`
+	Lost  uint64 `json:"lost"`
+}
+
+// PerfMapConfig contains the configuration of the ring buffers of a perf map, as passed to the eBPF manager
+type PerfMapConfig struct {
+	// Size is the size in bytes of the ring buffer of each cpu
+	Size uint64 `json:"size"`
+	// PageCount is the number of memory pages of the ring buffer of each cpu
+	PageCount uint64 `json:"page_count"`
+	// DefaultSize is true when the size is the default size of the manager options
+	DefaultSize bool `json:"default_size"`
+	// PerCPU is true when a ring buffer is allocated for each cpu, which is always the case of the perf maps
+	PerCPU bool `json:"per_cpu"`
+	// NumCPU is the number of cpus for which a ring buffer is allocated
+	NumCPU int `json:"num_cpu"`
+}
+
+// counterSnapshot holds the values of the event counters, the lost events counters and the event size histograms
+// of a perf map, indexed by cpu and event type
+type counterSnapshot struct {
+	events [][maxEventType]PerfMapStats
+	lost   []uint64
+	sizes  [][maxEventType][]uint64
+}
+
+// newCounterSnapshot allocates a snapshot of the counters of numCPU cpus
+func newCounterSnapshot(numCPU int, buckets []uint64) counterSnapshot {
+	return counterSnapshot{
+		events: make([][maxEventType]PerfMapStats, numCPU),
+		lost:   make([]uint64, numCPU),
+		sizes:  newSizeHistograms(numCPU, buckets),
+	}
+}
+
+// perfMapCounters holds the counters of one perf map, indexed by cpu and event type
+type perfMapCounters struct {
+	events [][maxEventType]PerfMapStats
+	lost   []uint64
+	// capacity is the size in bytes of the ring buffer of each cpu
+	capacity uint64
+	// config is the configuration of the ring buffers of the perf map
+	config PerfMapConfig
+	// writtenBytes holds the bytes received on each cpu since the last turnover sample
+	writtenBytes []uint64
+	// peakTurnover holds the highest turnover sampled on each cpu
+	peakTurnover []float64
+	// sampleTicks counts the events of the sampled event types on each cpu, to count 1 in N of them
+	sampleTicks [][maxEventType]uint64
+	// sizes holds the event size histogram of each cpu and event type, indexed by bucket
+	sizes [][maxEventType][]uint64
+	// collected holds the values reset by the collections of the metrics, added to the counters they give the totals
+	// since the creation of the monitor or its last ResetStats. It's protected by the collectLock of the monitor.
+	collected counterSnapshot
+	// lastRead holds the totals at the previous read of the statistics in the DeltaCounters mode. It's protected by
+	// the collectLock of the monitor.
+	lastRead counterSnapshot
+}
+
+// newSizeHistograms allocates the event size histograms of numCPU cpus, with an extra bucket for the largest sizes
+func newSizeHistograms(numCPU int, buckets []uint64) [][maxEventType][]uint64 {
+	sizes := make([][maxEventType][]uint64, numCPU)
+	for cpu := range sizes {
+		for eventType := range sizes[cpu] {
+			sizes[cpu][eventType] = make([]uint64, len(buckets)+1)
+		}
+	}
+	return sizes
+}
+
+// PerfBufferMonitor holds statistics about the number of lost and received events
+type PerfBufferMonitor struct {
+	// numCPU holds the count of CPU for which a perf ring buffer is allocated
+	numCPU int
+	// counters holds the user space counters, indexed by the name of the perf map
+	counters map[string]*perfMapCounters
+	// turnoverLock protects the turnover peaks of the perf maps and the time of the last turnover sample
+	turnoverLock sync.RWMutex
+	// lastTurnoverSample is the time of the previous turnover sample
+	lastTurnoverSample time.Time
+	// collectLock serializes the resets of the counters by the collections with the reads of their totals, it must
+	// be taken before turnoverLock
+	collectLock sync.Mutex
+	// lastSendStats is the time of the previous Collect call, it is used to compute the rate metrics
+	lastSendStats time.Time
+	// sampleRates holds the sample rate of each event type, 0 and 1 mean that all the events are counted
+	sampleRates [maxEventType]uint64
+	// sizeBuckets holds the sorted upper bounds of the buckets of the event size histogram
+	sizeBuckets []uint64
+	// deltaCounters is set to 1 when the counter mode is DeltaCounters
+	deltaCounters int32
+}
+
+// NewPerfBufferMonitor instantiates a new perf buffer monitor for the perf maps of the provided manager
+func NewPerfBufferMonitor(m *manager.Manager, managerOptions manager.Options) (*PerfBufferMonitor, error) {
+	if m == nil {
+		return nil, errors.New("manager is null")
+	}
+
+	pbm := &PerfBufferMonitor{
+		numCPU:      runtime.NumCPU(),
+		counters:    make(map[string]*perfMapCounters),
+		sizeBuckets: DefaultEventSizeBuckets,
+	}
+
+	pageSize := uint64(os.Getpagesize())
+	for _, perfMap := range m.PerfMaps {
+		capacity := perfMap.PerfRingBufferSize
+		if capacity == 0 {
+			capacity = managerOptions.DefaultPerfRingBufferSize
+		}
+		config := PerfMapConfig{
+			Size:        uint64(capacity),
+			PageCount:   uint64(capacity) / pageSize,
+			DefaultSize: perfMap.PerfRingBufferSize == 0,
+			PerCPU:      true,
+			NumCPU:      pbm.numCPU,
+		}
+
+		pbm.counters[perfMap.Name] = &perfMapCounters{
+			events:       make([][maxEventType]PerfMapStats, pbm.numCPU),
+			lost:         make([]uint64, pbm.numCPU),
+			capacity:     uint64(capacity),
+			config:       config,
+			writtenBytes: make([]uint64, pbm.numCPU),
+			peakTurnover: make([]float64, pbm.numCPU),
+			sampleTicks:  make([][maxEventType]uint64, pbm.numCPU),
+			sizes:        newSizeHistograms(pbm.numCPU, pbm.sizeBuckets),
+			collected:    newCounterSnapshot(pbm.numCPU, pbm.sizeBuckets),
+			lastRead:     newCounterSnapshot(pbm.numCPU, pbm.sizeBuckets),
+		}
+	}
+
+	return pbm, nil
+}
+
+// SetCounterMode sets whether reading the statistics resets the counters, see CounterMode
+func (pbm *PerfBufferMonitor) SetCounterMode(mode CounterMode) error {
+	switch mode {
+	case CumulativeCounters:
+		atomic.StoreInt32(&pbm.deltaCounters, 0)
+	case DeltaCounters:
+		atomic.StoreInt32(&pbm.deltaCounters, 1)
+	default:
+		return fmt.Errorf("unknown counter mode %s", mode)
+	}
+	return nil
+}
+
+// GetCounterMode returns the counter mode of the perf buffer monitor
+func (pbm *PerfBufferMonitor) GetCounterMode() CounterMode {
+	if atomic.LoadInt32(&pbm.deltaCounters) == 1 {
+		return DeltaCounters
+	}
+	return CumulativeCounters
+}
+
+// readDeltas returns a copy of the perf buffer monitor holding the counts since its previous call, along with the
+// turnover peaks which are reset. The counters are left untouched so that the metrics collected for statsd are
+// unaffected: the totals of the counters, including the values reset by the collections, are compared with the ones
+// of the previous call. The copy is only meant to be read, it can't count events.
+func (pbm *PerfBufferMonitor) readDeltas() *PerfBufferMonitor {
+	deltas := &PerfBufferMonitor{
+		numCPU:      pbm.numCPU,
+		counters:    make(map[string]*perfMapCounters, len(pbm.counters)),
+		sampleRates: pbm.sampleRates,
+		sizeBuckets: pbm.sizeBuckets,
+	}
+
+	pbm.collectLock.Lock()
+	defer pbm.collectLock.Unlock()
+	pbm.turnoverLock.Lock()
+	defer pbm.turnoverLock.Unlock()
+
+	for perfMap, counters := range pbm.counters {
+		c := &perfMapCounters{
+			events:       make([][maxEventType]PerfMapStats, len(counters.events)),
+			lost:         make([]uint64, len(counters.lost)),
+			capacity:     counters.capacity,
+			config:       counters.config,
+			peakTurnover: append([]float64{}, counters.peakTurnover...),
+			sizes:        newSizeHistograms(len(counters.sizes), pbm.sizeBuckets),
+		}
+		for cpu := range counters.events {
+			for eventType := range counters.events[cpu] {
+				total := counters.collected.events[cpu][eventType]
+				total.add(PerfMapStats{
+					Count: atomic.LoadUint64(&counters.events[cpu][eventType].Count),
+					Bytes: atomic.LoadUint64(&counters.events[cpu][eventType].Bytes),
+				})
+				last := &counters.lastRead.events[cpu][eventType]
+				c.events[cpu][eventType] = PerfMapStats{Count: total.Count - last.Count, Bytes: total.Bytes - last.Bytes}
+				*last = total
+
+				for bucket := range counters.sizes[cpu][eventType] {
+					total := counters.collected.sizes[cpu][eventType][bucket] + atomic.LoadUint64(&counters.sizes[cpu][eventType][bucket])
+					c.sizes[cpu][eventType][bucket] = total - counters.lastRead.sizes[cpu][eventType][bucket]
+					counters.lastRead.sizes[cpu][eventType][bucket] = total
+				}
+			}
+
+			total := counters.collected.lost[cpu] + atomic.LoadUint64(&counters.lost[cpu])
+			c.lost[cpu] = total - counters.lastRead.lost[cpu]
+			counters.lastRead.lost[cpu] = total
+			counters.peakTurnover[cpu] = 0
+		}
+		deltas.counters[perfMap] = c
+	}
+	return deltas
+}
+
+// getCounters returns the counters of the provided perf map and cpu, nil if they don't exist
+func (pbm *PerfBufferMonitor) getCounters(perfMap string, cpu int) *perfMapCounters {
+	counters, ok := pbm.counters[perfMap]
+	if !ok || cpu < 0 || cpu >= pbm.numCPU {
+		return nil
+	}
+	return counters
+}
+
+// SetSampleRate makes the monitor only count 1 in `rate` events of the specified type, the counters are scaled
+// accordingly so that their totals are estimates of the real ones. It must be called before the events are counted.
+func (pbm *PerfBufferMonitor) SetSampleRate(eventType EventType, rate uint64) {
+	if eventType >= maxEventType {
+		return
+	}
+	pbm.sampleRates[eventType] = rate
+}
+
+// SetSizeBuckets sets the upper bounds, in bytes, of the buckets of the event size histogram, an extra bucket holds
+// the larger events. It resets the histogram and must be called before the events are counted.
+func (pbm *PerfBufferMonitor) SetSizeBuckets(buckets []uint64) {
+	pbm.sizeBuckets = append([]uint64{}, buckets...)
+	sort.Slice(pbm.sizeBuckets, func(i, j int) bool { return pbm.sizeBuckets[i] < pbm.sizeBuckets[j] })
+	for _, counters := range pbm.counters {
+		counters.sizes = newSizeHistograms(pbm.numCPU, pbm.sizeBuckets)
+		counters.collected.sizes = newSizeHistograms(pbm.numCPU, pbm.sizeBuckets)
+		counters.lastRead.sizes = newSizeHistograms(pbm.numCPU, pbm.sizeBuckets)
+	}
+}
+
+// sizeBucket returns the index of the bucket of the event size histogram holding size
+func (pbm *PerfBufferMonitor) sizeBucket(size uint64) int {
+	return sort.Search(len(pbm.sizeBuckets), func(i int) bool { return size <= pbm.sizeBuckets[i] })
+}
+
+// sizeBucketLabel returns the label of a bucket of the event size histogram, e.g. le_256 or gt_4096
+func (pbm *PerfBufferMonitor) sizeBucketLabel(bucket int) string {
+	if bucket < len(pbm.sizeBuckets) {
+		return fmt.Sprintf("le_%d", pbm.sizeBuckets[bucket])
+	}
+	if len(pbm.sizeBuckets) == 0 {
+		return "all"
+	}
+	return fmt.Sprintf("gt_%d", pbm.sizeBuckets[len(pbm.sizeBuckets)-1])
+}
+
+// IsSampled returns whether the counters of the specified event type are estimates
+func (pbm *PerfBufferMonitor) IsSampled(eventType EventType) bool {
+	return eventType < maxEventType && pbm.sampleRates[eventType] > 1
+}
+
+// CountEvent adds `count` to the counter of received events of the specified type
+func (pbm *PerfBufferMonitor) CountEvent(eventType EventType, count uint64, size uint64, perfMap *manager.PerfMap, cpu int) {
+	if eventType >= maxEventType {
+		return
+	}
+	counters := pbm.getCounters(perfMap.Name, cpu)
+	if counters == nil {
+		return
+	}
+
+	if rate := pbm.sampleRates[eventType]; rate > 1 {
+		if atomic.AddUint64(&counters.sampleTicks[cpu][eventType], 1)%rate != 0 {
+			return
+		}
+		count *= rate
+		size *= rate
+	}
+	// the size of a single event is size / count
+	if count > 0 {
+		atomic.AddUint64(&counters.sizes[cpu][eventType][pbm.sizeBucket(size/count)], count)
+	}
+
+	stats := &counters.events[cpu][eventType]
+	atomic.AddUint64(&stats.Count, count)
+	atomic.AddUint64(&stats.Bytes, size)
+	atomic.AddUint64(&counters.writtenBytes[cpu], size)
+}
+
+// CountLostEvent adds `count` to the counter of lost events
+func (pbm *PerfBufferMonitor) CountLostEvent(count uint64, perfMap *manager.PerfMap, cpu int) {
+	counters := pbm.getCounters(perfMap.Name, cpu)
+	if counters == nil {
+		return
+	}
+	atomic.AddUint64(&counters.lost[cpu], count)
+}
+
+// collectEventStats aggregates the statistics of an event type for the selected perf maps and cpus.
+// An empty perf map name selects all the perf maps, a negative cpu selects all the cpus.
+func (pbm *PerfBufferMonitor) collectEventStats(eventType EventType, perfMap string, cpu int, reset bool) PerfMapStats {
+	var stats PerfMapStats
+	if eventType >= maxEventType {
+		return stats
+	}
+	if reset {
+		pbm.collectLock.Lock()
+		defer pbm.collectLock.Unlock()
+	}
+
+	for name, counters := range pbm.counters {
+		if perfMap != "" && name != perfMap {
+			continue
+		}
+		for i := range counters.events {
+			if cpu >= 0 && i != cpu {
+				continue
+			}
+			entry := &counters.events[i][eventType]
+			if reset {
+				collected := PerfMapStats{
+					Count: atomic.SwapUint64(&entry.Count, 0),
+					Bytes: atomic.SwapUint64(&entry.Bytes, 0),
+				}
+				counters.collected.events[i][eventType].add(collected)
+				stats.add(collected)
+			} else {
+				stats.add(PerfMapStats{
+					Count: atomic.LoadUint64(&entry.Count),
+					Bytes: atomic.LoadUint64(&entry.Bytes),
+				})
+			}
+		}
+	}
+	return stats
+}
+
+// GetCPUStats returns the statistics of the received and lost events of each cpu, aggregated across all the perf maps
+// and event types. An uneven breakdown reveals that the perf buffer of a cpu is overwhelmed while the others are idle.
+func (pbm *PerfBufferMonitor) GetCPUStats() map[int]CPUStats {
+	cpuStats := make(map[int]CPUStats, pbm.numCPU)
+	for cpu := 0; cpu < pbm.numCPU; cpu++ {
+		var stats CPUStats
+		for eventType := EventType(1); eventType < maxEventType; eventType++ {
+			events := pbm.collectEventStats(eventType, "", cpu, false)
+			stats.Count += events.Count
+			stats.Bytes += events.Bytes
+		}
+		stats.Lost = pbm.collectLostCount("", cpu, false)
+		cpuStats[cpu] = stats
+	}
+	return cpuStats
+}
+
+// collectSizeHistogram aggregates the event size histogram of an event type for all the perf maps and cpus
+func (pbm *PerfBufferMonitor) collectSizeHistogram(eventType EventType, reset bool) []uint64 {
+	histogram := make([]uint64, len(pbm.sizeBuckets)+1)
+	if eventType >= maxEventType {
+		return histogram
+	}
+	if reset {
+		pbm.collectLock.Lock()
+		defer pbm.collectLock.Unlock()
+	}
+
+	for _, counters := range pbm.counters {
+		for cpu := range counters.sizes {
+			for bucket := range counters.sizes[cpu][eventType] {
+				if reset {
+					collected := atomic.SwapUint64(&counters.sizes[cpu][eventType][bucket], 0)
+					counters.collected.sizes[cpu][eventType][bucket] += collected
+					histogram[bucket] += collected
+				} else {
+					histogram[bucket] += atomic.LoadUint64(&counters.sizes[cpu][eventType][bucket])
+				}
+			}
+		}
+	}
+	return histogram
+}
+
+// GetSizeHistogram returns the number of events of the specified type in each bucket of the event size histogram,
+// indexed by bucket label. Only the non empty buckets are returned.
+func (pbm *PerfBufferMonitor) GetSizeHistogram(eventType EventType) map[string]uint64 {
+	histogram := make(map[string]uint64)
+	for bucket, count := range pbm.collectSizeHistogram(eventType, false) {
+		if count > 0 {
+			histogram[pbm.sizeBucketLabel(bucket)] = count
+		}
+	}
+	return histogram
+}
+
+// collectLostCount aggregates the lost events count for the selected perf maps and cpus.
+// An empty perf map name selects all the perf maps, a negative cpu selects all the cpus.
+func (pbm *PerfBufferMonitor) collectLostCount(perfMap string, cpu int, reset bool) uint64 {
+	var lost uint64
+	if reset {
+		pbm.collectLock.Lock()
+		defer pbm.collectLock.Unlock()
+	}
+	for name, counters := range pbm.counters {
+		if perfMap != "" && name != perfMap {
+			continue
+		}
+		for i := range counters.lost {
+			if cpu >= 0 && i != cpu {
+				continue
+			}
+			if reset {
+				collected := atomic.SwapUint64(&counters.lost[i], 0)
+				counters.collected.lost[i] += collected
+				lost += collected
+			} else {
+				lost += atomic.LoadUint64(&counters.lost[i])
+			}
+		}
+	}
+	return lost
+}
+
+// GetEventStats returns the statistics of the received events of the specified type.
+// An empty perf map name selects all the perf maps, a negative cpu selects all the cpus.
+func (pbm *PerfBufferMonitor) GetEventStats(eventType EventType, perfMap string, cpu int) PerfMapStats {
+	return pbm.collectEventStats(eventType, perfMap, cpu, false)
+}
+
+// GetAndResetEventStats returns the statistics of the received events of the specified type and resets the counters
+func (pbm *PerfBufferMonitor) GetAndResetEventStats(eventType EventType, perfMap string, cpu int) PerfMapStats {
+	return pbm.collectEventStats(eventType, perfMap, cpu, true)
+}
+
+// GetLostCount returns the number of lost events.
+// An empty perf map name selects all the perf maps, a negative cpu selects all the cpus.
+func (pbm *PerfBufferMonitor) GetLostCount(perfMap string, cpu int) uint64 {
+	return pbm.collectLostCount(perfMap, cpu, false)
+}
+
+// GetAndResetLostCount returns the number of lost events and resets the counters
+func (pbm *PerfBufferMonitor) GetAndResetLostCount(perfMap string, cpu int) uint64 {
+	return pbm.collectLostCount(perfMap, cpu, true)
+}
+
+// ResetStats zeroes the counters of all the perf maps and cpus, along with the event size histograms and the
+// turnover peaks. Each counter is reset atomically, so it is safe to call ResetStats while events are being counted.
+func (pbm *PerfBufferMonitor) ResetStats() {
+	pbm.collectLock.Lock()
+	defer pbm.collectLock.Unlock()
+	pbm.turnoverLock.Lock()
+	defer pbm.turnoverLock.Unlock()
+
+	for _, counters := range pbm.counters {
+		counters.collected = newCounterSnapshot(pbm.numCPU, pbm.sizeBuckets)
+		counters.lastRead = newCounterSnapshot(pbm.numCPU, pbm.sizeBuckets)
+		for cpu := range counters.events {
+			for eventType := range counters.events[cpu] {
+				atomic.StoreUint64(&counters.events[cpu][eventType].Count, 0)
+				atomic.StoreUint64(&counters.events[cpu][eventType].Bytes, 0)
+				atomic.StoreUint64(&counters.sampleTicks[cpu][eventType], 0)
+				for bucket := range counters.sizes[cpu][eventType] {
+					atomic.StoreUint64(&counters.sizes[cpu][eventType][bucket], 0)
+				}
+			}
+			atomic.StoreUint64(&counters.lost[cpu], 0)
+			atomic.StoreUint64(&counters.writtenBytes[cpu], 0)
+			counters.peakTurnover[cpu] = 0
+		}
+	}
+}
+
+// sampleTurnovers computes the turnover of the ring buffer of each cpu since the previous sample, and updates the
+// turnover peaks. The turnover is the number of times per second a ring buffer is written in full, i.e. the bytes
+// written per second relative to its capacity. It is a throughput, not the fill level of the ring buffer: the perf
+// reader doesn't expose the positions of the reader and of the writer in the ring buffers. A turnover of 1 means that
+// the reader has to consume a whole ring buffer every second to keep up, it is independent of the sampling period.
+// Nothing is returned on the first sample.
+func (pbm *PerfBufferMonitor) sampleTurnovers(now time.Time) map[string][]float64 {
+	pbm.turnoverLock.Lock()
+	defer pbm.turnoverLock.Unlock()
+
+	var elapsed float64
+	if !pbm.lastTurnoverSample.IsZero() {
+		elapsed = now.Sub(pbm.lastTurnoverSample).Seconds()
+	}
+	pbm.lastTurnoverSample = now
+
+	turnovers := make(map[string][]float64)
+	for perfMap, counters := range pbm.counters {
+		cpuTurnovers := make([]float64, len(counters.writtenBytes))
+		for cpu := range counters.writtenBytes {
+			written := atomic.SwapUint64(&counters.writtenBytes[cpu], 0)
+			if counters.capacity == 0 || elapsed <= 0 {
+				continue
+			}
+			cpuTurnovers[cpu] = float64(written) / elapsed / float64(counters.capacity)
+			if cpuTurnovers[cpu] > counters.peakTurnover[cpu] {
+				counters.peakTurnover[cpu] = cpuTurnovers[cpu]
+			}
+		}
+		if counters.capacity != 0 && elapsed > 0 {
+			turnovers[perfMap] = cpuTurnovers
+		}
+	}
+	return turnovers
+}
+
+// GetPeakTurnover returns the highest turnover sampled on each cpu for the provided perf map, see sampleTurnovers
+func (pbm *PerfBufferMonitor) GetPeakTurnover(perfMap string) []float64 {
+	pbm.turnoverLock.RLock()
+	defer pbm.turnoverLock.RUnlock()
+
+	counters, ok := pbm.counters[perfMap]
+	if !ok {
+		return nil
+	}
+	return append([]float64{}, counters.peakTurnover...)
+}
+
+// GetPerfMapConfigs returns the configuration of the ring buffers of the perf maps, indexed by the name of the perf map
+func (pbm *PerfBufferMonitor) GetPerfMapConfigs() map[string]PerfMapConfig {
+	configs := make(map[string]PerfMapConfig, len(pbm.counters))
+	for perfMap, counters := range pbm.counters {
+		configs[perfMap] = counters.config
+	}
+	return configs
+}
+
+// Collect returns the perf buffer statistics and resets the counters. Each metric is tagged with the name of its
+// perf map, and with its event type when it applies. The metrics of the sampled event types are estimates, they are
+// tagged with estimate:true. The event size histogram is collected as a count of events per bucket, tagged with the
+// upper bound of the bucket. Along with the counts, the per-second rates since the previous collection and the
+// turnovers of the ring buffers are collected as gauges, they are skipped on the first call.
+func (pbm *PerfBufferMonitor) Collect() []Metric {
+	return pbm.collect(time.Now())
+}
+
+func (pbm *PerfBufferMonitor) collect(now time.Time) []Metric {
+	var metrics []Metric
+	receivedEvents := MetricPrefix + ".events.received"
+
+	// the counters are reset each time they are collected, the values are the deltas since the previous call
+	var elapsed float64
+	if !pbm.lastSendStats.IsZero() {
+		elapsed = now.Sub(pbm.lastSendStats).Seconds()
+	}
+	pbm.lastSendStats = now
+
+	for perfMap, cpuTurnovers := range pbm.sampleTurnovers(now) {
+		mapTag := fmt.Sprintf("%s:%s", MapTagKey, perfMap)
+		for cpu, turnover := range cpuTurnovers {
+			tags := []string{mapTag, fmt.Sprintf("%s:%d", CPUTagKey, cpu)}
+			metrics = append(metrics, newGaugeMetric(MetricPrefix+".perf_buffer.turnover", turnover, tags))
+		}
+	}
+
+	// the histogram is aggregated for all the perf maps
+	for i := EventType(1); i < maxEventType; i++ {
+		for bucket, count := range pbm.collectSizeHistogram(i, true) {
+			if count == 0 {
+				continue
+			}
+			tags := []string{fmt.Sprintf("%s:%s", EventTypeTagKey, i), fmt.Sprintf("%s:%s", SizeBucketTagKey, pbm.sizeBucketLabel(bucket))}
+			metrics = append(metrics, newCountMetric(MetricPrefix+".events.size", int64(count), tags))
+		}
+	}
+
+	for perfMap := range pbm.counters {
+		mapTag := fmt.Sprintf("%s:%s", MapTagKey, perfMap)
+
+		lost := pbm.GetAndResetLostCount(perfMap, -1)
+		metrics = append(metrics, newCountMetric(MetricPrefix+".events.lost", int64(lost), []string{mapTag}))
+		if elapsed > 0 {
+			metrics = append(metrics, newGaugeMetric(MetricPrefix+".events.lost_rate", float64(lost)/elapsed, []string{mapTag}))
+		}
+
+		for i := EventType(1); i < maxEventType; i++ {
+			tags := []string{fmt.Sprintf("%s:%s", EventTypeTagKey, i), mapTag}
+			if pbm.IsSampled(i) {
+				tags = append(tags, EstimateTagKey+":true")
+			}
+			if stats := pbm.GetAndResetEventStats(i, perfMap, -1); stats.Count > 0 {
+				metrics = append(metrics, newCountMetric(receivedEvents, int64(stats.Count), tags))
+				if elapsed > 0 {
+					metrics = append(metrics, newGaugeMetric(receivedEvents+"_rate", float64(stats.Count)/elapsed, tags))
+				}
+			}
+		}
+	}
+
+	return metrics
+}
@@ -10,6 +10,7 @@ package probe
 import (
 	"context"
 	"fmt"
+	"io"
 	"runtime"
 	"strings"
 	"sync/atomic"
@@ -70,16 +71,19 @@ type Probe struct {
 	regexCache         *simplelru.LRU
 	flushingDiscarders int64
 	approvers          map[eval.EventType]activeApprovers
-	syscallMonitor     *SyscallMonitor
-	loadController     *LoadController
+	statsdClient       StatsdClient
+	monitor            *Monitor
+	perfMap            *manager.PerfMap
 	kernelVersion      kernel.Version
-	_                  uint32 // padding for goarch=386
-	eventsStats        EventsStats
 	startTime          time.Time
 	event              *Event
 	reOrderer          *ReOrderer
 	ctx                context.Context
 	cancelFnc          context.CancelFunc
+
+	// managerStarted is set once the manager attached the eBPF programs and started
+	// the perf buffer readers, until it's stopped
+	managerStarted int32
 }
 
 // GetResolvers returns the resolvers of Probe
@@ -114,26 +118,59 @@ func (p *Probe) Init() error {
 	p.startTime = time.Now()
 	p.detectKernelVersion()
 
+	asset, err := managerAsset()
+	if err != nil {
+		return err
+	}
+
+	if selectors, exists := probes.SelectorsPerEventType["*"]; exists {
+		p.managerOptions.ActivatedProbes = append(p.managerOptions.ActivatedProbes, selectors...)
+	}
+
+	if p.manager, p.perfMap, err = p.newManager(asset); err != nil {
+		return err
+	}
+
+	if err := p.bindManager(); err != nil {
+		return err
+	}
+
+	p.monitor, err = NewMonitor(p, p.statsdClient)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// managerAsset returns the name of the eBPF asset matching the syscalls of the kernel
+func managerAsset() (string, error) {
 	asset := "runtime-security"
 	openSyscall, err := manager.GetSyscallFnName("open")
 	if err != nil {
-		return err
+		return "", err
 	}
 	if !strings.HasPrefix(openSyscall, "SyS_") && !strings.HasPrefix(openSyscall, "sys_") {
 		asset += "-syscall-wrapper"
 	}
+	return asset, nil
+}
 
+// newManager returns an initialized eBPF manager loaded from the provided asset, along with its events perf map
+func (p *Probe) newManager(asset string) (*manager.Manager, *manager.PerfMap, error) {
 	bytecodeReader, err := bytecode.GetReader(p.config.BPFDir, asset+".o")
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	p.manager = ebpf.NewRuntimeSecurityManager()
+	m := ebpf.NewRuntimeSecurityManager()
 
 	// Set data and lost handlers
-	for _, perfMap := range p.manager.PerfMaps {
+	var eventsPerfMap *manager.PerfMap
+	for _, perfMap := range m.PerfMaps {
 		switch perfMap.Name {
 		case "events":
+			eventsPerfMap = perfMap
 			perfMap.PerfMapOptions = manager.PerfMapOptions{
 				DataHandler: p.reOrderer.HandleEvent,
 				LostHandler: p.handleLostEvents,
@@ -141,14 +178,16 @@ func (p *Probe) Init() error {
 		}
 	}
 
-	if selectors, exists := probes.SelectorsPerEventType["*"]; exists {
-		p.managerOptions.ActivatedProbes = append(p.managerOptions.ActivatedProbes, selectors...)
+	if err := m.InitWithOptions(bytecodeReader, p.managerOptions); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to init manager")
 	}
 
-	if err := p.manager.InitWithOptions(bytecodeReader, p.managerOptions); err != nil {
-		return errors.Wrap(err, "failed to init manager")
-	}
+	return m, eventsPerfMap, nil
+}
 
+// bindManager binds the discarders maps and the resolvers to the maps of the current eBPF manager
+func (p *Probe) bindManager() error {
+	var err error
 	if p.pidDiscarders, err = p.Map("pid_discarders"); err != nil {
 		return err
 	}
@@ -157,18 +196,44 @@ func (p *Probe) Init() error {
 		return err
 	}
 
-	if err := p.resolvers.Start(); err != nil {
+	return p.resolvers.Start()
+}
+
+// ReloadManager replaces the eBPF manager of the probe with a new one loaded from the same asset. The monitor
+// sends the stats of the previous manager before it is stopped, the kernel caches of the new manager are then
+// filled with a new snapshot. The probes of the rule set must be selected again with SelectProbes.
+func (p *Probe) ReloadManager() error {
+	asset, err := managerAsset()
+	if err != nil {
 		return err
 	}
 
-	if p.config.SyscallMonitor {
-		p.syscallMonitor, err = NewSyscallMonitor(p.manager)
-		if err != nil {
-			return err
-		}
+	newManager, perfMap, err := p.newManager(asset)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	if err := p.monitor.OnManagerReload(newManager, p.managerOptions); err != nil {
+		newManager.Stop(manager.CleanAll)
+		return errors.Wrap(err, "failed to rebind the monitor")
+	}
+
+	atomic.StoreInt32(&p.managerStarted, 0)
+	if err := p.manager.Stop(manager.CleanAll); err != nil {
+		log.Errorf("failed to stop the previous eBPF manager: %v", err)
+	}
+
+	p.manager, p.perfMap = newManager, perfMap
+	if err := p.bindManager(); err != nil {
+		return err
+	}
+
+	if err := p.manager.Start(); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&p.managerStarted, 1)
+
+	return p.Snapshot()
 }
 
 // Start the runtime security probe
@@ -178,8 +243,9 @@ func (p *Probe) Start() error {
 	if err := p.manager.Start(); err != nil {
 		return err
 	}
+	atomic.StoreInt32(&p.managerStarted, 1)
 
-	go p.loadController.Start(context.Background())
+	p.monitor.Start(p.ctx)
 
 	return nil
 }
@@ -196,74 +262,38 @@ func (p *Probe) DispatchEvent(event *Event) {
 	}
 }
 
-// SendStats sends statistics about the probe to Datadog
-func (p *Probe) SendStats(statsdClient *statsd.Client) error {
-	if p.syscallMonitor != nil {
-		if err := p.syscallMonitor.SendStats(statsdClient); err != nil {
-			return errors.Wrap(err, "failed to send syscall monitor stats")
-		}
-	}
-
-	if err := statsdClient.Count(MetricPrefix+".events.lost", p.eventsStats.GetAndResetLost(), nil, 1.0); err != nil {
-		return errors.Wrap(err, "failed to send events.lost metric")
-	}
-
-	receivedEvents := MetricPrefix + ".events.received"
-	for i := range p.eventsStats.PerEventType {
-		if i == 0 {
-			continue
-		}
-
-		eventType := EventType(i)
-		tags := []string{fmt.Sprintf("event_type:%s", eventType.String())}
-		if value := p.eventsStats.GetAndResetEventCount(eventType); value > 0 {
-			if err := statsdClient.Count(receivedEvents, value, tags, 1.0); err != nil {
-				return errors.Wrap(err, "failed to send events.received metric")
-			}
-		}
+// SendStats sends the statistics of the probe monitor when its own stats loop is disabled
+func (p *Probe) SendStats() error {
+	if p.monitor == nil || p.config.StatsPollingInterval > 0 {
+		return nil
 	}
-
-	return nil
+	return p.monitor.SendStats()
 }
 
-// GetStats returns Stats according to the system-probe module format
-func (p *Probe) GetStats() (map[string]interface{}, error) {
-	stats := make(map[string]interface{})
-
-	var syscalls *SyscallStats
-	var err error
-
-	if p.syscallMonitor != nil {
-		syscalls, err = p.syscallMonitor.GetStats()
-	}
-
-	stats["events"] = map[string]interface{}{
-		"lost":     p.eventsStats.GetLost(),
-		"syscalls": syscalls,
-	}
-
-	perEventType := make(map[string]int64)
-	stats["per_event_type"] = perEventType
-	for i := range p.eventsStats.PerEventType {
-		if i == 0 {
-			continue
-		}
+// GetMonitor returns the monitor of the probe
+func (p *Probe) GetMonitor() *Monitor {
+	return p.monitor
+}
 
-		eventType := EventType(i)
-		perEventType[eventType.String()] = p.eventsStats.GetEventCount(eventType)
+// GetStats returns Stats according to the system-probe module format, restricted to the provided sections if any
+func (p *Probe) GetStats(sections ...string) (map[string]interface{}, error) {
+	if p.monitor == nil {
+		return nil, errors.New("probe not initialized")
 	}
-
-	return stats, err
+	return p.monitor.GetStats(sections...)
 }
 
-// GetEventsStats returns statistics about the events received by the probe
-func (p *Probe) GetEventsStats() EventsStats {
-	return p.eventsStats
+// DumpDiagnostics writes a human readable report of the state of the monitor of the probe
+func (p *Probe) DumpDiagnostics(w io.Writer) error {
+	if p.monitor == nil {
+		return errors.New("probe not initialized")
+	}
+	return p.monitor.DumpDiagnostics(w)
 }
 
 func (p *Probe) handleLostEvents(CPU int, count uint64, perfMap *manager.PerfMap, manager *manager.Manager) {
 	log.Tracef("lost %d events\n", count)
-	p.eventsStats.CountLost(int64(count))
+	p.monitor.ProcessLostEvent(count, CPU, perfMap)
 }
 
 var eventZero Event
@@ -282,7 +312,7 @@ func (p *Probe) unmarshalProcessContainer(data []byte, event *Event) (int, error
 	return read, nil
 }
 
-func (p *Probe) handleEvent(data []byte) {
+func (p *Probe) handleEvent(CPU int, data []byte) {
 	offset := 0
 	event := p.zeroEvent()
 
@@ -445,8 +475,7 @@ func (p *Probe) handleEvent(data []byte) {
 		log.Tracef("Dispatching event %s\n", prettyEvent)
 	}
 
-	p.eventsStats.CountEventType(eventType, 1)
-	p.loadController.Count(eventType, event.Process.Pid)
+	p.monitor.ProcessEvent(event, uint64(len(data)), CPU, p.perfMap)
 	p.DispatchEvent(event)
 }
 
@@ -676,6 +705,11 @@ func (p *Probe) Snapshot() error {
 func (p *Probe) Close() error {
 	p.cancelFnc()
 
+	if p.monitor != nil {
+		p.monitor.Stop()
+	}
+
+	atomic.StoreInt32(&p.managerStarted, 0)
 	return p.manager.Stop(manager.CleanAll)
 }
 
@@ -728,6 +762,11 @@ func NewProbe(config *config.Config, client *statsd.Client) (*Probe, error) {
 		cancelFnc:         cancel,
 	}
 
+	// avoid storing a typed nil pointer in the StatsdClient interface
+	if client != nil {
+		p.statsdClient = client
+	}
+
 	if !p.config.EnableKernelFilters {
 		log.Warn("Forcing in-kernel filter policy to `pass`: filtering not enabled")
 	}
@@ -744,10 +783,6 @@ func NewProbe(config *config.Config, client *statsd.Client) (*Probe, error) {
 
 	p.resolvers = resolvers
 	p.event = NewEvent(p.resolvers)
-	p.loadController, err = NewLoadController(p, client)
-	if err != nil {
-		return nil, err
-	}
 
 	windowSize := uint64(10 * runtime.NumCPU())
 	if windowSize < 50 {
@@ -344,7 +344,8 @@ func (p *ProcessResolver) Get(pid uint32) *ProcessCacheEntry {
 
 // Start starts the resolver
 func (p *ProcessResolver) Start() error {
-	// initializes the list of snapshot probes
+	// initializes the list of snapshot probes, it is rebuilt when the eBPF manager is reloaded
+	p.snapshotProbes = p.snapshotProbes[:0]
 	for _, id := range snapshotProbeIDs {
 		probe, ok := p.probe.manager.GetProbe(id)
 		if !ok {
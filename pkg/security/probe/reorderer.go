@@ -47,6 +47,7 @@ type reOrdererList struct {
 
 type reOrdererNode struct {
 	timestamp uint64
+	cpu       int
 	data      []byte
 	next      *reOrdererNode
 	prev      *reOrdererNode
@@ -97,10 +98,16 @@ type ReOrdererOpts struct {
 	Rate       time.Duration // delay between two time based iterations
 }
 
+// reOrdererEntry holds the data read from a perf ring buffer along with the cpu it was read from
+type reOrdererEntry struct {
+	cpu  int
+	data []byte
+}
+
 // ReOrderer defines an event re-orderer
 type ReOrderer struct {
-	queue            chan []byte
-	handler          func(data []byte)
+	queue            chan reOrdererEntry
+	handler          func(cpu int, data []byte)
 	list             *reOrdererList
 	pool             *reOrdererNodePool
 	resolveTimestamp func(t uint64) time.Time
@@ -116,7 +123,7 @@ func (r *ReOrderer) Start(ctx context.Context) {
 	dequeue := func(predicate func(node *reOrdererNode) bool) {
 		curr := r.list.head
 		for curr != nil && predicate(curr) {
-			r.handler(curr.data)
+			r.handler(curr.cpu, curr.data)
 			next := curr.next
 
 			r.pool.free(curr)
@@ -135,15 +142,16 @@ func (r *ReOrderer) Start(ctx context.Context) {
 
 	for {
 		select {
-		case data := <-r.queue:
-			tm, err := r.timestampGetter(data)
+		case entry := <-r.queue:
+			tm, err := r.timestampGetter(entry.data)
 			if err != nil {
 				continue
 			}
 
 			node := r.pool.alloc()
 			node.timestamp = tm
-			node.data = data
+			node.cpu = entry.cpu
+			node.data = entry.data
 
 			r.list.append(node)
 
@@ -183,13 +191,13 @@ func (r *ReOrderer) Start(ctx context.Context) {
 
 // HandleEvent handle event form perf ring
 func (r *ReOrderer) HandleEvent(CPU int, data []byte, perfMap *manager.PerfMap, manager *manager.Manager) {
-	r.queue <- data
+	r.queue <- reOrdererEntry{cpu: CPU, data: data}
 }
 
 // NewReOrderer returns a new ReOrderer
-func NewReOrderer(handler func([]byte), tsg func(data []byte) (uint64, error), rts func(t uint64) time.Time, opts ReOrdererOpts) *ReOrderer {
+func NewReOrderer(handler func(int, []byte), tsg func(data []byte) (uint64, error), rts func(t uint64) time.Time, opts ReOrdererOpts) *ReOrderer {
 	return &ReOrderer{
-		queue:            make(chan []byte, opts.QueueSize),
+		queue:            make(chan reOrdererEntry, opts.QueueSize),
 		handler:          handler,
 		list:             &reOrdererList{},
 		pool:             &reOrdererNodePool{},
@@ -11,10 +11,11 @@ import (
 	"C"
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 	"unsafe"
 
-	"github.com/DataDog/datadog-go/statsd"
 	lib "github.com/DataDog/ebpf"
 	"github.com/DataDog/ebpf/manager"
 	"github.com/pkg/errors"
@@ -25,8 +26,11 @@ import (
 )
 
 const (
-	syscallMetric = MetricPrefix + ".syscalls"
-	execMetric    = MetricPrefix + ".exec"
+	syscallMetric           = MetricPrefix + ".syscalls"
+	perProcessSyscallMetric = MetricPrefix + ".syscalls.per_process"
+	execMetric              = MetricPrefix + ".exec"
+	// otherProcesses is the command of the processes reported together by the per process syscall counts
+	otherProcesses = "other"
 )
 
 // ProcessSyscall represents a syscall made by a process
@@ -75,7 +79,7 @@ func (p *ProcessPath) UnmarshalBinary(data []byte) error {
 
 // SyscallStatsCollector is the interface implemented by an object that collect syscall statistics
 type SyscallStatsCollector interface {
-	CountSyscall(process string, syscallID Syscall, count uint64) error
+	CountSyscall(process string, pid uint32, syscallID Syscall, count uint64) error
 	CountExec(process string, count uint64) error
 }
 
@@ -83,7 +87,7 @@ type SyscallStatsCollector interface {
 type SyscallStats map[Syscall]map[string]uint64
 
 // CountSyscall counts the number of calls of a syscall by a process
-func (s *SyscallStats) CountSyscall(process string, syscallID Syscall, count uint64) error {
+func (s *SyscallStats) CountSyscall(process string, pid uint32, syscallID Syscall, count uint64) error {
 	if (*s)[syscallID] == nil {
 		(*s)[syscallID] = make(map[string]uint64)
 	}
@@ -96,29 +100,131 @@ func (s *SyscallStats) CountExec(process string, count uint64) error {
 	return nil
 }
 
-// SyscallStatsdCollector collects syscall statistics and sends them to statsd
-type SyscallStatsdCollector struct {
-	statsdClient *statsd.Client
-}
-
-// CountSyscall counts the number of calls of a syscall by a process
-func (s *SyscallStatsdCollector) CountSyscall(process string, syscallID Syscall, count uint64) error {
+// syscallMetrics returns the metrics of the calls of a syscall by a process. The per-second rate is only returned
+// when elapsed, the duration in seconds covered by the count, is set.
+func syscallMetrics(process string, syscallID Syscall, count uint64, elapsed float64) []Metric {
 	syscall := strings.ToLower(strings.TrimPrefix(syscallID.String(), "Sys"))
 	tags := []string{
-		fmt.Sprintf("process:%s", process),
-		fmt.Sprintf("syscall:%s", syscall),
+		fmt.Sprintf("%s:%s", ProcessTagKey, process),
+		fmt.Sprintf("%s:%s", SyscallTagKey, syscall),
 	}
 
-	return s.statsdClient.Count(syscallMetric, int64(count), tags, 1.0)
+	metrics := []Metric{newCountMetric(syscallMetric, int64(count), tags)}
+	if elapsed > 0 {
+		metrics = append(metrics, newGaugeMetric(syscallMetric+"_rate", float64(count)/elapsed, tags))
+	}
+	return metrics
 }
 
-// CountExec counts the number times a process was executed
-func (s *SyscallStatsdCollector) CountExec(process string, count uint64) error {
+// execMetrics returns the metrics of the executions of a process. The per-second rate is only returned when elapsed,
+// the duration in seconds covered by the count, is set.
+func execMetrics(process string, count uint64, elapsed float64) []Metric {
 	tags := []string{
-		fmt.Sprintf("process:%s", process),
+		fmt.Sprintf("%s:%s", ProcessTagKey, process),
+	}
+
+	metrics := []Metric{newCountMetric(execMetric, int64(count), tags)}
+	if elapsed > 0 {
+		metrics = append(metrics, newGaugeMetric(execMetric+"_rate", float64(count)/elapsed, tags))
+	}
+	return metrics
+}
+
+// processKey identifies a process in the per process syscall counts
+type processKey struct {
+	pid  uint32
+	comm string
+}
+
+// SyscallMetricsCollector collects syscall statistics as metrics
+type SyscallMetricsCollector struct {
+	metrics []Metric
+	// elapsed is the duration in seconds covered by the collected counts, the per-second rates are only collected
+	// when it is set
+	elapsed float64
+	// topN is the number of processes reported by the per process syscall counts, 0 disables them
+	topN int
+	// perProcess holds the syscall count of each process
+	perProcess map[processKey]uint64
+}
+
+// CountSyscall counts the number of calls of a syscall by a process
+func (s *SyscallMetricsCollector) CountSyscall(process string, pid uint32, syscallID Syscall, count uint64) error {
+	s.metrics = append(s.metrics, syscallMetrics(process, syscallID, count, s.elapsed)...)
+	if s.topN > 0 {
+		if s.perProcess == nil {
+			s.perProcess = make(map[processKey]uint64)
+		}
+		s.perProcess[processKey{pid: pid, comm: process}] += count
 	}
+	return nil
+}
+
+// perProcessMetrics returns the syscall counts of the topN processes issuing the most syscalls, tagged with their pid
+// and command. The syscalls of the other processes are counted together, to bound the cardinality of the metrics.
+func (s *SyscallMetricsCollector) perProcessMetrics() []Metric {
+	if s.topN <= 0 || len(s.perProcess) == 0 {
+		return nil
+	}
+
+	processes := make([]processKey, 0, len(s.perProcess))
+	for process := range s.perProcess {
+		processes = append(processes, process)
+	}
+	sort.Slice(processes, func(i, j int) bool {
+		if s.perProcess[processes[i]] != s.perProcess[processes[j]] {
+			return s.perProcess[processes[i]] > s.perProcess[processes[j]]
+		}
+		return processes[i].pid < processes[j].pid
+	})
+
+	var metrics []Metric
+	var other uint64
+	for i, process := range processes {
+		if i >= s.topN {
+			other += s.perProcess[process]
+			continue
+		}
+		tags := []string{
+			fmt.Sprintf("%s:%d", PIDTagKey, process.pid),
+			fmt.Sprintf("%s:%s", CommTagKey, process.comm),
+		}
+		metrics = append(metrics, newCountMetric(perProcessSyscallMetric, int64(s.perProcess[process]), tags))
+	}
+	if other > 0 {
+		tags := []string{fmt.Sprintf("%s:%s", CommTagKey, otherProcesses)}
+		metrics = append(metrics, newCountMetric(perProcessSyscallMetric, int64(other), tags))
+	}
+	return metrics
+}
+
+// CountExec counts the number times a process was executed
+func (s *SyscallMetricsCollector) CountExec(process string, count uint64) error {
+	s.metrics = append(s.metrics, execMetrics(process, count, s.elapsed)...)
+	return nil
+}
+
+const bufferSelectorName = "buffer_selector"
+
+var (
+	syscallBufferNames = [2]string{"noisy_processes_fb", "noisy_processes_bb"}
+	execBufferNames    = [2]string{"exec_count_fb", "exec_count_bb"}
+)
 
-	return s.statsdClient.Count(execMetric, int64(count), tags, 1.0)
+// MapReadError is returned when some of the eBPF maps of a sub-monitor couldn't be read, the statistics of the other
+// maps are still collected
+type MapReadError struct {
+	// Errors holds the read error of each unreadable map, indexed by the name of the map
+	Errors map[string]error
+}
+
+func (e *MapReadError) Error() string {
+	maps := make([]string, 0, len(e.Errors))
+	for name, err := range e.Errors {
+		maps = append(maps, fmt.Sprintf("%s: %v", name, err))
+	}
+	sort.Strings(maps)
+	return fmt.Sprintf("couldn't read %s", strings.Join(maps, ", "))
 }
 
 // SyscallMonitor monitors syscalls using eBPF maps filled using kernel tracepoints
@@ -127,32 +233,91 @@ type SyscallMonitor struct {
 	buffers            [2]*lib.Map
 	execBuffers        [2]*lib.Map
 	activeKernelBuffer uint32
+	// lastSendStats is the time of the previous Collect call, it is used to compute the rate metrics
+	lastSendStats time.Time
+	// perProcessTopN is the number of processes reported by the per process syscall counts, 0 disables them
+	perProcessTopN int
+}
+
+// SetPerProcessTopN makes the syscall monitor report the syscall counts of the n processes issuing the most
+// syscalls, tagged with their pid and command. The syscalls of the other processes are counted together.
+func (sm *SyscallMonitor) SetPerProcessTopN(n int) {
+	sm.perProcessTopN = n
 }
 
-// GetStats returns the syscall statistics
+// GetStats returns the syscall statistics, along with a *MapReadError when only some of the maps could be read
 func (sm *SyscallMonitor) GetStats() (*SyscallStats, error) {
 	stats := make(SyscallStats)
-	if err := sm.CollectStats(&stats); err != nil {
-		return nil, err
+	err := sm.CollectStats(&stats)
+	return &stats, err
+}
+
+// Collect returns the syscall statistics as metrics. Along with the counts, the per-second rates since the previous
+// call are collected as gauges, they are skipped on the first call. The metrics of the readable maps are returned
+// along with a *MapReadError when some of the maps can't be read.
+func (sm *SyscallMonitor) Collect() ([]Metric, error) {
+	now := time.Now()
+	collector := &SyscallMetricsCollector{topN: sm.perProcessTopN}
+	if !sm.lastSendStats.IsZero() {
+		collector.elapsed = now.Sub(sm.lastSendStats).Seconds()
 	}
-	return &stats, nil
+	sm.lastSendStats = now
+	err := sm.CollectStats(collector)
+	return append(collector.metrics, collector.perProcessMetrics()...), err
 }
 
-// SendStats sends the syscall statistics to statsd
-func (sm *SyscallMonitor) SendStats(statsdClient *statsd.Client) error {
-	collector := &SyscallStatsdCollector{statsdClient: statsdClient}
-	return sm.CollectStats(collector)
+// ResetStats drops the syscall statistics collected so far. Both buffers are drained, the active one is swapped
+// with the inactive one in the process.
+func (sm *SyscallMonitor) ResetStats() error {
+	for i := 0; i < len(sm.buffers); i++ {
+		stats := make(SyscallStats)
+		if err := sm.CollectStats(&stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check returns an error if the eBPF maps of the syscall monitor can't be read
+func (sm *SyscallMonitor) Check() error {
+	var activeKernelBuffer uint32
+	if err := sm.bufferSelector.Lookup(ebpf.ZeroUint32MapItem, &activeKernelBuffer); err != nil {
+		return errors.Wrapf(err, "couldn't read %s", sm.bufferSelector.String())
+	}
+	return nil
 }
 
-// CollectStats fetches the syscall statistics from the eBPF maps
+// CollectStats fetches the syscall statistics from the eBPF maps. Each map is read independently, the statistics
+// of the readable maps are collected even if some of the maps can't be read, a *MapReadError lists the others.
 func (sm *SyscallMonitor) CollectStats(collector SyscallStatsCollector) error {
+	inactive := 1 - sm.activeKernelBuffer
+	mapErrors := make(map[string]error)
+
+	if err := sm.collectSyscalls(sm.buffers[inactive], collector); err != nil {
+		mapErrors[syscallBufferNames[inactive]] = err
+	}
+	if err := sm.collectExecs(sm.execBuffers[inactive], collector); err != nil {
+		mapErrors[execBufferNames[inactive]] = err
+	}
+
+	// the buffers are only swapped once the kernel writes to the other one
+	if err := sm.bufferSelector.Put(ebpf.ZeroUint32MapItem, inactive); err != nil {
+		mapErrors[bufferSelectorName] = err
+	} else {
+		sm.activeKernelBuffer = inactive
+	}
+
+	if len(mapErrors) > 0 {
+		return &MapReadError{Errors: mapErrors}
+	}
+	return nil
+}
+
+func (sm *SyscallMonitor) collectSyscalls(buffer *lib.Map, collector SyscallStatsCollector) error {
 	var (
 		value             uint64
 		processSyscall    ProcessSyscall
 		processSyscallRaw []byte
-		processPath       ProcessPath
-		buffer            = sm.buffers[1-sm.activeKernelBuffer]
-		execBuffer        = sm.execBuffers[1-sm.activeKernelBuffer]
 	)
 
 	mapIterator := buffer.Iterate()
@@ -167,15 +332,20 @@ func (sm *SyscallMonitor) CollectStats(collector SyscallStatsCollector) error {
 			}
 		}
 
-		if err := collector.CountSyscall(processSyscall.Process, Syscall(processSyscall.ID), value); err != nil {
+		if err := collector.CountSyscall(processSyscall.Process, processSyscall.Pid, Syscall(processSyscall.ID), value); err != nil {
 			return err
 		}
 	}
-	if mapIterator.Err() != nil {
-		log.Debugf("couldn't iterate over %s: %v", buffer.String(), mapIterator.Err())
-	}
+	return mapIterator.Err()
+}
+
+func (sm *SyscallMonitor) collectExecs(execBuffer *lib.Map, collector SyscallStatsCollector) error {
+	var (
+		value       uint64
+		processPath ProcessPath
+	)
 
-	mapIterator = execBuffer.Iterate()
+	mapIterator := execBuffer.Iterate()
 	for mapIterator.Next(&processPath, &value) {
 		if !processPath.IsEmpty() {
 			if err := execBuffer.Delete(&processPath.PathRaw); err != nil {
@@ -186,25 +356,19 @@ func (sm *SyscallMonitor) CollectStats(collector SyscallStatsCollector) error {
 				return err
 			}
 		}
-
 	}
-	if mapIterator.Err() != nil {
-		log.Debugf("couldn't iterate over %s: %v", execBuffer.String(), mapIterator.Err())
-	}
-
-	sm.activeKernelBuffer = 1 - sm.activeKernelBuffer
-	return sm.bufferSelector.Put(ebpf.ZeroUint32MapItem, sm.activeKernelBuffer)
+	return mapIterator.Err()
 }
 
 // NewSyscallMonitor instantiates a new syscall monitor
 func NewSyscallMonitor(manager *manager.Manager) (*SyscallMonitor, error) {
 	// select eBPF maps
-	bufferSelector, ok, err := manager.GetMap("buffer_selector")
+	bufferSelector, ok, err := manager.GetMap(bufferSelectorName)
 	if err != nil {
 		return nil, err
 	}
 	if !ok {
-		return nil, errors.New("map buffer_selector not found")
+		return nil, errors.Errorf("map %s not found", bufferSelectorName)
 	}
 
 	frontBuffer, ok, err := manager.GetMap("noisy_processes_fb")
@@ -0,0 +1,93 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+// +build linux
+
+package probe
+
+import (
+	"strings"
+)
+
+// thresholdRearmIntervals is the number of consecutive stats intervals a watched metric has to stay at or below
+// its threshold before a new crossing fires the callback again, so that a metric flapping around the threshold
+// doesn't fire it at every interval
+const thresholdRearmIntervals = 3
+
+// thresholdWatch is a threshold watched by WatchThreshold
+type thresholdWatch struct {
+	metric    string
+	threshold float64
+	cb        func(value float64)
+	// crossed is true once the callback fired, until the metric stays below the threshold for thresholdRearmIntervals
+	crossed       bool
+	belowInterval int
+}
+
+// WatchThreshold calls cb when the metric crosses the threshold, e.g. "events.lost_rate" or "perf_buffer.turnover",
+// with or without the runtime_security prefix. The metrics are evaluated each time they are collected by the stats
+// loop or by SendStats, the value of a metric with several series, e.g. one per perf map or cpu, is the maximum
+// of its series. cb is called from the stats loop when the value goes above the threshold, it must return quickly.
+// It is called again only after the value stayed at or below the threshold for a few intervals.
+func (m *Monitor) WatchThreshold(metric string, threshold float64, cb func(value float64)) {
+	if !strings.HasPrefix(metric, MetricPrefix+".") {
+		metric = MetricPrefix + "." + metric
+	}
+
+	m.thresholdsLock.Lock()
+	defer m.thresholdsLock.Unlock()
+	m.thresholdWatches = append(m.thresholdWatches, &thresholdWatch{metric: metric, threshold: threshold, cb: cb})
+}
+
+// hasThresholdWatches returns true if some thresholds are watched
+func (m *Monitor) hasThresholdWatches() bool {
+	m.thresholdsLock.Lock()
+	defer m.thresholdsLock.Unlock()
+	return len(m.thresholdWatches) > 0
+}
+
+// evaluateThresholds updates the watched thresholds with the collected metrics and calls the callbacks of the
+// thresholds crossed, once the lock is released. The watches of the metrics missing from the collection are
+// left unchanged.
+func (m *Monitor) evaluateThresholds(metrics []Metric) {
+	values := make(map[string]float64)
+	for _, metric := range metrics {
+		if value, found := values[metric.Name]; !found || metric.Value > value {
+			values[metric.Name] = metric.Value
+		}
+	}
+
+	type crossing struct {
+		cb    func(value float64)
+		value float64
+	}
+	var crossings []crossing
+
+	m.thresholdsLock.Lock()
+	for _, watch := range m.thresholdWatches {
+		value, found := values[watch.metric]
+		if !found {
+			continue
+		}
+		switch {
+		case value > watch.threshold && !watch.crossed:
+			watch.crossed = true
+			watch.belowInterval = 0
+			crossings = append(crossings, crossing{cb: watch.cb, value: value})
+		case value > watch.threshold:
+			watch.belowInterval = 0
+		case watch.crossed:
+			watch.belowInterval++
+			if watch.belowInterval >= thresholdRearmIntervals {
+				watch.crossed = false
+			}
+		}
+	}
+	m.thresholdsLock.Unlock()
+
+	for _, c := range crossings {
+		c.cb(c.value)
+	}
+}
@@ -0,0 +1,121 @@
+package serverless
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// apiKeyEnvVar is the environment variable read by the default API key provider.
+const apiKeyEnvVar = "DD_API_KEY"
+
+// APIKeyProvider resolves the API key of the extension, e.g. from the environment or from a secrets source
+// only referenced in the environment.
+type APIKeyProvider interface {
+	// Name describes the source of the API key in the logs and the errors.
+	Name() string
+	// APIKey returns the API key, or an empty string and a nil error when the source doesn't set any.
+	APIKey() (string, error)
+}
+
+type funcAPIKeyProvider struct {
+	name    string
+	resolve func() (string, error)
+}
+
+func (p funcAPIKeyProvider) Name() string            { return p.name }
+func (p funcAPIKeyProvider) APIKey() (string, error) { return p.resolve() }
+
+// NewAPIKeyProvider returns an APIKeyProvider named name resolving the API key with resolve, it is the hook
+// to plug the secrets-backed sources, e.g. AWS Secrets Manager or SSM.
+func NewAPIKeyProvider(name string, resolve func() (string, error)) APIKeyProvider {
+	return funcAPIKeyProvider{name: name, resolve: resolve}
+}
+
+// EnvAPIKeyProvider returns the default APIKeyProvider, reading the API key from the DD_API_KEY environment variable.
+func EnvAPIKeyProvider() APIKeyProvider {
+	return NewAPIKeyProvider("environment variable", func() (string, error) {
+		return os.Getenv(apiKeyEnvVar), nil
+	})
+}
+
+type chainAPIKeyProvider []APIKeyProvider
+
+func (c chainAPIKeyProvider) Name() string {
+	names := make([]string, 0, len(c))
+	for _, provider := range c {
+		names = append(names, provider.Name())
+	}
+	return strings.Join(names, ", ")
+}
+
+func (c chainAPIKeyProvider) APIKey() (string, error) {
+	var errs []string
+	for _, provider := range c {
+		apiKey, err := provider.APIKey()
+		if err != nil {
+			log.Errorf("Error while trying to read an API Key from %s: %s", provider.Name(), err)
+			errs = append(errs, fmt.Sprintf("%s: %v", provider.Name(), err))
+			continue
+		}
+		if apiKey != "" {
+			log.Infof("Using the API key set in %s.", provider.Name())
+			return apiKey, nil
+		}
+	}
+	if len(errs) > 0 {
+		return "", fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return "", nil
+}
+
+// ChainAPIKeyProviders returns an APIKeyProvider returning the API key of the first of the providers setting one.
+// The providers failing are logged and skipped, the error lists their errors when no provider sets an API key.
+func ChainAPIKeyProviders(providers ...APIKeyProvider) APIKeyProvider {
+	return chainAPIKeyProvider(providers)
+}
+
+// APIKeyError is returned by RegisterWithAPIKey when the extension is registered but its API key can't be resolved.
+type APIKeyError struct {
+	// Provider is the name of the provider of the API key
+	Provider string
+	// Err is the error of the provider, nil when it doesn't set any API key
+	Err error
+}
+
+func (e *APIKeyError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: can't resolve the API key from %s: %v", e.ErrorEnum(), e.Provider, e.Err)
+	}
+	return fmt.Sprintf("%s: no API key set in %s", e.ErrorEnum(), e.Provider)
+}
+
+// ErrorEnum returns the error to report to the AWS Extension environment.
+func (e *APIKeyError) ErrorEnum() ErrorEnum {
+	return FatalNoAPIKey
+}
+
+// RegisterWithAPIKey registers the extension like Register, then resolves its API key with the provider.
+// When the API key can't be resolved, the ID is returned along with an *APIKeyError: it is not reported
+// to the AWS Extension environment, as the only error reporting available, ReportInitError, stops the
+// function execution, the caller can report e.ErrorEnum() once the errors can be reported without stopping it.
+func RegisterWithAPIKey(extensionName string, provider APIKeyProvider) (ID, string, error) {
+	return registerWithAPIKey(runtimeAPI.register, extensionName, provider)
+}
+
+func registerWithAPIKey(route string, extensionName string, provider APIKeyProvider) (ID, string, error) {
+	id, err := register(route, extensionName)
+	if err != nil {
+		return "", "", err
+	}
+
+	apiKey, err := provider.APIKey()
+	if err != nil || apiKey == "" {
+		health.setAPIKeyResolved(false)
+		return id, "", &APIKeyError{Provider: provider.Name(), Err: err}
+	}
+	health.setAPIKeyResolved(true)
+	return id, apiKey, nil
+}
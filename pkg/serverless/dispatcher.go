@@ -0,0 +1,77 @@
+package serverless
+
+import (
+	"github.com/DataDog/datadog-agent/pkg/dogstatsd"
+	"github.com/DataDog/datadog-agent/pkg/forwarder"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// Types of the events sent by the AWS Extension environment.
+const (
+	invokeEventType   = "INVOKE"
+	shutdownEventType = "SHUTDOWN"
+)
+
+// EventHandler handles an event received from the AWS Extension environment.
+type EventHandler func(payload Payload)
+
+// Dispatcher calls the handlers registered for the type of the events received by WaitForNextInvocation,
+// in the order they were registered. It decouples the invocation loop from what the extension does
+// on each event. It is not thread-safe, the handlers must be registered before waiting for the events.
+type Dispatcher struct {
+	invokeHandlers   []EventHandler
+	shutdownHandlers []EventHandler
+}
+
+// NewDispatcher returns a Dispatcher without handlers.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// NewDefaultDispatcher returns a Dispatcher whose shutdown handler flushes the metrics of the DogStatsD
+// server, if not nil, retrying what the forwarder could not send, and writes into stopCh to stop the
+// main thread of the running program.
+func NewDefaultDispatcher(stopCh chan struct{}, statsdServer *dogstatsd.Server, f *forwarder.SyncForwarder) *Dispatcher {
+	var retrier transactionRetrier
+	if f != nil {
+		retrier = f
+	}
+	d := NewDispatcher()
+	d.OnShutdown(func(payload Payload) {
+		if statsdServer != nil {
+			// flush metrics synchronously, even if DogStatsD has nothing buffered
+			// as the agent is about to stop and other metrics may be aggregated.
+			flushMetricsBeforeShutdown(statsdServer, retrier, payload.deadline()) //nolint:errcheck
+		}
+		// shutdown the serverless agent
+		stopCh <- struct{}{}
+	})
+	return d
+}
+
+// OnInvoke registers a handler called on each INVOKE event.
+func (d *Dispatcher) OnInvoke(handler EventHandler) {
+	d.invokeHandlers = append(d.invokeHandlers, handler)
+}
+
+// OnShutdown registers a handler called on the SHUTDOWN event.
+func (d *Dispatcher) OnShutdown(handler EventHandler) {
+	d.shutdownHandlers = append(d.shutdownHandlers, handler)
+}
+
+// dispatch calls the handlers registered for the type of the event.
+func (d *Dispatcher) dispatch(payload Payload) {
+	var handlers []EventHandler
+	switch payload.EventType {
+	case invokeEventType:
+		handlers = d.invokeHandlers
+	case shutdownEventType:
+		handlers = d.shutdownHandlers
+	default:
+		log.Debugf("No handler for the event type %q", payload.EventType)
+		return
+	}
+	for _, handler := range handlers {
+		handler(payload)
+	}
+}
@@ -0,0 +1,103 @@
+package serverless
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// States of the logs subscription reported by the health route.
+const (
+	logsSubscriptionDisabled int32 = iota
+	logsSubscriptionActive
+	logsSubscriptionInactive
+)
+
+// healthState is the state of the extension reported by the health route, its fields must be accessed atomically.
+type healthState struct {
+	registered     int32
+	apiKeyResolved int32
+	// logsSubscription stays disabled until a logs subscription is attempted
+	logsSubscription int32
+}
+
+// health is populated by Register, RegisterWithAPIKey, SubscribeLogs and the logs subscription supervisor.
+var health healthState
+
+func (s *healthState) setRegistered(registered bool) {
+	atomic.StoreInt32(&s.registered, boolToInt32(registered))
+}
+
+func (s *healthState) setAPIKeyResolved(resolved bool) {
+	atomic.StoreInt32(&s.apiKeyResolved, boolToInt32(resolved))
+}
+
+func (s *healthState) setLogsSubscribed(subscribed bool) {
+	state := logsSubscriptionInactive
+	if subscribed {
+		state = logsSubscriptionActive
+	}
+	atomic.StoreInt32(&s.logsSubscription, state)
+}
+
+// HealthStatus is the body of the health route.
+type HealthStatus struct {
+	Registered     bool `json:"registered"`
+	APIKeyResolved bool `json:"api_key_resolved"`
+	// LogsSubscription is "active", "inactive" when the subscription failed or was dropped,
+	// or "disabled" when the logs are not collected.
+	LogsSubscription string `json:"logs_subscription"`
+	// Ready is true when the extension is registered, its API key is resolved and
+	// its logs subscription, if any, is active.
+	Ready bool `json:"ready"`
+}
+
+func (s *healthState) status() HealthStatus {
+	status := HealthStatus{
+		Registered:     atomic.LoadInt32(&s.registered) == 1,
+		APIKeyResolved: atomic.LoadInt32(&s.apiKeyResolved) == 1,
+	}
+	logsSubscription := atomic.LoadInt32(&s.logsSubscription)
+	switch logsSubscription {
+	case logsSubscriptionActive:
+		status.LogsSubscription = "active"
+	case logsSubscriptionInactive:
+		status.LogsSubscription = "inactive"
+	default:
+		status.LogsSubscription = "disabled"
+	}
+	status.Ready = status.Registered && status.APIKeyResolved && logsSubscription != logsSubscriptionInactive
+	return status
+}
+
+// Health is the route reporting whether the extension is ready, e.g. during local development
+// and canary deploys. Returns 200 when it is ready, 503 otherwise, with the HealthStatus as body.
+type Health struct {
+	state *healthState
+}
+
+// ServeHTTP - see type Health comment.
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Debug("Hit on the serverless.Health route.")
+
+	status := h.state.status()
+	body, err := json.Marshal(status)
+	if err != nil {
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Ready {
+		w.WriteHeader(503)
+	}
+	w.Write(body) //nolint:errcheck
+}
+
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,140 @@
+package serverless
+
+import (
+	"time"
+
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+const (
+	// DefaultLogsResubscribeInterval is the default period at which the logs subscription is re-established.
+	DefaultLogsResubscribeInterval = 5 * time.Minute
+
+	// logsResubscribeBackoff is the delay before retrying a failed re-subscription, it doubles after each
+	// retry up to logsResubscribeMaxBackoff.
+	logsResubscribeBackoff    = time.Second
+	logsResubscribeMaxBackoff = time.Minute
+)
+
+// LogsResubscribeCallback is called each time the logs subscription has been re-established, with the
+// subscription echoed back by the platform and the number of attempts it took.
+type LogsResubscribeCallback func(subscription LogsSubscription, attempts int)
+
+// LogsSubscriptionSupervisor keeps the logs subscription alive: the platform may drop it, e.g. when the log
+// router of the sandbox restarts, and the logs then silently stop flowing to the HTTP endpoint. The supervisor
+// re-issues the subscription periodically and whenever the caller detects a gap in the logs, retrying with a
+// backoff on failure. Re-subscribing with the same destination is idempotent on the platform side.
+type LogsSubscriptionSupervisor struct {
+	route         string
+	id            ID
+	httpAddr      string
+	interval      time.Duration
+	backoff       time.Duration
+	onResubscribe LogsResubscribeCallback
+
+	// resubscribeCh coalesces the re-subscriptions requested while one is in progress
+	resubscribeCh chan struct{}
+	stopCh        chan struct{}
+	doneCh        chan struct{}
+}
+
+// NewLogsSubscriptionSupervisor returns a supervisor of the logs subscription to httpAddr, see SubscribeLogs.
+// The subscription is re-established every interval, 0 disables the periodic re-subscription.
+// onResubscribe, if not nil, is called each time the subscription has been re-established.
+func NewLogsSubscriptionSupervisor(id ID, httpAddr string, interval time.Duration, onResubscribe LogsResubscribeCallback) *LogsSubscriptionSupervisor {
+	return newLogsSubscriptionSupervisor(runtimeAPI.subscribeLogs, id, httpAddr, interval, onResubscribe)
+}
+
+func newLogsSubscriptionSupervisor(route string, id ID, httpAddr string, interval time.Duration, onResubscribe LogsResubscribeCallback) *LogsSubscriptionSupervisor {
+	return &LogsSubscriptionSupervisor{
+		route:         route,
+		id:            id,
+		httpAddr:      httpAddr,
+		interval:      interval,
+		backoff:       logsResubscribeBackoff,
+		onResubscribe: onResubscribe,
+		resubscribeCh: make(chan struct{}, 1),
+		stopCh:        make(chan struct{}),
+		doneCh:        make(chan struct{}),
+	}
+}
+
+// Start subscribes to the logs and starts supervising the subscription. The first subscription is
+// synchronous so that its error can be reported as an init error, nothing is supervised when it fails.
+func (s *LogsSubscriptionSupervisor) Start() (LogsSubscription, error) {
+	subscription, err := subscribeLogs(s.route, s.id, s.httpAddr)
+	health.setLogsSubscribed(err == nil)
+	if err != nil {
+		close(s.doneCh)
+		return subscription, err
+	}
+	go s.run()
+	return subscription, nil
+}
+
+// Resubscribe requests the subscription to be re-established as soon as possible, e.g. when no logs have
+// been received for a while. It doesn't block, the requests made during a re-subscription are merged.
+func (s *LogsSubscriptionSupervisor) Resubscribe() {
+	select {
+	case s.resubscribeCh <- struct{}{}:
+	default:
+	}
+}
+
+// Stop stops the supervision and waits for the re-subscription in progress, if any, to be abandoned.
+func (s *LogsSubscriptionSupervisor) Stop() {
+	select {
+	case <-s.stopCh:
+	default:
+		close(s.stopCh)
+	}
+	<-s.doneCh
+}
+
+func (s *LogsSubscriptionSupervisor) run() {
+	defer close(s.doneCh)
+
+	var tick <-chan time.Time
+	if s.interval > 0 {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-tick:
+		case <-s.resubscribeCh:
+		case <-s.stopCh:
+			return
+		}
+		s.resubscribe()
+	}
+}
+
+// resubscribe re-issues the subscription until it succeeds or the supervisor is stopped.
+func (s *LogsSubscriptionSupervisor) resubscribe() {
+	backoff := s.backoff
+	for attempt := 1; ; attempt++ {
+		subscription, err := subscribeLogs(s.route, s.id, s.httpAddr)
+		// the logs are reported inactive until the subscription is re-established
+		health.setLogsSubscribed(err == nil)
+		if err == nil {
+			log.Debugf("Re-subscribed to the logs after %d attempt(s)", attempt)
+			if s.onResubscribe != nil {
+				s.onResubscribe(subscription, attempt)
+			}
+			return
+		}
+		log.Warnf("Could not re-subscribe to the logs (attempt %d), retrying in %s: %v", attempt, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-s.stopCh:
+			return
+		}
+		if backoff *= 2; backoff > logsResubscribeMaxBackoff {
+			backoff = logsResubscribeMaxBackoff
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"github.com/DataDog/datadog-agent/pkg/dogstatsd"
+	"github.com/DataDog/datadog-agent/pkg/forwarder"
 	"github.com/DataDog/datadog-agent/pkg/util/log"
 )
 
@@ -12,7 +13,8 @@ import (
 // The name "daemon" is just in order to avoid serverless.StartServer ...
 type Daemon struct {
 	httpServer   *http.Server
-	statsdServer *dogstatsd.Server
+	statsdServer metricsFlusher
+	forwarder    transactionRetrier
 	stopCh       chan struct{}
 	// Wait on this WaitGroup in controllers to be sure that the Daemon is ready.
 	// (i.e. that the DogStatsD server is properly instanciated)
@@ -21,7 +23,17 @@ type Daemon struct {
 
 // SetStatsdServer sets the DogStatsD server instance running when it is ready.
 func (d *Daemon) SetStatsdServer(statsdServer *dogstatsd.Server) {
-	d.statsdServer = statsdServer
+	if statsdServer != nil {
+		d.statsdServer = statsdServer
+	}
+}
+
+// SetForwarder sets the forwarder sending the metrics of the DogStatsD server, for the
+// flushes to send again what it could not send.
+func (d *Daemon) SetForwarder(f *forwarder.SyncForwarder) {
+	if f != nil {
+		d.forwarder = f
+	}
 }
 
 // StartDaemon starts an HTTP server to receive messages from the runtime.
@@ -42,6 +54,7 @@ func StartDaemon(stopCh chan struct{}) *Daemon {
 
 	mux.Handle("/lambda/hello", &Hello{daemon})
 	mux.Handle("/lambda/flush", &Flush{daemon})
+	mux.Handle("/health", &Health{&health})
 
 	// this wait group will be blocking until the DogStatsD server has been instanciated
 	daemon.ReadyWg.Add(1)
@@ -89,5 +102,5 @@ func (f *Flush) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// synchronous flush
-	f.daemon.statsdServer.Flush(true)
+	flushMetrics(f.daemon.statsdServer, f.daemon.forwarder)
 }
@@ -5,18 +5,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/DataDog/datadog-agent/pkg/dogstatsd"
+	"github.com/DataDog/datadog-agent/pkg/util/log"
 )
 
 const (
-	name = "datadog-agent"
+	// ExtensionName is the name used by default to register the extension
+	// in the AWS Extension environment.
+	ExtensionName = "datadog-agent"
 
-	routeRegister  string = "http://localhost:9001/2020-01-01/extension/register"
-	routeEventNext string = "http://localhost:9001/2020-01-01/extension/event/next"
-	routeInitError string = "http://localhost:9001/2020-01-01/extension/init/error"
+	// defaultRuntimeAPIBaseURL is the base URL of the runtime API of the AWS Extension environment.
+	defaultRuntimeAPIBaseURL = "http://localhost:9001"
+
+	// DefaultConnectTimeout is the default timeout to connect to the AWS Extension environment.
+	DefaultConnectTimeout = 2 * time.Second
+	// DefaultRequestTimeout is the default timeout of the requests to the AWS Extension environment,
+	// except the long-poll waiting for the next invocation.
+	DefaultRequestTimeout = 5 * time.Second
 
 	// FatalNoAPIKey is the error reported to the AWS Extension environment when
 	// no API key has been set. Unused until we can report error
@@ -30,8 +41,107 @@ const (
 	// bad endpoints have been configured. Unused until we can report error
 	// without stopping the extension.
 	FatalBadEndpoint ErrorEnum = "Fatal.BadEndpoint"
+
+	// shutdownFlushBackoff is the delay before sending again the metrics the forwarder could not
+	// send at shutdown, it doubles after each retry.
+	shutdownFlushBackoff = 100 * time.Millisecond
+	// shutdownFlushMargin is the part of the shutdown deadline kept to stop the extension after the
+	// last flush, no send is retried within it.
+	shutdownFlushMargin = 200 * time.Millisecond
+)
+
+// invocationCount and shutdownCount are the numbers of INVOKE and SHUTDOWN events
+// received since the start, they must be accessed atomically.
+var (
+	invocationCount uint64
+	shutdownCount   uint64
 )
 
+// InvocationCount returns the number of INVOKE events received since the start.
+func InvocationCount() uint64 {
+	return atomic.LoadUint64(&invocationCount)
+}
+
+// ShutdownCount returns the number of SHUTDOWN events received since the start.
+func ShutdownCount() uint64 {
+	return atomic.LoadUint64(&shutdownCount)
+}
+
+// runtimeAPI holds the routes called by the exported functions, tests point it to a local server.
+var runtimeAPI = newRoutes(defaultRuntimeAPIBaseURL)
+
+// routes are the routes of the AWS Extension environment, derived from the base URL of its runtime API.
+type routes struct {
+	register      string
+	eventNext     string
+	initError     string
+	subscribeLogs string
+}
+
+func newRoutes(baseURL string) routes {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return routes{
+		register:      baseURL + "/2020-01-01/extension/register",
+		eventNext:     baseURL + "/2020-01-01/extension/event/next",
+		initError:     baseURL + "/2020-01-01/extension/init/error",
+		subscribeLogs: baseURL + "/2020-08-15/logs",
+	}
+}
+
+// clients are the HTTP clients used to call the AWS Extension environment.
+var clients = newHTTPClients(DefaultConnectTimeout, DefaultRequestTimeout)
+
+// httpClients are the HTTP clients used to call the AWS Extension environment,
+// they share a transport bounding the time to connect.
+type httpClients struct {
+	// client is used for the requests bounded by the request timeout.
+	client *http.Client
+	// longPollClient is used to wait for the next invocation, its requests
+	// never time out once connected.
+	longPollClient *http.Client
+}
+
+func newHTTPClients(connectTimeout, requestTimeout time.Duration) httpClients {
+	transport := &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:       10,
+		IdleConnTimeout:    5 * time.Second,
+		DisableCompression: true,
+	}
+	return httpClients{
+		client:         &http.Client{Transport: transport, Timeout: requestTimeout},
+		longPollClient: &http.Client{Transport: transport, Timeout: 0},
+	}
+}
+
+// SetHTTPTimeouts sets the timeouts of the calls to the AWS Extension environment.
+// connectTimeout bounds the connection to the runtime API of every call, including the
+// long-poll waiting for the next invocation, so that a dead runtime API surfaces quickly.
+// requestTimeout bounds the whole request of every call but the long-poll.
+// It is not thread-safe and must be called before Register.
+func SetHTTPTimeouts(connectTimeout, requestTimeout time.Duration) {
+	clients = newHTTPClients(connectTimeout, requestTimeout)
+}
+
+// metricsFlusher is the part of the DogStatsD server used to flush the metrics.
+type metricsFlusher interface {
+	BufferedCount() uint64
+	Flush(waitForSerializer bool)
+}
+
+// transactionRetrier is the part of the SyncForwarder keeping the transactions it could not send.
+type transactionRetrier interface {
+	PendingTransactions() int
+	RetryTransactions() error
+}
+
+// InvocationWaitCallback is called with the duration WaitForNextInvocation
+// has been blocked waiting for the next event.
+type InvocationWaitCallback func(waited time.Duration)
+
 // ID is the extension ID within the AWS Extension environment.
 type ID string
 
@@ -46,12 +156,51 @@ type Payload struct {
 	//    RequestId string `json:"requestId"` // unused
 }
 
+// deadline returns the time by which the event must be handled, the zero time when the payload has none.
+func (p Payload) deadline() time.Time {
+	if p.DeadlineMs <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, p.DeadlineMs*int64(time.Millisecond))
+}
+
+// LogsSubscription is the configuration of the logs subscription echoed back by the
+// platform, its fields are left empty when the platform doesn't return them.
+type LogsSubscription struct {
+	SchemaVersion string          `json:"schemaVersion"`
+	Types         []string        `json:"types"`
+	Buffering     *LogsBuffering  `json:"buffering"`
+	Destination   *LogDestination `json:"destination"`
+}
+
+// LogsBuffering is the buffering configuration of a logs subscription.
+type LogsBuffering struct {
+	MaxItems  int `json:"maxItems"`
+	MaxBytes  int `json:"maxBytes"`
+	TimeoutMs int `json:"timeoutMs"`
+}
+
+// LogDestination is where the platform sends the logs of a logs subscription.
+type LogDestination struct {
+	URI      string `json:"URI"`
+	Protocol string `json:"protocol"`
+}
+
 // Register registers the serverless daemon and subscribe to INVOKE and SHUTDOWN messages.
+// The extension is registered under the given name, ExtensionName is used if it is empty.
 // Returns either (the serverless ID assigned by the serverless daemon + the api key as read from
 // the environment) or an error.
-func Register() (ID, error) {
+func Register(extensionName string) (ID, error) {
+	return register(runtimeAPI.register, extensionName)
+}
+
+func register(url string, extensionName string) (ID, error) {
 	var err error
 
+	if len(extensionName) == 0 {
+		extensionName = ExtensionName
+	}
+
 	// create the POST register request
 	// we will want to add here every configuration field that the serverless
 	// agent supports.
@@ -62,14 +211,13 @@ func Register() (ID, error) {
 	var request *http.Request
 	var response *http.Response
 
-	if request, err = http.NewRequest("POST", routeRegister, payload); err != nil {
+	if request, err = http.NewRequest("POST", url, payload); err != nil {
 		return "", fmt.Errorf("Register: can't create the POST register request: %v", err)
 	}
-	request.Header.Set("Lambda-Extension-Name", name)
+	request.Header.Set("Lambda-Extension-Name", extensionName)
 
 	// call the service to register and retrieve the given Id
-	client := &http.Client{Timeout: 5 * time.Second}
-	if response, err = client.Do(request); err != nil {
+	if response, err = clients.client.Do(request); err != nil {
 		return "", fmt.Errorf("Register: error while POST register route: %v", err)
 	}
 
@@ -83,7 +231,7 @@ func Register() (ID, error) {
 	defer response.Body.Close()
 
 	if response.StatusCode != 200 {
-		return "", fmt.Errorf("Register: didn't receive an HTTP 200: %v -- Response body content: %v", response.StatusCode, string(body))
+		return "", fmt.Errorf("Register: didn't receive an HTTP 200: %v -- Response body content: %v", response.StatusCode, redactSensitive(string(body)))
 	}
 
 	// read the ID
@@ -91,14 +239,19 @@ func Register() (ID, error) {
 
 	id := response.Header.Get("Lambda-Extension-Identifier")
 	if len(id) == 0 {
-		return "", fmt.Errorf("Register: didn't receive an identifier -- Response body content: %v", string(body))
+		return "", fmt.Errorf("Register: didn't receive an identifier -- Response body content: %v", redactSensitive(string(body)))
 	}
 
+	health.setRegistered(true)
 	return ID(id), nil
 }
 
 // ReportInitError reports an init error to the environment.
 func ReportInitError(id ID, errorEnum ErrorEnum) error {
+	return reportInitError(runtimeAPI.initError, id, errorEnum)
+}
+
+func reportInitError(route string, id ID, errorEnum ErrorEnum) error {
 	var err error
 	var content []byte
 	var request *http.Request
@@ -110,22 +263,17 @@ func ReportInitError(id ID, errorEnum ErrorEnum) error {
 		return fmt.Errorf("ReportInitError: can't write the payload: %s", err)
 	}
 
-	if request, err = http.NewRequest("POST", routeInitError, bytes.NewBuffer(content)); err != nil {
+	if request, err = http.NewRequest("POST", route, bytes.NewBuffer(content)); err != nil {
 		return fmt.Errorf("ReportInitError: can't create the POST request: %s", err)
 	}
 
 	request.Header.Set("Lambda-Extension-Identifier", string(id))
 	request.Header.Set("Lambda-Extension-Function-Error-Type", "Fatal.ConnectFailed")
 
-	tr := &http.Transport{
-		MaxIdleConns:       10,
-		IdleConnTimeout:    5 * time.Second,
-		DisableCompression: true,
-	}
-	client := &http.Client{Transport: tr, Timeout: 5 * time.Second}
-	if response, err = client.Do(request); err != nil {
+	if response, err = clients.client.Do(request); err != nil {
 		return fmt.Errorf("ReportInitError: while POST init error route: %s", err)
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode >= 300 {
 		return fmt.Errorf("ReportInitError: received an HTTP %s", response.Status)
@@ -134,10 +282,130 @@ func ReportInitError(id ID, errorEnum ErrorEnum) error {
 	return nil
 }
 
-// WaitForNextInvocation starts waiting and blocking until it receives a request.
+// SubscribeLogs subscribes to the logs collection on the platform.
+// We send a request to AWS to subscribe for logs, indicating on which address
+// an HTTP server is listening to receive the platform and function logs.
+// httpAddr must be an http URL that the AWS Lambda platform can reach from the sandbox,
+// e.g. http://sandbox:8080.
+// Returns the subscription echoed back by the platform so that callers can check which
+// configuration it accepted, its fields are empty if the platform didn't return any.
+func SubscribeLogs(id ID, httpAddr string) (LogsSubscription, error) {
+	subscription, err := subscribeLogs(runtimeAPI.subscribeLogs, id, httpAddr)
+	health.setLogsSubscribed(err == nil)
+	return subscription, err
+}
+
+func subscribeLogs(route string, id ID, httpAddr string) (LogsSubscription, error) {
+	var err error
+	var subscription LogsSubscription
+
+	if err = validateLogsHTTPAddr(httpAddr); err != nil {
+		return subscription, fmt.Errorf("SubscribeLogs: invalid address %q: %v", httpAddr, err)
+	}
+
+	var content []byte
+	if content, err = json.Marshal(map[string]interface{}{
+		"destination": map[string]string{
+			"URI":      httpAddr,
+			"protocol": "HTTP",
+		},
+		"types": []string{"platform", "function"},
+	}); err != nil {
+		return subscription, fmt.Errorf("SubscribeLogs: can't marshal subscribe JSON: %v", err)
+	}
+
+	var request *http.Request
+	var response *http.Response
+
+	if request, err = http.NewRequest("PUT", route, bytes.NewBuffer(content)); err != nil {
+		return subscription, fmt.Errorf("SubscribeLogs: can't create the PUT request: %v", err)
+	}
+	request.Header.Set("Lambda-Extension-Identifier", string(id))
+	request.Header.Set("Content-Type", "application/json")
+
+	if response, err = clients.client.Do(request); err != nil {
+		return subscription, fmt.Errorf("SubscribeLogs: while PUT subscribe request: %v", err)
+	}
+	defer response.Body.Close()
+
+	var body []byte
+	if body, err = ioutil.ReadAll(response.Body); err != nil {
+		return subscription, fmt.Errorf("SubscribeLogs: can't read the body: %v", err)
+	}
+
+	if response.StatusCode >= 300 {
+		return subscription, fmt.Errorf("SubscribeLogs: received an HTTP %s -- Response body content: %v", response.Status, redactSensitive(string(body)))
+	}
+
+	// the platform may only answer "OK", the subscription is left empty in this case
+	if err = json.Unmarshal(body, &subscription); err != nil {
+		log.Debugf("SubscribeLogs: no subscription in the response body: %v", err)
+		subscription = LogsSubscription{}
+	}
+
+	return subscription, nil
+}
+
+// redactSensitive scrubs the credentials from s with the rules used for the agent
+// logs, it must be used before adding the responses of the AWS Extension environment
+// to errors as they are logged.
+func redactSensitive(s string) string {
+	cleaned, err := log.CredentialsCleanerBytes([]byte(s))
+	if err != nil {
+		return "<unable to scrub the content>"
+	}
+	return string(cleaned)
+}
+
+// validateLogsHTTPAddr checks that the address can be used by the AWS Lambda
+// platform to send the logs, which otherwise rejects it without details.
+func validateLogsHTTPAddr(httpAddr string) error {
+	if len(httpAddr) == 0 {
+		return fmt.Errorf("empty address")
+	}
+
+	u, err := url.Parse(httpAddr)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" {
+		return fmt.Errorf("the scheme must be http, e.g. http://sandbox:8080")
+	}
+	if len(u.Host) == 0 {
+		return fmt.Errorf("missing host")
+	}
+	if strings.Count(u.Host, ":") > 1 && !strings.HasPrefix(u.Host, "[") {
+		return fmt.Errorf("IPv6 addresses must be enclosed in brackets, e.g. http://[fd00::1]:8080")
+	}
+
+	host := u.Hostname()
+	if len(host) == 0 {
+		return fmt.Errorf("missing host")
+	}
+	if strings.EqualFold(host, "localhost") {
+		return fmt.Errorf("localhost can't be reached by the platform, use sandbox instead")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.IsLoopback() {
+			return fmt.Errorf("loopback addresses can't be reached by the platform, use sandbox instead")
+		}
+		if ip.IsUnspecified() {
+			return fmt.Errorf("unspecified addresses can't be reached by the platform, use sandbox instead")
+		}
+	}
+	return nil
+}
+
+// WaitForNextInvocation starts waiting and blocking until it receives a request, then calls the
+// handlers registered in the dispatcher for the type of the event.
 // Note that for now, we only subscribe to INVOKE and SHUTDOWN messages.
-// Write into stopCh to stop the main thread of the running program.
-func WaitForNextInvocation(stopCh chan struct{}, statsdServer *dogstatsd.Server, id ID) error {
+// Use NewDefaultDispatcher to stop the main thread of the running program on SHUTDOWN.
+// onWait, if not nil, is called with the duration of the blocking call once an event is received.
+func WaitForNextInvocation(dispatcher *Dispatcher, id ID, onWait InvocationWaitCallback) error {
+	return waitForNextInvocation(runtimeAPI.eventNext, dispatcher, id, onWait)
+}
+
+func waitForNextInvocation(route string, dispatcher *Dispatcher, id ID, onWait InvocationWaitCallback) error {
 	var err error
 
 	// do the blocking HTTP GET call
@@ -145,16 +413,19 @@ func WaitForNextInvocation(stopCh chan struct{}, statsdServer *dogstatsd.Server,
 	var request *http.Request
 	var response *http.Response
 
-	if request, err = http.NewRequest("GET", routeEventNext, nil); err != nil {
+	if request, err = http.NewRequest("GET", route, nil); err != nil {
 		return fmt.Errorf("WaitForNextInvocation: can't create the GET request: %v", err)
 	}
 	request.Header.Set("Lambda-Extension-Identifier", string(id))
 
-	// the blocking call is here
-	client := &http.Client{Timeout: 0} // this one should never timeout
-	if response, err = client.Do(request); err != nil {
+	// the blocking call is here, it never times out once connected
+	waitStart := time.Now()
+	if response, err = clients.longPollClient.Do(request); err != nil {
 		return fmt.Errorf("WaitForNextInvocation: while GET next route: %v", err)
 	}
+	if onWait != nil {
+		onWait(time.Since(waitStart))
+	}
 
 	// we received a response, meaning we've been invoked
 
@@ -169,14 +440,60 @@ func WaitForNextInvocation(stopCh chan struct{}, statsdServer *dogstatsd.Server,
 		return fmt.Errorf("WaitForNextInvocation: can't unmarshal the payload: %v", err)
 	}
 
-	if payload.EventType == "SHUTDOWN" {
-		if statsdServer != nil {
-			// flush metrics synchronously
-			statsdServer.Flush(true)
+	switch payload.EventType {
+	case invokeEventType:
+		atomic.AddUint64(&invocationCount, 1)
+	case shutdownEventType:
+		atomic.AddUint64(&shutdownCount, 1)
+	}
+	dispatcher.dispatch(payload)
+
+	return nil
+}
+
+// flushMetrics synchronously flushes the metrics buffered by the DogStatsD server.
+// The flush is skipped when no metrics have been received since the last one and the forwarder,
+// if not nil, has no transactions left from a failed send, to not add the latency of pointless
+// network calls to idle invocations. The pending transactions are sent again by the forwarder
+// before the ones of the flush, or on their own when nothing is buffered.
+// Returns whether the metrics have been flushed.
+func flushMetrics(statsdServer metricsFlusher, forwarder transactionRetrier) bool {
+	pending := forwarder != nil && forwarder.PendingTransactions() > 0
+	if statsdServer.BufferedCount() == 0 {
+		if !pending {
+			log.Debug("No metrics buffered or pending, skipping the flush")
+			return false
+		}
+		if err := forwarder.RetryTransactions(); err != nil {
+			log.Warnf("Could not send the pending metrics, they will be sent by the next flush: %v", err)
 		}
-		// shutdown the serverless agent
-		stopCh <- struct{}{}
+		return true
 	}
+	statsdServer.Flush(true)
+	return true
+}
 
+// flushMetricsBeforeShutdown synchronously flushes the metrics before the extension stops. The transactions
+// the forwarder, if not nil, could not send, e.g. when the intake is briefly unreachable, are sent again with
+// a backoff as long as the retry can start before the shutdown deadline minus shutdownFlushMargin, they are
+// not retried when there is no deadline.
+// Returns an error when some metrics could not be sent.
+func flushMetricsBeforeShutdown(statsdServer metricsFlusher, forwarder transactionRetrier, deadline time.Time) error {
+	statsdServer.Flush(true)
+	if forwarder == nil {
+		return nil
+	}
+	backoff := shutdownFlushBackoff
+	for attempt := 1; forwarder.PendingTransactions() > 0; attempt++ {
+		if deadline.IsZero() || time.Until(deadline)-shutdownFlushMargin < backoff {
+			err := fmt.Errorf("%d transaction(s) could not be sent after %d attempt(s)", forwarder.PendingTransactions(), attempt)
+			log.Errorf("Could not flush the metrics before shutdown, they are lost: %v", err)
+			return err
+		}
+		log.Warnf("Could not flush the metrics before shutdown (attempt %d), retrying in %s", attempt, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		forwarder.RetryTransactions() //nolint:errcheck
+	}
 	return nil
 }
@@ -0,0 +1,614 @@
+package serverless
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DataDog/datadog-agent/pkg/forwarder"
+	"github.com/DataDog/datadog-agent/pkg/metrics"
+	"github.com/DataDog/datadog-agent/pkg/serializer"
+)
+
+func TestRegisterExtensionName(t *testing.T) {
+	var extensionName string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		extensionName = r.Header.Get("Lambda-Extension-Name")
+		w.Header().Set("Lambda-Extension-Identifier", "test-id")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	id, err := register(ts.URL, "custom-extension")
+	assert.Nil(t, err)
+	assert.Equal(t, ID("test-id"), id)
+	assert.Equal(t, "custom-extension", extensionName)
+
+	_, err = register(ts.URL, "")
+	assert.Nil(t, err)
+	assert.Equal(t, ExtensionName, extensionName)
+}
+
+type mockFlusher struct {
+	bufferedCount uint64
+	flushes       int
+}
+
+func (m *mockFlusher) BufferedCount() uint64 {
+	return m.bufferedCount
+}
+
+func (m *mockFlusher) Flush(waitForSerializer bool) {
+	m.flushes++
+	m.bufferedCount = 0
+}
+
+// serializerFlusher flushes a serie through a real serializer and SyncForwarder.
+type serializerFlusher struct {
+	mockFlusher
+	serializer *serializer.Serializer
+}
+
+func (s *serializerFlusher) Flush(waitForSerializer bool) {
+	s.mockFlusher.Flush(waitForSerializer)
+	s.serializer.SendSeries(metrics.Series{{ //nolint:errcheck
+		Name:   "test.metric",
+		Points: []metrics.Point{{Ts: 1, Value: 1}},
+		MType:  metrics.APIGaugeType,
+	}})
+}
+
+// newIntake returns an intake failing its first failures requests, and the number of requests it received.
+func newIntake(failures int64) (*httptest.Server, *int64) {
+	var requests int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&requests, 1) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	return ts, &requests
+}
+
+func newSerializerFlusher(intakeURL string) (*serializerFlusher, *forwarder.SyncForwarder) {
+	f := forwarder.NewSyncForwarder(map[string][]string{intakeURL: {"api_key"}}, 5*time.Second)
+	return &serializerFlusher{serializer: serializer.NewSerializer(f)}, f
+}
+
+func TestFlushMetricsBeforeShutdownRetries(t *testing.T) {
+	ts, requests := newIntake(1)
+	defer ts.Close()
+	flusher, f := newSerializerFlusher(ts.URL)
+
+	assert.Nil(t, flushMetricsBeforeShutdown(flusher, f, time.Now().Add(5*time.Second)))
+	assert.Equal(t, 1, flusher.flushes)
+	assert.Equal(t, int64(2), atomic.LoadInt64(requests))
+	assert.Equal(t, 0, f.PendingTransactions())
+}
+
+func TestFlushMetricsBeforeShutdownGivesUpBeforeDeadline(t *testing.T) {
+	ts, requests := newIntake(math.MaxInt64)
+	defer ts.Close()
+
+	// without deadline the metrics are sent once
+	flusher, f := newSerializerFlusher(ts.URL)
+	assert.NotNil(t, flushMetricsBeforeShutdown(flusher, f, time.Time{}))
+	assert.Equal(t, int64(1), atomic.LoadInt64(requests))
+
+	// the deadline is too close to retry
+	flusher, f = newSerializerFlusher(ts.URL)
+	assert.NotNil(t, flushMetricsBeforeShutdown(flusher, f, time.Now().Add(shutdownFlushMargin)))
+	assert.Equal(t, int64(2), atomic.LoadInt64(requests))
+	assert.Equal(t, 1, f.PendingTransactions())
+}
+
+func TestPayloadDeadline(t *testing.T) {
+	assert.True(t, Payload{}.deadline().IsZero())
+	assert.Equal(t, int64(1500), Payload{DeadlineMs: 1500}.deadline().UnixNano()/int64(time.Millisecond))
+}
+
+func TestFlushSkippedWithoutBufferedMetrics(t *testing.T) {
+	flusher := &mockFlusher{}
+	daemon := &Daemon{statsdServer: flusher, ReadyWg: &sync.WaitGroup{}}
+	route := &Flush{daemon}
+
+	route.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/lambda/flush", nil))
+	assert.Equal(t, 0, flusher.flushes)
+
+	flusher.bufferedCount = 3
+	route.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/lambda/flush", nil))
+	assert.Equal(t, 1, flusher.flushes)
+	assert.Equal(t, uint64(0), flusher.bufferedCount)
+}
+
+func TestFlushRetriedWithPendingTransactions(t *testing.T) {
+	ts, requests := newIntake(1)
+	defer ts.Close()
+	flusher, f := newSerializerFlusher(ts.URL)
+
+	flusher.bufferedCount = 3
+	assert.True(t, flushMetrics(flusher, f))
+	assert.Equal(t, 1, f.PendingTransactions())
+
+	// nothing has been received since, the pending transaction is sent anyway
+	assert.True(t, flushMetrics(flusher, f))
+	assert.Equal(t, 1, flusher.flushes)
+	assert.Equal(t, int64(2), atomic.LoadInt64(requests))
+	assert.Equal(t, 0, f.PendingTransactions())
+
+	assert.False(t, flushMetrics(flusher, f))
+	assert.Equal(t, int64(2), atomic.LoadInt64(requests))
+}
+
+func TestValidateLogsHTTPAddr(t *testing.T) {
+	for _, addr := range []string{
+		"http://sandbox:8080",
+		"http://sandbox.localdomain:8080",
+		"http://169.254.79.130:8080",
+		"http://[fd00::1]:8080",
+	} {
+		assert.Nil(t, validateLogsHTTPAddr(addr), addr)
+	}
+
+	for _, addr := range []string{
+		"",
+		"sandbox:8080",
+		"https://sandbox:8080",
+		"http://:8080",
+		"http://fd00::1:8080",
+		"http://localhost:8080",
+		"http://127.0.0.1:8080",
+		"http://[::1]:8080",
+		"http://0.0.0.0:8080",
+		"http://sandbox:port",
+	} {
+		assert.NotNil(t, validateLogsHTTPAddr(addr), addr)
+	}
+}
+
+func TestSubscribeLogs(t *testing.T) {
+	var payload map[string]interface{}
+	var extensionID string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		extensionID = r.Header.Get("Lambda-Extension-Identifier")
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&payload))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	subscription, err := subscribeLogs(ts.URL, "test-id", "http://sandbox:8080")
+	assert.Nil(t, err)
+	assert.Equal(t, LogsSubscription{}, subscription)
+	assert.Equal(t, "test-id", extensionID)
+	assert.Equal(t, map[string]interface{}{"URI": "http://sandbox:8080", "protocol": "HTTP"}, payload["destination"])
+
+	// invalid addresses are not sent to the platform
+	extensionID = ""
+	_, err = subscribeLogs(ts.URL, "test-id", "http://localhost:8080")
+	assert.NotNil(t, err)
+	assert.Equal(t, "", extensionID)
+}
+
+func TestSubscribeLogsResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"schemaVersion":"2020-08-15","types":["platform","function"],"buffering":{"maxItems":1000,"maxBytes":262144,"timeoutMs":100},"destination":{"URI":"http://sandbox:8080","protocol":"HTTP"}}`))
+	}))
+	defer ts.Close()
+
+	subscription, err := subscribeLogs(ts.URL, "test-id", "http://sandbox:8080")
+	assert.Nil(t, err)
+	assert.Equal(t, LogsSubscription{
+		SchemaVersion: "2020-08-15",
+		Types:         []string{"platform", "function"},
+		Buffering:     &LogsBuffering{MaxItems: 1000, MaxBytes: 262144, TimeoutMs: 100},
+		Destination:   &LogDestination{URI: "http://sandbox:8080", Protocol: "HTTP"},
+	}, subscription)
+}
+
+func TestSubscribeLogsError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errorType":"Logs.ValidationError"}`))
+	}))
+	defer ts.Close()
+
+	_, err := subscribeLogs(ts.URL, "test-id", "http://sandbox:8080")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "400 Bad Request")
+	assert.Contains(t, err.Error(), "Logs.ValidationError")
+}
+
+func TestWaitForNextInvocationReportsWait(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`{"eventType":"INVOKE","deadlineMs":1}`))
+	}))
+	defer ts.Close()
+
+	var waited time.Duration
+	err := waitForNextInvocation(ts.URL, NewDefaultDispatcher(make(chan struct{}), nil, nil), "test-id", func(d time.Duration) {
+		waited = d
+	})
+	assert.Nil(t, err)
+	assert.True(t, waited >= 50*time.Millisecond)
+
+	// no callback
+	assert.Nil(t, waitForNextInvocation(ts.URL, NewDefaultDispatcher(make(chan struct{}), nil, nil), "test-id", nil))
+}
+
+func TestHTTPTimeouts(t *testing.T) {
+	SetHTTPTimeouts(time.Second, 50*time.Millisecond)
+	defer SetHTTPTimeouts(DefaultConnectTimeout, DefaultRequestTimeout)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Lambda-Extension-Identifier", "test-id")
+		w.Write([]byte(`{"eventType":"INVOKE","deadlineMs":1}`))
+	}))
+	defer ts.Close()
+
+	// the request timeout applies to the regular calls
+	_, err := register(ts.URL, "")
+	assert.NotNil(t, err)
+
+	// but not to the long-poll
+	assert.Nil(t, waitForNextInvocation(ts.URL, NewDefaultDispatcher(make(chan struct{}), nil, nil), "test-id", nil))
+}
+
+func TestRuntimeAPIRoutes(t *testing.T) {
+	routes := newRoutes("http://localhost:9001/")
+	assert.Equal(t, "http://localhost:9001/2020-01-01/extension/register", routes.register)
+	assert.Equal(t, "http://localhost:9001/2020-01-01/extension/event/next", routes.eventNext)
+	assert.Equal(t, "http://localhost:9001/2020-01-01/extension/init/error", routes.initError)
+	assert.Equal(t, "http://localhost:9001/2020-08-15/logs", routes.subscribeLogs)
+}
+
+func TestRuntimeAPICalls(t *testing.T) {
+	requests := make(map[string]*http.Request)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.Method+" "+r.URL.Path] = r
+		switch r.URL.Path {
+		case "/2020-01-01/extension/register":
+			w.Header().Set("Lambda-Extension-Identifier", "test-id")
+		case "/2020-01-01/extension/init/error":
+			w.WriteHeader(http.StatusAccepted)
+		case "/2020-01-01/extension/event/next":
+			w.Write([]byte(`{"eventType":"INVOKE","deadlineMs":1}`))
+		}
+	}))
+	defer ts.Close()
+
+	defaultRuntimeAPI := runtimeAPI
+	runtimeAPI = newRoutes(ts.URL)
+	defer func() { runtimeAPI = defaultRuntimeAPI }()
+
+	id, err := Register("")
+	assert.Nil(t, err)
+	assert.Equal(t, ID("test-id"), id)
+	assert.Equal(t, ExtensionName, requests["POST /2020-01-01/extension/register"].Header.Get("Lambda-Extension-Name"))
+
+	assert.Nil(t, ReportInitError(id, FatalNoAPIKey))
+	assert.Equal(t, "test-id", requests["POST /2020-01-01/extension/init/error"].Header.Get("Lambda-Extension-Identifier"))
+	assert.Equal(t, "Fatal.ConnectFailed", requests["POST /2020-01-01/extension/init/error"].Header.Get("Lambda-Extension-Function-Error-Type"))
+
+	_, err = SubscribeLogs(id, "http://sandbox:8080")
+	assert.Nil(t, err)
+	assert.Equal(t, "application/json", requests["PUT /2020-08-15/logs"].Header.Get("Content-Type"))
+
+	assert.Nil(t, WaitForNextInvocation(NewDefaultDispatcher(make(chan struct{}), nil, nil), id, nil))
+	assert.Equal(t, "test-id", requests["GET /2020-01-01/extension/event/next"].Header.Get("Lambda-Extension-Identifier"))
+}
+
+func TestRuntimeAPIErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	routes := newRoutes(ts.URL)
+	_, err := register(routes.register, "")
+	assert.NotNil(t, err)
+	assert.NotNil(t, reportInitError(routes.initError, "test-id", FatalNoAPIKey))
+	_, err = subscribeLogs(routes.subscribeLogs, "test-id", "http://sandbox:8080")
+	assert.NotNil(t, err)
+	// the empty body can't be unmarshaled
+	assert.NotNil(t, waitForNextInvocation(routes.eventNext, NewDefaultDispatcher(make(chan struct{}), nil, nil), "test-id", nil))
+}
+
+func TestEventCounts(t *testing.T) {
+	var eventType string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"eventType":"` + eventType + `","deadlineMs":1}`))
+	}))
+	defer ts.Close()
+
+	invocations, shutdowns := InvocationCount(), ShutdownCount()
+
+	eventType = "INVOKE"
+	assert.Nil(t, waitForNextInvocation(ts.URL, NewDefaultDispatcher(make(chan struct{}), nil, nil), "test-id", nil))
+	assert.Nil(t, waitForNextInvocation(ts.URL, NewDefaultDispatcher(make(chan struct{}), nil, nil), "test-id", nil))
+	assert.Equal(t, invocations+2, InvocationCount())
+	assert.Equal(t, shutdowns, ShutdownCount())
+
+	eventType = "SHUTDOWN"
+	stopCh := make(chan struct{}, 1)
+	assert.Nil(t, waitForNextInvocation(ts.URL, NewDefaultDispatcher(stopCh, nil, nil), "test-id", nil))
+	assert.Equal(t, invocations+2, InvocationCount())
+	assert.Equal(t, shutdowns+1, ShutdownCount())
+}
+
+func TestDispatcher(t *testing.T) {
+	var eventType string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"eventType":"` + eventType + `","deadlineMs":42}`))
+	}))
+	defer ts.Close()
+
+	var calls []string
+	dispatcher := NewDispatcher()
+	dispatcher.OnInvoke(func(payload Payload) { calls = append(calls, "invoke 1") })
+	dispatcher.OnInvoke(func(payload Payload) { calls = append(calls, "invoke 2") })
+	dispatcher.OnShutdown(func(payload Payload) {
+		assert.Equal(t, int64(42), payload.DeadlineMs)
+		calls = append(calls, "shutdown")
+	})
+
+	eventType = "INVOKE"
+	assert.Nil(t, waitForNextInvocation(ts.URL, dispatcher, "test-id", nil))
+	assert.Equal(t, []string{"invoke 1", "invoke 2"}, calls)
+
+	// the unknown events are ignored
+	calls = nil
+	eventType = "UNKNOWN"
+	assert.Nil(t, waitForNextInvocation(ts.URL, dispatcher, "test-id", nil))
+	assert.Empty(t, calls)
+
+	eventType = "SHUTDOWN"
+	assert.Nil(t, waitForNextInvocation(ts.URL, dispatcher, "test-id", nil))
+	assert.Equal(t, []string{"shutdown"}, calls)
+}
+
+func TestDefaultDispatcherStopsOnShutdown(t *testing.T) {
+	stopCh := make(chan struct{}, 1)
+	dispatcher := NewDefaultDispatcher(stopCh, nil, nil)
+
+	dispatcher.dispatch(Payload{EventType: "INVOKE"})
+	assert.Len(t, stopCh, 0)
+
+	dispatcher.dispatch(Payload{EventType: "SHUTDOWN"})
+	assert.Len(t, stopCh, 1)
+}
+
+func TestLogsSubscriptionSupervisorRecovers(t *testing.T) {
+	var lock sync.Mutex
+	var subscriptions, failures int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if failures > 0 {
+			// the log router of the sandbox is restarting
+			failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		subscriptions++
+		w.Write([]byte(`{"schemaVersion":"2020-08-15"}`))
+	}))
+	defer ts.Close()
+
+	resubscribed := make(chan int, 1)
+	supervisor := newLogsSubscriptionSupervisor(ts.URL, "test-id", "http://sandbox:8080", 0, func(subscription LogsSubscription, attempts int) {
+		assert.Equal(t, "2020-08-15", subscription.SchemaVersion)
+		resubscribed <- attempts
+	})
+	supervisor.backoff = 10 * time.Millisecond
+	defer supervisor.Stop()
+
+	_, err := supervisor.Start()
+	assert.Nil(t, err)
+
+	// the subscription is dropped and the platform fails twice before it recovers
+	lock.Lock()
+	failures = 2
+	lock.Unlock()
+	supervisor.Resubscribe()
+
+	select {
+	case attempts := <-resubscribed:
+		assert.Equal(t, 3, attempts)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the subscription was not re-established")
+	}
+	lock.Lock()
+	assert.Equal(t, 2, subscriptions)
+	lock.Unlock()
+}
+
+func TestLogsSubscriptionSupervisorPeriodic(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer ts.Close()
+
+	resubscribed := make(chan int, 1)
+	supervisor := newLogsSubscriptionSupervisor(ts.URL, "test-id", "http://sandbox:8080", 10*time.Millisecond, func(subscription LogsSubscription, attempts int) {
+		select {
+		case resubscribed <- attempts:
+		default:
+		}
+	})
+	_, err := supervisor.Start()
+	assert.Nil(t, err)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case attempts := <-resubscribed:
+			assert.Equal(t, 1, attempts)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the subscription was not re-established periodically")
+		}
+	}
+	supervisor.Stop()
+	// stopping twice is safe
+	supervisor.Stop()
+}
+
+func TestLogsSubscriptionSupervisorStartError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	supervisor := newLogsSubscriptionSupervisor(ts.URL, "test-id", "http://sandbox:8080", time.Millisecond, nil)
+	_, err := supervisor.Start()
+	assert.NotNil(t, err)
+	supervisor.Stop()
+}
+
+func TestRegisterWithAPIKey(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Lambda-Extension-Identifier", "test-id")
+	}))
+	defer ts.Close()
+
+	var secretsCalls int
+	secrets := NewAPIKeyProvider("fake secrets", func() (string, error) {
+		secretsCalls++
+		return "secret-api-key", nil
+	})
+	unset := NewAPIKeyProvider("unset", func() (string, error) { return "", nil })
+	failing := NewAPIKeyProvider("failing", func() (string, error) { return "", errors.New("access denied") })
+
+	// the first provider setting an API key is used, the failing ones are skipped
+	id, apiKey, err := registerWithAPIKey(ts.URL, "", ChainAPIKeyProviders(failing, unset, secrets, EnvAPIKeyProvider()))
+	assert.Nil(t, err)
+	assert.Equal(t, ID("test-id"), id)
+	assert.Equal(t, "secret-api-key", apiKey)
+	assert.Equal(t, 1, secretsCalls)
+
+	// the extension is registered even if the API key can't be resolved
+	id, apiKey, err = registerWithAPIKey(ts.URL, "", ChainAPIKeyProviders(unset, failing))
+	assert.Equal(t, ID("test-id"), id)
+	assert.Empty(t, apiKey)
+	apiKeyErr, ok := err.(*APIKeyError)
+	assert.True(t, ok)
+	assert.Equal(t, "unset, failing", apiKeyErr.Provider)
+	assert.Equal(t, FatalNoAPIKey, apiKeyErr.ErrorEnum())
+	assert.Contains(t, err.Error(), "access denied")
+
+	_, _, err = registerWithAPIKey(ts.URL, "", unset)
+	assert.Equal(t, "Fatal.NoAPIKey: no API key set in unset", err.Error())
+}
+
+func TestEnvAPIKeyProvider(t *testing.T) {
+	defer os.Setenv("DD_API_KEY", os.Getenv("DD_API_KEY"))
+
+	os.Setenv("DD_API_KEY", "env-api-key")
+	apiKey, err := EnvAPIKeyProvider().APIKey()
+	assert.Nil(t, err)
+	assert.Equal(t, "env-api-key", apiKey)
+}
+
+func TestRegisterWithAPIKeyRegistrationError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	var called bool
+	provider := NewAPIKeyProvider("fake", func() (string, error) {
+		called = true
+		return "api-key", nil
+	})
+	_, _, err := registerWithAPIKey(ts.URL, "", provider)
+	assert.NotNil(t, err)
+	_, isAPIKeyErr := err.(*APIKeyError)
+	assert.False(t, isAPIKeyErr)
+	assert.False(t, called)
+}
+
+func TestHealth(t *testing.T) {
+	state := &healthState{}
+	handler := &Health{state}
+
+	check := func(expectedCode int, expected HealthStatus) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/health", nil))
+		assert.Equal(t, expectedCode, recorder.Code)
+		var status HealthStatus
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+		assert.Equal(t, expected, status)
+	}
+
+	check(503, HealthStatus{LogsSubscription: "disabled"})
+
+	state.setRegistered(true)
+	check(503, HealthStatus{Registered: true, LogsSubscription: "disabled"})
+
+	// the logs subscription is optional
+	state.setAPIKeyResolved(true)
+	check(200, HealthStatus{Registered: true, APIKeyResolved: true, LogsSubscription: "disabled", Ready: true})
+
+	state.setLogsSubscribed(true)
+	check(200, HealthStatus{Registered: true, APIKeyResolved: true, LogsSubscription: "active", Ready: true})
+
+	// but it must be active once attempted
+	state.setLogsSubscribed(false)
+	check(503, HealthStatus{Registered: true, APIKeyResolved: true, LogsSubscription: "inactive"})
+
+	state.setLogsSubscribed(true)
+	state.setAPIKeyResolved(false)
+	check(503, HealthStatus{Registered: true, LogsSubscription: "active"})
+}
+
+func TestHealthPopulatedByRegistration(t *testing.T) {
+	defaultHealth := health
+	defer func() { health = defaultHealth }()
+	health = healthState{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Lambda-Extension-Identifier", "test-id")
+	}))
+	defer ts.Close()
+
+	_, _, err := registerWithAPIKey(ts.URL, "", NewAPIKeyProvider("fake", func() (string, error) { return "api-key", nil }))
+	assert.Nil(t, err)
+	assert.Equal(t, HealthStatus{Registered: true, APIKeyResolved: true, LogsSubscription: "disabled", Ready: true}, health.status())
+}
+
+func TestRedactSensitive(t *testing.T) {
+	assert.Equal(t, "no secret here", redactSensitive("no secret here"))
+	assert.Equal(t, `{"error":"invalid api key ***************************bcdef"}`,
+		redactSensitive(`{"error":"invalid api key 0123456789abcdef0123456789abcdef"}`))
+	assert.Equal(t, "DD_APP_KEY=***********************************bcdef, DD_API_KEY=***************************BCDEF",
+		redactSensitive("DD_APP_KEY=0123456789abcdef0123456789abcdef012bcdef, DD_API_KEY=0123456789ABCDEF0123456789ABCDEF"))
+	// identifiers of other lengths are kept
+	assert.Equal(t, "request 0123456789abcdef failed", redactSensitive("request 0123456789abcdef failed"))
+}
+
+func TestRegisterRedactsResponseBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errorMessage":"bad key 0123456789abcdef0123456789abcdef"}`))
+	}))
+	defer ts.Close()
+
+	_, err := register(ts.URL, "")
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "0123456789abcdef0123456789abcdef")
+	assert.Contains(t, err.Error(), "***************************bcdef")
+
+	_, err = subscribeLogs(ts.URL, "test-id", "http://sandbox:8080")
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "0123456789abcdef0123456789abcdef")
+}
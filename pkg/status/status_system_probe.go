@@ -35,3 +35,18 @@ func GetSystemProbeStats(socketPath string) map[string]interface{} {
 
 	return systemProbeDetails
 }
+
+// GetRuntimeSecurityDiagnostics returns the diagnostics report of the runtime security module of the system probe
+func GetRuntimeSecurityDiagnostics(socketPath string) ([]byte, error) {
+	net.SetSystemProbePath(socketPath)
+	probeUtil, err := net.GetRemoteSystemProbeUtil()
+	if err != nil {
+		return nil, err
+	}
+
+	diagnostics, err := probeUtil.GetRuntimeSecurityDiagnostics()
+	if err != nil {
+		return nil, fmt.Errorf("issue querying the runtime security diagnostics from system probe: %v", err)
+	}
+	return diagnostics, nil
+}
@@ -17,3 +17,8 @@ func GetSystemProbeStats(socketPath string) map[string]interface{} {
 		"Errors": fmt.Sprintf("System Probe is not supported on this system"),
 	}
 }
+
+// GetRuntimeSecurityDiagnostics returns an error on systems that do not at least build the process agent
+func GetRuntimeSecurityDiagnostics(socketPath string) ([]byte, error) {
+	return nil, fmt.Errorf("System Probe is not supported on this system")
+}
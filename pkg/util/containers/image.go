@@ -8,6 +8,7 @@ package containers
 import (
 	"errors"
 	"strings"
+	"unicode"
 )
 
 var (
@@ -15,6 +16,10 @@ var (
 	ErrEmptyImage = errors.New("empty image name")
 	// ErrImageIsSha256 is returned when image name argument is a sha256
 	ErrImageIsSha256 = errors.New("invalid image name (is a sha256)")
+	// ErrImageHasInvalidChars is returned when image name argument contains whitespace or control characters
+	ErrImageHasInvalidChars = errors.New("invalid image name (contains whitespace or control characters)")
+	// ErrImageHasBackslash is returned when image name argument uses backslashes, like a Windows path or UNC host
+	ErrImageHasBackslash = errors.New("invalid image name (contains backslashes)")
 )
 
 // SplitImageName splits a valid image name (from ResolveImageName) and returns:
@@ -22,20 +27,36 @@ var (
 //    - the "short image name", without registry, prefix nor tag
 //    - the image tag if present
 //    - an error if parsing failed
+// Surrounding whitespace is ignored and the registry host is lowercased, as registries are
+// case-insensitive, while the repository and tag keep their casing.
+// The parsing doesn't depend on the OS the agent runs on, references to Windows images
+// follow the same format as the Linux ones.
+// The image names parsed into a degenerate result, e.g. an empty short name, are counted
+// in MalformedImageCount.
 func SplitImageName(image string) (string, string, string, error) {
 	// See TestSplitImageName for supported formats (number 6 will surprise you!)
+	image = strings.TrimSpace(image)
 	if image == "" {
 		return "", "", "", ErrEmptyImage
 	}
 	if strings.HasPrefix(image, "sha256:") {
 		return "", "", "", ErrImageIsSha256
 	}
-	long := image
-	if pos := strings.LastIndex(long, "@sha"); pos > 0 {
-		// Remove @sha suffix when orchestrator is sha-pinning
+	if strings.IndexFunc(image, isInvalidImageRune) > -1 {
+		return "", "", "", ErrImageHasInvalidChars
+	}
+	if strings.Contains(image, "\\") {
+		// Backslashes are never valid in a reference, don't mistake them for path separators
+		return "", "", "", ErrImageHasBackslash
+	}
+	long := normalizeRegistryHost(image)
+	if pos := digestSeparator(long); pos > 0 {
+		// Remove the digest suffix when orchestrator is sha-pinning, before looking for the tag
+		// so that the colon of the digest or of the registry port isn't mistaken for it
 		long = long[0:pos]
 	}
 
+	ref := long
 	var short, tag string
 	lastColon := strings.LastIndex(long, ":")
 	lastSlash := strings.LastIndex(long, "/")
@@ -51,5 +72,69 @@ func SplitImageName(image string) (string, string, string, error) {
 	} else {
 		short = long
 	}
+	if isDegenerateImageName(ref, short, tag) {
+		reportMalformedImage(image, short, tag)
+	}
 	return long, short, tag, nil
 }
+
+// ImageIdentity returns a stable identity of the image, collapsing the mutable tags onto the
+// immutable digest: the long image name qualified with the digest when the reference has one,
+// e.g. "datadog/agent@sha256:5bef...", otherwise with the tag if any, e.g. "datadog/agent:latest".
+// The tag is dropped when a digest is present, as it can point to another image later.
+// Returns an empty string when the image name can't be parsed by SplitImageName.
+func ImageIdentity(image string) string {
+	long, _, tag, err := SplitImageName(image)
+	if err != nil {
+		return ""
+	}
+	if digest := imageDigest(image); digest != "" {
+		return long + "@" + digest
+	}
+	if tag != "" {
+		return long + ":" + tag
+	}
+	return long
+}
+
+// imageDigest returns the digest of a valid image name, e.g. "sha256:5bef...", or an empty string
+// if it isn't pinned to a digest.
+func imageDigest(image string) string {
+	image = strings.TrimSpace(image)
+	pos := digestSeparator(image)
+	if pos <= 0 {
+		return ""
+	}
+	return image[pos+1:]
+}
+
+// digestSeparator returns the position of the '@' separating the digest of an image name, e.g.
+// "sha256:5bef...", -1 if it has none. The '@' can't appear elsewhere in a reference, any digest
+// algorithm is recognized as long as the digest has the "algorithm:hex" form.
+func digestSeparator(image string) int {
+	pos := strings.LastIndex(image, "@")
+	if pos < 0 || !strings.Contains(image[pos+1:], ":") {
+		return -1
+	}
+	return pos
+}
+
+// isInvalidImageRune returns true for the characters that can't be part of an image name
+func isInvalidImageRune(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsControl(r)
+}
+
+// normalizeRegistryHost lowercases the registry host of the image name if it has one.
+// Like docker, the first component is considered a registry host if it contains a '.'
+// or a ':', or if it is localhost.
+func normalizeRegistryHost(image string) string {
+	pos := strings.Index(image, "/")
+	if pos < 0 {
+		return image
+	}
+	host := image[:pos]
+	if !strings.ContainsAny(host, ".:") && strings.ToLower(host) != "localhost" {
+		return image
+	}
+	return strings.ToLower(host) + image[pos:]
+}
@@ -0,0 +1,82 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package containers
+
+import (
+	"expvar"
+	"strings"
+	"sync"
+
+	"github.com/DataDog/datadog-agent/pkg/util/log"
+)
+
+// maxLoggedMalformedImages is the maximum number of distinct malformed image names logged,
+// the next ones are only counted
+const maxLoggedMalformedImages = 100
+
+var (
+	imageExpvars    = expvar.NewMap("image_names")
+	malformedImages = expvar.Int{}
+
+	loggedMalformedImagesLock sync.Mutex
+	loggedMalformedImages     = make(map[string]struct{})
+)
+
+func init() {
+	imageExpvars.Set("malformed", &malformedImages)
+}
+
+// MalformedImageCount returns the number of image names SplitImageName parsed into a degenerate
+// result since the agent started, it is also exposed in the image_names expvar
+func MalformedImageCount() int64 {
+	return malformedImages.Value()
+}
+
+// isDegenerateImageName returns true if the parts of a parsed image name can't identify an image, given
+// the reference they were parsed from, without its digest:
+//    - an empty short name, e.g. "org/"
+//    - an empty tag after the colon, e.g. "org/app:"
+//    - a digest without repository, e.g. "@sha256:5bef..."
+//    - a bare registry host and port, e.g. "registry.example.com:5000", parsed as a numeric tag
+func isDegenerateImageName(ref, short, tag string) bool {
+	switch {
+	case short == "":
+		return true
+	case strings.HasSuffix(ref, ":"):
+		return true
+	case strings.HasPrefix(ref, "@"):
+		return true
+	case !strings.Contains(ref, "/") && isNumeric(tag):
+		return strings.Contains(short, ".") || strings.ToLower(short) == "localhost"
+	}
+	return false
+}
+
+// isNumeric returns true if s is a non empty string of digits, like a port
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// reportMalformedImage counts a degenerate image name and logs it the first time it is seen
+func reportMalformedImage(image, short, tag string) {
+	malformedImages.Add(1)
+
+	loggedMalformedImagesLock.Lock()
+	defer loggedMalformedImagesLock.Unlock()
+	if _, logged := loggedMalformedImages[image]; logged || len(loggedMalformedImages) >= maxLoggedMalformedImages {
+		return
+	}
+	loggedMalformedImages[image] = struct{}{}
+	log.Warnf("Image name %q is malformed, it was parsed into short name %q and tag %q", image, short, tag)
+}
@@ -48,6 +48,34 @@ func TestSplitImageName(t *testing.T) {
 		// Test swarm image
 		{"dockercloud/haproxy:1.6.7@sha256:8c4ed4049f55de49cbc8d03d057a5a7e8d609c264bb75b59a04470db1d1c5121",
 			"dockercloud/haproxy", "haproxy", "1.6.7", nil},
+		// Surrounding whitespace is trimmed
+		{"  datadog/agent:7.23.0\n", "datadog/agent", "agent", "7.23.0", nil},
+		// Whitespace only
+		{" \t ", "", "", "", fmt.Errorf("empty image name")},
+		// Internal whitespace
+		{"datadog/agent :7.23.0", "", "", "", fmt.Errorf("invalid image name (contains whitespace or control characters)")},
+		// Control character
+		{"datadog/agent\x00:7.23.0", "", "", "", fmt.Errorf("invalid image name (contains whitespace or control characters)")},
+		// Registry host is lowercased, repository and tag keep their casing
+		{"MyRegistry.Local:5000/Testing/Test-Image:Version",
+			"myregistry.local:5000/Testing/Test-Image", "Test-Image", "Version", nil},
+		{"LOCALHOST/Test-Image:Version", "localhost/Test-Image", "Test-Image", "Version", nil},
+		// Org prefix is not a registry host and keeps its casing
+		{"DataDog/Agent:Latest", "DataDog/Agent", "Agent", "Latest", nil},
+		// Microsoft Container Registry, Windows images with multi-segment repositories
+		{"mcr.microsoft.com/windows/servercore:ltsc2019",
+			"mcr.microsoft.com/windows/servercore", "servercore", "ltsc2019", nil},
+		{"mcr.microsoft.com/windows/servercore/iis",
+			"mcr.microsoft.com/windows/servercore/iis", "iis", "", nil},
+		{"mcr.microsoft.com/dotnet/framework/aspnet:4.8-windowsservercore-ltsc2019",
+			"mcr.microsoft.com/dotnet/framework/aspnet", "aspnet", "4.8-windowsservercore-ltsc2019", nil},
+		{"MCR.Microsoft.com/windows/nanoserver:1809@sha256:5bef08742407efd622d243692b79ba0055383bbce12900324f75e56f589aedb0",
+			"mcr.microsoft.com/windows/nanoserver", "nanoserver", "1809", nil},
+		{"mcr.microsoft.com:443/windows/nanoserver@sha256:5bef08742407efd622d243692b79ba0055383bbce12900324f75e56f589aedb0",
+			"mcr.microsoft.com:443/windows/nanoserver", "nanoserver", "", nil},
+		// Windows path or UNC host
+		{"mcr.microsoft.com\\windows\\servercore:ltsc2019", "", "", "", fmt.Errorf("invalid image name (contains backslashes)")},
+		{"\\\\myregistry\\windows\\servercore", "", "", "", fmt.Errorf("invalid image name (contains backslashes)")},
 	} {
 		t.Run(fmt.Sprintf("case %d: %s", nb, tc.source), func(t *testing.T) {
 			assert := assert.New(t)
@@ -65,3 +93,118 @@ func TestSplitImageName(t *testing.T) {
 		})
 	}
 }
+
+func TestImageIdentity(t *testing.T) {
+	digest := "sha256:5bef08742407efd622d243692b79ba0055383bbce12900324f75e56f589aedb0"
+	for nb, tc := range []struct {
+		source   string
+		identity string
+	}{
+		// No tag nor digest
+		{"alpine", "alpine"},
+		// Tag only
+		{"nginx:latest", "nginx:latest"},
+		{"myregistry.local:5000/testing/test-image:version", "myregistry.local:5000/testing/test-image:version"},
+		// Digest only
+		{"redis@" + digest, "redis@" + digest},
+		// Tag and digest, the mutable tag is dropped
+		{"org/redis:latest@" + digest, "org/redis@" + digest},
+		{"myregistry.local:5000/testing/test-image:version@" + digest, "myregistry.local:5000/testing/test-image@" + digest},
+		// Same image pinned under different tags
+		{"org/redis:6.0@" + digest, "org/redis@" + digest},
+		// Normalized like SplitImageName
+		{"  MyRegistry.Local:5000/Testing/Test-Image:Version\n", "myregistry.local:5000/Testing/Test-Image:Version"},
+		// Invalid names
+		{"", ""},
+		{digest, ""},
+		{"datadog/agent :7.23.0", ""},
+	} {
+		t.Run(fmt.Sprintf("case %d: %s", nb, tc.source), func(t *testing.T) {
+			assert.Equal(t, tc.identity, ImageIdentity(tc.source))
+		})
+	}
+}
+
+func TestSplitImageNameDigests(t *testing.T) {
+	digest := "sha256:5bef08742407efd622d243692b79ba0055383bbce12900324f75e56f589aedb0"
+	for _, tc := range []struct {
+		name      string
+		source    string
+		longName  string
+		shortName string
+		tag       string
+	}{
+		{"digest only", "app@" + digest, "app", "app", ""},
+		{"digest with org", "org/app@" + digest, "org/app", "app", ""},
+		{"digest with registry port", "myregistry:5000/app@" + digest, "myregistry:5000/app", "app", ""},
+		{"digest with registry port and org", "myregistry:5000/org/app@" + digest, "myregistry:5000/org/app", "app", ""},
+		{"digest with localhost port", "localhost:5000/app@" + digest, "localhost:5000/app", "app", ""},
+		{"tag and digest with registry port", "myregistry:5000/app:1.0@" + digest, "myregistry:5000/app", "app", "1.0"},
+		{"tag without digest with registry port", "myregistry:5000/app:1.0", "myregistry:5000/app", "app", "1.0"},
+		{"registry port without tag nor digest", "myregistry:5000/app", "myregistry:5000/app", "app", ""},
+		{"short digest", "myregistry:5000/app@sha256:abc", "myregistry:5000/app", "app", ""},
+		{"other digest algorithm", "myregistry:5000/app@sha512:abc", "myregistry:5000/app", "app", ""},
+		{"non sha digest algorithm", "myregistry:5000/app@blake3:abc", "myregistry:5000/app", "app", ""},
+		{"tag and non sha digest", "org/app:latest@blake3:abc", "org/app", "app", "latest"},
+		{"uppercase registry with digest", "MyRegistry:5000/App@" + digest, "myregistry:5000/App", "App", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			long, short, tag, err := SplitImageName(tc.source)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.longName, long)
+			assert.Equal(t, tc.shortName, short)
+			assert.Equal(t, tc.tag, tag)
+		})
+	}
+}
+
+func TestSplitImageNameCountsMalformedImages(t *testing.T) {
+	for _, tc := range []struct {
+		source    string
+		malformed bool
+	}{
+		{"datadog/agent:7.23.0", false},
+		{"myregistry:5000/app@sha256:abc", false},
+		{"datadog/", true},
+		{"myregistry:5000/", true},
+		{":latest", true},
+		{"datadog/agent:", true},
+		{"@sha256:abc", true},
+		{"registry.example.com:5000", true},
+		{"localhost:5000", true},
+		{"redis:6", false},
+	} {
+		t.Run(tc.source, func(t *testing.T) {
+			before := MalformedImageCount()
+			_, _, _, err := SplitImageName(tc.source)
+			assert.Nil(t, err)
+			if tc.malformed {
+				assert.Equal(t, before+1, MalformedImageCount())
+			} else {
+				assert.Equal(t, before, MalformedImageCount())
+			}
+		})
+	}
+
+	// the malformed image names are logged once
+	SplitImageName("datadog/") //nolint:errcheck
+	loggedMalformedImagesLock.Lock()
+	defer loggedMalformedImagesLock.Unlock()
+	assert.Contains(t, loggedMalformedImages, "datadog/")
+	assert.True(t, len(loggedMalformedImages) <= maxLoggedMalformedImages)
+}
+
+func TestIsDegenerateImageName(t *testing.T) {
+	assert.False(t, isDegenerateImageName("datadog/agent:7.23.0", "agent", "7.23.0"))
+	assert.False(t, isDegenerateImageName("datadog/agent", "agent", ""))
+	assert.False(t, isDegenerateImageName("redis:6", "redis", "6"))
+	assert.False(t, isDegenerateImageName("registry.example.com:5000/app:1", "app", "1"))
+	assert.True(t, isDegenerateImageName(":latest", "", "latest"))
+	// empty tag after the colon
+	assert.True(t, isDegenerateImageName("datadog/agent:", "agent", ""))
+	// digest without repository
+	assert.True(t, isDegenerateImageName("@sha256:abc", "@sha256", "abc"))
+	// bare registry host and port
+	assert.True(t, isDegenerateImageName("registry.example.com:5000", "registry.example.com", "5000"))
+	assert.True(t, isDegenerateImageName("localhost:5000", "localhost", "5000"))
+}
@@ -102,7 +102,7 @@ func cgroupMountPoints() (map[string]string, error) {
 	if !pathExists(mountsFile) {
 		return nil, fmt.Errorf("/proc/mounts does not exist")
 	}
-	f, err := os.Open(mountsFile)
+	f, err := fs.Open(mountsFile)
 	if err != nil {
 		return nil, err
 	}
@@ -193,7 +193,7 @@ func scrapeAllCgroups() (map[string]*ContainerCgroup, error) {
 
 // readCgroupsForPath reads the cgroups from a /proc/$pid/cgroup path.
 func readCgroupsForPath(pidCgroupPath, prefix string) (string, map[string]string, error) {
-	f, err := os.Open(pidCgroupPath)
+	f, err := fs.Open(pidCgroupPath)
 	if os.IsNotExist(err) {
 		log.Debugf("cgroup path '%s' could not be read: %s", pidCgroupPath, err)
 		return "", nil, nil
@@ -275,3 +275,80 @@ func containerIDFromCgroup(cgroup, prefix string) (string, bool) {
 	}
 	return matches[len(matches)-1], true
 }
+
+// ParseCgroupV2 returns the ID of the container running the process from its /proc/$pid/cgroup file,
+// an empty string if the process doesn't run in a container. The version of the cgroups is detected from
+// the file: on the hosts using the cgroup v2 unified hierarchy, it only has a 0::$path line, e.g.
+//
+// 0::/system.slice/docker-a27f1331f6ddf72629811aac65207949fc858ea90100c438768b531a4c540419.scope
+//
+// otherwise the ID is parsed from the v1 hierarchies like parseCgroupPaths does, the v1 hierarchies
+// win on the hosts mixing both.
+func ParseCgroupV2(pid int) (string, error) {
+	f, err := fs.Open(hostProc(strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return parseContainerIDFromCgroups(f)
+}
+
+// parseContainerIDFromCgroups returns the container ID of a /proc/$pid/cgroup file, see ParseCgroupV2
+func parseContainerIDFromCgroups(r io.Reader) (string, error) {
+	var v1ID, v2Path string
+	var isV1 bool
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		l := scanner.Text()
+		if p := strings.TrimPrefix(l, "0::"); p != l {
+			v2Path = p
+			continue
+		}
+		isV1 = isV1 || l != ""
+		if cID, ok := containerIDFromCgroup(l, ""); ok && v1ID == "" {
+			v1ID = cID
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if isV1 {
+		return v1ID, nil
+	}
+	return containerIDFromUnifiedCgroup(v2Path), nil
+}
+
+// containerIDFromUnifiedCgroup returns the container ID of a cgroup v2 path, it is the last element of the path
+// holding one, once unescaped and without its .scope suffix. The systemd cgroup driver names the containers
+// runtime-$id.scope, e.g. docker-$id.scope, cri-containerd-$id.scope or libpod-$id.scope, some runtimes nest
+// the processes of the container in a sub cgroup of its scope.
+func containerIDFromUnifiedCgroup(cgroupPath string) string {
+	elements := strings.Split(cgroupPath, "/")
+	for i := len(elements) - 1; i >= 0; i-- {
+		element := strings.TrimSuffix(unescapeSystemdUnit(elements[i]), ".scope")
+		if matches := containerRe.FindAllString(element, -1); matches != nil {
+			return matches[len(matches)-1]
+		}
+	}
+	return ""
+}
+
+// unescapeSystemdUnit replaces the \xHH escape sequences of a systemd unit name with the bytes they stand for,
+// systemd escapes the dashes of the names it builds a unit name from as \x2d
+func unescapeSystemdUnit(name string) string {
+	if !strings.Contains(name, `\x`) {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+3 < len(name) && name[i+1] == 'x' {
+			if c, err := strconv.ParseUint(name[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
@@ -8,6 +8,7 @@
 package cgroup
 
 import (
+	"os"
 	"strings"
 	"testing"
 
@@ -392,3 +393,116 @@ func TestDindContainer(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, value, uint64(1234))
 }
+
+func TestParseContainerIDFromCgroups(t *testing.T) {
+	containerID := "a27f1331f6ddf72629811aac65207949fc858ea90100c438768b531a4c540419"
+	for _, tc := range []struct {
+		name       string
+		contents   string
+		expectedID string
+	}{
+		{
+			name:       "v2 docker with systemd driver",
+			contents:   "0::/system.slice/docker-" + containerID + ".scope\n",
+			expectedID: containerID,
+		},
+		{
+			name:       "v2 docker with cgroupfs driver",
+			contents:   "0::/docker/" + containerID + "\n",
+			expectedID: containerID,
+		},
+		{
+			name:       "v2 kubernetes with containerd and systemd driver",
+			contents:   "0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod2baa3444_4d37_11e7_bd2f_080027d2bf10.slice/cri-containerd-" + containerID + ".scope\n",
+			expectedID: containerID,
+		},
+		{
+			name:       "v2 kubernetes with cri-o",
+			contents:   "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod2baa3444_4d37_11e7_bd2f_080027d2bf10.slice/crio-" + containerID + ".scope\n",
+			expectedID: containerID,
+		},
+		{
+			name:       "v2 kubernetes with cgroupfs driver",
+			contents:   "0::/kubepods/besteffort/pod2baa3444-4d37-11e7-bd2f-080027d2bf10/" + containerID + "\n",
+			expectedID: containerID,
+		},
+		{
+			name:       "v2 rootless podman, the processes are in a sub cgroup of the scope",
+			contents:   "0::/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-" + containerID + ".scope/container\n",
+			expectedID: containerID,
+		},
+		{
+			name:       "v2 cloudfoundry with escaped dashes",
+			contents:   `0::/system.slice/garden\x2dbc3362fa\x2d913c\x2d4977\x2d5812\x2dd628.scope` + "\n",
+			expectedID: "bc3362fa-913c-4977-5812-d628",
+		},
+		{
+			name:     "v2 host process",
+			contents: "0::/user.slice/user-1000.slice/session-3.scope\n",
+		},
+		{
+			name:     "v2 cgroup namespace root",
+			contents: "0::/\n",
+		},
+		{
+			name: "v1",
+			contents: detab(`
+                11:net_cls:/docker/` + containerID + `
+                10:freezer:/docker/` + containerID + `
+                9:cpu,cpuacct:/docker/` + containerID + `
+                1:name=systemd:/docker/` + containerID + `
+            `),
+			expectedID: containerID,
+		},
+		{
+			name: "v1 host process",
+			contents: detab(`
+                11:net_cls:/
+                9:cpu,cpuacct:/user.slice
+                1:name=systemd:/user.slice/user-1000.slice/session-3.scope
+            `),
+		},
+		{
+			name: "hybrid, the v1 hierarchies win",
+			contents: detab(`
+                9:cpu,cpuacct:/docker/` + containerID + `
+                1:name=systemd:/docker/` + containerID + `
+                0::/system.slice/containerd.service
+            `),
+			expectedID: containerID,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := parseContainerIDFromCgroups(strings.NewReader(tc.contents))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedID, id)
+		})
+	}
+}
+
+func TestParseCgroupV2(t *testing.T) {
+	containerID := "a27f1331f6ddf72629811aac65207949fc858ea90100c438768b531a4c540419"
+	defer useFakeFileSystem(fakeFileSystem{
+		hostProc("1245", "cgroup"): "0::/system.slice/docker-" + containerID + ".scope\n",
+		hostProc("1", "cgroup"):    "0::/init.scope\n",
+	})()
+
+	id, err := ParseCgroupV2(1245)
+	assert.NoError(t, err)
+	assert.Equal(t, containerID, id)
+
+	id, err = ParseCgroupV2(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "", id)
+
+	_, err = ParseCgroupV2(42)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUnescapeSystemdUnit(t *testing.T) {
+	assert.Equal(t, "docker-abc.scope", unescapeSystemdUnit("docker-abc.scope"))
+	assert.Equal(t, "garden-a-b.scope", unescapeSystemdUnit(`garden\x2da\x2db.scope`))
+	// invalid or truncated sequences are kept
+	assert.Equal(t, `a\xzz`, unescapeSystemdUnit(`a\xzz`))
+	assert.Equal(t, `a\x2`, unescapeSystemdUnit(`a\x2`))
+}
@@ -36,7 +36,7 @@ func (c ContainerCgroup) Mem() (*metrics.ContainerMemStats, error) {
 	ret := &metrics.ContainerMemStats{}
 	statfile := c.cgroupFilePath("memory", "memory.stat")
 
-	f, err := os.Open(statfile)
+	f, err := fs.Open(statfile)
 	if os.IsNotExist(err) {
 		log.Debugf("Missing cgroup file: %s", statfile)
 		return ret, nil
@@ -190,7 +190,7 @@ func (c ContainerCgroup) SoftMemLimit() (uint64, error) {
 func (c ContainerCgroup) CPU() (*metrics.ContainerCPUStats, error) {
 	ret := &metrics.ContainerCPUStats{}
 	statfile := c.cgroupFilePath("cpuacct", "cpuacct.stat")
-	f, err := os.Open(statfile)
+	f, err := fs.Open(statfile)
 	if os.IsNotExist(err) {
 		log.Debugf("Missing cgroup file: %s", statfile)
 		return ret, nil
@@ -241,7 +241,7 @@ func (c ContainerCgroup) CPU() (*metrics.ContainerCPUStats, error) {
 // If the cgroup file does not exist then we just log debug and return 0.
 func (c ContainerCgroup) CPUPeriods() (throttledNr uint64, throttledTime float64, err error) {
 	statfile := c.cgroupFilePath("cpu", "cpu.stat")
-	f, err := os.Open(statfile)
+	f, err := fs.Open(statfile)
 	if os.IsNotExist(err) {
 		log.Debugf("Missing cgroup file: %s", statfile)
 		return 0, 0, nil
@@ -304,6 +304,13 @@ func (c ContainerCgroup) CPULimit() (float64, error) {
 		return 0, err
 	}
 
+	if len(plines) == 0 {
+		return 0, fmt.Errorf("wrong file format: %s", periodFile)
+	}
+	if len(qlines) == 0 {
+		return 0, fmt.Errorf("wrong file format: %s", quotaFile)
+	}
+
 	period, err := strconv.ParseFloat(plines[0], 64)
 	if err != nil {
 		return 0, err
@@ -320,7 +327,7 @@ func (c ContainerCgroup) CPULimit() (float64, error) {
 		periodFile = c.cgroupParentFilePath("cpu", "cpu.cfs_period_us")
 		quotaFile = c.cgroupParentFilePath("cpu", "cpu.cfs_quota_us")
 		plines, err = readLines(periodFile)
-		if err == nil {
+		if err == nil && len(plines) > 0 {
 			parentPeriod, err := strconv.ParseFloat(plines[0], 64)
 			if err == nil {
 				period = parentPeriod
@@ -328,7 +335,7 @@ func (c ContainerCgroup) CPULimit() (float64, error) {
 		}
 
 		qlines, err := readLines(quotaFile)
-		if err == nil {
+		if err == nil && len(qlines) > 0 {
 			parentQuota, err := strconv.ParseFloat(qlines[0], 64)
 			if err == nil {
 				quota = parentQuota
@@ -513,7 +520,7 @@ func (c ContainerCgroup) ParseSingleStat(target, file string) (uint64, error) {
 // Parse file
 func (c ContainerCgroup) scanStatFile(target, file string, parser func(line string) error) error {
 	filePath := c.cgroupFilePath(target, file)
-	f, err := os.Open(filePath)
+	f, err := fs.Open(filePath)
 	if os.IsNotExist(err) {
 		log.Debugf("Missing cgroup file: %s", filePath)
 		return nil
@@ -167,6 +167,48 @@ func TestParseSingleStat(t *testing.T) {
 	assert.Equal(t, value, uint64(1234))
 }
 
+func TestCPULimit(t *testing.T) {
+	tempFolder, err := newTempFolder("cpu-limit")
+	assert.Nil(t, err)
+	defer tempFolder.removeAll()
+
+	cgroup := newDummyContainerCgroup(tempFolder.RootPath, "cpu")
+
+	// No file
+	value, err := cgroup.CPULimit()
+	assert.Nil(t, err)
+	assert.Equal(t, numCPU*100, value)
+
+	// Empty files
+	tempFolder.add("cpu/cpu.cfs_period_us", "")
+	tempFolder.add("cpu/cpu.cfs_quota_us", "")
+	_, err = cgroup.CPULimit()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "wrong file format")
+
+	// Valid limit
+	tempFolder.add("cpu/cpu.cfs_period_us", "100000")
+	tempFolder.add("cpu/cpu.cfs_quota_us", "50000")
+	value, err = cgroup.CPULimit()
+	assert.Nil(t, err)
+	assert.Equal(t, 50.0, value)
+
+	// No limit, the empty parent files are ignored
+	tempFolder.add("cpu/cpu.cfs_quota_us", "-1")
+	tempFolder.add("cpu.cfs_period_us", "")
+	tempFolder.add("cpu.cfs_quota_us", "")
+	value, err = cgroup.CPULimit()
+	assert.Nil(t, err)
+	assert.Equal(t, numCPU*100, value)
+
+	// Parent limit
+	tempFolder.add("cpu.cfs_quota_us", "200000")
+	tempFolder.add("cpu.cfs_period_us", "100000")
+	value, err = cgroup.CPULimit()
+	assert.Nil(t, err)
+	assert.Equal(t, 200.0, value)
+}
+
 func TestThreadLimit(t *testing.T) {
 	tempFolder, err := newTempFolder("thread-limit")
 	assert.Nil(t, err)
@@ -11,10 +11,24 @@ import (
 	"bufio"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/DataDog/datadog-agent/pkg/config"
+	"github.com/DataDog/datadog-agent/pkg/util/filesystem"
 )
 
+const (
+	// pathStatCacheTTL is how long pathExists caches the stats of the procfs and cgroup paths,
+	// the same paths are checked for each container by each collection
+	pathStatCacheTTL        = time.Second
+	pathStatCacheMaxEntries = 10000
+)
+
+// pathStats caches the stats of pathExists, the stats go through fs so that tests can replace it
+var pathStats = filesystem.NewStatCacheWithStat(pathStatCacheTTL, pathStatCacheMaxEntries, func(name string) (os.FileInfo, error) {
+	return fs.Stat(name)
+})
+
 // ContainerCgroup is a structure that stores paths and mounts for a cgroup.
 // It provides several methods for collecting stats about the cgroup using the
 // paths and mounts metadata.
@@ -26,10 +40,12 @@ type ContainerCgroup struct {
 }
 
 // readLines reads contents from a file and splits them by new lines.
+// It returns nil on error, so that ranging over the lines of a file that
+// can't be read is a no-op.
 func readLines(filename string) ([]string, error) {
-	f, err := os.Open(filename)
+	f, err := fs.Open(filename)
 	if err != nil {
-		return []string{""}, err
+		return nil, err
 	}
 	defer f.Close()
 
@@ -48,10 +64,8 @@ func hostProc(combineWith ...string) string {
 	return filepath.Join(parts...)
 }
 
-// pathExists returns a boolean indicating if the given path exists on the file system.
+// pathExists returns a boolean indicating if the given path exists on the file system,
+// its result is cached for pathStatCacheTTL.
 func pathExists(filename string) bool {
-	if _, err := os.Stat(filename); err == nil {
-		return true
-	}
-	return false
+	return pathStats.Exists(filename)
 }
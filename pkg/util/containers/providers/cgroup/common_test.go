@@ -9,10 +9,15 @@ package cgroup
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 type tempFolder struct {
@@ -46,6 +51,86 @@ func (f *tempFolder) add(fileName string, contents string) error {
 	return err
 }
 
+func TestReadLines(t *testing.T) {
+	tempFolder, err := newTempFolder("read-lines")
+	assert.Nil(t, err)
+	defer tempFolder.removeAll()
+
+	// a file that can't be read has no lines
+	lines, err := readLines(filepath.Join(tempFolder.RootPath, "notfound"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Nil(t, lines)
+
+	tempFolder.add("empty", "")
+	lines, err = readLines(filepath.Join(tempFolder.RootPath, "empty"))
+	assert.Nil(t, err)
+	assert.Empty(t, lines)
+
+	tempFolder.add("lines", "first\nsecond\n")
+	lines, err = readLines(filepath.Join(tempFolder.RootPath, "lines"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"first", "second"}, lines)
+}
+
+// fakeFileSystem is an in-memory fileSystem holding the contents of the files, indexed by their path
+type fakeFileSystem map[string]string
+
+func (f fakeFileSystem) Open(name string) (io.ReadCloser, error) {
+	contents, ok := f[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return ioutil.NopCloser(strings.NewReader(contents)), nil
+}
+
+func (f fakeFileSystem) Stat(name string) (os.FileInfo, error) {
+	contents, ok := f[name]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return fakeFileInfo{name: filepath.Base(name), size: int64(len(contents))}, nil
+}
+
+type fakeFileInfo struct {
+	name string
+	size int64
+}
+
+func (f fakeFileInfo) Name() string       { return f.name }
+func (f fakeFileInfo) Size() int64        { return f.size }
+func (f fakeFileInfo) Mode() os.FileMode  { return 0444 }
+func (f fakeFileInfo) ModTime() time.Time { return time.Time{} }
+func (f fakeFileInfo) IsDir() bool        { return false }
+func (f fakeFileInfo) Sys() interface{}   { return nil }
+
+// useFakeFileSystem makes the provider read the files from the fake file system until the returned function is called
+func useFakeFileSystem(files fakeFileSystem) func() {
+	previous := fs
+	fs = files
+	pathStats.Purge()
+	return func() {
+		fs = previous
+		pathStats.Purge()
+	}
+}
+
+func TestFakeFileSystem(t *testing.T) {
+	defer useFakeFileSystem(fakeFileSystem{
+		hostProc("diskstats"): "   8       0 sda 1 0 2 0 0 0 0 0 0 0 0",
+	})()
+
+	assert.True(t, pathExists(hostProc("diskstats")))
+	assert.False(t, pathExists(hostProc("self", "cgroup")))
+
+	lines, err := readLines(hostProc("diskstats"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"   8       0 sda 1 0 2 0 0 0 0 0 0 0 0"}, lines)
+
+	lines, err = readLines(hostProc("self", "cgroup"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Nil(t, lines)
+}
+
 type dummyCgroupStat map[string]uint64
 
 func (c dummyCgroupStat) String() string {
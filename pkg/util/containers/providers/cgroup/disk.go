@@ -10,7 +10,6 @@ package cgroup
 import (
 	"bufio"
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
@@ -44,7 +43,7 @@ func getDiskDeviceMapping() (*diskDeviceMapping, error) {
 
 	// Cache miss, parse file
 	statfile := hostProc("diskstats")
-	f, err := os.Open(statfile)
+	f, err := fs.Open(statfile)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,34 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+// +build linux
+
+package cgroup
+
+import (
+	"io"
+	"os"
+)
+
+// fileSystem is the part of the file system the provider reads the procfs and cgroup files from.
+// The errors must be *os.PathError so that os.IsNotExist and os.IsPermission work on them.
+type fileSystem interface {
+	Open(name string) (io.ReadCloser, error)
+	Stat(name string) (os.FileInfo, error)
+}
+
+// osFileSystem is the real file system of the host
+type osFileSystem struct{}
+
+func (osFileSystem) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (osFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// fs is the file system the files are read from, tests replace it with a fake procfs
+var fs fileSystem = osFileSystem{}
@@ -0,0 +1,109 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+// +build linux
+
+package cgroup
+
+import (
+	"os"
+	"strings"
+	"sync"
+)
+
+// runtimeMarkers maps the markers found in the cgroup paths and mount points of
+// a containerized process to the name of its container runtime. The markers are
+// checked in order, the more specific ones first.
+var runtimeMarkers = []struct {
+	marker  string
+	runtime string
+}{
+	{"/docker/containers/", "docker"},
+	{"/docker/", "docker"},
+	{"/docker-", "docker"},
+	{"cri-containerd", "containerd"},
+	{"/containerd/", "containerd"},
+	{"/crio-", "crio"},
+	{"/containers/storage/", "crio"},
+	{"/kubepods", "kubernetes"},
+	{"/kubelet/pods/", "kubernetes"},
+}
+
+var (
+	inContainerOnce    sync.Once
+	inContainer        bool
+	inContainerRuntime string
+	inContainerErr     error
+)
+
+// IsRunningInContainer returns whether the current process runs inside a container,
+// and the name of the detected container runtime. The detection relies on the markers
+// found in the cgroups and mount points of the process, its result is cached as it
+// can't change during the process lifetime.
+func IsRunningInContainer() (bool, string, error) {
+	inContainerOnce.Do(func() {
+		inContainer, inContainerRuntime, inContainerErr = detectContainerRuntime()
+	})
+	return inContainer, inContainerRuntime, inContainerErr
+}
+
+// containerMountPoints are the files that container runtimes bind mount from their own storage
+var containerMountPoints = map[string]struct{}{
+	"/etc/hostname":    {},
+	"/etc/hosts":       {},
+	"/etc/resolv.conf": {},
+}
+
+// detectContainerRuntime looks for container runtime markers in /proc/self/cgroup,
+// then in /proc/self/mountinfo, as the cgroups of the process are hidden when it
+// runs in its own cgroup namespace.
+func detectContainerRuntime() (bool, string, error) {
+	cgroups, err := readLines(hostProc("self", "cgroup"))
+	if err != nil && !os.IsNotExist(err) {
+		return false, "", err
+	}
+	if runtime := findRuntimeMarker(cgroups); runtime != "" {
+		return true, runtime, nil
+	}
+
+	mounts, err := readLines(hostProc("self", "mountinfo"))
+	if err != nil && !os.IsNotExist(err) {
+		return false, "", err
+	}
+	if runtime := findRuntimeMarker(containerMountRoots(mounts)); runtime != "" {
+		return true, runtime, nil
+	}
+	return false, "", nil
+}
+
+// containerMountRoots returns the roots of the container mount points found in mountinfo lines.
+// The host mount points are ignored as they can reference the storage of container runtimes too.
+func containerMountRoots(mountinfo []string) []string {
+	var roots []string
+	for _, line := range mountinfo {
+		// 640 620 8:1 /var/lib/docker/containers/47fc31db38b4/hostname /etc/hostname rw,relatime - ext4 /dev/sda1 rw
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		if _, found := containerMountPoints[fields[4]]; found {
+			roots = append(roots, fields[3])
+		}
+	}
+	return roots
+}
+
+// findRuntimeMarker returns the name of the container runtime matching the first
+// marker found in the lines, or an empty string if there is none.
+func findRuntimeMarker(lines []string) string {
+	for _, m := range runtimeMarkers {
+		for _, line := range lines {
+			if strings.Contains(line, m.marker) {
+				return m.runtime
+			}
+		}
+	}
+	return ""
+}
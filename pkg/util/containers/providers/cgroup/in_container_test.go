@@ -0,0 +1,94 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+// +build linux
+
+package cgroup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DataDog/datadog-agent/pkg/config"
+)
+
+func TestDetectContainerRuntime(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		cgroup      string
+		mountinfo   string
+		inContainer bool
+		runtime     string
+	}{
+		{
+			name:        "host",
+			cgroup:      "12:memory:/user.slice\n1:name=systemd:/user.slice/user-1000.slice/session-2.scope",
+			mountinfo:   "25 0 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw",
+			inContainer: false,
+		},
+		{
+			name:        "docker",
+			cgroup:      "12:memory:/docker/47fc31db38b4fa0f4db44b99d0cad10e3cd4d5f142135a7721c1c95c1aadfb2e",
+			inContainer: true,
+			runtime:     "docker",
+		},
+		{
+			name:        "docker with systemd driver",
+			cgroup:      "12:memory:/system.slice/docker-47fc31db38b4fa0f4db44b99d0cad10e3cd4d5f142135a7721c1c95c1aadfb2e.scope",
+			inContainer: true,
+			runtime:     "docker",
+		},
+		{
+			name:        "containerd in kubernetes",
+			cgroup:      "12:memory:/kubepods/besteffort/pod2baa3444-4d37-11e7-bd2f-080027d2bf10/cri-containerd-47fc31db38b4fa0f4db44b99d0cad10e3cd4d5f142135a7721c1c95c1aadfb2e.scope",
+			inContainer: true,
+			runtime:     "containerd",
+		},
+		{
+			name:        "cri-o in kubernetes",
+			cgroup:      "12:memory:/kubepods.slice/kubepods-besteffort.slice/crio-47fc31db38b4fa0f4db44b99d0cad10e3cd4d5f142135a7721c1c95c1aadfb2e.scope",
+			inContainer: true,
+			runtime:     "crio",
+		},
+		{
+			name:        "kubernetes with unknown runtime",
+			cgroup:      "12:memory:/kubepods/besteffort/pod2baa3444-4d37-11e7-bd2f-080027d2bf10/47fc31db38b4fa0f4db44b99d0cad10e3cd4d5f142135a7721c1c95c1aadfb2e",
+			inContainer: true,
+			runtime:     "kubernetes",
+		},
+		{
+			name:        "host running containers",
+			cgroup:      "0::/user.slice/user-1000.slice/session-2.scope",
+			mountinfo:   "1042 25 0:52 / /var/lib/docker/overlay2/4a6b1c/merged rw,relatime shared:513 - overlay overlay rw",
+			inContainer: false,
+		},
+		{
+			name:        "cgroup namespace, detected from the mount points",
+			cgroup:      "0::/",
+			mountinfo:   "640 620 8:1 /var/lib/docker/containers/47fc31db38b4/hostname /etc/hostname rw,relatime - ext4 /dev/sda1 rw",
+			inContainer: true,
+			runtime:     "docker",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dummyProcDir, err := newTempFolder("test-detect-container-runtime")
+			assert.Nil(t, err)
+			defer dummyProcDir.removeAll() // clean up
+			config.Datadog.SetDefault("container_proc_root", dummyProcDir.RootPath)
+			defer config.Datadog.SetDefault("container_proc_root", "/proc")
+
+			assert.Nil(t, dummyProcDir.add("self/cgroup", tc.cgroup))
+			if tc.mountinfo != "" {
+				assert.Nil(t, dummyProcDir.add("self/mountinfo", tc.mountinfo))
+			}
+
+			inContainer, runtime, err := detectContainerRuntime()
+			assert.Nil(t, err)
+			assert.Equal(t, tc.inContainer, inContainer)
+			assert.Equal(t, tc.runtime, runtime)
+		})
+	}
+}
@@ -183,7 +183,7 @@ func defaultHostIPs() ([]string, error) {
 func defaultGatewayFields() ([]string, error) {
 	procRoot := config.Datadog.GetString("proc_root")
 	netRouteFile := filepath.Join(procRoot, "net", "route")
-	f, err := os.Open(netRouteFile)
+	f, err := fs.Open(netRouteFile)
 	if err != nil {
 		if os.IsNotExist(err) || os.IsPermission(err) {
 			log.Errorf("Unable to open %s: %s", netRouteFile, err)
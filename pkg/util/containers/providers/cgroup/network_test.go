@@ -182,6 +182,28 @@ func TestCollectNetworkStats(t *testing.T) {
 	}
 }
 
+func TestCollectNetworkStatsFakeProcfs(t *testing.T) {
+	defer useFakeFileSystem(fakeFileSystem{
+		hostProc("1245", "net", "dev"): detab(`
+            Inter-|   Receive                                                |  Transmit
+             face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+              eth0:    1345      10    0    0    0     0          0         0      200       2    0    0    0     0       0          0
+                lo:       0       0    0    0    0     0          0         0        0       0    0    0    0     0       0          0
+        `),
+	})()
+
+	stat, err := collectNetworkStats(1245, map[string]string{"eth0": "bridge"})
+	assert.Nil(t, err)
+	assert.Equal(t, metrics.ContainerNetStats{
+		&metrics.InterfaceNetStats{NetworkName: "bridge", BytesRcvd: 1345, PacketsRcvd: 10, BytesSent: 200, PacketsSent: 2},
+	}, stat)
+
+	// the processes without procfs entry have no network stats
+	stat, err = collectNetworkStats(42, nil)
+	assert.Nil(t, err)
+	assert.Empty(t, stat)
+}
+
 func TestDetectNetworkDestinations(t *testing.T) {
 	dummyProcDir, err := newTempFolder("test-find-docker-networks")
 	assert.Nil(t, err)
@@ -0,0 +1,108 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package filesystem
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// StatCache caches the results of os.Stat for a short time, to coalesce the stats of the same paths
+// repeated by the loops scanning many files on slow file systems. It holds at most maxEntries paths,
+// the paths stated while it is full are not cached. It is safe for concurrent use.
+type StatCache struct {
+	ttl        time.Duration
+	maxEntries int
+	stat       func(string) (os.FileInfo, error)
+
+	lock    sync.Mutex
+	entries map[string]statCacheEntry
+}
+
+type statCacheEntry struct {
+	info    os.FileInfo
+	err     error
+	expires time.Time
+}
+
+// NewStatCache returns a new StatCache keeping the results for ttl, a ttl of 0 or less disables the cache
+func NewStatCache(ttl time.Duration, maxEntries int) *StatCache {
+	return NewStatCacheWithStat(ttl, maxEntries, os.Stat)
+}
+
+// NewStatCacheWithStat returns a new StatCache caching the results of stat instead of os.Stat,
+// for the callers reading the files through another file system
+func NewStatCacheWithStat(ttl time.Duration, maxEntries int, stat func(string) (os.FileInfo, error)) *StatCache {
+	return &StatCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		stat:       stat,
+		entries:    make(map[string]statCacheEntry),
+	}
+}
+
+// Stat returns the result of os.Stat for the path, cached if it was stated less than ttl ago
+func (c *StatCache) Stat(path string) (os.FileInfo, error) {
+	if c.ttl <= 0 {
+		return c.stat(path)
+	}
+	now := time.Now()
+	c.lock.Lock()
+	entry, found := c.entries[path]
+	c.lock.Unlock()
+	if found && now.Before(entry.expires) {
+		return entry.info, entry.err
+	}
+
+	info, err := c.stat(path)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.entries) >= c.maxEntries {
+		c.removeExpired(now)
+	}
+	if _, found := c.entries[path]; found || len(c.entries) < c.maxEntries {
+		c.entries[path] = statCacheEntry{info: info, err: err, expires: now.Add(c.ttl)}
+	}
+	return info, err
+}
+
+// Exists returns true if the path exists, as FileExists does
+func (c *StatCache) Exists(path string) bool {
+	_, err := c.Stat(path)
+	return err == nil
+}
+
+// Invalidate forgets the cached result of the path, it is stated again on the next call
+func (c *StatCache) Invalidate(path string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.entries, path)
+}
+
+// Purge forgets all the cached results
+func (c *StatCache) Purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries = make(map[string]statCacheEntry)
+}
+
+// Len returns the number of cached paths, including the expired ones not removed yet
+func (c *StatCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.entries)
+}
+
+// removeExpired removes the expired entries, it must be called with the lock held
+func (c *StatCache) removeExpired(now time.Time) {
+	for path, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, path)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package filesystem
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countStats makes the cache count the stats it does
+func countStats(c *StatCache) *int64 {
+	var count int64
+	c.stat = func(path string) (os.FileInfo, error) {
+		atomic.AddInt64(&count, 1)
+		return os.Stat(path)
+	}
+	return &count
+}
+
+func TestStatCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stat-cache-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+
+	c := NewStatCache(time.Hour, 10)
+	stats := countStats(c)
+
+	// the missing files are cached too
+	assert.False(t, c.Exists(path))
+	assert.Nil(t, ioutil.WriteFile(path, []byte("hello"), 0644))
+	assert.False(t, c.Exists(path))
+	assert.Equal(t, int64(1), atomic.LoadInt64(stats))
+
+	// until they are invalidated
+	c.Invalidate(path)
+	info, err := c.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), info.Size())
+	assert.True(t, c.Exists(path))
+	assert.Equal(t, int64(2), atomic.LoadInt64(stats))
+
+	c.Purge()
+	assert.Equal(t, 0, c.Len())
+	assert.True(t, c.Exists(path))
+	assert.Equal(t, int64(3), atomic.LoadInt64(stats))
+}
+
+func TestStatCacheExpires(t *testing.T) {
+	c := NewStatCache(10*time.Millisecond, 10)
+	stats := countStats(c)
+
+	c.Exists("/does/not/exist")
+	c.Exists("/does/not/exist")
+	assert.Equal(t, int64(1), atomic.LoadInt64(stats))
+	time.Sleep(20 * time.Millisecond)
+	c.Exists("/does/not/exist")
+	assert.Equal(t, int64(2), atomic.LoadInt64(stats))
+
+	// a ttl of 0 disables the cache
+	c = NewStatCache(0, 10)
+	stats = countStats(c)
+	c.Exists("/does/not/exist")
+	c.Exists("/does/not/exist")
+	assert.Equal(t, int64(2), atomic.LoadInt64(stats))
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestStatCacheBounded(t *testing.T) {
+	c := NewStatCache(20*time.Millisecond, 2)
+	stats := countStats(c)
+
+	c.Exists("/a")
+	c.Exists("/b")
+	// the cache is full, /c is not cached
+	c.Exists("/c")
+	c.Exists("/c")
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, int64(4), atomic.LoadInt64(stats))
+
+	// the expired entries make room for the new ones
+	time.Sleep(30 * time.Millisecond)
+	c.Exists("/c")
+	c.Exists("/c")
+	assert.Equal(t, 1, c.Len())
+	assert.Equal(t, int64(5), atomic.LoadInt64(stats))
+}
+
+func TestStatCacheConcurrent(t *testing.T) {
+	c := NewStatCache(time.Hour, 100)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Exists(fmt.Sprintf("/does/not/exist/%d", j))
+				if j%10 == i {
+					c.Invalidate(fmt.Sprintf("/does/not/exist/%d", j))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.True(t, c.Len() <= 100)
+}
+
+// BenchmarkStatCacheScan simulates scans of thousands of files, each stated three times per scan like the file
+// scanner does to sort, filter and check the age of the files, the stats/op metric is the number of syscalls
+func BenchmarkStatCacheScan(b *testing.B) {
+	dir, err := ioutil.TempDir("", "stat-cache-bench-")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	paths := make([]string, 5000)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("%d.log", i))
+		if err := ioutil.WriteFile(paths[i], nil, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, bench := range []struct {
+		name string
+		ttl  time.Duration
+	}{
+		{"uncached", 0},
+		{"cached", time.Second},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			c := NewStatCache(bench.ttl, len(paths))
+			stats := countStats(c)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// every scan starts with fresh results
+				c.Purge()
+				for _, path := range paths {
+					for j := 0; j < 3; j++ {
+						c.Stat(path) //nolint:errcheck
+					}
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(stats))/float64(b.N), "stats/op")
+		})
+	}
+}
+
+func TestStatCacheWithStat(t *testing.T) {
+	var stated []string
+	c := NewStatCacheWithStat(time.Hour, 10, func(path string) (os.FileInfo, error) {
+		stated = append(stated, path)
+		return nil, os.ErrNotExist
+	})
+	assert.False(t, c.Exists("/proc/1/net/dev"))
+	assert.False(t, c.Exists("/proc/1/net/dev"))
+	assert.Equal(t, []string{"/proc/1/net/dev"}, stated)
+}